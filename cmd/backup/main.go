@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"sudo/internal/backup"
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/migrations"
+	"sudo/internal/security"
+
+	"github.com/google/uuid"
+)
+
+func usage() {
+	fmt.Println("Usage: go run cmd/backup/main.go <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("   export --out FILE [--user EMAIL] [--rekey KEY]")
+	fmt.Println("        write every board of the instance, or the boards EMAIL owns, to a ZIP archive")
+	fmt.Println("   restore --in FILE")
+	fmt.Println("        copy an archive into this instance under new IDs")
+	fmt.Println("   inspect --in FILE")
+	fmt.Println("        print an archive's manifest")
+	fmt.Println()
+	fmt.Println("Archived emails stay encrypted. Without --rekey only an instance with the same")
+	fmt.Println("ENCRYPTION_MASTER_KEY (current or in ENCRYPTION_PREVIOUS_KEYS) can restore them;")
+	fmt.Println("pass the target instance's key as --rekey to re-encrypt them for it.")
+	fmt.Println()
+	fmt.Println("Task attachments live in attachment storage and are not part of the archive.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command, args := os.Args[1], os.Args[2:]
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	out := fs.String("out", "", "archive to write (export)")
+	in := fs.String("in", "", "archive to read (restore, inspect)")
+	userEmail := fs.String("user", "", "only export the boards this user owns (export)")
+	rekey := fs.String("rekey", "", "base64 master key to re-encrypt emails under (export)")
+	rekeyVersion := fs.Int("rekey-version", 1, "ENCRYPTION_KEY_VERSION that goes with --rekey (export)")
+	fs.Usage = usage
+	fs.Parse(args)
+
+	switch command {
+	case "export":
+		if *out == "" {
+			log.Fatalf("❌ --out is required")
+		}
+		exportArchive(*out, *userEmail, *rekey, *rekeyVersion)
+	case "restore":
+		restoreArchive(readArchive(*in))
+	case "inspect":
+		printManifest(readArchive(*in).Manifest)
+	default:
+		usage()
+		os.Exit(2)
+	}
+}
+
+// connect opens the database and makes sure its schema matches this build
+func connect(ctx context.Context) (*database.DB, int) {
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	all, err := migrations.All()
+	if err != nil {
+		log.Fatalf("❌ Invalid migrations: %v", err)
+	}
+	db := database.NewDB(cfg)
+	runner := migrations.NewRunner(migrations.ReadOnly(db), all)
+	if err := runner.Check(ctx); err != nil {
+		log.Fatalf("❌ %v\n   Run `go run cmd/migrate/main.go up` first.", err)
+	}
+	return db, runner.Latest()
+}
+
+func exportArchive(path, userEmail, rekey string, rekeyVersion int) {
+	ctx := context.Background()
+	db, schemaVersion := connect(ctx)
+
+	var target *security.CryptoService
+	if rekey != "" {
+		var err error
+		if target, err = security.NewCryptoServiceWithKey(rekey, rekeyVersion); err != nil {
+			log.Fatalf("❌ Invalid --rekey: %v", err)
+		}
+	}
+
+	var ownerID *uuid.UUID
+	if userEmail != "" {
+		user, err := db.GetUserByEmail(ctx, userEmail)
+		if err != nil {
+			log.Fatalf("❌ No user with email %s: %v", userEmail, err)
+		}
+		ownerID = &user.ID
+	}
+
+	snapshot, err := db.ExportWorkspace(ctx, ownerID, target)
+	if err != nil {
+		log.Fatalf("❌ Export failed: %v", err)
+	}
+	snapshot.Manifest.CreatedAt = time.Now().UTC()
+	snapshot.Manifest.SchemaVersion = schemaVersion
+
+	if err := writeArchive(path, snapshot); err != nil {
+		log.Fatalf("❌ Failed to write archive: %v", err)
+	}
+
+	printManifest(snapshot.Manifest)
+	fmt.Printf("\nArchive written to %s\n", path)
+}
+
+func restoreArchive(snapshot *backup.Snapshot) {
+	ctx := context.Background()
+	db, schemaVersion := connect(ctx)
+	if snapshot.Manifest.SchemaVersion > schemaVersion {
+		log.Fatalf("❌ The archive was made at schema version %d; upgrade this instance to at least that version first (it is at %d)",
+			snapshot.Manifest.SchemaVersion, schemaVersion)
+	}
+
+	restored, skipped, err := db.RestoreWorkspace(ctx, snapshot)
+	for _, table := range backup.TableNames() {
+		if restored[table] > 0 || skipped[table] > 0 {
+			fmt.Printf("   %-22s %6d restored", table, restored[table])
+			if skipped[table] > 0 {
+				fmt.Printf(", %d skipped (they point at rows outside the archive)", skipped[table])
+			}
+			fmt.Println()
+		}
+	}
+	if err != nil {
+		log.Fatalf("❌ Restore stopped: %v\n   Rows listed above were restored; restore into a fresh instance to retry.", err)
+	}
+	fmt.Println()
+	fmt.Println("Restore complete.")
+}
+
+// writeArchive writes next to the destination and renames, so a failed export never
+// leaves a truncated archive behind. The file is only readable by its owner.
+func writeArchive(path string, snapshot *backup.Snapshot) error {
+	file, err := os.CreateTemp(filepath.Dir(path), ".backup-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := backup.Write(file, snapshot); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func readArchive(path string) *backup.Snapshot {
+	if path == "" {
+		log.Fatalf("❌ --in is required")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("❌ Failed to open archive: %v", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatalf("❌ Failed to open archive: %v", err)
+	}
+
+	snapshot, err := backup.Read(file, info.Size())
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+	return snapshot
+}
+
+func printManifest(m backup.Manifest) {
+	fmt.Printf("Format:         %d\n", m.Format)
+	fmt.Printf("Created:        %s\n", m.CreatedAt.Format(time.RFC3339))
+	fmt.Printf("Schema version: %d\n", m.SchemaVersion)
+	fmt.Printf("Scope:          %s\n", m.Scope)
+
+	for _, table := range backup.TableNames() {
+		fmt.Printf("   %-22s %6d\n", table, m.Counts[table])
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
 	"sudo/internal/security"
 )
 
@@ -13,6 +18,11 @@ func main() {
 		return
 	}
 
+	if len(os.Args) > 1 && os.Args[1] == "rotate" {
+		rotateKeys(os.Args[2:])
+		return
+	}
+
 	fmt.Println("SUDO Kanban - Encryption Key Generator")
 	fmt.Println("=========================================")
 	fmt.Println()
@@ -42,23 +52,116 @@ func main() {
 	fmt.Println("To test the encryption system:")
 	fmt.Printf("   export ENCRYPTION_MASTER_KEY=\"%s\"\n", masterKey)
 	fmt.Println("   go run cmd/keygen/main.go --test")
+	fmt.Println()
+	fmt.Println("To rotate an existing key, see:")
+	fmt.Println("   go run cmd/keygen/main.go rotate --help")
+}
+
+// rotateKeys re-encrypts stored emails from previous keys onto the current key
+func rotateKeys(args []string) {
+	fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "decrypt and count rows without writing changes")
+	batchSize := fs.Int("batch-size", 200, "rows re-encrypted per batch")
+	table := fs.String("table", "", "only rotate this table (users or otp_tokens)")
+	after := fs.String("after", "", "resume after this row id (printed after each batch)")
+	fs.Usage = func() {
+		fmt.Println("Usage: go run cmd/keygen/main.go rotate [flags]")
+		fmt.Println()
+		fmt.Println("Rotation steps:")
+		fmt.Println("   1. Generate a new key:   go run cmd/keygen/main.go")
+		fmt.Println("   2. Deploy with both keys so the app can read old and new data:")
+		fmt.Println("        ENCRYPTION_MASTER_KEY=<new key>")
+		fmt.Println("        ENCRYPTION_KEY_VERSION=2")
+		fmt.Println("        ENCRYPTION_PREVIOUS_KEYS=1:<old key>")
+		fmt.Println("   3. Run this command with the same environment (try --dry-run first)")
+		fmt.Println("   4. Once every table reports 0 remaining, drop ENCRYPTION_PREVIOUS_KEYS")
+		fmt.Println()
+		fmt.Println("Running it without a new key upgrades emails stored in the old deterministic")
+		fmt.Println("format to randomized encryption and fills in the email_hash blind index.")
+		fmt.Println("Until every user has one, sign-ins for unknown emails also try the slower")
+		fmt.Println("legacy lookup; the server stops doing so within a minute of the last upgrade.")
+		fmt.Println()
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	tables := database.EmailKeyRotationTables
+	if *table != "" {
+		tables = []string{*table}
+	} else if *after != "" {
+		log.Fatalf("❌ --after requires --table")
+	}
+
+	db := database.NewDB(cfg)
+	ctx := context.Background()
+
+	mode := "Rotating"
+	if *dryRun {
+		mode = "Dry run: checking"
+	}
+	fmt.Printf("%s emails onto key version %d\n", mode, db.CurrentKeyVersion())
+	fmt.Println()
+
+	failedTotal := 0
+	for _, t := range tables {
+		cursor := ""
+		if t == *table {
+			cursor = *after
+		}
+
+		rotated, failed := 0, 0
+		for {
+			batch, err := db.RotateEmailBatch(ctx, t, cursor, *batchSize, *dryRun)
+			if err != nil {
+				log.Fatalf("❌ Rotation of %s stopped: %v\n   Resume with: rotate --table %s --after %s", t, err, t, cursor)
+			}
+
+			rotated += batch.Rotated
+			failed += batch.Failed
+			if batch.LastID == "" {
+				break
+			}
+
+			cursor = batch.LastID
+			fmt.Printf("   %s: %d re-encrypted, %d failed (resume with --table %s --after %s)\n", t, rotated, failed, t, cursor)
+		}
+
+		fmt.Printf("%s: %d re-encrypted, %d failed\n", t, rotated, failed)
+		failedTotal += failed
+	}
+
+	fmt.Println()
+	if failedTotal > 0 {
+		fmt.Printf("%d rows could not be re-encrypted; check the log and keep ENCRYPTION_PREVIOUS_KEYS set.\n", failedTotal)
+		os.Exit(1)
+	}
+	if *dryRun {
+		fmt.Println("Dry run complete. No rows were changed.")
+		return
+	}
+	fmt.Println("Rotation complete. Run again to confirm nothing remains, then remove ENCRYPTION_PREVIOUS_KEYS.")
 }
 
 func testEncryption() {
 	fmt.Println("Testing encryption functionality...")
 	fmt.Println()
 
-	// Check if master key is set, if not use a test key
-	if os.Getenv("ENCRYPTION_MASTER_KEY") == "" {
-		// Use a test key for demonstration
-		testKey := "PuPdaOvxf9KPbAXwL+ZJ9qf3bW+igdh7SwAQqIci4yQ="
-		os.Setenv("ENCRYPTION_MASTER_KEY", testKey)
-		fmt.Printf("Using test key: %s...\n", testKey[:20])
+	// Use the configured keys, or a test key when the configuration is incomplete
+	encryption := config.Encryption{MasterKey: "PuPdaOvxf9KPbAXwL+ZJ9qf3bW+igdh7SwAQqIci4yQ=", KeyVersion: 1}
+	if cfg, err := config.Load(""); err == nil {
+		encryption = cfg.Encryption
+	} else {
+		fmt.Printf("Using test key: %s...\n", encryption.MasterKey[:20])
 		fmt.Println()
 	}
 
 	// Create crypto service
-	crypto, err := security.NewCryptoService()
+	crypto, err := security.NewCryptoService(encryption)
 	if err != nil {
 		fmt.Printf("Failed to create crypto service: %v\n", err)
 		return
@@ -1,25 +1,41 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"sudo/internal/attachments"
+	"sudo/internal/buildinfo"
+	"sudo/internal/config"
 	"sudo/internal/database"
+	"sudo/internal/dataexport"
 	"sudo/internal/email"
 	"sudo/internal/handlers"
+	"sudo/internal/inbound"
+	"sudo/internal/logging"
 	"sudo/internal/middleware"
+	"sudo/internal/migrations"
+	"sudo/internal/oidc"
 	"sudo/internal/realtime"
+	"sudo/internal/recurrence"
+	"sudo/internal/storage"
+	"sudo/internal/tracing"
 	"sudo/templates/pages"
 
 	"github.com/a-h/templ"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
-	"github.com/joho/godotenv"
 )
 
 // AuthMiddleware checks if user is authenticated
@@ -45,11 +61,36 @@ func AuthMiddleware() gin.HandlerFunc {
 	})
 }
 
+// checkSchema refuses to start against a database that is missing migrations
+func checkSchema(db *database.DB) {
+	all, err := migrations.All()
+	if err != nil {
+		log.Fatalf("Invalid migrations: %v", err)
+	}
+	runner := migrations.NewRunner(migrations.ReadOnly(db), all)
+	if err := runner.Check(context.Background()); err != nil {
+		log.Fatalf("Refusing to start: %v. Run `go run cmd/migrate/main.go up` (or `./migrate up` in the container).", err)
+	}
+	log.Printf("Database schema is up to date (migration %04d)", runner.Latest())
+}
+
 func main() {
-	// Load environment variables (silent - production uses system env vars)
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: failed to load .env file: %v", err)
+	configFile := flag.String("config", "", "KEY=VALUE file with settings (default: $CONFIG_FILE); the environment takes precedence")
+	printConfig := flag.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	flag.Parse()
+
+	// Settings come from the environment, the config file and .env; all problems are listed at once
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
+	logging.Configure(cfg)
 
 	// License Notice
 	log.Println("╔══════════════════════════════════════════════════════════════════╗")
@@ -63,42 +104,116 @@ func main() {
 	log.Println()
 
 	// Initialize services
-	db := database.NewDB()
-	emailService := email.NewEmailService()
+	db := database.NewDB(cfg)
+	checkSchema(db)
+
+	// Background workers run until shutdown cancels their context
+	workers := &backgroundWorkers{}
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+
+	// Cache invalidations from other instances are applied in the background
+	workers.Go(workerCtx, db.RunCacheSync)
+
+	// Spans are exported in the background; the last batch is sent when workers stop
+	tracer, err := tracing.Configure(cfg.Tracing, cfg.Env)
+	if err != nil {
+		log.Fatalf("Invalid tracing configuration: %v", err)
+	}
+	if tracer != nil {
+		workers.Go(workerCtx, tracer.Run)
+	}
+
+	// Emails are queued and delivered in the background with retries
+	emailService, err := email.NewEmailService(db, cfg.Email)
+	if err != nil {
+		log.Fatalf("Invalid email configuration: %v", err)
+	}
+	workers.Go(workerCtx, emailService.Run)
+
+	// Single sign-on providers are optional; OTP login keeps working without them
+	oidcProviders, err := oidc.NewManager(cfg.OIDC)
+	if err != nil {
+		log.Fatalf("Invalid OIDC configuration: %v", err)
+	}
+
+	// Attachments and avatars live in blob storage (local disk or an S3-compatible bucket)
+	blobStore, err := storage.NewStore(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Invalid storage configuration: %v", err)
+	}
+	attachmentService := attachments.NewService(db, blobStore, cfg.Attachments)
+	go func() {
+		// Move files saved inline before blob storage existed; a no-op once done
+		report, err := attachmentService.MigrateInline(context.Background())
+		if err != nil {
+			log.Printf("Blob migration failed: %v", err)
+			return
+		}
+		if report.Attachments+report.Avatars+report.Failed > 0 {
+			log.Printf("Blob migration: moved %d attachments and %d avatars to %s storage (%d failed)",
+				report.Attachments, report.Avatars, blobStore.Name(), report.Failed)
+		}
+	}()
 
 	// Add real-time service initialization
-	realtimeService := realtime.NewRealtimeService(db)
+	// WebSocket upgrades are only accepted from these origins (same host when unset)
+	realtimeService := realtime.NewRealtimeService(db, cfg.AllowedOrigins)
 	go realtimeService.Run() // Start the real-time hub
 
+	// Recurring tasks get their next instance on completion or when it comes due
+	recurrenceService := recurrence.NewService(db, realtimeService)
+	workers.Go(workerCtx, recurrenceService.Run)
+
+	// "Download my data" archives are built in the background and kept in blob storage
+	exportService := dataexport.NewService(db, blobStore, emailService)
+	workers.Go(workerCtx, exportService.Run)
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(db, emailService)
-	boardHandler := handlers.NewBoardHandler(db, realtimeService)       // Pass realtime service
-	taskHandler := handlers.NewTaskHandler(db, realtimeService)         // Pass realtime service
-	settingsHandler := handlers.NewSettingsHandler(db, realtimeService) // Pass realtime service
+	authHandler := handlers.NewAuthHandler(db, emailService, cfg)
+	oidcHandler := handlers.NewOIDCHandler(db, oidcProviders, cfg)
+	boardHandler := handlers.NewBoardHandler(db, realtimeService, emailService, attachmentService)
+	taskHandler := handlers.NewTaskHandler(db, realtimeService, attachmentService, recurrenceService) // Pass realtime service
+	settingsHandler := handlers.NewSettingsHandler(db, realtimeService, attachmentService, exportService)
+	attachmentHandler := handlers.NewAttachmentHandler(db, attachmentService, realtimeService)
+	adminHandler := handlers.NewAdminHandler(db, emailService, cfg)
+	healthHandler := handlers.NewHealthHandler(db, realtimeService, emailService, cfg)
+	timeHandler := handlers.NewTimeHandler(db, realtimeService)
+	analyticsHandler := handlers.NewAnalyticsHandler(db)
+	sprintHandler := handlers.NewSprintHandler(db, realtimeService)
+
+	// Inbound email turns messages sent to board addresses into tasks and comments
+	inboundProcessor := inbound.NewProcessor(db, realtimeService, emailService, attachmentService, cfg.Inbound)
+	inboundHandler := handlers.NewInboundHandler(db, inboundProcessor, cfg)
+	if cfg.Inbound.SMTPAddr != "" && inboundProcessor.Enabled() {
+		smtpServer := &inbound.SMTPServer{
+			Addr:        cfg.Inbound.SMTPAddr,
+			Processor:   inboundProcessor,
+			AllowedNets: cfg.Inbound.SMTPAllowedNets,
+		}
+		workers.Go(workerCtx, func(ctx context.Context) {
+			if err := smtpServer.ListenAndServe(ctx); err != nil {
+				log.Printf("Inbound SMTP stopped: %v", err)
+			}
+		})
+	}
 
 	// Setup Gin
-	if os.Getenv("APP_ENV") == "production" {
+	if cfg.Production() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 	r := gin.Default()
+	r.Use(middleware.TracingMiddleware(cfg.Tracing.ServiceName))
 
 	// Setup sessions with enhanced security
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		if os.Getenv("APP_ENV") == "production" {
-			log.Fatal("JWT_SECRET must be set in production!")
-		}
-		jwtSecret = "your-secret-key-change-in-production"
-		log.Println("Warning: Using default JWT secret. Set JWT_SECRET in production!")
-	}
-	store := cookie.NewStore([]byte(jwtSecret))
+	store := cookie.NewStore([]byte(cfg.SessionSecret))
 
 	// Configure secure session options
 	store.Options(sessions.Options{
 		Path:     "/",
 		MaxAge:   86400, // 24 hours
 		HttpOnly: true,
-		Secure:   os.Getenv("APP_ENV") == "production", // HTTPS only in production
+		Secure:   cfg.Production(), // HTTPS only in production
 		SameSite: http.SameSiteLaxMode,
 	})
 
@@ -110,9 +225,12 @@ func main() {
 
 	// Apply rate limiting to auth endpoints
 	authRateLimit := middleware.RateLimitMiddleware(5, time.Minute) // 5 requests per minute
+	// Single sign-on gets its own budget: teams often reach us from one office IP and every
+	// login is two requests (redirect and callback)
+	oidcRateLimit := middleware.RateLimitMiddleware(60, time.Minute)
 
 	// Serve static files with cache control headers for development
-	if os.Getenv("GIN_MODE") != "release" {
+	if cfg.GinMode != "release" {
 		r.Use(func(c *gin.Context) {
 			// Add no-cache headers for development to ensure fresh assets
 			if strings.HasPrefix(c.Request.URL.Path, "/static/") {
@@ -138,14 +256,22 @@ func main() {
 				return
 			}
 
-			component := pages.Login()
+			component := pages.Login(oidcProviders.Providers(), "")
 			handler := templ.Handler(component)
 			handler.ServeHTTP(c.Writer, c.Request)
 		})
 
 		public.POST("/auth/send-otp", authRateLimit, authHandler.SendOTP)
 		public.POST("/auth/verify-otp", authRateLimit, authHandler.VerifyOTP)
-		public.POST("/auth/logout", authHandler.Logout)
+		// Logout needs no session but must not be triggered by other sites
+		public.POST("/auth/logout", middleware.CSRFMiddleware(), authHandler.Logout)
+
+		// OpenID Connect single sign-on
+		public.GET("/auth/oidc/:provider/login", oidcRateLimit, oidcHandler.Login)
+		public.GET("/auth/oidc/:provider/callback", oidcRateLimit, oidcHandler.Callback)
+
+		// Inbound email webhook (authenticated with INBOUND_EMAIL_SECRET)
+		public.POST("/inbound/email", middleware.RateLimitMiddleware(60, time.Minute), inboundHandler.ReceiveEmail)
 	}
 
 	// Add request logging middleware
@@ -163,6 +289,7 @@ func main() {
 	// Protected routes (auth required)
 	protected := r.Group("/")
 	protected.Use(AuthMiddleware())
+	protected.Use(middleware.CSRFMiddleware())
 	{
 		// Dashboard
 		protected.GET("/dashboard", boardHandler.Dashboard)
@@ -196,6 +323,37 @@ func main() {
 		protected.POST("/api/tasks/:id/assignee-completion", taskHandler.ToggleAssigneeCompletion)
 		protected.GET("/api/tasks/:id/card", taskHandler.GetTaskCard)
 
+		// Attachment routes
+		protected.POST("/api/tasks/:id/attachments", attachmentHandler.UploadAttachment)
+		protected.GET("/api/tasks/:id/attachments/:attachmentId", attachmentHandler.DownloadAttachment)
+		protected.DELETE("/api/tasks/:id/attachments/:attachmentId", attachmentHandler.DeleteAttachment)
+
+		// Task dependency routes
+		protected.GET("/api/tasks/:id/dependencies", taskHandler.GetTaskDependencies)
+		protected.POST("/api/tasks/:id/dependencies", taskHandler.AddTaskDependency)
+		protected.DELETE("/api/tasks/:id/dependencies/:dependencyId", taskHandler.RemoveTaskDependency)
+
+		// Checklist routes
+		protected.POST("/api/tasks/:id/checklist", taskHandler.AddChecklistItem)
+		protected.POST("/api/tasks/:id/checklist/reorder", taskHandler.ReorderChecklist)
+		protected.PUT("/api/tasks/:id/checklist/:itemId", taskHandler.UpdateChecklistItem)
+		protected.DELETE("/api/tasks/:id/checklist/:itemId", taskHandler.DeleteChecklistItem)
+
+		// Time tracking routes
+		protected.GET("/api/timer", timeHandler.GetRunningTimer)
+		protected.POST("/api/tasks/:id/timer/start", timeHandler.StartTimer)
+		protected.POST("/api/tasks/:id/timer/stop", timeHandler.StopTimer)
+		protected.GET("/api/tasks/:id/time-entries", timeHandler.GetTimeEntries)
+		protected.POST("/api/tasks/:id/time-entries", timeHandler.AddTimeEntry)
+		protected.DELETE("/api/tasks/:id/time-entries/:entryId", timeHandler.DeleteTimeEntry)
+		protected.GET("/api/boards/:id/timesheet", timeHandler.BoardTimesheet)
+		protected.GET("/api/timesheet", timeHandler.UserTimesheet)
+
+		// Recurring task routes
+		protected.POST("/api/tasks/:id/recurrence", taskHandler.SetTaskRecurrence)
+		protected.POST("/api/tasks/:id/recurrence/skip", taskHandler.SkipTaskRecurrence)
+		protected.DELETE("/api/tasks/:id/recurrence", taskHandler.StopTaskRecurrence)
+
 		// Additional API endpoints for HTMX
 		protected.GET("/api/boards/:id/tasks", func(c *gin.Context) {
 			// Get all tasks for a board (for filtering/searching)
@@ -231,6 +389,23 @@ func main() {
 			boardHandler.GetBoardMembers(c)
 		})
 
+		protected.GET("/api/boards/:id/inbound-address", inboundHandler.BoardAddress)
+		protected.GET("/api/boards/:id/custom-fields", boardHandler.GetCustomFields)
+		protected.PUT("/api/boards/:id/custom-fields", boardHandler.UpdateCustomFields)
+		protected.GET("/api/boards/:id/export", boardHandler.ExportBoard)
+		protected.GET("/boards/:id/analytics", analyticsHandler.AnalyticsPage)
+		protected.GET("/api/boards/:id/analytics", analyticsHandler.GetBoardAnalytics)
+
+		// Sprint routes
+		protected.GET("/boards/:id/sprints", sprintHandler.SprintsPage)
+		protected.GET("/api/boards/:id/sprints", sprintHandler.ListSprints)
+		protected.POST("/api/boards/:id/sprints", sprintHandler.CreateSprint)
+		protected.PUT("/api/sprints/:id", sprintHandler.UpdateSprint)
+		protected.DELETE("/api/sprints/:id", sprintHandler.DeleteSprint)
+		protected.POST("/api/sprints/:id/start", sprintHandler.StartSprint)
+		protected.POST("/api/sprints/:id/close", sprintHandler.CloseSprint)
+		protected.GET("/api/sprints/:id/burndown", sprintHandler.GetBurndown)
+		protected.POST("/api/tasks/:id/sprint", sprintHandler.SetTaskSprint)
 		protected.GET("/api/dashboard/collaborators-count", func(c *gin.Context) {
 			// Get unique collaborators count for dashboard stats
 			boardHandler.GetCollaboratorsCount(c)
@@ -246,31 +421,98 @@ func main() {
 		protected.GET("/settings", settingsHandler.SettingsPage)
 		protected.POST("/settings/profile", settingsHandler.UpdateProfile)
 		protected.POST("/settings/upload-avatar", settingsHandler.UploadAvatar)
+		protected.GET("/avatars/:userId/:name", attachmentHandler.Avatar)
 		protected.POST("/settings/complete-onboarding", settingsHandler.CompleteOnboarding)
 		protected.GET("/settings/contacts", settingsHandler.GetContacts)
 		protected.GET("/settings/contacts/:contactId/boards", settingsHandler.GetContactBoards)
 		protected.POST("/settings/contacts/remove-from-board", settingsHandler.RemoveContactFromBoard)
 		protected.POST("/settings/contacts/remove", settingsHandler.RemoveContactCompletely)
 		protected.POST("/settings/delete-account", settingsHandler.DeleteAccount)
+		protected.POST("/settings/data-export", settingsHandler.RequestDataExport)
+		protected.GET("/settings/data-export/:exportId", settingsHandler.DownloadDataExport)
+
+		// Admin routes (restricted to ADMIN_EMAILS)
+		protected.GET("/api/admin/emails/dead", adminHandler.DeadLetters)
+		protected.POST("/api/admin/emails/:id/retry", adminHandler.RetryDeadLetter)
+		protected.DELETE("/api/admin/emails/:id", adminHandler.DiscardDeadLetter)
 	}
 
-	// Health check endpoint
+	// Health checks: /livez for liveness, /readyz checks dependencies and answers 503 when degraded
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
 	r.GET("/health", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"status":  "ok",
-			"version": "1.0.0",
+			"version": buildinfo.Version,
 		})
 	})
 
-	// Get port from environment
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	server := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
 
-	log.Printf("Server starting on port %s", port)
+	go func() {
+		log.Printf("Server %s starting on port %s", buildinfo.Version, cfg.Port)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// Wait for SIGINT (Ctrl+C) or SIGTERM (docker stop, deploys); a second signal exits immediately
+	signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	<-signalCtx.Done()
+	stopSignals()
+
+	shutdown(server, realtimeService, stopWorkers, workers, cfg.ShutdownTimeout)
+}
+
+// backgroundWorkers tracks the goroutines that have to stop before the process exits
+type backgroundWorkers struct {
+	wg sync.WaitGroup
+}
+
+// Go runs fn in a goroutine; fn must return once ctx is cancelled
+func (w *backgroundWorkers) Go(ctx context.Context, fn func(context.Context)) {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		fn(ctx)
+	}()
+}
+
+// shutdown stops accepting connections, lets in-flight requests finish, sends WebSocket
+// clients a reconnect notice and stops the background workers, all within SHUTDOWN_TIMEOUT
+func shutdown(server *http.Server, realtimeService *realtime.RealtimeService, stopWorkers context.CancelFunc, workers *backgroundWorkers, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	log.Printf("Shutting down (waiting up to %s)...", timeout)
+
+	// Shutdown closes the listener right away and then waits for in-flight requests.
+	// WebSocket connections are hijacked, so the realtime service closes them itself.
+	httpDone := make(chan error, 1)
+	go func() {
+		httpDone <- server.Shutdown(ctx)
+	}()
+	if err := realtimeService.Shutdown(ctx); err != nil {
+		log.Printf("WebSocket connections did not close in time: %v", err)
+	}
+	if err := <-httpDone; err != nil {
+		log.Printf("In-flight requests did not finish in time: %v", err)
+	}
 
-	if err := r.Run(":" + port); err != nil {
-		log.Fatal("Failed to start server:", err)
+	// Workers go last so requests that were still running could queue emails and exports
+	stopWorkers()
+	stopped := make(chan struct{})
+	go func() {
+		workers.wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		log.Printf("Server stopped")
+	case <-ctx.Done():
+		log.Printf("Background workers did not stop in time")
 	}
 }
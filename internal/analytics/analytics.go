@@ -0,0 +1,230 @@
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// maxDays bounds the cumulative flow diagram, e.g. a year of days
+const maxDays = 400
+
+// Column is a board column in board order. Tasks in a Done column count as finished.
+type Column struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Done bool   `json:"done"`
+}
+
+// Transition is a task entering a column. A task's first transition is its creation.
+type Transition struct {
+	At     time.Time
+	Column string
+}
+
+// Task is a task with its column history, oldest transition first
+type Task struct {
+	ID          string
+	Title       string
+	Transitions []Transition
+}
+
+// Percentiles summarizes durations in days
+type Percentiles struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50"`
+	P85   float64 `json:"p85"`
+	P95   float64 `json:"p95"`
+}
+
+// FlowDay counts the tasks in each column at the end of a day, in column order
+type FlowDay struct {
+	Date   time.Time `json:"date"`
+	Counts []int     `json:"counts"`
+}
+
+// WeekCount is the number of tasks finished in the week starting on Week (a Monday)
+type WeekCount struct {
+	Week      time.Time `json:"week"`
+	Completed int       `json:"completed"`
+}
+
+// AgingTask is an unfinished task with the days since work on it started and the days
+// it has spent in its current column
+type AgingTask struct {
+	ID           string  `json:"id"`
+	Title        string  `json:"title"`
+	AgeDays      float64 `json:"age_days"`
+	InColumnDays float64 `json:"in_column_days"`
+}
+
+// ColumnAging lists a column's unfinished tasks, oldest first
+type ColumnAging struct {
+	Column Column      `json:"column"`
+	Tasks  []AgingTask `json:"tasks"`
+}
+
+// Report holds the flow metrics of a board for the days [From, To)
+type Report struct {
+	From       time.Time     `json:"from"`
+	To         time.Time     `json:"to"`
+	Columns    []Column      `json:"columns"`
+	Flow       []FlowDay     `json:"cumulative_flow"`
+	LeadTime   Percentiles   `json:"lead_time"`
+	CycleTime  Percentiles   `json:"cycle_time"`
+	Throughput []WeekCount   `json:"throughput"`
+	Aging      []ColumnAging `json:"aging_wip"`
+}
+
+// Build computes the report. from and to must be midnights in the report's time zone.
+// Lead time runs from creation to completion, cycle time from the task first leaving the
+// column it was created in to completion; both count tasks completed within the range.
+// Aging WIP is the state at now, regardless of the range.
+func Build(columns []Column, tasks []Task, from, to, now time.Time) (*Report, error) {
+	if !from.Before(to) {
+		return nil, fmt.Errorf("empty date range")
+	}
+
+	report := &Report{From: from, To: to, Columns: columns}
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column.ID] = i
+	}
+	isDone := func(columnID string) bool {
+		i, ok := index[columnID]
+		return ok && columns[i].Done
+	}
+
+	for day := from; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if len(report.Flow) == maxDays {
+			return nil, fmt.Errorf("report would cover more than %d days", maxDays)
+		}
+		counts := make([]int, len(columns))
+		end := day.AddDate(0, 0, 1)
+		for _, task := range tasks {
+			if i, ok := index[columnAt(task, end)]; ok {
+				counts[i]++
+			}
+		}
+		report.Flow = append(report.Flow, FlowDay{Date: day, Counts: counts})
+	}
+
+	for week := weekStart(from); week.Before(to); week = week.AddDate(0, 0, 7) {
+		report.Throughput = append(report.Throughput, WeekCount{Week: week})
+	}
+
+	var leadTimes, cycleTimes []time.Duration
+	for _, task := range tasks {
+		completedAt, ok := Completion(task, isDone)
+		if !ok || completedAt.Before(from) || !completedAt.Before(to) {
+			continue
+		}
+		leadTimes = append(leadTimes, completedAt.Sub(task.Transitions[0].At))
+		if startedAt, ok := workStart(task); ok && !startedAt.After(completedAt) {
+			cycleTimes = append(cycleTimes, completedAt.Sub(startedAt))
+		}
+		for i := range report.Throughput {
+			if !completedAt.Before(report.Throughput[i].Week) && completedAt.Before(report.Throughput[i].Week.AddDate(0, 0, 7)) {
+				report.Throughput[i].Completed++
+			}
+		}
+	}
+	report.LeadTime = percentiles(leadTimes)
+	report.CycleTime = percentiles(cycleTimes)
+
+	report.Aging = make([]ColumnAging, 0, len(columns))
+	for _, column := range columns {
+		if !column.Done {
+			report.Aging = append(report.Aging, ColumnAging{Column: column, Tasks: []AgingTask{}})
+		}
+	}
+	for _, task := range tasks {
+		if len(task.Transitions) == 0 {
+			continue
+		}
+		current := task.Transitions[len(task.Transitions)-1]
+		if _, ok := index[current.Column]; !ok || isDone(current.Column) {
+			continue
+		}
+		startedAt, ok := workStart(task)
+		if !ok {
+			startedAt = task.Transitions[0].At
+		}
+		for i := range report.Aging {
+			if report.Aging[i].Column.ID == current.Column {
+				report.Aging[i].Tasks = append(report.Aging[i].Tasks, AgingTask{
+					ID:           task.ID,
+					Title:        task.Title,
+					AgeDays:      days(now.Sub(startedAt)),
+					InColumnDays: days(now.Sub(current.At)),
+				})
+			}
+		}
+	}
+	for _, aging := range report.Aging {
+		sort.SliceStable(aging.Tasks, func(i, j int) bool { return aging.Tasks[i].AgeDays > aging.Tasks[j].AgeDays })
+	}
+
+	return report, nil
+}
+
+// columnAt returns the column the task was in just before t, or "" if it did not exist yet
+func columnAt(task Task, t time.Time) string {
+	column := ""
+	for _, transition := range task.Transitions {
+		if !transition.At.Before(t) {
+			break
+		}
+		column = transition.Column
+	}
+	return column
+}
+
+// Completion returns when the task entered the run of done columns it is still in
+func Completion(task Task, isDone func(string) bool) (time.Time, bool) {
+	var completedAt time.Time
+	for i := len(task.Transitions) - 1; i >= 0 && isDone(task.Transitions[i].Column); i-- {
+		completedAt = task.Transitions[i].At
+	}
+	return completedAt, !completedAt.IsZero()
+}
+
+// workStart returns when the task first left the column it was created in
+func workStart(task Task) (time.Time, bool) {
+	for _, transition := range task.Transitions {
+		if transition.Column != task.Transitions[0].Column {
+			return transition.At, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// weekStart returns the Monday starting t's week, in t's location
+func weekStart(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// percentiles uses the nearest-rank method
+func percentiles(durations []time.Duration) Percentiles {
+	result := Percentiles{Count: len(durations)}
+	if len(durations) == 0 {
+		return result
+	}
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+	rank := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(durations)))) - 1
+		if i < 0 {
+			i = 0
+		}
+		return days(durations[i])
+	}
+	result.P50, result.P85, result.P95 = rank(0.50), rank(0.85), rank(0.95)
+	return result
+}
+
+// days converts d to days, rounded to one decimal
+func days(d time.Duration) float64 {
+	return math.Round(d.Hours()/24*10) / 10
+}
@@ -0,0 +1,76 @@
+package analytics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuild(t *testing.T) {
+	columns := []Column{{ID: "todo", Name: "To Do"}, {ID: "doing", Name: "Doing"}, {ID: "done", Name: "Done", Done: true}}
+	at := func(day, hour int) time.Time { return time.Date(2025, 3, day, hour, 0, 0, 0, time.UTC) }
+
+	tasks := []Task{
+		// Created before the range, started on the 3rd and finished on the 5th
+		{ID: "a", Title: "A", Transitions: []Transition{{at(1, 9), "todo"}, {at(3, 9), "doing"}, {at(5, 9), "done"}}},
+		// Finished on the 4th, reopened and finished again on the 11th
+		{ID: "b", Title: "B", Transitions: []Transition{{at(3, 9), "todo"}, {at(3, 12), "doing"}, {at(4, 12), "done"}, {at(6, 9), "doing"}, {at(11, 9), "done"}}},
+		// Still in progress
+		{ID: "c", Title: "C", Transitions: []Transition{{at(2, 9), "todo"}, {at(4, 9), "doing"}}},
+		// Not started
+		{ID: "d", Title: "D", Transitions: []Transition{{at(6, 9), "todo"}}},
+	}
+
+	from, to := at(3, 0), at(13, 0)
+	report, err := Build(columns, tasks, from, to, at(12, 9))
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if len(report.Flow) != 10 {
+		t.Fatalf("got %d flow days, want 10", len(report.Flow))
+	}
+	wantFlow := map[int][]int{
+		0: {1, 2, 0}, // the 3rd: A and B moved to doing, C waiting
+		1: {0, 2, 1}, // the 4th: B done, C started
+		5: {1, 2, 1}, // the 8th: B reopened, D created
+		9: {1, 1, 2},
+	}
+	for i, want := range wantFlow {
+		if !reflect.DeepEqual(report.Flow[i].Counts, want) {
+			t.Errorf("Flow[%d] = %v, want %v", i, report.Flow[i].Counts, want)
+		}
+	}
+
+	// A: lead 4 days, cycle 2 days; B: lead 8 days, cycle 7.9 days
+	if report.LeadTime != (Percentiles{Count: 2, P50: 4, P85: 8, P95: 8}) {
+		t.Errorf("LeadTime = %+v", report.LeadTime)
+	}
+	if report.CycleTime != (Percentiles{Count: 2, P50: 2, P85: 7.9, P95: 7.9}) {
+		t.Errorf("CycleTime = %+v", report.CycleTime)
+	}
+
+	wantThroughput := []WeekCount{{Week: at(3, 0), Completed: 1}, {Week: at(10, 0), Completed: 1}}
+	if !reflect.DeepEqual(report.Throughput, wantThroughput) {
+		t.Errorf("Throughput = %+v", report.Throughput)
+	}
+
+	if len(report.Aging) != 2 {
+		t.Fatalf("got aging for %d columns, want 2", len(report.Aging))
+	}
+	wantTodo := []AgingTask{{ID: "d", Title: "D", AgeDays: 6, InColumnDays: 6}}
+	wantDoing := []AgingTask{{ID: "c", Title: "C", AgeDays: 8, InColumnDays: 8}}
+	if !reflect.DeepEqual(report.Aging[0].Tasks, wantTodo) || !reflect.DeepEqual(report.Aging[1].Tasks, wantDoing) {
+		t.Errorf("Aging = %+v", report.Aging)
+	}
+}
+
+func TestBuildRange(t *testing.T) {
+	from := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := Build(nil, nil, from, from, from); err == nil {
+		t.Error("Build should refuse an empty range")
+	}
+	if _, err := Build(nil, nil, from, from.AddDate(2, 0, 0), from); err == nil {
+		t.Error("Build should refuse oversized ranges")
+	}
+}
@@ -0,0 +1,121 @@
+package attachments
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strings"
+
+	"sudo/internal/models"
+	"sudo/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const migrationBatchSize = 100
+
+// MigrationReport counts what MigrateInline moved into blob storage
+type MigrationReport struct {
+	Attachments int
+	Avatars     int
+	Failed      int
+}
+
+// MigrateInline moves attachments and avatars that are still stored inline as base64
+// (in tasks.attachments and users.avatar_url) into blob storage. It is safe to run
+// repeatedly; rows that were already moved are left alone.
+func (s *Service) MigrateInline(ctx context.Context) (*MigrationReport, error) {
+	report := &MigrationReport{}
+
+	after := uuid.Nil
+	for {
+		tasks, err := s.db.ListTasksWithAttachments(ctx, after, migrationBatchSize)
+		if err != nil {
+			return report, err
+		}
+		for i := range tasks {
+			after = tasks[i].ID
+			s.migrateTask(ctx, &tasks[i], report)
+		}
+		if len(tasks) < migrationBatchSize {
+			break
+		}
+	}
+
+	users, err := s.db.ListUsersWithInlineAvatars(ctx)
+	if err != nil {
+		return report, err
+	}
+	for _, user := range users {
+		data, err := DecodeDataURL(user.AvatarURL)
+		if err == nil {
+			_, err = s.SetAvatar(ctx, user.ID, data)
+		}
+		if err != nil {
+			log.Printf("Blob migration: failed to move avatar of user %s: %v", user.ID.String(), err)
+			report.Failed++
+			continue
+		}
+		report.Avatars++
+	}
+
+	return report, nil
+}
+
+func (s *Service) migrateTask(ctx context.Context, task *models.Task, report *MigrationReport) {
+	attachments := task.GetAttachments()
+
+	for i := range attachments {
+		attachment := &attachments[i]
+		if attachment.Key != "" || attachment.Data == "" {
+			continue
+		}
+
+		data, err := base64.StdEncoding.DecodeString(attachment.Data)
+		if err != nil {
+			log.Printf("Blob migration: attachment %s on task %s is not valid base64: %v", attachment.ID, task.ID.String(), err)
+			report.Failed++
+			continue
+		}
+
+		attachment.Key = fmt.Sprintf("tasks/%s/%s", task.ID.String(), attachment.ID)
+		if attachment.ContentType == "" {
+			attachment.ContentType = storage.SniffContentType(data)
+		}
+		if err := s.store.Put(ctx, attachment.Key, data, attachment.ContentType); err != nil {
+			log.Printf("Blob migration: failed to store attachment %s: %v", attachment.ID, err)
+			attachment.Key = ""
+			report.Failed++
+			continue
+		}
+		if storage.CanThumbnail(attachment.ContentType) {
+			if thumbnail, contentType, err := storage.Thumbnail(data, ThumbnailSize); err == nil {
+				if err := s.store.Put(ctx, attachment.Key+"_thumb", thumbnail, contentType); err == nil {
+					attachment.ThumbnailKey = attachment.Key + "_thumb"
+				}
+			}
+		}
+
+		attachment.Size = int64(len(data))
+		attachment.Data = ""
+
+		// Entries are replaced one at a time so uploads made meanwhile are kept
+		if err := s.db.ReplaceTaskAttachment(ctx, task.ID, *attachment); err != nil {
+			log.Printf("Blob migration: failed to update attachment %s on task %s: %v", attachment.ID, task.ID.String(), err)
+			s.deleteBlobs(ctx, *attachment)
+			report.Failed++
+			continue
+		}
+		report.Attachments++
+	}
+}
+
+// DecodeDataURL decodes a base64 "data:<type>;base64,<data>" URL, as sent by the avatar form
+func DecodeDataURL(dataURL string) ([]byte, error) {
+	header, encoded, ok := strings.Cut(dataURL, ",")
+	if !ok || !strings.HasPrefix(header, "data:") || !strings.HasSuffix(header, ";base64") {
+		return nil, fmt.Errorf("not a base64 data URL")
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,356 @@
+package attachments
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxAttachmentsPerTask keeps task rows (which hold the attachment list) small
+	MaxAttachmentsPerTask = 20
+	// ThumbnailSize is the longest edge of image attachment previews
+	ThumbnailSize = 320
+	// AvatarSize is the longest edge avatars are stored at
+	AvatarSize = 256
+	// MaxAvatarSize limits avatar uploads before they are resized
+	MaxAvatarSize = 5 << 20
+
+	avatarURLPrefix = "/avatars/"
+)
+
+var (
+	ErrNotFound      = errors.New("attachment not found")
+	ErrTooLarge      = errors.New("file is too large")
+	ErrTooMany       = fmt.Errorf("a task can have at most %d attachments", MaxAttachmentsPerTask)
+	ErrQuotaExceeded = errors.New("board storage quota exceeded")
+	ErrEmpty         = errors.New("file is empty")
+	ErrNotImage      = errors.New("avatar must be a PNG, JPEG, GIF or WebP image")
+)
+
+// Service stores task attachments and avatars in blob storage and keeps the
+// metadata on the task and user rows in sync
+type Service struct {
+	db          *database.DB
+	store       storage.Store
+	maxFileSize int64
+	boardQuota  int64
+}
+
+// NewService configures the per-file and per-board limits (ATTACHMENT_MAX_SIZE_MB,
+// default 8, which fits the request size limit, and BOARD_STORAGE_QUOTA_MB, default 500)
+func NewService(db *database.DB, store storage.Store, cfg config.Attachments) *Service {
+	return &Service{
+		db:          db,
+		store:       store,
+		maxFileSize: int64(cfg.MaxFileSizeMB) << 20,
+		boardQuota:  int64(cfg.BoardQuotaMB) << 20,
+	}
+}
+
+// MaxFileSize is the largest attachment accepted
+func (s *Service) MaxFileSize() int64 {
+	return s.maxFileSize
+}
+
+// Add stores a file and appends it to the task's attachments. The content type is
+// sniffed from the data; images also get a thumbnail.
+func (s *Service) Add(ctx context.Context, taskID, uploaderID uuid.UUID, filename string, data []byte) (*models.Attachment, error) {
+	if len(data) == 0 {
+		return nil, ErrEmpty
+	}
+	if int64(len(data)) > s.maxFileSize {
+		return nil, ErrTooLarge
+	}
+
+	task, err := s.db.GetTask(ctx, taskID)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	if len(task.GetAttachments()) >= MaxAttachmentsPerTask {
+		return nil, ErrTooMany
+	}
+
+	usage, err := s.BoardUsage(ctx, task.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	if usage+int64(len(data)) > s.boardQuota {
+		return nil, ErrQuotaExceeded
+	}
+
+	attachment := models.Attachment{
+		ID:          uuid.New().String(),
+		Filename:    sanitizeFilename(filename),
+		ContentType: storage.SniffContentType(data),
+		Size:        int64(len(data)),
+		UploadedBy:  uploaderID.String(),
+		UploadedAt:  time.Now().UTC(),
+	}
+	attachment.Key = fmt.Sprintf("tasks/%s/%s", task.ID.String(), attachment.ID)
+
+	if err := s.store.Put(ctx, attachment.Key, data, attachment.ContentType); err != nil {
+		return nil, fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	if storage.CanThumbnail(attachment.ContentType) {
+		thumbnail, contentType, err := storage.Thumbnail(data, ThumbnailSize)
+		if err == nil {
+			key := attachment.Key + "_thumb"
+			if err = s.store.Put(ctx, key, thumbnail, contentType); err == nil {
+				attachment.ThumbnailKey = key
+			}
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to create thumbnail for attachment %s: %v", attachment.ID, err)
+		}
+	}
+
+	// The limit is checked again by the database, where concurrent uploads are serialized
+	if err := s.db.AppendTaskAttachment(ctx, task.ID, attachment, MaxAttachmentsPerTask); err != nil {
+		s.deleteBlobs(ctx, attachment)
+		switch {
+		case errors.Is(err, database.ErrAttachmentLimit):
+			return nil, ErrTooMany
+		case errors.Is(err, database.ErrAttachmentNotFound):
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	log.Printf("Stored attachment %s (%s, %d bytes) on task %s", attachment.ID, attachment.ContentType, attachment.Size, task.ID.String())
+	return &attachment, nil
+}
+
+// Open returns an attachment's contents, or its thumbnail when one exists and thumbnail is true
+func (s *Service) Open(ctx context.Context, task *models.Task, attachmentID string, thumbnail bool) (io.ReadCloser, int64, *models.Attachment, error) {
+	attachment := findAttachment(task, attachmentID)
+	if attachment == nil {
+		return nil, 0, nil, ErrNotFound
+	}
+
+	key := attachment.Key
+	if thumbnail && attachment.ThumbnailKey != "" {
+		key = attachment.ThumbnailKey
+	}
+	if key == "" {
+		// Not migrated to blob storage yet
+		return nil, 0, nil, ErrNotFound
+	}
+
+	reader, size, err := s.store.Get(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, 0, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return reader, size, attachment, nil
+}
+
+// Remove deletes an attachment from a task and from blob storage
+func (s *Service) Remove(ctx context.Context, taskID uuid.UUID, attachmentID string) (*models.Attachment, error) {
+	removed, err := s.db.RemoveTaskAttachment(ctx, taskID, attachmentID)
+	if errors.Is(err, database.ErrAttachmentNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.deleteBlobs(ctx, *removed)
+	return removed, nil
+}
+
+// BoardAttachments snapshots the attachments of a board's tasks so their files can be
+// removed with DeleteBlobs once the board, and with it the task rows, has been deleted
+func (s *Service) BoardAttachments(ctx context.Context, boardID uuid.UUID) []models.Task {
+	tasks, err := s.db.GetBoardTaskAttachments(ctx, boardID)
+	if err != nil {
+		log.Printf("Warning: Failed to list attachments of board %s: %v", boardID.String(), err)
+		return nil
+	}
+	return tasks
+}
+
+// DeleteBlobs removes the stored files of every attachment on the tasks. Call it after the
+// tasks are deleted; failures are only logged because the rows are already gone.
+func (s *Service) DeleteBlobs(ctx context.Context, tasks ...models.Task) {
+	for i := range tasks {
+		for _, attachment := range tasks[i].GetAttachments() {
+			s.deleteBlobs(ctx, attachment)
+		}
+	}
+}
+
+// BoardUsage is the total size of all attachments on a board
+func (s *Service) BoardUsage(ctx context.Context, boardID uuid.UUID) (int64, error) {
+	tasks, err := s.db.GetBoardTaskAttachments(ctx, boardID)
+	if err != nil {
+		return 0, err
+	}
+
+	var total int64
+	for i := range tasks {
+		for _, attachment := range tasks[i].GetAttachments() {
+			total += attachment.Size
+		}
+	}
+	return total, nil
+}
+
+// SetAvatar resizes an uploaded image, stores it and points the user's avatar_url at it.
+// The previous stored avatar, if any, is deleted.
+func (s *Service) SetAvatar(ctx context.Context, userID uuid.UUID, data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", ErrEmpty
+	}
+	if len(data) > MaxAvatarSize {
+		return "", ErrTooLarge
+	}
+
+	contentType := storage.SniffContentType(data)
+	switch {
+	case storage.CanThumbnail(contentType):
+		resized, resizedType, err := storage.Thumbnail(data, AvatarSize)
+		if err != nil {
+			return "", ErrNotImage
+		}
+		data, contentType = resized, resizedType
+	case contentType == "image/webp":
+		// No WebP encoder in the standard library; stored as uploaded
+	default:
+		return "", ErrNotImage
+	}
+
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	name := randomName() + extensionFor(contentType)
+	key := "avatars/" + userID.String() + "/" + name
+	if err := s.store.Put(ctx, key, data, contentType); err != nil {
+		return "", fmt.Errorf("failed to store avatar: %w", err)
+	}
+
+	avatarURL := avatarURLPrefix + userID.String() + "/" + name
+	if err := s.db.UpdateUserProfile(ctx, userID, map[string]interface{}{"avatar_url": avatarURL}); err != nil {
+		_ = s.store.Delete(ctx, key)
+		return "", err
+	}
+
+	s.DeleteAvatar(ctx, user.AvatarURL)
+	return avatarURL, nil
+}
+
+// OpenAvatar returns a stored avatar and its content type
+func (s *Service) OpenAvatar(ctx context.Context, userID uuid.UUID, name string) (io.ReadCloser, int64, string, error) {
+	if name == "" || name != path.Base(name) || strings.HasPrefix(name, ".") {
+		return nil, 0, "", ErrNotFound
+	}
+
+	reader, size, err := s.store.Get(ctx, "avatars/"+userID.String()+"/"+name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, 0, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return reader, size, contentType, nil
+}
+
+// DeleteAvatar removes a stored avatar by its URL; other URLs (external images) are ignored
+func (s *Service) DeleteAvatar(ctx context.Context, avatarURL string) {
+	if !strings.HasPrefix(avatarURL, avatarURLPrefix) {
+		return
+	}
+	key := "avatars/" + strings.TrimPrefix(avatarURL, avatarURLPrefix)
+	if err := s.store.Delete(ctx, key); err != nil {
+		log.Printf("Warning: Failed to delete avatar %s: %v", key, err)
+	}
+}
+
+func (s *Service) deleteBlobs(ctx context.Context, attachment models.Attachment) {
+	for _, key := range []string{attachment.Key, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			log.Printf("Warning: Failed to delete blob %s: %v", key, err)
+		}
+	}
+}
+
+func findAttachment(task *models.Task, attachmentID string) *models.Attachment {
+	for _, attachment := range task.GetAttachments() {
+		if attachment.ID == attachmentID {
+			return &attachment
+		}
+	}
+	return nil
+}
+
+// sanitizeFilename keeps the base name and drops control characters, which would
+// otherwise end up in Content-Disposition headers
+func sanitizeFilename(filename string) string {
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	filename = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, filename)
+	filename = strings.TrimSpace(filename)
+
+	if filename == "" || filename == "." || filename == "/" {
+		return "attachment"
+	}
+	if runes := []rune(filename); len(runes) > 255 {
+		filename = string(runes[:255])
+	}
+	return filename
+}
+
+func extensionFor(contentType string) string {
+	switch contentType {
+	case "image/png":
+		return ".png"
+	case "image/jpeg":
+		return ".jpg"
+	case "image/gif":
+		return ".gif"
+	case "image/webp":
+		return ".webp"
+	}
+	return ""
+}
+
+func randomName() string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,440 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// fakePostgREST holds tasks and users in memory and implements the attachment
+// functions the way the migration does, one entry at a time under a lock
+type fakePostgREST struct {
+	mu          sync.Mutex
+	tasks       map[string]map[string]interface{}
+	users       map[string]map[string]interface{}
+	taskPatches int
+}
+
+func (f *fakePostgREST) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+
+	table := strings.TrimPrefix(r.URL.Path, "/rest/v1/")
+	if name, ok := strings.CutPrefix(table, "rpc/"); ok {
+		var params map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		json.NewEncoder(w).Encode(f.rpc(name, params))
+		return
+	}
+
+	id, byID := strings.CutPrefix(r.URL.Query().Get("id"), "eq.")
+	switch {
+	case table == "tasks" && r.Method == http.MethodPatch:
+		f.taskPatches++
+		json.NewEncoder(w).Encode([]interface{}{})
+	case table == "tasks" && byID:
+		json.NewEncoder(w).Encode(rowsOf(f.tasks[id]))
+	case table == "tasks":
+		// Board listings and the migration's page through tasks; the tests have few
+		board, byBoard := strings.CutPrefix(r.URL.Query().Get("board_id"), "eq.")
+		var rows []map[string]interface{}
+		for _, task := range f.tasks {
+			if !byBoard || task["board_id"] == board {
+				rows = append(rows, task)
+			}
+		}
+		json.NewEncoder(w).Encode(rowsOf(rows...))
+	case table == "users" && r.Method == http.MethodPatch:
+		var updates map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&updates)
+		if user := f.users[id]; user != nil {
+			user["avatar_url"] = updates["avatar_url"]
+		}
+		json.NewEncoder(w).Encode([]interface{}{})
+	case table == "users" && byID:
+		json.NewEncoder(w).Encode(rowsOf(f.users[id]))
+	case table == "users":
+		var rows []map[string]interface{}
+		for _, user := range f.users {
+			if avatar, _ := user["avatar_url"].(string); strings.HasPrefix(avatar, "data:") {
+				rows = append(rows, user)
+			}
+		}
+		json.NewEncoder(w).Encode(rowsOf(rows...))
+	default:
+		json.NewEncoder(w).Encode([]interface{}{})
+	}
+}
+
+func rowsOf(rows ...map[string]interface{}) []map[string]interface{} {
+	kept := []map[string]interface{}{}
+	for _, row := range rows {
+		if row != nil {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+func rpcError(code, message string) map[string]interface{} {
+	return map[string]interface{}{"code": code, "message": message}
+}
+
+func (f *fakePostgREST) rpc(name string, params map[string]interface{}) interface{} {
+	task := f.tasks[params["p_task_id"].(string)]
+	if task == nil {
+		return rpcError("P0002", "task not found")
+	}
+	list, _ := task["attachments"].([]interface{})
+
+	switch name {
+	case "append_task_attachment":
+		if len(list) >= int(params["p_max_attachments"].(float64)) {
+			return rpcError("23514", "task has too many attachments")
+		}
+		task["attachments"] = append(list, params["p_attachment"])
+		return params["p_task_id"]
+	case "replace_task_attachment":
+		replacement := params["p_attachment"].(map[string]interface{})
+		for i, entry := range list {
+			if entry.(map[string]interface{})["id"] == replacement["id"] {
+				list[i] = replacement
+				return params["p_task_id"]
+			}
+		}
+	case "remove_task_attachment":
+		for i, entry := range list {
+			if entry.(map[string]interface{})["id"] == params["p_attachment_id"] {
+				task["attachments"] = append(list[:i:i], list[i+1:]...)
+				return entry
+			}
+		}
+	}
+	return rpcError("P0002", "attachment not found")
+}
+
+type testEnv struct {
+	service *Service
+	db      *fakePostgREST
+	store   storage.Store
+	taskID  uuid.UUID
+	boardID uuid.UUID
+	userID  uuid.UUID
+}
+
+func newTestEnv(t *testing.T, quotaMB int) *testEnv {
+	t.Helper()
+	env := &testEnv{taskID: uuid.New(), boardID: uuid.New(), userID: uuid.New()}
+	env.db = &fakePostgREST{
+		tasks: map[string]map[string]interface{}{env.taskID.String(): {
+			"id": env.taskID.String(), "board_id": env.boardID.String(), "attachments": []interface{}{},
+		}},
+		users: map[string]map[string]interface{}{env.userID.String(): {"id": env.userID.String()}},
+	}
+	server := httptest.NewServer(env.db)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		Database: config.Database{SupabaseURL: server.URL, SupabaseServiceKey: "test-key"},
+		Encryption: config.Encryption{
+			MasterKey:  base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			KeyVersion: 1,
+		},
+		Cache: config.Cache{Driver: "off"},
+	}
+	store, err := storage.NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	env.store = store
+	env.service = NewService(database.NewDB(cfg), store, config.Attachments{MaxFileSizeMB: 1, BoardQuotaMB: quotaMB})
+	return env
+}
+
+func (e *testEnv) attachments(t *testing.T) []models.Attachment {
+	t.Helper()
+	e.db.mu.Lock()
+	defer e.db.mu.Unlock()
+	data, _ := json.Marshal(e.db.tasks[e.taskID.String()]["attachments"])
+	var attachments []models.Attachment
+	if err := json.Unmarshal(data, &attachments); err != nil {
+		t.Fatal(err)
+	}
+	return attachments
+}
+
+func (e *testEnv) blobExists(t *testing.T, key string) bool {
+	t.Helper()
+	reader, _, err := e.store.Get(context.Background(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.Close()
+	return true
+}
+
+func testPNG(t *testing.T, size int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for x := 0; x < size; x++ {
+		img.Set(x, x, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAddAndRemove(t *testing.T) {
+	env := newTestEnv(t, 10)
+	ctx := context.Background()
+
+	attachment, err := env.service.Add(ctx, env.taskID, env.userID, `../notes "draft".png`, testPNG(t, 600))
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if attachment.Filename != "notes draft.png" || attachment.ContentType != "image/png" || attachment.ThumbnailKey == "" {
+		t.Errorf("attachment = %+v", attachment)
+	}
+	if !env.blobExists(t, attachment.Key) || !env.blobExists(t, attachment.ThumbnailKey) {
+		t.Error("the file and its thumbnail should be stored")
+	}
+	if stored := env.attachments(t); len(stored) != 1 || stored[0].ID != attachment.ID || stored[0].Data != "" {
+		t.Errorf("task attachments = %+v", stored)
+	}
+
+	if _, err := env.service.Remove(ctx, env.taskID, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Remove of an unknown attachment = %v, want ErrNotFound", err)
+	}
+	if _, err := env.service.Remove(ctx, env.taskID, attachment.ID); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if len(env.attachments(t)) != 0 || env.blobExists(t, attachment.Key) || env.blobExists(t, attachment.ThumbnailKey) {
+		t.Error("Remove should delete the entry and both blobs")
+	}
+	if env.db.taskPatches != 0 {
+		t.Errorf("attachments were written back with %d task updates instead of the RPCs", env.db.taskPatches)
+	}
+}
+
+func TestConcurrentAddsKeepEveryAttachment(t *testing.T) {
+	env := newTestEnv(t, 10)
+
+	const uploads = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, uploads)
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := env.service.Add(context.Background(), env.taskID, env.userID, "file.txt", []byte(strings.Repeat("x", i+1)))
+			errs <- err
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	if stored := env.attachments(t); len(stored) != uploads {
+		t.Errorf("task has %d attachments after %d concurrent uploads", len(stored), uploads)
+	}
+}
+
+func TestAddLimits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("empty and oversized files", func(t *testing.T) {
+		env := newTestEnv(t, 10)
+		if _, err := env.service.Add(ctx, env.taskID, env.userID, "a.txt", nil); !errors.Is(err, ErrEmpty) {
+			t.Errorf("empty file = %v, want ErrEmpty", err)
+		}
+		if _, err := env.service.Add(ctx, env.taskID, env.userID, "a.bin", make([]byte, 1<<20+1)); !errors.Is(err, ErrTooLarge) {
+			t.Errorf("oversized file = %v, want ErrTooLarge", err)
+		}
+	})
+
+	t.Run("unknown task", func(t *testing.T) {
+		env := newTestEnv(t, 10)
+		if _, err := env.service.Add(ctx, uuid.New(), env.userID, "a.txt", []byte("x")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Add to an unknown task = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("board quota", func(t *testing.T) {
+		env := newTestEnv(t, 1)
+		if _, err := env.service.Add(ctx, env.taskID, env.userID, "a.bin", make([]byte, 700<<10)); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		if _, err := env.service.Add(ctx, env.taskID, env.userID, "b.bin", make([]byte, 700<<10)); !errors.Is(err, ErrQuotaExceeded) {
+			t.Errorf("Add over the quota = %v, want ErrQuotaExceeded", err)
+		}
+	})
+
+	t.Run("task already full", func(t *testing.T) {
+		env := newTestEnv(t, 10)
+		full := make([]interface{}, MaxAttachmentsPerTask)
+		for i := range full {
+			full[i] = map[string]interface{}{"id": uuid.NewString(), "size": 1}
+		}
+		env.db.tasks[env.taskID.String()]["attachments"] = full
+
+		_, err := env.service.Add(ctx, env.taskID, env.userID, "late.txt", []byte("x"))
+		if !errors.Is(err, ErrTooMany) {
+			t.Fatalf("Add to a full task = %v, want ErrTooMany", err)
+		}
+	})
+
+	t.Run("limit reached by a concurrent upload", func(t *testing.T) {
+		env := newTestEnv(t, 10)
+		full := make([]interface{}, MaxAttachmentsPerTask)
+		for i := range full {
+			full[i] = map[string]interface{}{"id": uuid.NewString()}
+		}
+
+		// The task was empty when Add checked it, but is full by the time of the append
+		blobs := t.TempDir()
+		store, err := storage.NewLocalStore(blobs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.service.store = &fillingStore{Store: store, fill: func() {
+			env.db.mu.Lock()
+			env.db.tasks[env.taskID.String()]["attachments"] = full
+			env.db.mu.Unlock()
+		}}
+
+		if _, err := env.service.Add(ctx, env.taskID, env.userID, "late.txt", []byte("x")); !errors.Is(err, ErrTooMany) {
+			t.Fatalf("Add = %v, want ErrTooMany", err)
+		}
+		var files []string
+		_ = filepath.WalkDir(blobs, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if len(files) != 0 {
+			t.Errorf("the rejected upload left blobs behind: %v", files)
+		}
+	})
+}
+
+// fillingStore runs fill after the first Put, to simulate another upload finishing first
+type fillingStore struct {
+	storage.Store
+	fill func()
+	once sync.Once
+}
+
+func (s *fillingStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	err := s.Store.Put(ctx, key, data, contentType)
+	s.once.Do(s.fill)
+	return err
+}
+
+func TestSetAvatar(t *testing.T) {
+	env := newTestEnv(t, 10)
+	ctx := context.Background()
+
+	if _, err := env.service.SetAvatar(ctx, env.userID, []byte("not an image")); !errors.Is(err, ErrNotImage) {
+		t.Errorf("SetAvatar with text = %v, want ErrNotImage", err)
+	}
+
+	first, err := env.service.SetAvatar(ctx, env.userID, testPNG(t, 800))
+	if err != nil {
+		t.Fatalf("SetAvatar failed: %v", err)
+	}
+	// Must satisfy users_avatar_url_check
+	if !strings.HasPrefix(first, "/avatars/"+env.userID.String()+"/") || !strings.HasSuffix(first, ".png") {
+		t.Errorf("avatar URL = %q", first)
+	}
+
+	reader, _, contentType, err := env.service.OpenAvatar(ctx, env.userID, strings.TrimPrefix(first, "/avatars/"+env.userID.String()+"/"))
+	if err != nil {
+		t.Fatalf("OpenAvatar failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil || contentType != "image/png" || img.Bounds().Dx() > AvatarSize {
+		t.Errorf("stored avatar: %v, %s, %v", err, contentType, img.Bounds())
+	}
+
+	second, err := env.service.SetAvatar(ctx, env.userID, testPNG(t, 100))
+	if err != nil {
+		t.Fatalf("SetAvatar failed: %v", err)
+	}
+	if env.db.users[env.userID.String()]["avatar_url"] != second {
+		t.Errorf("avatar_url = %v, want %s", env.db.users[env.userID.String()]["avatar_url"], second)
+	}
+	if env.blobExists(t, "avatars/"+strings.TrimPrefix(first, "/avatars/")) {
+		t.Error("the previous avatar should be deleted")
+	}
+
+	if _, _, _, err := env.service.OpenAvatar(ctx, env.userID, "../secret"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("OpenAvatar with a path = %v, want ErrNotFound", err)
+	}
+}
+
+func TestMigrateInline(t *testing.T) {
+	env := newTestEnv(t, 10)
+	ctx := context.Background()
+
+	inlineID, storedID := uuid.NewString(), uuid.NewString()
+	env.db.tasks[env.taskID.String()]["attachments"] = []interface{}{
+		map[string]interface{}{"id": inlineID, "filename": "notes.txt", "data": base64.StdEncoding.EncodeToString([]byte("hello"))},
+		map[string]interface{}{"id": storedID, "filename": "kept.txt", "key": "tasks/x/kept", "size": 4},
+	}
+	env.db.users[env.userID.String()]["avatar_url"] = "data:image/png;base64," + base64.StdEncoding.EncodeToString(testPNG(t, 10))
+
+	report, err := env.service.MigrateInline(ctx)
+	if err != nil {
+		t.Fatalf("MigrateInline failed: %v", err)
+	}
+	if report.Attachments != 1 || report.Failed != 0 {
+		t.Errorf("report = %+v", report)
+	}
+
+	stored := env.attachments(t)
+	if len(stored) != 2 || stored[0].Data != "" || stored[0].Size != 5 || stored[1].Key != "tasks/x/kept" {
+		t.Fatalf("task attachments = %+v", stored)
+	}
+	reader, _, _, err := env.service.Open(ctx, &models.Task{Attachments: []map[string]interface{}{{"id": inlineID, "key": stored[0].Key}}}, inlineID, false)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "hello" {
+		t.Errorf("migrated contents = %q", data)
+	}
+}
@@ -0,0 +1,135 @@
+// Package backup defines the workspace archive written by cmd/backup and the ID
+// remapping used to restore it.
+//
+// An archive is a ZIP file holding manifest.json and one JSON Lines file per table
+// under tables/. Rows are stored as PostgREST returns them; user emails stay
+// encrypted, under the source instance's key or the key chosen at export.
+package backup
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// FormatVersion is bumped whenever the archive layout changes incompatibly
+const FormatVersion = 1
+
+const manifestFile = "manifest.json"
+
+// Row is one database row, keyed by column
+type Row = map[string]interface{}
+
+// Manifest describes an archive
+type Manifest struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	// SchemaVersion is the latest migration of the instance that wrote the archive
+	SchemaVersion int `json:"schema_version"`
+	// Scope is "instance" or "user:<id>"
+	Scope  string         `json:"scope"`
+	Counts map[string]int `json:"counts"`
+}
+
+// Snapshot is the content of an archive
+type Snapshot struct {
+	Manifest Manifest
+	Tables   map[string][]Row
+}
+
+// Write stores the snapshot as a ZIP archive
+func Write(w io.Writer, s *Snapshot) error {
+	s.Manifest.Format = FormatVersion
+	s.Manifest.Counts = make(map[string]int)
+	for _, table := range TableNames() {
+		s.Manifest.Counts[table] = len(s.Tables[table])
+	}
+
+	archive := zip.NewWriter(w)
+	for _, table := range TableNames() {
+		file, err := archive.Create("tables/" + table + ".jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", table, err)
+		}
+		encoder := json.NewEncoder(file)
+		for _, row := range s.Tables[table] {
+			if err := encoder.Encode(row); err != nil {
+				return fmt.Errorf("failed to write %s: %w", table, err)
+			}
+		}
+	}
+
+	file, err := archive.Create(manifestFile)
+	if err != nil {
+		return fmt.Errorf("failed to add manifest: %w", err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(s.Manifest); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return archive.Close()
+}
+
+// Read loads an archive written by Write
+func Read(r io.ReaderAt, size int64) (*Snapshot, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+
+	s := &Snapshot{Tables: make(map[string][]Row)}
+	if err := readJSON(archive, manifestFile, func(data []byte) error {
+		return json.Unmarshal(data, &s.Manifest)
+	}); err != nil {
+		return nil, err
+	}
+	if s.Manifest.Format < 1 || s.Manifest.Format > FormatVersion {
+		return nil, fmt.Errorf("archive format %d is not supported (this build reads up to %d)", s.Manifest.Format, FormatVersion)
+	}
+
+	for _, table := range TableNames() {
+		err := readJSON(archive, "tables/"+table+".jsonl", func(data []byte) error {
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+			for scanner.Scan() {
+				decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+				decoder.UseNumber()
+				var row Row
+				if err := decoder.Decode(&row); err != nil {
+					return err
+				}
+				s.Tables[table] = append(s.Tables[table], row)
+			}
+			return scanner.Err()
+		})
+		if err != nil {
+			return nil, err
+		}
+		if got, want := len(s.Tables[table]), s.Manifest.Counts[table]; got != want {
+			return nil, fmt.Errorf("archive has %d %s rows, manifest says %d", got, table, want)
+		}
+	}
+	return s, nil
+}
+
+func readJSON(archive *zip.Reader, name string, decode func([]byte) error) error {
+	file, err := archive.Open(name)
+	if err != nil {
+		return fmt.Errorf("archive is missing %s: %w", name, err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	if err := decode(data); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
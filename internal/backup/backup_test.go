@@ -0,0 +1,126 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func testSnapshot() *Snapshot {
+	return &Snapshot{
+		Manifest: Manifest{Scope: "user:u1", SchemaVersion: 14},
+		Tables: map[string][]Row{
+			"users": {{"id": "u1", "email": "enc-1"}, {"id": "u2", "email": "enc-2"}},
+			"boards": {
+				{"id": "child", "owner_id": "u1", "parent_board_id": "root", "inbound_email_token": "0123456789abcdef"},
+				{"id": "root", "owner_id": "u1", "parent_board_id": nil},
+			},
+			"board_members": {
+				{"id": "m1", "board_id": "root", "user_id": "u2", "invited_by": "u1"},
+				{"id": "m2", "board_id": "root", "user_id": "gone", "invited_by": "u1"},
+			},
+			"columns": {{"id": "c1", "board_id": "root"}},
+			"tasks": {
+				{"id": "t1", "board_id": "root", "column_id": "c1", "assigned_to": "gone", "nested_board_id": "child", "recurrence_id": "r1", "estimated_hours": 2.5},
+				{"id": "t2", "board_id": "root", "column_id": "c1"},
+			},
+			"task_dependencies": {
+				{"id": "d1", "source_task_id": "t1", "target_task_id": "t2"},
+				{"id": "d2", "source_task_id": "t1", "target_task_id": "elsewhere"},
+			},
+			"comments":           {{"id": "k1", "task_id": "t1", "user_id": "u2", "mentions": []interface{}{"u1", "gone"}}},
+			"task_column_events": {{"id": "e1", "task_id": "t1", "board_id": "root", "from_column_id": "deleted", "to_column_id": "c1"}},
+		},
+	}
+}
+
+func TestWriteAndRead(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, testSnapshot()); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	s, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if s.Manifest.Format != FormatVersion || s.Manifest.Scope != "user:u1" || s.Manifest.Counts["tasks"] != 2 {
+		t.Errorf("unexpected manifest: %+v", s.Manifest)
+	}
+	if got := s.Tables["tasks"][0]["estimated_hours"]; got != json.Number("2.5") {
+		t.Errorf("estimated_hours = %#v", got)
+	}
+	if len(s.Tables["users"]) != 2 || len(s.Tables["activity_log"]) != 0 {
+		t.Errorf("unexpected tables: %v", s.Tables)
+	}
+}
+
+func TestReadRejectsNewerFormats(t *testing.T) {
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	file, _ := archive.Create(manifestFile)
+	_, _ = file.Write([]byte(`{"format": 99}`))
+	_ = archive.Close()
+
+	if _, err := Read(bytes.NewReader(buf.Bytes()), int64(buf.Len())); err == nil {
+		t.Error("Read should refuse an unknown format")
+	}
+}
+
+func TestRemap(t *testing.T) {
+	s := testSnapshot()
+	tables, skipped, err := Remap(s, map[string]string{"u1": "new-u1", "u2": "new-u2"})
+	if err != nil {
+		t.Fatalf("Remap failed: %v", err)
+	}
+
+	boards := tables["boards"]
+	if len(boards) != 2 || boards[0]["parent_board_id"] != nil || boards[1]["parent_board_id"] != boards[0]["id"] {
+		t.Fatalf("parents should come first with remapped IDs: %v", boards)
+	}
+	if boards[0]["id"] == "root" || boards[1]["inbound_email_token"] != nil || boards[0]["owner_id"] != "new-u1" {
+		t.Errorf("boards were not remapped: %v", boards)
+	}
+
+	if len(tables["board_members"]) != 1 || skipped["board_members"] != 1 {
+		t.Errorf("members of unknown users should be skipped: %v", tables["board_members"])
+	}
+
+	task := tables["tasks"][0]
+	if task["column_id"] != tables["columns"][0]["id"] || task["assigned_to"] != nil ||
+		task["nested_board_id"] != boards[1]["id"] || task["recurrence_id"] != nil {
+		t.Errorf("task references were not rewritten: %v", task)
+	}
+
+	if len(tables["task_dependencies"]) != 1 || tables["task_dependencies"][0]["target_task_id"] != tables["tasks"][1]["id"] {
+		t.Errorf("dependencies leaving the archive should be skipped: %v", tables["task_dependencies"])
+	}
+
+	mentions := tables["comments"][0]["mentions"].([]interface{})
+	if len(mentions) != 1 || mentions[0] != "new-u1" {
+		t.Errorf("mentions = %v", mentions)
+	}
+
+	event := tables["task_column_events"][0]
+	if event["from_column_id"] != "deleted" || event["to_column_id"] != tables["columns"][0]["id"] {
+		t.Errorf("column events should keep unknown columns: %v", event)
+	}
+
+	if s.Tables["tasks"][0]["id"] != "t1" {
+		t.Error("Remap should not modify the snapshot")
+	}
+}
+
+func TestReferencedIDs(t *testing.T) {
+	ids := ReferencedIDs(testSnapshot(), "users")
+	want := []string{"gone", "u1", "u2"}
+	if len(ids) != len(want) {
+		t.Fatalf("ReferencedIDs = %v, want %v", ids, want)
+	}
+	for i := range want {
+		if ids[i] != want[i] {
+			t.Errorf("ReferencedIDs = %v, want %v", ids, want)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package backup
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// Reference is a column holding the ID of a row in another archived table
+type Reference struct {
+	Column string
+	Table  string
+	// Required rows are dropped when the referenced row is not in the archive;
+	// otherwise the column is cleared
+	Required bool
+	// Array columns hold a list of IDs; unknown IDs are removed from the list
+	Array bool
+	// Loose columns carry no foreign key, so unknown IDs are kept as they are
+	Loose bool
+}
+
+// Table describes how an archived table is exported and restored
+type Table struct {
+	Name string
+	// Rows are exported where By matches an ID of the From table
+	By   string
+	From string
+	// Conflict is the unique key to merge on when the target already has the row
+	Conflict   string
+	References []Reference
+	// Clear lists columns that are not carried over to the target
+	Clear []string
+}
+
+// Tables lists the archived tables in restore order. Users and boards come first
+// and are exported by scope rather than by reference.
+var Tables = []Table{
+	{Name: "users"},
+	{
+		Name: "boards",
+		References: []Reference{
+			{Column: "owner_id", Table: "users", Required: true},
+			{Column: "parent_board_id", Table: "boards"},
+		},
+		// Inbound addresses must stay unique across instances
+		Clear: []string{"inbound_email_token"},
+	},
+	{
+		Name: "board_members", By: "board_id", From: "boards",
+		// Creating a board already adds its owner as a member
+		Conflict: "board_id,user_id",
+		References: []Reference{
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "user_id", Table: "users", Required: true},
+			{Column: "invited_by", Table: "users"},
+		},
+	},
+	{
+		Name: "columns", By: "board_id", From: "boards",
+		References: []Reference{{Column: "board_id", Table: "boards", Required: true}},
+	},
+	{
+		Name: "sprints", By: "board_id", From: "boards",
+		References: []Reference{
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "created_by", Table: "users"},
+		},
+	},
+	{
+		Name: "tasks", By: "board_id", From: "boards",
+		References: []Reference{
+			{Column: "column_id", Table: "columns", Required: true},
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "assigned_to", Table: "users"},
+			{Column: "nested_board_id", Table: "boards"},
+			{Column: "sprint_id", Table: "sprints"},
+		},
+		// Recurrence series are not archived; the tasks they generated are
+		Clear: []string{"recurrence_id"},
+	},
+	{
+		Name: "task_assignees", By: "task_id", From: "tasks",
+		References: []Reference{
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "user_id", Table: "users", Required: true},
+			{Column: "assigned_by", Table: "users"},
+		},
+	},
+	{
+		Name: "task_checklist_items", By: "task_id", From: "tasks",
+		References: []Reference{
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "checked_by", Table: "users"},
+			{Column: "assigned_to", Table: "users"},
+			{Column: "created_by", Table: "users"},
+		},
+	},
+	{
+		Name: "task_dependencies", By: "source_task_id", From: "tasks",
+		References: []Reference{
+			{Column: "source_task_id", Table: "tasks", Required: true},
+			{Column: "target_task_id", Table: "tasks", Required: true},
+			{Column: "created_by", Table: "users"},
+		},
+	},
+	{
+		Name: "comments", By: "task_id", From: "tasks",
+		References: []Reference{
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "user_id", Table: "users", Required: true},
+			{Column: "mentions", Table: "users", Array: true},
+		},
+	},
+	{
+		Name: "activity_log", By: "board_id", From: "boards",
+		References: []Reference{
+			{Column: "user_id", Table: "users", Required: true},
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "task_id", Table: "tasks"},
+		},
+	},
+	{
+		Name: "time_entries", By: "board_id", From: "boards",
+		References: []Reference{
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "user_id", Table: "users", Required: true},
+		},
+	},
+	{
+		Name: "task_column_events", By: "board_id", From: "boards",
+		References: []Reference{
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "board_id", Table: "boards", Required: true},
+			{Column: "user_id", Table: "users"},
+			{Column: "from_column_id", Table: "columns", Loose: true},
+			{Column: "to_column_id", Table: "columns", Loose: true},
+		},
+	},
+	{
+		Name: "sprint_task_changes", By: "sprint_id", From: "sprints",
+		References: []Reference{
+			{Column: "sprint_id", Table: "sprints", Required: true},
+			{Column: "task_id", Table: "tasks", Required: true},
+			{Column: "user_id", Table: "users"},
+		},
+	},
+}
+
+// TableNames lists the archived tables in restore order
+func TableNames() []string {
+	names := make([]string, len(Tables))
+	for i, table := range Tables {
+		names[i] = table.Name
+	}
+	return names
+}
+
+// ReferencedIDs collects the IDs of table that the other archived rows point at
+func ReferencedIDs(s *Snapshot, table string) []string {
+	seen := make(map[string]bool)
+	var ids []string
+	add := func(value interface{}) {
+		if id, ok := value.(string); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	for _, spec := range Tables {
+		for _, ref := range spec.References {
+			if ref.Table != table {
+				continue
+			}
+			for _, row := range s.Tables[spec.Name] {
+				if items, ok := row[ref.Column].([]interface{}); ok {
+					for _, item := range items {
+						add(item)
+					}
+				} else {
+					add(row[ref.Column])
+				}
+			}
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Remap gives every archived row except users a new ID and rewrites references to
+// match. users maps archived user IDs to the IDs they have in the target. Rows whose
+// required references cannot be resolved are dropped and counted in skipped.
+func Remap(s *Snapshot, users map[string]string) (tables map[string][]Row, skipped map[string]int, err error) {
+	ids := map[string]map[string]string{"users": users}
+	for _, spec := range Tables[1:] {
+		ids[spec.Name] = make(map[string]string)
+		for _, row := range s.Tables[spec.Name] {
+			id, ok := row["id"].(string)
+			if !ok {
+				return nil, nil, fmt.Errorf("%s row without an id", spec.Name)
+			}
+			ids[spec.Name][id] = uuid.NewString()
+		}
+	}
+
+	tables = make(map[string][]Row)
+	skipped = make(map[string]int)
+	for _, spec := range Tables[1:] {
+		for _, row := range s.Tables[spec.Name] {
+			out, ok := remapRow(spec, row, ids)
+			if !ok {
+				skipped[spec.Name]++
+				continue
+			}
+			tables[spec.Name] = append(tables[spec.Name], out)
+		}
+	}
+	tables["boards"] = parentsFirst(tables["boards"])
+	return tables, skipped, nil
+}
+
+func remapRow(spec Table, row Row, ids map[string]map[string]string) (Row, bool) {
+	out := make(Row, len(row))
+	for column, value := range row {
+		out[column] = value
+	}
+	out["id"] = ids[spec.Name][row["id"].(string)]
+	for _, column := range spec.Clear {
+		if _, ok := out[column]; ok {
+			out[column] = nil
+		}
+	}
+
+	for _, ref := range spec.References {
+		value, present := row[ref.Column]
+		if !present || value == nil {
+			if ref.Required {
+				return nil, false
+			}
+			continue
+		}
+
+		if ref.Array {
+			items, _ := value.([]interface{})
+			mapped := make([]interface{}, 0, len(items))
+			for _, item := range items {
+				if id, ok := ids[ref.Table][fmt.Sprint(item)]; ok {
+					mapped = append(mapped, id)
+				}
+			}
+			out[ref.Column] = mapped
+			continue
+		}
+
+		id, ok := ids[ref.Table][fmt.Sprint(value)]
+		switch {
+		case ok:
+			out[ref.Column] = id
+		case ref.Required:
+			return nil, false
+		case !ref.Loose:
+			out[ref.Column] = nil
+		}
+	}
+	return out, true
+}
+
+// parentsFirst orders boards so that every board comes after its parent
+func parentsFirst(boards []Row) []Row {
+	byID := make(map[string]Row, len(boards))
+	for _, board := range boards {
+		byID[board["id"].(string)] = board
+	}
+
+	ordered := make([]Row, 0, len(boards))
+	placed := make(map[string]bool, len(boards))
+	var place func(board Row)
+	place = func(board Row) {
+		id := board["id"].(string)
+		if placed[id] {
+			return
+		}
+		placed[id] = true
+		if parentID, ok := board["parent_board_id"].(string); ok {
+			if parent, ok := byID[parentID]; ok {
+				place(parent)
+			}
+		}
+		ordered = append(ordered, board)
+	}
+	for _, board := range boards {
+		place(board)
+	}
+	return ordered
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"sudo/internal/config"
+)
+
+// Store is a key/value cache whose entries expire after the store's TTL. Misses and
+// backend failures are both reported as a miss by Get, so callers fall back to the
+// source of truth. Implementations must be safe for concurrent use.
+//
+// Every Delete advances the store's generation. Get returns the generation along with
+// a miss, and Set drops the value when the generation has moved since: a value read
+// from the source before a concurrent write's Delete is never stored after it.
+type Store interface {
+	Name() string
+	Get(ctx context.Context, key string) (value []byte, gen uint64, ok bool)
+	// Set stores value unless a Delete has happened since Get returned gen
+	Set(ctx context.Context, key string, value []byte, gen uint64) error
+	// Delete removes the keys; deleting a missing key is not an error
+	Delete(ctx context.Context, keys ...string) error
+}
+
+// NewStore picks the store for cfg.Driver (memory, redis or off). When unset it uses
+// Redis if cfg.RedisURL is set and turns caching off otherwise. The memory driver keeps
+// cfg.Size entries per instance; with cfg.RedisURL set its deletes are published to the
+// other instances, without it the driver is only safe for a single instance, as others
+// would keep serving revoked memberships for up to cfg.TTL. It returns a nil Store when
+// caching is off. Stores that need a background worker implement Run.
+func NewStore(cfg config.Cache) (Store, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		if cfg.RedisURL != "" {
+			driver = "redis"
+		} else {
+			driver = "off"
+		}
+	}
+
+	switch driver {
+	case "off":
+		return nil, nil
+	case "memory":
+		if cfg.RedisURL != "" {
+			return NewSyncedStore(cfg.RedisURL, cfg.Size, cfg.TTL)
+		}
+		return NewMemoryStore(cfg.Size, cfg.TTL), nil
+	case "redis":
+		return NewRedisStore(cfg.RedisURL, cfg.TTL)
+	default:
+		return nil, fmt.Errorf("unknown CACHE_DRIVER %q (expected memory, redis or off)", driver)
+	}
+}
@@ -0,0 +1,268 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// fill stores value the way a read-through miss does
+func fill(ctx context.Context, s Store, key string, value []byte) error {
+	_, gen, _ := s.Get(ctx, key)
+	return s.Set(ctx, key, value, gen)
+}
+
+func get(ctx context.Context, s Store, key string) ([]byte, bool) {
+	value, _, ok := s.Get(ctx, key)
+	return value, ok
+}
+
+func TestMemoryStoreEvictsAndExpires(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 4, 21, 9, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	_ = fill(ctx, s, "a", []byte("1"))
+	_ = fill(ctx, s, "b", []byte("2"))
+	get(ctx, s, "a") // b is now the least recently used
+	_ = fill(ctx, s, "c", []byte("3"))
+
+	if _, ok := get(ctx, s, "b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if v, ok := get(ctx, s, "a"); !ok || string(v) != "1" {
+		t.Errorf("a = %q, %v", v, ok)
+	}
+
+	_ = s.Delete(ctx, "a", "missing")
+	if _, ok := get(ctx, s, "a"); ok {
+		t.Error("a should have been deleted")
+	}
+
+	now = now.Add(time.Minute)
+	if _, ok := get(ctx, s, "c"); ok {
+		t.Error("c should have expired")
+	}
+}
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx := context.Background()
+	s, err := NewRedisStore("redis://"+server.Addr(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewRedisStore failed: %v", err)
+	}
+
+	if _, ok := get(ctx, s, "board:1"); ok {
+		t.Error("a missing key should be a miss")
+	}
+
+	value := "line one\r\nline two"
+	if err := fill(ctx, s, "board:1", []byte(value)); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, ok := get(ctx, s, "board:1"); !ok || string(got) != value {
+		t.Errorf("Get = %q, %v", got, ok)
+	}
+	if !server.Exists(redisKeySpace + "board:1") {
+		t.Error("keys should be stored under the key space prefix")
+	}
+	if ttl := server.TTL(redisKeySpace + "board:1"); ttl != time.Minute {
+		t.Errorf("TTL = %v, want 1m", ttl)
+	}
+
+	if err := s.Delete(ctx, "board:1", "board:2"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, ok := get(ctx, s, "board:1"); ok {
+		t.Error("board:1 should have been deleted")
+	}
+
+	server.SetError("LOADING Redis is loading the dataset in memory")
+	if _, ok := get(ctx, s, "board:2"); ok {
+		t.Error("an error reply should be a miss")
+	}
+	if err := fill(ctx, s, "board:2", []byte("x")); err == nil {
+		t.Error("Set should return error replies")
+	}
+	server.SetError("")
+	if err := fill(ctx, s, "board:2", []byte("x")); err != nil {
+		t.Errorf("the client should recover after an error reply: %v", err)
+	}
+}
+
+func TestNewRedisStoreRejectsBadURL(t *testing.T) {
+	for _, rawURL := range []string{"http://localhost:6379", "redis://localhost:6379/x"} {
+		if _, err := NewRedisStore(rawURL, time.Minute); err == nil {
+			t.Errorf("NewRedisStore accepted %q", rawURL)
+		}
+	}
+}
+
+// waitFor polls cond until it holds or five seconds have passed
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncedStoreSharesInvalidations(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+	b, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+
+	// Nothing is cached before the subscription is up
+	_ = fill(ctx, b, "members:1", []byte("owner"))
+	if _, ok := get(ctx, b, "members:1"); ok {
+		t.Error("entries should not be served before Run has subscribed")
+	}
+
+	go a.Run(ctx)
+	go b.Run(ctx)
+	waitFor(t, "both subscriptions", func() bool { return a.live.Load() && b.live.Load() })
+
+	_ = fill(ctx, b, "members:1", []byte("owner"))
+	_ = fill(ctx, b, "members:2", []byte("owner"))
+	if v, ok := get(ctx, b, "members:1"); !ok || string(v) != "owner" {
+		t.Fatalf("Get = %q, %v", v, ok)
+	}
+
+	// A membership change on a reaches b
+	if err := a.Delete(ctx, "members:1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	waitFor(t, "the invalidation", func() bool {
+		_, ok := get(ctx, b, "members:1")
+		return !ok
+	})
+	if _, ok := get(ctx, b, "members:2"); !ok {
+		t.Error("other keys should stay cached")
+	}
+
+	// A malformed message clears everything, as the keys it meant are unknown
+	server.Publish(invalidationChannel, "members:2")
+	waitFor(t, "the cache to be cleared", func() bool {
+		_, ok := get(ctx, b, "members:2")
+		return !ok
+	})
+}
+
+func TestSyncedStoreBypassesCacheWhileDisconnected(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	s, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+	go s.Run(ctx)
+	waitFor(t, "the subscription", s.live.Load)
+	_ = fill(ctx, s, "user:1", []byte("ada"))
+
+	// Invalidations published while the connection is down are lost
+	server.Close()
+	waitFor(t, "the cache to be bypassed", func() bool { return !s.live.Load() })
+	if _, ok := get(ctx, s, "user:1"); ok {
+		t.Error("entries should not be served while disconnected")
+	}
+
+	if err := server.Restart(); err != nil {
+		t.Fatalf("Restart failed: %v", err)
+	}
+	waitFor(t, "the resubscription", s.live.Load)
+	if _, ok := get(ctx, s, "user:1"); ok {
+		t.Error("entries from before the disconnect should have been cleared")
+	}
+}
+
+func TestFillAfterDeleteIsDropped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := miniredis.RunT(t)
+
+	redisStore, err := NewRedisStore("redis://"+server.Addr(), time.Minute)
+	if err != nil {
+		t.Fatalf("NewRedisStore failed: %v", err)
+	}
+	synced, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+	go synced.Run(ctx)
+	waitFor(t, "the subscription", synced.live.Load)
+
+	for _, s := range []Store{NewMemoryStore(10, time.Minute), redisStore, synced} {
+		t.Run(s.Name(), func(t *testing.T) {
+			// A reader misses and loads the old membership from the database...
+			_, gen, ok := s.Get(ctx, "members:1")
+			if ok {
+				t.Fatal("members:1 should start as a miss")
+			}
+			// ...while a writer revokes it and invalidates...
+			if err := s.Delete(ctx, "members:1"); err != nil {
+				t.Fatalf("Delete failed: %v", err)
+			}
+			// ...so the late fill must not be stored
+			if err := s.Set(ctx, "members:1", []byte("revoked"), gen); err != nil {
+				t.Fatalf("Set failed: %v", err)
+			}
+			if v, ok := get(ctx, s, "members:1"); ok {
+				t.Errorf("stale fill was cached: %q", v)
+			}
+
+			if err := fill(ctx, s, "members:1", []byte("current")); err != nil {
+				t.Fatalf("fill failed: %v", err)
+			}
+			if v, ok := get(ctx, s, "members:1"); !ok || string(v) != "current" {
+				t.Errorf("Get = %q, %v after a clean fill", v, ok)
+			}
+		})
+	}
+}
+
+func TestSyncedStoreDropsFillRacingRemoteDelete(t *testing.T) {
+	server := miniredis.RunT(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+	b, err := NewSyncedStore("redis://"+server.Addr(), 10, time.Minute)
+	if err != nil {
+		t.Fatalf("NewSyncedStore failed: %v", err)
+	}
+	go a.Run(ctx)
+	go b.Run(ctx)
+	waitFor(t, "both subscriptions", func() bool { return a.live.Load() && b.live.Load() })
+
+	_, gen, _ := b.Get(ctx, "board:1")
+	if err := a.Delete(ctx, "board:1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	waitFor(t, "the invalidation", func() bool { _, g, _ := b.Get(ctx, "board:1"); return g != gen })
+
+	_ = b.Set(ctx, "board:1", []byte("old owner"), gen)
+	if _, ok := get(ctx, b, "board:1"); ok {
+		t.Error("a fill read before the remote delete should be dropped")
+	}
+}
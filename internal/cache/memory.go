@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore is an in-process LRU cache. It is only consistent within one instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries *list.List // most recently used first
+	byKey   map[string]*list.Element
+	gen     uint64 // advanced by every Delete and Clear
+	now     func() time.Time
+}
+
+type memoryEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func NewMemoryStore(size int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		size:    size,
+		ttl:     ttl,
+		entries: list.New(),
+		byKey:   make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Name() string { return "memory" }
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.byKey[key]
+	if !ok {
+		return nil, s.gen, false
+	}
+	entry := element.Value.(*memoryEntry)
+	if !s.now().Before(entry.expires) {
+		s.remove(element)
+		return nil, s.gen, false
+	}
+	s.entries.MoveToFront(element)
+	return entry.value, s.gen, true
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, gen uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if gen != s.gen {
+		return nil
+	}
+
+	expires := s.now().Add(s.ttl)
+	if element, ok := s.byKey[key]; ok {
+		entry := element.Value.(*memoryEntry)
+		entry.value, entry.expires = value, expires
+		s.entries.MoveToFront(element)
+		return nil
+	}
+
+	s.byKey[key] = s.entries.PushFront(&memoryEntry{key: key, value: value, expires: expires})
+	for s.entries.Len() > s.size {
+		s.remove(s.entries.Back())
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, keys ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	for _, key := range keys {
+		if element, ok := s.byKey[key]; ok {
+			s.remove(element)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) remove(element *list.Element) {
+	s.entries.Remove(element)
+	delete(s.byKey, element.Value.(*memoryEntry).key)
+}
+
+// Clear drops every entry
+func (s *MemoryStore) Clear() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gen++
+	s.entries.Init()
+	clear(s.byKey)
+}
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisTimeout  = 2 * time.Second
+	redisKeySpace = "sudo:"
+	// redisGenKey counts deletes, so fills that raced one can be dropped
+	redisGenKey = redisKeySpace + "generation"
+)
+
+// RedisStore keeps entries in Redis, so every instance sees the same data and an
+// invalidation on one instance applies to all of them.
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// newRedisClient connects to redis://[user:password@]host[:port][/database] (or rediss://
+// for TLS) and pings the server, so a bad URL fails at startup rather than on the first
+// request
+func newRedisClient(rawURL string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL must look like redis://host:6379/0: %w", err)
+	}
+	opts.DialTimeout = redisTimeout
+	opts.ReadTimeout = redisTimeout
+	opts.WriteTimeout = redisTimeout
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return client, nil
+}
+
+// NewRedisStore connects to the Redis server at rawURL
+func NewRedisStore(rawURL string, ttl time.Duration) (*RedisStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client, ttl: ttl}, nil
+}
+
+func (s *RedisStore) Name() string { return "redis" }
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, uint64, bool) {
+	values, err := s.client.MGet(ctx, redisKeySpace+key, redisGenKey).Result()
+	if err != nil {
+		log.Printf("Cache GET %s failed: %v", key, err)
+		return nil, 0, false
+	}
+	var gen uint64
+	if raw, ok := values[1].(string); ok {
+		gen, _ = strconv.ParseUint(raw, 10, 64)
+	}
+	value, ok := values[0].(string)
+	if !ok {
+		return nil, gen, false
+	}
+	return []byte(value), gen, true
+}
+
+// setIfGen stores the value only while the generation is unchanged, atomically
+var setIfGen = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') ~= ARGV[2] then
+	return 0
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, gen uint64) error {
+	err := setIfGen.Run(ctx, s.client,
+		[]string{redisKeySpace + key, redisGenKey},
+		value, strconv.FormatUint(gen, 10), s.ttl.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("failed to set cache entry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the keys and advances the generation in one transaction
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = redisKeySpace + key
+	}
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, prefixed...)
+		pipe.Incr(ctx, redisGenKey)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete cache entries: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// invalidationChannel carries the keys one instance deleted, as a JSON array
+const invalidationChannel = redisKeySpace + "invalidate"
+
+// SyncedStore is an in-process LRU whose deletes are published over Redis pub/sub, so
+// every instance evicts the same keys. Entries are served only while the subscription is
+// up: until Run has subscribed, and from the moment it loses the connection until it has
+// resubscribed and emptied the local store, Get reports a miss and Set does nothing, as
+// invalidations from that window may have been missed.
+type SyncedStore struct {
+	local  *MemoryStore
+	client *redis.Client
+	live   atomic.Bool
+}
+
+// NewSyncedStore keeps size entries locally and exchanges invalidations through the Redis
+// server at rawURL
+func NewSyncedStore(rawURL string, size int, ttl time.Duration) (*SyncedStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &SyncedStore{local: NewMemoryStore(size, ttl), client: client}, nil
+}
+
+func (s *SyncedStore) Name() string { return "memory (invalidated over Redis)" }
+
+// Get and Set share the local generation, which remote invalidations advance too, so
+// a fill racing a write on another instance is dropped as well
+func (s *SyncedStore) Get(ctx context.Context, key string) ([]byte, uint64, bool) {
+	value, gen, ok := s.local.Get(ctx, key)
+	if !s.live.Load() {
+		return nil, gen, false
+	}
+	return value, gen, ok
+}
+
+func (s *SyncedStore) Set(ctx context.Context, key string, value []byte, gen uint64) error {
+	if !s.live.Load() {
+		return nil
+	}
+	return s.local.Set(ctx, key, value, gen)
+}
+
+// Delete evicts the keys here and tells the other instances to do the same
+func (s *SyncedStore) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_ = s.local.Delete(ctx, keys...)
+
+	payload, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode invalidation: %w", err)
+	}
+	if err := s.client.Publish(ctx, invalidationChannel, payload).Err(); err != nil {
+		return fmt.Errorf("failed to publish invalidation: %w", err)
+	}
+	return nil
+}
+
+// Run applies invalidations published by other instances until ctx is cancelled
+func (s *SyncedStore) Run(ctx context.Context) {
+	pubsub := s.client.Subscribe(ctx, invalidationChannel)
+	defer pubsub.Close()
+
+	for {
+		msg, err := pubsub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			// go-redis resubscribes on the next Receive; until then nothing is cached
+			if s.live.Swap(false) {
+				log.Printf("[CACHE] Lost the invalidation feed, bypassing the cache: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(redisTimeout):
+			}
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				// Whatever was published while unsubscribed is lost, so start empty
+				s.local.Clear()
+				s.live.Store(true)
+			}
+		case *redis.Message:
+			var keys []string
+			if err := json.Unmarshal([]byte(msg.Payload), &keys); err != nil {
+				// The keys are unknown, so drop everything
+				log.Printf("[CACHE] Malformed invalidation %q, clearing the cache: %v", msg.Payload, err)
+				s.local.Clear()
+				continue
+			}
+			_ = s.local.Delete(ctx, keys...)
+		}
+	}
+}
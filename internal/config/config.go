@@ -0,0 +1,502 @@
+// Package config loads the application settings into one validated struct that is handed
+// to every constructor. Values come from, in order of precedence: the environment, the
+// optional config file (--config or CONFIG_FILE), a .env file in the working directory,
+// and the defaults below. Both files hold KEY=VALUE lines named like the variables.
+// Secrets can also be read from a file named by <KEY>_FILE.
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvProduction  = "production"
+
+	// minSessionSecretLength is the shortest JWT_SECRET accepted in production
+	minSessionSecretLength = 32
+)
+
+// Config is the complete application configuration
+type Config struct {
+	Env             string        // APP_ENV: development or production
+	Port            string        // PORT
+	GinMode         string        // GIN_MODE: debug, release or test
+	LogLevel        string        // LOG_LEVEL: debug or info
+	ShutdownTimeout time.Duration // SHUTDOWN_TIMEOUT
+	// SessionSecret signs session cookies (JWT_SECRET). Development instances without
+	// one get a random secret, so sessions end when the server restarts.
+	SessionSecret  string
+	AllowedOrigins []string // ALLOWED_ORIGINS
+	AdminEmails    []string // ADMIN_EMAILS, lower-cased
+
+	Database    Database
+	Encryption  Encryption
+	Email       Email
+	Cache       Cache
+	Storage     Storage
+	Attachments Attachments
+	Inbound     Inbound
+	OIDC        OIDC
+	Tracing     Tracing
+
+	settings []Setting
+}
+
+// Database is the Supabase project the data lives in
+type Database struct {
+	SupabaseURL        string
+	SupabaseServiceKey string
+	// URL is a direct Postgres connection, used only by cmd/migrate
+	URL string
+}
+
+// Encryption holds the email encryption keys. PreviousKeys maps the versions of rotated
+// out keys to the keys, which stay readable until `keygen rotate` has finished.
+type Encryption struct {
+	MasterKey    string
+	KeyVersion   int
+	PreviousKeys map[int]string
+}
+
+// Email selects how outgoing mail is delivered. An empty Transport picks Resend when
+// ResendAPIKey is set, SMTP when SMTP credentials are set and the file sink otherwise.
+type Email struct {
+	Transport    string
+	FromName     string
+	FromEmail    string
+	ResendAPIKey string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+	SinkPath     string
+}
+
+// Cache configures the read-through cache. An empty Driver picks redis when RedisURL
+// is set and off otherwise. The memory driver publishes invalidations over RedisURL
+// when it is set.
+type Cache struct {
+	Driver   string
+	RedisURL string
+	TTL      time.Duration
+	Size     int
+}
+
+// Storage configures blob storage. An empty Driver picks s3 when S3.Bucket is set and
+// local otherwise.
+type Storage struct {
+	Driver string
+	Path   string
+	S3     S3
+}
+
+// S3 is an S3-compatible bucket
+type S3 struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	PathStyle       bool
+}
+
+// Attachments limits uploads, in megabytes
+type Attachments struct {
+	MaxFileSizeMB int
+	BoardQuotaMB  int
+}
+
+// Inbound configures inbound email; it is disabled when Domain is empty
+type Inbound struct {
+	Domain      string
+	Secret      string
+	SMTPAddr    string
+	RequireAuth bool
+	// AuthServID names the relay whose Authentication-Results header is trusted
+	AuthServID string
+	// SMTPAllowedNets are the peers the SMTP listener accepts connections from
+	SMTPAllowedNets []*net.IPNet
+}
+
+// OIDC lists the single sign-on providers in the order they are shown
+type OIDC struct {
+	Providers []OIDCProvider
+}
+
+// OIDCProvider is one OpenID Connect provider. Optional fields left empty get the
+// oidc package's defaults.
+type OIDCProvider struct {
+	Name           string
+	DisplayName    string
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	AllowedDomains []string
+}
+
+// Tracing configures OpenTelemetry tracing. Exporter is none, stdout or otlp; spans are
+// sent to Endpoint over OTLP/HTTP. SampleRatio is the share of new traces recorded,
+// requests that arrive with a traceparent continue the caller's trace but are sampled at
+// the same ratio, whatever the caller's sampled flag says.
+type Tracing struct {
+	Exporter    string
+	Endpoint    string
+	Headers     map[string]string
+	ServiceName string
+	SampleRatio float64
+}
+
+// Production reports whether APP_ENV is production
+func (c *Config) Production() bool {
+	return c.Env == EnvProduction
+}
+
+// Load reads the configuration. file is an optional KEY=VALUE file; when empty the
+// CONFIG_FILE variable names it. All problems are reported together.
+func Load(file string) (*Config, error) {
+	return load(file, os.LookupEnv)
+}
+
+func load(file string, env func(string) (string, bool)) (*Config, error) {
+	l := &loader{env: env, seen: make(map[string]bool)}
+
+	if file == "" {
+		file, _ = env("CONFIG_FILE")
+	}
+	if file != "" {
+		values, err := godotenv.Read(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		l.file = values
+	}
+	if values, err := godotenv.Read(".env"); err == nil {
+		l.dotenv = values
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read .env: %w", err)
+	}
+
+	cfg := &Config{
+		Env:             l.oneOf("APP_ENV", EnvDevelopment, EnvDevelopment, EnvProduction),
+		Port:            l.string("PORT", "8080"),
+		GinMode:         l.oneOf("GIN_MODE", "", "debug", "release", "test"),
+		LogLevel:        l.oneOf("LOG_LEVEL", "", "debug", "info"),
+		ShutdownTimeout: l.duration("SHUTDOWN_TIMEOUT", 20*time.Second),
+		SessionSecret:   l.secret("JWT_SECRET"),
+		AllowedOrigins:  l.list("ALLOWED_ORIGINS"),
+	}
+	for _, address := range l.list("ADMIN_EMAILS") {
+		cfg.AdminEmails = append(cfg.AdminEmails, strings.ToLower(address))
+	}
+
+	cfg.Database = Database{
+		SupabaseURL:        l.string("SUPABASE_URL", ""),
+		SupabaseServiceKey: l.secret("SUPABASE_SERVICE_KEY"),
+		URL:                l.secret("DATABASE_URL"),
+	}
+	cfg.Encryption = loadEncryption(l)
+	cfg.Email = Email{
+		Transport:    l.oneOf("EMAIL_TRANSPORT", "", "resend", "smtp", "file"),
+		FromName:     l.string("FROM_NAME", "SUDO Kanban Board"),
+		FromEmail:    l.string("FROM_EMAIL", "send@sudo-kanban.co.in"),
+		ResendAPIKey: l.secret("RESEND_API_KEY"),
+		SMTPHost:     l.string("SMTP_HOST", "smtp.gmail.com"),
+		SMTPPort:     l.string("SMTP_PORT", "465"),
+		SMTPUsername: l.string("SMTP_USERNAME", ""),
+		SMTPPassword: l.secret("SMTP_PASSWORD"),
+		SinkPath:     l.string("EMAIL_SINK_PATH", "logs/mail.mbox"),
+	}
+	cfg.Cache = Cache{
+		Driver:   l.oneOf("CACHE_DRIVER", "", "memory", "redis", "off"),
+		RedisURL: l.secret("REDIS_URL"),
+		TTL:      l.duration("CACHE_TTL", time.Minute),
+		Size:     l.int("CACHE_SIZE", 10000),
+	}
+	cfg.Storage = Storage{
+		Driver: l.oneOf("STORAGE_DRIVER", "", "local", "s3"),
+		Path:   l.string("STORAGE_PATH", "data/blobs"),
+		S3: S3{
+			Endpoint:        l.string("S3_ENDPOINT", "https://s3.amazonaws.com"),
+			Region:          l.string("S3_REGION", "us-east-1"),
+			Bucket:          l.string("S3_BUCKET", ""),
+			AccessKeyID:     l.string("S3_ACCESS_KEY_ID", ""),
+			SecretAccessKey: l.secret("S3_SECRET_ACCESS_KEY"),
+			PathStyle:       l.bool("S3_PATH_STYLE", true),
+		},
+	}
+	cfg.Attachments = Attachments{
+		MaxFileSizeMB: l.int("ATTACHMENT_MAX_SIZE_MB", 8),
+		BoardQuotaMB:  l.int("BOARD_STORAGE_QUOTA_MB", 500),
+	}
+	cfg.Inbound = Inbound{
+		Domain:      strings.ToLower(l.string("INBOUND_EMAIL_DOMAIN", "")),
+		Secret:      l.secret("INBOUND_EMAIL_SECRET"),
+		SMTPAddr:    l.string("INBOUND_SMTP_ADDR", ""),
+		RequireAuth: l.bool("INBOUND_EMAIL_REQUIRE_AUTH", true),
+		AuthServID:  strings.ToLower(l.string("INBOUND_EMAIL_AUTHSERV_ID", "")),
+	}
+	cfg.Inbound.SMTPAllowedNets = loadNets(l, "INBOUND_SMTP_ALLOWED_NETS", "127.0.0.1/32", "::1/128")
+	cfg.OIDC = loadOIDC(l)
+	cfg.Tracing = loadTracing(l)
+
+	cfg.validate(l)
+	if err := l.err(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+
+	if cfg.SessionSecret == "" {
+		log.Println("Warning: JWT_SECRET is not set, using a random secret; sessions end when the server restarts")
+		cfg.SessionSecret = randomSecret()
+	}
+	cfg.settings = l.settings
+	return cfg, nil
+}
+
+// ENCRYPTION_PREVIOUS_KEYS lists "version:base64key" pairs separated by commas
+func loadEncryption(l *loader) Encryption {
+	enc := Encryption{
+		MasterKey:    l.secret("ENCRYPTION_MASTER_KEY"),
+		KeyVersion:   l.int("ENCRYPTION_KEY_VERSION", 1),
+		PreviousKeys: make(map[int]string),
+	}
+
+	for _, entry := range strings.Split(l.secret("ENCRYPTION_PREVIOUS_KEYS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		versionStr, key, ok := strings.Cut(entry, ":")
+		if !ok {
+			l.errorf("ENCRYPTION_PREVIOUS_KEYS entries must look like version:key")
+			continue
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil || version < 1 {
+			l.errorf("ENCRYPTION_PREVIOUS_KEYS: invalid key version %q", versionStr)
+			continue
+		}
+		if version == enc.KeyVersion {
+			l.errorf("ENCRYPTION_PREVIOUS_KEYS: version %d clashes with ENCRYPTION_KEY_VERSION", version)
+			continue
+		}
+		if err := checkKey(key); err != nil {
+			l.errorf("ENCRYPTION_PREVIOUS_KEYS: key version %d %v", version, err)
+			continue
+		}
+		enc.PreviousKeys[version] = key
+	}
+	return enc
+}
+
+// loadNets reads a list of CIDR blocks, falling back to defaults when key is not set
+func loadNets(l *loader, key string, defaults ...string) []*net.IPNet {
+	cidrs := l.list(key)
+	if len(cidrs) == 0 {
+		cidrs = defaults
+	}
+
+	var nets []*net.IPNet
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			l.errorf("%s: %q is not a CIDR block", key, cidr)
+			continue
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+// loadOIDC reads OIDC_PROVIDERS and the OIDC_<NAME>_* variables of each provider.
+// OIDC_ALLOWED_DOMAINS applies to providers without their own list.
+func loadOIDC(l *loader) OIDC {
+	var cfg OIDC
+	globalDomains := l.list("OIDC_ALLOWED_DOMAINS")
+	seen := make(map[string]bool)
+
+	for _, name := range l.list("OIDC_PROVIDERS") {
+		name = strings.ToLower(name)
+		if seen[name] {
+			l.errorf("OIDC provider %q is configured twice", name)
+			continue
+		}
+		seen[name] = true
+
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		p := OIDCProvider{
+			Name:           name,
+			DisplayName:    l.string(prefix+"DISPLAY_NAME", ""),
+			Issuer:         strings.TrimSuffix(l.string(prefix+"ISSUER", ""), "/"),
+			ClientID:       l.string(prefix+"CLIENT_ID", ""),
+			ClientSecret:   l.secret(prefix + "CLIENT_SECRET"),
+			RedirectURL:    l.string(prefix+"REDIRECT_URL", ""),
+			Scopes:         l.list(prefix + "SCOPES"),
+			AllowedDomains: l.list(prefix + "ALLOWED_DOMAINS"),
+		}
+		if p.Issuer == "" || p.ClientID == "" {
+			l.errorf("OIDC provider %q requires %sISSUER and %sCLIENT_ID", name, prefix, prefix)
+		}
+		if len(p.AllowedDomains) == 0 {
+			p.AllowedDomains = globalDomains
+		}
+		cfg.Providers = append(cfg.Providers, p)
+	}
+	return cfg
+}
+
+// loadTracing reads the OTEL_* variables. OTEL_EXPORTER_OTLP_HEADERS lists
+// "name=value" pairs separated by commas, as other OpenTelemetry exporters expect.
+func loadTracing(l *loader) Tracing {
+	cfg := Tracing{
+		Exporter:    l.oneOf("OTEL_TRACES_EXPORTER", "none", "none", "stdout", "otlp"),
+		Endpoint:    strings.TrimSuffix(l.string("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"), "/"),
+		Headers:     make(map[string]string),
+		ServiceName: l.string("OTEL_SERVICE_NAME", "sudo"),
+		SampleRatio: l.float("OTEL_TRACES_SAMPLER_ARG", 1),
+	}
+
+	for _, entry := range strings.Split(l.secret("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(name) == "" {
+			l.errorf("OTEL_EXPORTER_OTLP_HEADERS entries must look like name=value")
+			continue
+		}
+		cfg.Headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return cfg
+}
+
+// validate checks the values that depend on each other
+func (c *Config) validate(l *loader) {
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		l.errorf("PORT must be a port number, got %q", c.Port)
+	}
+
+	switch {
+	case c.SessionSecret == "" && c.Production():
+		l.errorf("JWT_SECRET must be set in production")
+	case c.SessionSecret != "" && c.Production() && len(c.SessionSecret) < minSessionSecretLength:
+		l.errorf("JWT_SECRET must be at least %d characters in production", minSessionSecretLength)
+	}
+
+	if c.Database.SupabaseURL == "" || c.Database.SupabaseServiceKey == "" {
+		l.errorf("SUPABASE_URL and SUPABASE_SERVICE_KEY must be set")
+	} else if u, err := url.Parse(c.Database.SupabaseURL); err != nil || u.Host == "" ||
+		(u.Scheme != "http" && u.Scheme != "https") {
+		l.errorf("SUPABASE_URL must be an http(s) URL, got %q", c.Database.SupabaseURL)
+	}
+
+	if c.Encryption.MasterKey == "" {
+		l.errorf("ENCRYPTION_MASTER_KEY must be set (generate one with `go run cmd/keygen/main.go`)")
+	} else if err := checkKey(c.Encryption.MasterKey); err != nil {
+		l.errorf("ENCRYPTION_MASTER_KEY %v", err)
+	}
+	if c.Encryption.KeyVersion < 1 {
+		l.errorf("ENCRYPTION_KEY_VERSION must be a positive integer, got %d", c.Encryption.KeyVersion)
+	}
+
+	if port, err := strconv.Atoi(c.Email.SMTPPort); err != nil || port < 1 || port > 65535 {
+		l.errorf("SMTP_PORT must be a port number, got %q", c.Email.SMTPPort)
+	}
+	if c.Email.Transport == "resend" && c.Email.ResendAPIKey == "" {
+		l.errorf("EMAIL_TRANSPORT=resend requires RESEND_API_KEY")
+	}
+
+	if c.Cache.Size <= 0 {
+		l.errorf("CACHE_SIZE must be a positive integer, got %d", c.Cache.Size)
+	}
+	if c.Cache.Driver == "redis" && c.Cache.RedisURL == "" {
+		l.errorf("CACHE_DRIVER=redis requires REDIS_URL")
+	}
+
+	if c.Storage.Driver == "s3" || (c.Storage.Driver == "" && c.Storage.S3.Bucket != "") {
+		if c.Storage.S3.Bucket == "" || c.Storage.S3.AccessKeyID == "" || c.Storage.S3.SecretAccessKey == "" {
+			l.errorf("S3 storage requires S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY")
+		}
+	}
+
+	if c.Attachments.MaxFileSizeMB <= 0 {
+		l.errorf("ATTACHMENT_MAX_SIZE_MB must be a positive integer, got %d", c.Attachments.MaxFileSizeMB)
+	}
+	if c.Attachments.BoardQuotaMB <= 0 {
+		l.errorf("BOARD_STORAGE_QUOTA_MB must be a positive integer, got %d", c.Attachments.BoardQuotaMB)
+	}
+
+	if c.Inbound.Domain != "" && c.Inbound.RequireAuth && c.Inbound.AuthServID == "" {
+		l.errorf("INBOUND_EMAIL_AUTHSERV_ID must name the relay that adds Authentication-Results " +
+			"(or set INBOUND_EMAIL_REQUIRE_AUTH=false)")
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		l.errorf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+	}
+	if c.Tracing.Exporter == "otlp" {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https") {
+			l.errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an http(s) URL, got %q", c.Tracing.Endpoint)
+		}
+	}
+}
+
+// checkKey reports whether key is a base64 encoded 32 byte key
+func checkKey(key string) error {
+	decoded, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return fmt.Errorf("is not valid base64")
+	}
+	if len(decoded) != 32 {
+		return fmt.Errorf("must decode to 32 bytes, got %d", len(decoded))
+	}
+	return nil
+}
+
+func randomSecret() string {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("failed to generate session secret: %v", err))
+	}
+	return base64.StdEncoding.EncodeToString(secret)
+}
+
+// Settings returns every value that was read, sorted by key
+func (c *Config) Settings() []Setting {
+	settings := append([]Setting(nil), c.settings...)
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Key < settings[j].Key })
+	return settings
+}
+
+// Print writes the configuration as KEY=VALUE lines with the source of each value.
+// Secrets are replaced by <redacted>, so the output is safe to paste into an issue.
+func (c *Config) Print(w io.Writer) error {
+	for _, setting := range c.Settings() {
+		value := setting.Value
+		if setting.Secret && value != "" {
+			value = "<redacted>"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s # %s\n", setting.Key, value, setting.Source); err != nil {
+			return err
+		}
+	}
+	return nil
+}
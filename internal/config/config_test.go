@@ -0,0 +1,172 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testKey = "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="
+
+func envFrom(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "sudo.env")
+	secretFile := filepath.Join(dir, "jwt_secret")
+	if err := os.WriteFile(file, []byte("PORT=9000\nCACHE_TTL=5m\nSMTP_HOST=mail.example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secretFile, []byte("a-session-secret-that-is-long-enough-for-prod\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := load(file, envFrom(map[string]string{
+		"APP_ENV":                    "Production",
+		"PORT":                       "8081",
+		"JWT_SECRET_FILE":            secretFile,
+		"SUPABASE_URL":               "https://project.supabase.co",
+		"SUPABASE_SERVICE_KEY":       "service-key",
+		"ENCRYPTION_MASTER_KEY":      testKey,
+		"ENCRYPTION_KEY_VERSION":     "2",
+		"ENCRYPTION_PREVIOUS_KEYS":   "1:" + testKey,
+		"ADMIN_EMAILS":               "Ada@Example.com, grace@example.com",
+		"OIDC_PROVIDERS":             "okta",
+		"OIDC_OKTA_ISSUER":           "https://okta.example.com/",
+		"OIDC_OKTA_CLIENT_ID":        "client",
+		"OIDC_OKTA_SCOPES":           "openid email",
+		"OIDC_ALLOWED_DOMAINS":       "example.com",
+		"OTEL_TRACES_EXPORTER":       "OTLP",
+		"OTEL_TRACES_SAMPLER_ARG":    "0.25",
+		"OTEL_EXPORTER_OTLP_HEADERS": "Authorization=Bearer abc, X-Tenant=sudo",
+		"INBOUND_EMAIL_DOMAIN":       "Tasks.Example.com",
+		"INBOUND_EMAIL_AUTHSERV_ID":  "MX.Example.com",
+		"INBOUND_SMTP_ALLOWED_NETS":  "10.0.0.0/8, 192.168.1.5/32",
+	}))
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if !cfg.Production() || cfg.Port != "8081" || cfg.Cache.TTL != 5*time.Minute || cfg.Email.SMTPHost != "mail.example.com" {
+		t.Errorf("environment should win over the file and the file over defaults: %+v", cfg)
+	}
+	if cfg.SessionSecret != "a-session-secret-that-is-long-enough-for-prod" {
+		t.Errorf("JWT_SECRET_FILE was not read: %q", cfg.SessionSecret)
+	}
+	if cfg.Attachments.MaxFileSizeMB != 8 || cfg.ShutdownTimeout != 20*time.Second || cfg.Email.SinkPath != "logs/mail.mbox" {
+		t.Errorf("defaults not applied: %+v", cfg)
+	}
+	if cfg.Encryption.KeyVersion != 2 || cfg.Encryption.PreviousKeys[1] != testKey {
+		t.Errorf("encryption = %+v", cfg.Encryption)
+	}
+	if len(cfg.AdminEmails) != 2 || cfg.AdminEmails[0] != "ada@example.com" {
+		t.Errorf("admin emails = %v", cfg.AdminEmails)
+	}
+	if len(cfg.OIDC.Providers) != 1 {
+		t.Fatalf("providers = %+v", cfg.OIDC.Providers)
+	}
+	okta := cfg.OIDC.Providers[0]
+	if okta.Issuer != "https://okta.example.com" || len(okta.Scopes) != 2 || okta.AllowedDomains[0] != "example.com" {
+		t.Errorf("okta = %+v", okta)
+	}
+
+	if cfg.Tracing.Exporter != "otlp" || cfg.Tracing.SampleRatio != 0.25 || cfg.Tracing.Endpoint != "http://localhost:4318" ||
+		cfg.Tracing.Headers["Authorization"] != "Bearer abc" || cfg.Tracing.Headers["X-Tenant"] != "sudo" {
+		t.Errorf("tracing = %+v", cfg.Tracing)
+	}
+
+	if in := cfg.Inbound; in.Domain != "tasks.example.com" || !in.RequireAuth || in.AuthServID != "mx.example.com" ||
+		len(in.SMTPAllowedNets) != 2 || in.SMTPAllowedNets[0].String() != "10.0.0.0/8" {
+		t.Errorf("inbound = %+v", in)
+	}
+
+	var out bytes.Buffer
+	if err := cfg.Print(&out); err != nil {
+		t.Fatalf("Print failed: %v", err)
+	}
+	printed := out.String()
+	for _, want := range []string{
+		"JWT_SECRET=<redacted> # env (JWT_SECRET_FILE)",
+		"PORT=8081 # env",
+		"CACHE_TTL=5m # file",
+		"STORAGE_PATH=data/blobs # default",
+		"SUPABASE_SERVICE_KEY=<redacted> # env",
+	} {
+		if !strings.Contains(printed, want) {
+			t.Errorf("printed config does not contain %q:\n%s", want, printed)
+		}
+	}
+	for _, secret := range []string{"service-key", testKey, "long-enough", "Bearer abc"} {
+		if strings.Contains(printed, secret) {
+			t.Errorf("printed config leaks %q", secret)
+		}
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	_, err := load("", envFrom(map[string]string{
+		"APP_ENV":                   "production",
+		"PORT":                      "http",
+		"SUPABASE_URL":              "https://project.supabase.co",
+		"ENCRYPTION_MASTER_KEY":     "short",
+		"CACHE_TTL":                 "soon",
+		"STORAGE_DRIVER":            "ftp",
+		"RESEND_API_KEY":            "key",
+		"RESEND_API_KEY_FILE":       "/run/secrets/resend",
+		"OIDC_PROVIDERS":            "okta",
+		"BOARD_STORAGE_QUOTA_MB":    "0",
+		"OTEL_TRACES_SAMPLER_ARG":   "2",
+		"INBOUND_EMAIL_DOMAIN":      "tasks.example.com",
+		"INBOUND_SMTP_ALLOWED_NETS": "10.0.0.1",
+	}))
+	if err == nil {
+		t.Fatal("Load accepted an invalid configuration")
+	}
+
+	for _, want := range []string{
+		"PORT must be a port number",
+		"JWT_SECRET must be set in production",
+		"SUPABASE_URL and SUPABASE_SERVICE_KEY must be set",
+		"ENCRYPTION_MASTER_KEY is not valid base64",
+		"CACHE_TTL must be a positive duration",
+		"STORAGE_DRIVER must be one of local, s3",
+		"RESEND_API_KEY and RESEND_API_KEY_FILE are both set",
+		`OIDC provider "okta" requires OIDC_OKTA_ISSUER`,
+		"BOARD_STORAGE_QUOTA_MB must be a positive integer",
+		"OTEL_TRACES_SAMPLER_ARG must be between 0 and 1",
+		"INBOUND_EMAIL_AUTHSERV_ID must name the relay",
+		`INBOUND_SMTP_ALLOWED_NETS: "10.0.0.1" is not a CIDR block`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadDevelopmentSessionSecret(t *testing.T) {
+	env := envFrom(map[string]string{
+		"SUPABASE_URL":          "http://localhost:54321",
+		"SUPABASE_SERVICE_KEY":  "service-key",
+		"ENCRYPTION_MASTER_KEY": testKey,
+	})
+	first, err := load("", env)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	second, err := load("", env)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if first.Production() || len(first.SessionSecret) < minSessionSecretLength || first.SessionSecret == second.SessionSecret {
+		t.Errorf("development without JWT_SECRET should get a random secret, got %q and %q",
+			first.SessionSecret, second.SessionSecret)
+	}
+}
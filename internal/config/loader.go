@@ -0,0 +1,167 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources, in the order they are consulted
+const (
+	SourceEnv     = "env"
+	SourceFile    = "file"
+	SourceDotEnv  = ".env"
+	SourceDefault = "default"
+)
+
+// Setting is one configuration value as it was resolved, for --print-config
+type Setting struct {
+	Key    string
+	Value  string
+	Source string
+	Secret bool
+}
+
+// loader reads typed values from the environment and the config files, recording every
+// key it resolves and collecting every problem instead of stopping at the first one
+type loader struct {
+	env      func(string) (string, bool)
+	file     map[string]string
+	dotenv   map[string]string
+	settings []Setting
+	seen     map[string]bool
+	errs     []error
+}
+
+func (l *loader) errorf(format string, args ...interface{}) {
+	l.errs = append(l.errs, fmt.Errorf(format, args...))
+}
+
+func (l *loader) err() error {
+	return errors.Join(l.errs...)
+}
+
+// lookup returns the raw value of key and where it came from; empty values count as unset
+func (l *loader) lookup(key string) (string, string) {
+	if value, ok := l.env(key); ok && value != "" {
+		return value, SourceEnv
+	}
+	if value := l.file[key]; value != "" {
+		return value, SourceFile
+	}
+	if value := l.dotenv[key]; value != "" {
+		return value, SourceDotEnv
+	}
+	return "", ""
+}
+
+func (l *loader) record(key, value, source string, secret bool) {
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	if source == "" {
+		source = SourceDefault
+	}
+	l.settings = append(l.settings, Setting{Key: key, Value: value, Source: source, Secret: secret})
+}
+
+func (l *loader) string(key, defaultValue string) string {
+	value, source := l.lookup(key)
+	value = strings.TrimSpace(value)
+	if value == "" {
+		value = defaultValue
+	}
+	l.record(key, value, source, false)
+	return value
+}
+
+// secret reads key, or the contents of the file named by key_FILE, which is how Docker
+// and Kubernetes secrets are mounted. Setting both is an error.
+func (l *loader) secret(key string) string {
+	value, source := l.lookup(key)
+	path, fileSource := l.lookup(key + "_FILE")
+	switch {
+	case path != "" && value != "":
+		l.errorf("%s and %s_FILE are both set; use one", key, key)
+	case path != "":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			l.errorf("%s_FILE: %v", key, err)
+			break
+		}
+		value = strings.TrimRight(string(data), "\r\n")
+		if value == "" {
+			l.errorf("%s_FILE: %s is empty", key, path)
+		}
+		source = fileSource + " (" + key + "_FILE)"
+	}
+	l.record(key, value, source, true)
+	return value
+}
+
+func (l *loader) int(key string, defaultValue int) int {
+	raw := l.string(key, strconv.Itoa(defaultValue))
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		l.errorf("%s must be an integer, got %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
+
+func (l *loader) float(key string, defaultValue float64) float64 {
+	raw := l.string(key, strconv.FormatFloat(defaultValue, 'g', -1, 64))
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		l.errorf("%s must be a number, got %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
+
+func (l *loader) bool(key string, defaultValue bool) bool {
+	raw := l.string(key, strconv.FormatBool(defaultValue))
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		l.errorf("%s must be true or false, got %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
+
+func (l *loader) duration(key string, defaultValue time.Duration) time.Duration {
+	raw := l.string(key, defaultValue.String())
+	value, err := time.ParseDuration(raw)
+	if err != nil || value <= 0 {
+		l.errorf("%s must be a positive duration such as 30s or 5m, got %q", key, raw)
+		return defaultValue
+	}
+	return value
+}
+
+// list reads a comma or space separated value
+func (l *loader) list(key string) []string {
+	return strings.FieldsFunc(l.string(key, ""), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// oneOf reads a lower-cased value that must be one of allowed; "" is allowed when it is
+// the default
+func (l *loader) oneOf(key, defaultValue string, allowed ...string) string {
+	value := strings.ToLower(l.string(key, defaultValue))
+	if value == defaultValue {
+		return value
+	}
+	for _, candidate := range allowed {
+		if value == candidate {
+			return value
+		}
+	}
+	l.errorf("%s must be one of %s, got %q", key, strings.Join(allowed, ", "), value)
+	return defaultValue
+}
@@ -0,0 +1,393 @@
+package customfields
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxFields     = 50
+	maxOptions    = 50
+	maxNameLength = 100
+	maxTextLength = 1000
+	maxURLLength  = 2000
+	dateLayout    = "2006-01-02"
+)
+
+// ErrInvalid wraps every validation error, so handlers can answer 400
+var ErrInvalid = errors.New("invalid custom field")
+
+// MemberCheck reports whether a user can be picked in a user field
+type MemberCheck func(userID uuid.UUID) bool
+
+// ValidateDefinitions checks and normalises a board's field definitions. Fields without an ID
+// are new and get one.
+func ValidateDefinitions(fields []models.CustomField) ([]models.CustomField, error) {
+	if len(fields) > MaxFields {
+		return nil, fmt.Errorf("%w: at most %d fields per board", ErrInvalid, MaxFields)
+	}
+
+	seen := make(map[string]bool)
+	names := make(map[string]bool)
+	result := make([]models.CustomField, 0, len(fields))
+	for _, field := range fields {
+		field.Name = strings.TrimSpace(field.Name)
+		if field.Name == "" || len(field.Name) > maxNameLength {
+			return nil, fmt.Errorf("%w: names must be 1-%d characters", ErrInvalid, maxNameLength)
+		}
+		if names[strings.ToLower(field.Name)] {
+			return nil, fmt.Errorf("%w: duplicate field name %q", ErrInvalid, field.Name)
+		}
+		names[strings.ToLower(field.Name)] = true
+
+		if field.ID == "" {
+			field.ID = uuid.New().String()
+		}
+		if seen[field.ID] {
+			return nil, fmt.Errorf("%w: duplicate field ID %s", ErrInvalid, field.ID)
+		}
+		seen[field.ID] = true
+
+		switch field.Type {
+		case models.CustomFieldSelect, models.CustomFieldMultiSelect:
+			options, err := normaliseOptions(field.Options)
+			if err != nil {
+				return nil, fmt.Errorf("%w: field %q: %v", ErrInvalid, field.Name, err)
+			}
+			field.Options = options
+		case models.CustomFieldText, models.CustomFieldNumber, models.CustomFieldDate,
+			models.CustomFieldUser, models.CustomFieldCheckbox, models.CustomFieldURL:
+			field.Options = nil
+		default:
+			return nil, fmt.Errorf("%w: unknown field type %q", ErrInvalid, field.Type)
+		}
+
+		result = append(result, field)
+	}
+
+	return result, nil
+}
+
+func normaliseOptions(options []string) ([]string, error) {
+	if len(options) == 0 || len(options) > maxOptions {
+		return nil, fmt.Errorf("select fields need 1-%d options", maxOptions)
+	}
+	seen := make(map[string]bool)
+	result := make([]string, 0, len(options))
+	for _, option := range options {
+		option = strings.TrimSpace(option)
+		if option == "" || len(option) > maxNameLength {
+			return nil, fmt.Errorf("options must be 1-%d characters", maxNameLength)
+		}
+		if seen[option] {
+			return nil, fmt.Errorf("duplicate option %q", option)
+		}
+		seen[option] = true
+		result = append(result, option)
+	}
+	return result, nil
+}
+
+// Validate checks values (keyed by field ID) against the definitions and returns them
+// normalised. A nil or empty value clears the field and is returned as nil.
+func Validate(fields []models.CustomField, values map[string]interface{}, isMember MemberCheck) (map[string]interface{}, error) {
+	byID := make(map[string]models.CustomField, len(fields))
+	for _, field := range fields {
+		byID[field.ID] = field
+	}
+
+	result := make(map[string]interface{}, len(values))
+	for id, value := range values {
+		field, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %s", ErrInvalid, id)
+		}
+
+		normalised, err := validateValue(field, value, isMember)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalid, field.Name, err)
+		}
+		result[id] = normalised
+	}
+
+	return result, nil
+}
+
+func validateValue(field models.CustomField, value interface{}, isMember MemberCheck) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	if s, ok := value.(string); ok {
+		value = strings.TrimSpace(s)
+		if value == "" && field.Type != models.CustomFieldCheckbox {
+			return nil, nil
+		}
+	}
+
+	switch field.Type {
+	case models.CustomFieldText:
+		text, ok := value.(string)
+		if !ok || len(text) > maxTextLength {
+			return nil, fmt.Errorf("must be text of at most %d characters", maxTextLength)
+		}
+		return text, nil
+
+	case models.CustomFieldNumber:
+		switch v := value.(type) {
+		case float64:
+			return v, nil
+		case string:
+			number, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("must be a number")
+			}
+			return number, nil
+		}
+		return nil, fmt.Errorf("must be a number")
+
+	case models.CustomFieldDate:
+		date, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+		if _, err := time.Parse(dateLayout, date); err != nil {
+			return nil, fmt.Errorf("must be a date (YYYY-MM-DD)")
+		}
+		return date, nil
+
+	case models.CustomFieldSelect:
+		option, ok := value.(string)
+		if !ok || !contains(field.Options, option) {
+			return nil, fmt.Errorf("must be one of %s", strings.Join(field.Options, ", "))
+		}
+		return option, nil
+
+	case models.CustomFieldMultiSelect:
+		var selected []string
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				option, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("must be a list of options")
+				}
+				selected = append(selected, option)
+			}
+		case []string:
+			selected = v
+		case string:
+			selected = strings.Split(v, ",")
+		default:
+			return nil, fmt.Errorf("must be a list of options")
+		}
+
+		// Keep the definition's order and drop duplicates
+		chosen := make(map[string]bool)
+		for _, option := range selected {
+			option = strings.TrimSpace(option)
+			if !contains(field.Options, option) {
+				return nil, fmt.Errorf("%q is not an option", option)
+			}
+			chosen[option] = true
+		}
+		result := make([]interface{}, 0, len(chosen))
+		for _, option := range field.Options {
+			if chosen[option] {
+				result = append(result, option)
+			}
+		}
+		if len(result) == 0 {
+			return nil, nil
+		}
+		return result, nil
+
+	case models.CustomFieldUser:
+		idStr, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a user ID")
+		}
+		userID, err := uuid.Parse(idStr)
+		if err != nil {
+			return nil, fmt.Errorf("must be a user ID")
+		}
+		if isMember == nil || !isMember(userID) {
+			return nil, fmt.Errorf("user is not a board member")
+		}
+		return userID.String(), nil
+
+	case models.CustomFieldCheckbox:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			switch strings.ToLower(v) {
+			case "true", "on", "1":
+				return true, nil
+			case "false", "off", "0", "":
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("must be true or false")
+
+	case models.CustomFieldURL:
+		link, ok := value.(string)
+		if !ok || len(link) > maxURLLength {
+			return nil, fmt.Errorf("must be a URL")
+		}
+		parsed, err := url.Parse(link)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("must be an http(s) URL")
+		}
+		return link, nil
+	}
+
+	return nil, fmt.Errorf("unknown field type %q", field.Type)
+}
+
+// Merge applies validated updates to a task's current values. Cleared fields and values of
+// fields that no longer exist on the board are dropped.
+func Merge(fields []models.CustomField, current, updates map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for _, field := range fields {
+		value, updated := updates[field.ID]
+		if !updated {
+			value = current[field.ID]
+		}
+		if value != nil {
+			merged[field.ID] = value
+		}
+	}
+	return merged
+}
+
+// Format renders a stored value as text, e.g. for search and export. userNames maps user
+// IDs to display names; unknown users are shown by ID.
+func Format(field models.CustomField, value interface{}, userNames map[string]string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "Yes"
+		}
+		return "No"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ", ")
+	case string:
+		if field.Type == models.CustomFieldUser {
+			if name, ok := userNames[v]; ok {
+				return name
+			}
+		}
+		return v
+	}
+	return fmt.Sprint(value)
+}
+
+// Matches reports whether a stored value satisfies a search filter. Text and URL fields match
+// substrings; numbers and dates also accept a "min..max" range (either end may be empty);
+// multi-select fields match when the option is selected.
+func Matches(field models.CustomField, value interface{}, filter string) bool {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return true
+	}
+	if value == nil {
+		return false
+	}
+
+	switch field.Type {
+	case models.CustomFieldText, models.CustomFieldURL:
+		return strings.Contains(strings.ToLower(fmt.Sprint(value)), strings.ToLower(filter))
+
+	case models.CustomFieldNumber:
+		number, ok := value.(float64)
+		if !ok {
+			return false
+		}
+		if low, high, isRange := strings.Cut(filter, ".."); isRange {
+			if min, err := strconv.ParseFloat(low, 64); low != "" && (err != nil || number < min) {
+				return false
+			}
+			if max, err := strconv.ParseFloat(high, 64); high != "" && (err != nil || number > max) {
+				return false
+			}
+			return true
+		}
+		want, err := strconv.ParseFloat(filter, 64)
+		return err == nil && number == want
+
+	case models.CustomFieldDate:
+		date, _ := value.(string)
+		// ISO dates compare correctly as strings
+		if low, high, isRange := strings.Cut(filter, ".."); isRange {
+			return (low == "" || date >= low) && (high == "" || date <= high)
+		}
+		return date == filter
+
+	case models.CustomFieldMultiSelect:
+		items, _ := value.([]interface{})
+		for _, item := range items {
+			if strings.EqualFold(fmt.Sprint(item), filter) {
+				return true
+			}
+		}
+		return false
+
+	case models.CustomFieldCheckbox:
+		checked, _ := value.(bool)
+		return strconv.FormatBool(checked) == strings.ToLower(filter)
+	}
+
+	return strings.EqualFold(fmt.Sprint(value), filter)
+}
+
+// Find looks a field up by ID, or else by case-insensitive name
+func Find(fields []models.CustomField, key string) (models.CustomField, bool) {
+	for _, field := range fields {
+		if field.ID == key {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(field.Name, key) {
+			return field, true
+		}
+	}
+	return models.CustomField{}, false
+}
+
+// MatchFilters reports whether values satisfy every filter, keyed by field ID or name.
+// Filters on fields the board doesn't define never match.
+func MatchFilters(fields []models.CustomField, values map[string]interface{}, filters map[string]string) bool {
+	for key, filter := range filters {
+		field, ok := Find(fields, key)
+		if !ok || !Matches(field, values[field.ID], filter) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,121 @@
+package customfields
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func testFields(t *testing.T) []models.CustomField {
+	t.Helper()
+	fields, err := ValidateDefinitions([]models.CustomField{
+		{ID: "points", Name: "Points", Type: models.CustomFieldNumber},
+		{ID: "area", Name: "Area", Type: models.CustomFieldMultiSelect, Options: []string{"api", " ui ", "db"}},
+		{ID: "owner", Name: "Owner", Type: models.CustomFieldUser},
+		{ID: "due", Name: "Review", Type: models.CustomFieldDate},
+		{Name: "Link", Type: models.CustomFieldURL},
+	})
+	if err != nil {
+		t.Fatalf("ValidateDefinitions failed: %v", err)
+	}
+	return fields
+}
+
+func TestValidateDefinitions(t *testing.T) {
+	fields := testFields(t)
+	if fields[4].ID == "" {
+		t.Error("new field did not get an ID")
+	}
+	if !reflect.DeepEqual(fields[1].Options, []string{"api", "ui", "db"}) {
+		t.Errorf("options = %v", fields[1].Options)
+	}
+
+	for _, invalid := range [][]models.CustomField{
+		{{Name: "", Type: models.CustomFieldText}},
+		{{Name: "A", Type: "colour"}},
+		{{Name: "A", Type: models.CustomFieldSelect}},
+		{{Name: "A", Type: models.CustomFieldText}, {Name: "a", Type: models.CustomFieldNumber}},
+		{{Name: "A", Type: models.CustomFieldSelect, Options: []string{"x", "x"}}},
+	} {
+		if _, err := ValidateDefinitions(invalid); !errors.Is(err, ErrInvalid) {
+			t.Errorf("ValidateDefinitions(%v) = %v, want ErrInvalid", invalid, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fields := testFields(t)
+	member := uuid.New()
+	isMember := func(id uuid.UUID) bool { return id == member }
+
+	values, err := Validate(fields, map[string]interface{}{
+		"points": "3.5",
+		"area":   []interface{}{"db", "api", "db"},
+		"owner":  member.String(),
+		"due":    "",
+	}, isMember)
+	if err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	want := map[string]interface{}{
+		"points": 3.5,
+		"area":   []interface{}{"api", "db"},
+		"owner":  member.String(),
+		"due":    nil,
+	}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("Validate = %v, want %v", values, want)
+	}
+
+	merged := Merge(fields, map[string]interface{}{"due": "2025-03-01", "gone": "x"}, values)
+	if _, ok := merged["due"]; ok {
+		t.Error("cleared field was kept")
+	}
+	if _, ok := merged["gone"]; ok {
+		t.Error("value of a deleted field was kept")
+	}
+
+	for _, invalid := range []map[string]interface{}{
+		{"points": "many"},
+		{"area": []interface{}{"mobile"}},
+		{"owner": uuid.New().String()},
+		{"due": "03/01/2025"},
+		{fields[4].ID: "javascript:alert(1)"},
+		{"unknown": "x"},
+	} {
+		if _, err := Validate(fields, invalid, isMember); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Validate(%v) = %v, want ErrInvalid", invalid, err)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	number := models.CustomField{Type: models.CustomFieldNumber}
+	date := models.CustomField{Type: models.CustomFieldDate}
+	multi := models.CustomField{Type: models.CustomFieldMultiSelect}
+
+	tests := []struct {
+		field  models.CustomField
+		value  interface{}
+		filter string
+		want   bool
+	}{
+		{number, 5.0, "5", true},
+		{number, 5.0, "1..5", true},
+		{number, 5.0, "6..", false},
+		{number, nil, "5", false},
+		{date, "2025-03-10", "2025-03-01..2025-03-31", true},
+		{date, "2025-04-01", "..2025-03-31", false},
+		{multi, []interface{}{"api", "db"}, "DB", true},
+		{multi, []interface{}{"api"}, "ui", false},
+	}
+	for _, tt := range tests {
+		if got := Matches(tt.field, tt.value, tt.filter); got != tt.want {
+			t.Errorf("Matches(%s, %v, %q) = %v, want %v", tt.field.Type, tt.value, tt.filter, got, tt.want)
+		}
+	}
+}
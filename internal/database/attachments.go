@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+var (
+	// ErrAttachmentNotFound means the task or the attachment on it does not exist
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	// ErrAttachmentLimit means the task already has the maximum number of attachments
+	ErrAttachmentLimit = errors.New("task has too many attachments")
+)
+
+// attachmentRPCError maps the errors raised by the attachment functions
+func attachmentRPCError(name string, err error) error {
+	var rpcErr *RPCError
+	if errors.As(err, &rpcErr) {
+		switch rpcErr.Code {
+		case "P0002": // no_data_found
+			return ErrAttachmentNotFound
+		case "23514": // check_violation
+			return ErrAttachmentLimit
+		}
+	}
+	return fmt.Errorf("failed to %s: %w", name, err)
+}
+
+// AppendTaskAttachment adds an attachment to a task in one statement, so concurrent
+// uploads cannot drop each other's entry. It fails with ErrAttachmentLimit when the
+// task already has max attachments.
+func (db *DB) AppendTaskAttachment(ctx context.Context, taskID uuid.UUID, attachment models.Attachment, max int) error {
+	ctx, span := startSpan(ctx, "AppendTaskAttachment")
+	defer span.End()
+
+	err := db.rpc("append_task_attachment", map[string]interface{}{
+		"p_task_id":         taskID.String(),
+		"p_attachment":      attachment,
+		"p_max_attachments": max,
+	}, nil)
+	if err != nil {
+		return attachmentRPCError("add attachment", err)
+	}
+	return nil
+}
+
+// ReplaceTaskAttachment overwrites the attachment with the same ID on a task
+func (db *DB) ReplaceTaskAttachment(ctx context.Context, taskID uuid.UUID, attachment models.Attachment) error {
+	ctx, span := startSpan(ctx, "ReplaceTaskAttachment")
+	defer span.End()
+
+	err := db.rpc("replace_task_attachment", map[string]interface{}{
+		"p_task_id":    taskID.String(),
+		"p_attachment": attachment,
+	}, nil)
+	if err != nil {
+		return attachmentRPCError("update attachment", err)
+	}
+	return nil
+}
+
+// RemoveTaskAttachment deletes an attachment from a task and returns it
+func (db *DB) RemoveTaskAttachment(ctx context.Context, taskID uuid.UUID, attachmentID string) (*models.Attachment, error) {
+	ctx, span := startSpan(ctx, "RemoveTaskAttachment")
+	defer span.End()
+
+	var removed models.Attachment
+	err := db.rpc("remove_task_attachment", map[string]interface{}{
+		"p_task_id":       taskID.String(),
+		"p_attachment_id": attachmentID,
+	}, &removed)
+	if err != nil {
+		return nil, attachmentRPCError("remove attachment", err)
+	}
+	return &removed, nil
+}
+
+// GetBoardTaskAttachments returns the id and attachments of every task on a board that has any
+func (db *DB) GetBoardTaskAttachments(ctx context.Context, boardID uuid.UUID) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "GetBoardTaskAttachments")
+	defer span.End()
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("id, board_id, attachments", "", false).
+		Eq("board_id", boardID.String()).
+		Neq("attachments", "[]").
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board attachments: %w", err)
+	}
+	return tasks, nil
+}
+
+// ListTasksWithAttachments pages through all tasks that have attachments, ordered by id
+func (db *DB) ListTasksWithAttachments(ctx context.Context, after uuid.UUID, limit int) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "ListTasksWithAttachments")
+	defer span.End()
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("id, board_id, attachments", "", false).
+		Neq("attachments", "[]").
+		Gt("id", after.String()).
+		Order("id", &postgrest.OrderOpts{Ascending: true}).
+		Limit(limit, "").
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks with attachments: %w", err)
+	}
+	return tasks, nil
+}
+
+// ListUsersWithInlineAvatars returns users whose avatar is still stored as a data URL
+func (db *DB) ListUsersWithInlineAvatars(ctx context.Context) ([]models.User, error) {
+	ctx, span := startSpan(ctx, "ListUsersWithInlineAvatars")
+	defer span.End()
+
+	var users []models.User
+	_, err := db.client.From("users").
+		Select("id, avatar_url", "", false).
+		Like("avatar_url", "data:*").
+		ExecuteTo(&users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inline avatars: %w", err)
+	}
+	return users, nil
+}
@@ -0,0 +1,234 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"sudo/internal/backup"
+	"sudo/internal/security"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+const (
+	// backupFilterSize keeps in.(...) filters well within URL length limits
+	backupFilterSize = 100
+	// backupPageSize stays below PostgREST's default max-rows of 1000
+	backupPageSize   = 1000
+	backupInsertSize = 500
+)
+
+// ExportWorkspace collects the boards owned by ownerID, or every board when ownerID
+// is nil, with everything that belongs to them and the users they mention. When
+// rekey is set, user emails are re-encrypted under its key instead of this
+// instance's.
+func (db *DB) ExportWorkspace(ctx context.Context, ownerID *uuid.UUID, rekey *security.CryptoService) (*backup.Snapshot, error) {
+	ctx, span := startSpan(ctx, "ExportWorkspace")
+	defer span.End()
+
+	s := &backup.Snapshot{
+		Manifest: backup.Manifest{Scope: "instance"},
+		Tables:   make(map[string][]backup.Row),
+	}
+
+	var err error
+	if ownerID == nil {
+		s.Tables["boards"], err = db.selectRows(ctx, "boards", "", nil)
+	} else {
+		s.Manifest.Scope = "user:" + ownerID.String()
+		s.Tables["boards"], err = db.selectBoardTree(ctx, ownerID.String())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, table := range backup.Tables {
+		if table.By == "" {
+			continue
+		}
+		s.Tables[table.Name], err = db.selectRows(ctx, table.Name, table.By, rowIDs(s.Tables[table.From]))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if ownerID != nil {
+		s.Tables["users"], err = db.selectRows(ctx, "users", "id", backup.ReferencedIDs(s, "users"))
+	} else {
+		s.Tables["users"], err = db.selectRows(ctx, "users", "", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if rekey != nil {
+		for _, user := range s.Tables["users"] {
+			encrypted, _ := user["email"].(string)
+			email, err := db.crypto.DecryptEmail(encrypted)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt email of user %v: %w", user["id"], err)
+			}
+			if user["email"], err = rekey.EncryptEmail(email); err != nil {
+				return nil, fmt.Errorf("failed to re-encrypt email of user %v: %w", user["id"], err)
+			}
+			user["email_hash"] = rekey.EmailBlindIndex(email)
+		}
+	}
+	return s, nil
+}
+
+// RestoreWorkspace inserts an archive's rows under new IDs. Users are matched to
+// existing accounts by email and created otherwise. Rows go in table by table, so
+// a failure leaves the rows restored so far in place; restore into a fresh instance.
+func (db *DB) RestoreWorkspace(ctx context.Context, s *backup.Snapshot) (restored, skipped map[string]int, err error) {
+	ctx, span := startSpan(ctx, "RestoreWorkspace")
+	defer span.End()
+
+	users, created, err := db.restoreUsers(ctx, s.Tables["users"])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tables, skipped, err := backup.Remap(s, users)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	restored = map[string]int{"users": created}
+	for _, table := range backup.Tables[1:] {
+		rows := tables[table.Name]
+		for start := 0; start < len(rows); start += backupInsertSize {
+			end := min(start+backupInsertSize, len(rows))
+			_, err := db.client.From(table.Name).
+				Insert(rows[start:end], table.Conflict != "", table.Conflict, "minimal", "").
+				ExecuteTo(nil)
+			if err != nil {
+				return restored, skipped, fmt.Errorf("failed to restore %s: %w", table.Name, err)
+			}
+			restored[table.Name] += end - start
+		}
+	}
+	return restored, skipped, nil
+}
+
+// restoreUsers maps each archived user to an account in this instance and returns
+// how many accounts had to be created
+func (db *DB) restoreUsers(ctx context.Context, rows []backup.Row) (map[string]string, int, error) {
+	ids := make(map[string]string, len(rows))
+	created := 0
+	for _, row := range rows {
+		oldID, _ := row["id"].(string)
+		encrypted, _ := row["email"].(string)
+		email, err := db.crypto.DecryptEmail(encrypted)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to decrypt email of user %s (was the archive made for another key?): %w", oldID, err)
+		}
+
+		if existing, err := db.GetUserByEmail(ctx, email); err == nil && existing != nil {
+			ids[oldID] = existing.ID.String()
+			continue
+		}
+
+		user := make(backup.Row, len(row))
+		for column, value := range row {
+			user[column] = value
+		}
+		delete(user, "id")
+		if user["email"], err = db.crypto.EncryptEmail(email); err != nil {
+			return nil, 0, fmt.Errorf("failed to encrypt email of user %s: %w", oldID, err)
+		}
+		user["email_hash"] = db.crypto.EmailBlindIndex(email)
+
+		var result []struct {
+			ID uuid.UUID `json:"id"`
+		}
+		_, err = db.client.From("users").Insert(user, false, "", "", "").ExecuteTo(&result)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to restore user %s: %w", oldID, err)
+		}
+		if len(result) == 0 {
+			return nil, 0, fmt.Errorf("failed to get restored user %s", oldID)
+		}
+		ids[oldID] = result[0].ID.String()
+		created++
+	}
+	log.Printf("Restore: matched %d existing users, created %d", len(rows)-created, created)
+	return ids, created, nil
+}
+
+// selectBoardTree returns the boards owned by ownerID and all boards nested below them
+func (db *DB) selectBoardTree(ctx context.Context, ownerID string) ([]backup.Row, error) {
+	boards, err := db.selectRows(ctx, "boards", "owner_id", []string{ownerID})
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, id := range rowIDs(boards) {
+		seen[id] = true
+	}
+	parents := rowIDs(boards)
+	for len(parents) > 0 {
+		children, err := db.selectRows(ctx, "boards", "parent_board_id", parents)
+		if err != nil {
+			return nil, err
+		}
+		parents = nil
+		for _, child := range children {
+			id, _ := child["id"].(string)
+			if !seen[id] {
+				seen[id] = true
+				boards = append(boards, child)
+				parents = append(parents, id)
+			}
+		}
+	}
+	return boards, nil
+}
+
+// selectRows reads every row of table whose column is one of values, or the whole
+// table when column is empty, page by page
+func (db *DB) selectRows(ctx context.Context, table, column string, values []string) ([]backup.Row, error) {
+	filters := [][]string{nil}
+	if column != "" {
+		filters = nil
+		for start := 0; start < len(values); start += backupFilterSize {
+			filters = append(filters, values[start:min(start+backupFilterSize, len(values))])
+		}
+	}
+
+	var rows []backup.Row
+	for _, filter := range filters {
+		for offset := 0; ; offset += backupPageSize {
+			query := db.client.From(table).Select("*", "", false)
+			if column != "" {
+				query = query.In(column, filter)
+			}
+			var page []backup.Row
+			_, err := query.
+				Order("id", &postgrest.OrderOpts{Ascending: true}).
+				Range(offset, offset+backupPageSize-1, "").
+				ExecuteTo(&page)
+			if err != nil {
+				return nil, fmt.Errorf("failed to export %s: %w", table, err)
+			}
+			rows = append(rows, page...)
+			if len(page) < backupPageSize {
+				break
+			}
+		}
+	}
+	return rows, nil
+}
+
+func rowIDs(rows []backup.Row) []string {
+	ids := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if id, ok := row["id"].(string); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
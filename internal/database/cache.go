@@ -0,0 +1,138 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// Cached reads. Every write to the rows behind a key deletes that key after the write
+// has committed. A read that misses remembers the store's generation and only fills
+// the key if no delete happened in between, so a value read before a concurrent write
+// cannot be cached after that write's delete. Once invalidate returns, this instance
+// no longer serves the old value; with several instances the store carries the delete
+// to all of them, either because it is shared (redis) or because it publishes the
+// delete (memory with REDIS_URL), and they stop serving it once it arrives.
+
+func userCacheKey(userID uuid.UUID) string     { return "user:" + userID.String() }
+func boardCacheKey(boardID uuid.UUID) string   { return "board:" + boardID.String() }
+func membersCacheKey(boardID uuid.UUID) string { return "members:" + boardID.String() }
+
+// boardAccess is the part of a board that access checks need
+type boardAccess struct {
+	OwnerID       uuid.UUID  `json:"owner_id"`
+	ParentBoardID *uuid.UUID `json:"parent_board_id"`
+}
+
+// cacheGet decodes a cached entry into out. On a miss it returns the generation to
+// pass to cacheSet once the value has been loaded.
+func (db *DB) cacheGet(ctx context.Context, key string, out interface{}) (uint64, bool) {
+	if db.cache == nil {
+		return 0, false
+	}
+	data, gen, ok := db.cache.Get(ctx, key)
+	if !ok {
+		return gen, false
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		log.Printf("Ignoring unreadable cache entry %s: %v", key, err)
+		return gen, false
+	}
+	return gen, true
+}
+
+// cacheSet fills key with value unless it was invalidated since cacheGet returned gen
+func (db *DB) cacheSet(ctx context.Context, key string, gen uint64, value interface{}) {
+	if db.cache == nil {
+		return
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		log.Printf("Failed to encode cache entry %s: %v", key, err)
+		return
+	}
+	if err := db.cache.Set(ctx, key, data, gen); err != nil {
+		log.Printf("Failed to cache %s: %v", key, err)
+	}
+}
+
+// invalidate drops cached entries after a write. A failure is logged; the entries
+// then live until they expire.
+func (db *DB) invalidate(ctx context.Context, keys ...string) {
+	if db.cache == nil || len(keys) == 0 {
+		return
+	}
+	if err := db.cache.Delete(ctx, keys...); err != nil {
+		log.Printf("Failed to invalidate %v: %v", keys, err)
+	}
+}
+
+// RunCacheSync applies invalidations from other instances until ctx is cancelled. It
+// returns at once when the cache needs no syncing.
+func (db *DB) RunCacheSync(ctx context.Context) {
+	if synced, ok := db.cache.(interface{ Run(context.Context) }); ok {
+		synced.Run(ctx)
+	}
+}
+
+func (db *DB) invalidateBoards(ctx context.Context, boardIDs ...uuid.UUID) {
+	keys := make([]string, 0, 2*len(boardIDs))
+	for _, boardID := range boardIDs {
+		keys = append(keys, boardCacheKey(boardID), membersCacheKey(boardID))
+	}
+	db.invalidate(ctx, keys...)
+}
+
+// getBoardAccess returns the board's owner and parent, or nil if there is no such board
+func (db *DB) getBoardAccess(ctx context.Context, boardID uuid.UUID) (*boardAccess, error) {
+	var access boardAccess
+	gen, ok := db.cacheGet(ctx, boardCacheKey(boardID), &access)
+	if ok {
+		return &access, nil
+	}
+
+	var boards []models.Board
+	_, err := db.client.From("boards").
+		Select("id, owner_id, parent_board_id", "", false).
+		Eq("id", boardID.String()).
+		ExecuteTo(&boards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board info: %w", err)
+	}
+	if len(boards) == 0 {
+		return nil, nil
+	}
+
+	access = boardAccess{OwnerID: boards[0].OwnerID, ParentBoardID: boards[0].ParentBoardID}
+	db.cacheSet(ctx, boardCacheKey(boardID), gen, access)
+	return &access, nil
+}
+
+// getBoardRoles maps each member of the board to their role
+func (db *DB) getBoardRoles(ctx context.Context, boardID uuid.UUID) (map[uuid.UUID]string, error) {
+	roles := make(map[uuid.UUID]string)
+	gen, ok := db.cacheGet(ctx, membersCacheKey(boardID), &roles)
+	if ok {
+		return roles, nil
+	}
+
+	var members []models.BoardMember
+	_, err := db.client.From("board_members").
+		Select("user_id, role", "", false).
+		Eq("board_id", boardID.String()).
+		ExecuteTo(&members)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check board membership: %w", err)
+	}
+
+	for _, member := range members {
+		roles[member.UserID] = member.Role
+	}
+	db.cacheSet(ctx, membersCacheKey(boardID), gen, roles)
+	return roles, nil
+}
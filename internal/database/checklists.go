@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// CreateChecklistItem appends an item to the end of the task's checklist
+func (db *DB) CreateChecklistItem(ctx context.Context, taskID uuid.UUID, content string, assignedTo *uuid.UUID, createdBy uuid.UUID) (*models.ChecklistItem, error) {
+	ctx, span := startSpan(ctx, "CreateChecklistItem")
+	defer span.End()
+
+	var last []models.ChecklistItem
+	_, err := db.client.From("task_checklist_items").
+		Select("position", "", false).
+		Eq("task_id", taskID.String()).
+		Order("position", &postgrest.OrderOpts{Ascending: false}).
+		Limit(1, "").
+		ExecuteTo(&last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checklist position: %w", err)
+	}
+	position := 0
+	if len(last) > 0 {
+		position = last[0].Position + 1
+	}
+
+	item := map[string]interface{}{
+		"task_id":    taskID.String(),
+		"content":    content,
+		"position":   position,
+		"created_by": createdBy.String(),
+	}
+	if assignedTo != nil {
+		item["assigned_to"] = assignedTo.String()
+	}
+
+	var result []models.ChecklistItem
+	_, err = db.client.From("task_checklist_items").
+		Insert(item, false, "", "", "").
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checklist item: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created checklist item")
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) GetChecklistItem(ctx context.Context, itemID uuid.UUID) (*models.ChecklistItem, error) {
+	ctx, span := startSpan(ctx, "GetChecklistItem")
+	defer span.End()
+
+	var items []models.ChecklistItem
+	_, err := db.client.From("task_checklist_items").
+		Select("*", "", false).
+		Eq("id", itemID.String()).
+		ExecuteTo(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checklist item: %w", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("checklist item not found")
+	}
+
+	return &items[0], nil
+}
+
+func (db *DB) UpdateChecklistItem(ctx context.Context, itemID uuid.UUID, updates map[string]interface{}) (*models.ChecklistItem, error) {
+	ctx, span := startSpan(ctx, "UpdateChecklistItem")
+	defer span.End()
+
+	updates["updated_at"] = time.Now()
+
+	var result []models.ChecklistItem
+	_, err := db.client.From("task_checklist_items").
+		Update(updates, "", "").
+		Eq("id", itemID.String()).
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update checklist item: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("checklist item not found")
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) DeleteChecklistItem(ctx context.Context, itemID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteChecklistItem")
+	defer span.End()
+
+	_, err := db.client.From("task_checklist_items").
+		Delete("", "").
+		Eq("id", itemID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete checklist item: %w", err)
+	}
+
+	return nil
+}
+
+// ReorderChecklistItems gives the task's items the positions of itemIDs, which must list
+// every item of the task exactly once
+func (db *DB) ReorderChecklistItems(ctx context.Context, taskID uuid.UUID, itemIDs []uuid.UUID) error {
+	ctx, span := startSpan(ctx, "ReorderChecklistItems")
+	defer span.End()
+
+	items, err := db.GetChecklistItems(ctx, taskID)
+	if err != nil {
+		return err
+	}
+
+	current := make(map[uuid.UUID]int, len(items))
+	for _, item := range items {
+		current[item.ID] = item.Position
+	}
+	if len(itemIDs) != len(items) {
+		return fmt.Errorf("expected %d checklist items, got %d", len(items), len(itemIDs))
+	}
+	seen := make(map[uuid.UUID]bool, len(itemIDs))
+	for _, id := range itemIDs {
+		if _, ok := current[id]; !ok || seen[id] {
+			return fmt.Errorf("checklist item %s does not belong to the task", id.String())
+		}
+		seen[id] = true
+	}
+
+	for position, id := range itemIDs {
+		if current[id] == position {
+			continue
+		}
+		_, err := db.client.From("task_checklist_items").
+			Update(map[string]interface{}{"position": position, "updated_at": time.Now()}, "", "").
+			Eq("id", id.String()).
+			ExecuteTo(nil)
+		if err != nil {
+			return fmt.Errorf("failed to reorder checklist items: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) GetChecklistItems(ctx context.Context, taskID uuid.UUID) ([]models.ChecklistItem, error) {
+	ctx, span := startSpan(ctx, "GetChecklistItems")
+	defer span.End()
+
+	byTask, err := db.getChecklistsForTasks(ctx, []uuid.UUID{taskID})
+	if err != nil {
+		return nil, err
+	}
+	return byTask[taskID], nil
+}
+
+// attachChecklists loads the checklists of tasks in one query
+func (db *DB) attachChecklists(ctx context.Context, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]uuid.UUID, len(tasks))
+	for i := range tasks {
+		taskIDs[i] = tasks[i].ID
+	}
+
+	byTask, err := db.getChecklistsForTasks(ctx, taskIDs)
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		tasks[i].Checklist = byTask[tasks[i].ID]
+	}
+	return nil
+}
+
+func (db *DB) getChecklistsForTasks(ctx context.Context, taskIDs []uuid.UUID) (map[uuid.UUID][]models.ChecklistItem, error) {
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+
+	var items []models.ChecklistItem
+	_, err := db.client.From("task_checklist_items").
+		Select("*", "", false).
+		In("task_id", ids).
+		Order("position", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checklist items: %w", err)
+	}
+
+	byTask := make(map[uuid.UUID][]models.ChecklistItem)
+	for _, item := range items {
+		byTask[item.TaskID] = append(byTask[item.TaskID], item)
+	}
+	return byTask, nil
+}
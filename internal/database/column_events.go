@@ -0,0 +1,137 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// RecordColumnEvent records the task entering toColumnID; fromColumnID is nil on creation
+// and userID is nil when nobody in particular moved it
+func (db *DB) RecordColumnEvent(ctx context.Context, taskID, boardID uuid.UUID, fromColumnID *uuid.UUID, toColumnID uuid.UUID, userID *uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RecordColumnEvent")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"task_id":      taskID.String(),
+		"board_id":     boardID.String(),
+		"to_column_id": toColumnID.String(),
+		"occurred_at":  time.Now().UTC(),
+	}
+	if fromColumnID != nil {
+		data["from_column_id"] = fromColumnID.String()
+	}
+	if userID != nil {
+		data["user_id"] = userID.String()
+	}
+
+	_, err := db.client.From("task_column_events").
+		Insert(data, false, "", "", "").
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to record column event: %w", err)
+	}
+
+	return nil
+}
+
+// GetBoardColumnEvents returns the board's column events before the given time, oldest first
+func (db *DB) GetBoardColumnEvents(ctx context.Context, boardID uuid.UUID, before time.Time) ([]models.ColumnEvent, error) {
+	ctx, span := startSpan(ctx, "GetBoardColumnEvents")
+	defer span.End()
+
+	var events []models.ColumnEvent
+	_, err := db.client.From("task_column_events").
+		Select("*", "", false).
+		Eq("board_id", boardID.String()).
+		Lt("occurred_at", before.UTC().Format(time.RFC3339)).
+		Order("occurred_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column events: %w", err)
+	}
+
+	return events, nil
+}
+
+// GetBoardTaskSummaries returns the board's tasks without relationships, for reports
+func (db *DB) GetBoardTaskSummaries(ctx context.Context, boardID uuid.UUID) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "GetBoardTaskSummaries")
+	defer span.End()
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("id, title, column_id, board_id, assigned_to, created_at", "", false).
+		Eq("board_id", boardID.String()).
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetAssignedTaskIDs returns which of the tasks are assigned to the user, through
+// task_assignees or the legacy assigned_to column
+func (db *DB) GetAssignedTaskIDs(ctx context.Context, tasks []models.Task, userID uuid.UUID) (map[uuid.UUID]bool, error) {
+	ctx, span := startSpan(ctx, "GetAssignedTaskIDs")
+	defer span.End()
+
+	assigned := make(map[uuid.UUID]bool)
+	ids := make([]string, 0, len(tasks))
+	for _, task := range tasks {
+		if task.AssignedTo != nil && *task.AssignedTo == userID {
+			assigned[task.ID] = true
+		}
+		ids = append(ids, task.ID.String())
+	}
+	if len(ids) == 0 {
+		return assigned, nil
+	}
+
+	var assignees []models.TaskAssignee
+	_, err := db.client.From("task_assignees").
+		Select("task_id, user_id", "", false).
+		Eq("user_id", userID.String()).
+		In("task_id", ids).
+		ExecuteTo(&assignees)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task assignees: %w", err)
+	}
+	for _, assignee := range assignees {
+		assigned[assignee.TaskID] = true
+	}
+
+	return assigned, nil
+}
+
+// GetTaskColumnEvents returns the column events of the tasks, oldest first
+func (db *DB) GetTaskColumnEvents(ctx context.Context, taskIDs []uuid.UUID) ([]models.ColumnEvent, error) {
+	ctx, span := startSpan(ctx, "GetTaskColumnEvents")
+	defer span.End()
+
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+
+	var events []models.ColumnEvent
+	_, err := db.client.From("task_column_events").
+		Select("*", "", false).
+		In("task_id", ids).
+		Order("occurred_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&events)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column events: %w", err)
+	}
+
+	return events, nil
+}
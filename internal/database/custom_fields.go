@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"sudo/internal/customfields"
+
+	"github.com/google/uuid"
+)
+
+// ApplyCustomFieldValues validates values against the board's custom fields and returns
+// current with them applied. User fields only accept members of the board. Validation
+// errors wrap customfields.ErrInvalid.
+func (db *DB) ApplyCustomFieldValues(ctx context.Context, boardID uuid.UUID, current, values map[string]interface{}) (map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "ApplyCustomFieldValues")
+	defer span.End()
+
+	board, err := db.GetBoard(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	fields := board.CustomFields()
+
+	validated, err := customfields.Validate(fields, values, func(userID uuid.UUID) bool {
+		member, err := db.HasBoardAccess(ctx, userID, boardID)
+		return err == nil && member
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate custom fields: %w", err)
+	}
+
+	return customfields.Merge(fields, current, validated), nil
+}
@@ -0,0 +1,333 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"sudo/internal/backup"
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// ErrDataExportInProgress means the user already has a pending or building export
+var ErrDataExportInProgress = errors.New("data export already in progress")
+
+// CreateDataExport queues a personal data export for the worker
+func (db *DB) CreateDataExport(ctx context.Context, export *models.DataExport) (*models.DataExport, error) {
+	ctx, span := startSpan(ctx, "CreateDataExport")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"id":           export.ID.String(),
+		"user_id":      export.UserID.String(),
+		"status":       models.DataExportPending,
+		"download_url": export.DownloadURL,
+	}
+
+	var result []models.DataExport
+	_, err := db.client.From("data_exports").Insert(data, false, "", "", "").ExecuteTo(&result)
+	if err != nil {
+		// idx_data_exports_active allows one pending or building export per user
+		if strings.Contains(err.Error(), "(23505)") {
+			return nil, ErrDataExportInProgress
+		}
+		return nil, fmt.Errorf("failed to create data export: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created data export")
+	}
+	return &result[0], nil
+}
+
+// GetDataExport returns one export request
+func (db *DB) GetDataExport(ctx context.Context, id uuid.UUID) (*models.DataExport, error) {
+	ctx, span := startSpan(ctx, "GetDataExport")
+	defer span.End()
+
+	var exports []models.DataExport
+	_, err := db.client.From("data_exports").
+		Select("*", "", false).
+		Eq("id", id.String()).
+		ExecuteTo(&exports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get data export: %w", err)
+	}
+	if len(exports) == 0 {
+		return nil, fmt.Errorf("data export not found")
+	}
+	return &exports[0], nil
+}
+
+// ListDataExports returns the user's export requests, newest first
+func (db *DB) ListDataExports(ctx context.Context, userID uuid.UUID) ([]models.DataExport, error) {
+	ctx, span := startSpan(ctx, "ListDataExports")
+	defer span.End()
+
+	var exports []models.DataExport
+	_, err := db.client.From("data_exports").
+		Select("*", "", false).
+		Eq("user_id", userID.String()).
+		Order("created_at", &postgrest.OrderOpts{Ascending: false}).
+		ExecuteTo(&exports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list data exports: %w", err)
+	}
+	return exports, nil
+}
+
+// ClaimDataExports leases up to limit pending exports to the caller for the lease duration.
+// Exports whose worker died are picked up again once their lease runs out.
+func (db *DB) ClaimDataExports(ctx context.Context, limit int, lease time.Duration) ([]models.DataExport, error) {
+	ctx, span := startSpan(ctx, "ClaimDataExports")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	// Release exports left behind by a worker that never reported back
+	_, err := db.client.From("data_exports").
+		Update(map[string]interface{}{"status": models.DataExportPending, "locked_until": nil}, "", "").
+		Eq("status", models.DataExportBuilding).
+		Lt("locked_until", now.Format(time.RFC3339)).
+		ExecuteTo(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release expired data export leases: %w", err)
+	}
+
+	var pending []models.DataExport
+	_, err = db.client.From("data_exports").
+		Select("*", "", false).
+		Eq("status", models.DataExportPending).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(limit, "").
+		ExecuteTo(&pending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load pending data exports: %w", err)
+	}
+
+	claimed := make([]models.DataExport, 0, len(pending))
+	for _, export := range pending {
+		// Only claim the export if no other worker changed its status in the meantime
+		var rows []models.DataExport
+		_, err := db.client.From("data_exports").
+			Update(map[string]interface{}{
+				"status":       models.DataExportBuilding,
+				"locked_until": now.Add(lease),
+			}, "", "").
+			Eq("id", export.ID.String()).
+			Eq("status", models.DataExportPending).
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim data export %s: %w", export.ID.String(), err)
+		}
+		if len(rows) > 0 {
+			claimed = append(claimed, rows[0])
+		}
+	}
+	return claimed, nil
+}
+
+// CompleteDataExport records where the finished archive is stored and until when
+func (db *DB) CompleteDataExport(ctx context.Context, id uuid.UUID, blobKey string, size int64, expiresAt time.Time) error {
+	ctx, span := startSpan(ctx, "CompleteDataExport")
+	defer span.End()
+
+	_, err := db.client.From("data_exports").
+		Update(map[string]interface{}{
+			"status":       models.DataExportReady,
+			"blob_key":     blobKey,
+			"size_bytes":   size,
+			"locked_until": nil,
+			"expires_at":   expiresAt.UTC(),
+		}, "", "").
+		Eq("id", id.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to complete data export: %w", err)
+	}
+	return nil
+}
+
+// FailDataExport records why an export could not be built; the row is kept until expiresAt
+// so the user can see what happened
+func (db *DB) FailDataExport(ctx context.Context, id uuid.UUID, lastError string, expiresAt time.Time) error {
+	ctx, span := startSpan(ctx, "FailDataExport")
+	defer span.End()
+
+	_, err := db.client.From("data_exports").
+		Update(map[string]interface{}{
+			"status":       models.DataExportFailed,
+			"last_error":   lastError,
+			"locked_until": nil,
+			"expires_at":   expiresAt.UTC(),
+		}, "", "").
+		Eq("id", id.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to record data export failure: %w", err)
+	}
+	return nil
+}
+
+// ListExpiredDataExports returns up to limit exports whose expiry has passed
+func (db *DB) ListExpiredDataExports(ctx context.Context, now time.Time, limit int) ([]models.DataExport, error) {
+	ctx, span := startSpan(ctx, "ListExpiredDataExports")
+	defer span.End()
+
+	var exports []models.DataExport
+	_, err := db.client.From("data_exports").
+		Select("*", "", false).
+		Lt("expires_at", now.UTC().Format(time.RFC3339)).
+		Order("expires_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(limit, "").
+		ExecuteTo(&exports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list expired data exports: %w", err)
+	}
+	return exports, nil
+}
+
+// DeleteDataExport removes an export request; its archive has to be deleted separately
+func (db *DB) DeleteDataExport(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteDataExport")
+	defer span.End()
+
+	_, err := db.client.From("data_exports").
+		Delete("", "").
+		Eq("id", id.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete data export: %w", err)
+	}
+	return nil
+}
+
+// PersonalData collects everything stored about the user for a data export
+func (db *DB) PersonalData(ctx context.Context, userID uuid.UUID) (*models.PersonalData, error) {
+	ctx, span := startSpan(ctx, "PersonalData")
+	defer span.End()
+
+	id := []string{userID.String()}
+	data := &models.PersonalData{}
+
+	users, err := db.selectRows(ctx, "users", "id", id)
+	if err != nil {
+		return nil, err
+	}
+	if len(users) == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+	data.Profile = users[0]
+	encrypted, _ := data.Profile["email"].(string)
+	if data.Profile["email"], err = db.crypto.DecryptEmail(encrypted); err != nil {
+		return nil, fmt.Errorf("failed to decrypt email: %w", err)
+	}
+	delete(data.Profile, "email_hash")
+
+	if data.Memberships, err = db.selectRows(ctx, "board_members", "user_id", id); err != nil {
+		return nil, err
+	}
+	if data.Boards, err = db.personalBoards(ctx, userID, data.Memberships); err != nil {
+		return nil, err
+	}
+	if data.Activity, err = db.selectRows(ctx, "activity_log", "user_id", id); err != nil {
+		return nil, err
+	}
+	if data.Tasks, err = db.personalTasks(ctx, userID, data.Activity); err != nil {
+		return nil, err
+	}
+	if data.Comments, err = db.selectRows(ctx, "comments", "user_id", id); err != nil {
+		return nil, err
+	}
+	if data.Sessions, err = db.selectRows(ctx, "realtime_sessions", "user_id", id); err != nil {
+		return nil, err
+	}
+
+	// Presence rows are keyed by (user_id, board_id) and have no id to page by
+	_, err = db.client.From("user_presence").
+		Select("*", "", false).
+		Eq("user_id", userID.String()).
+		Order("board_id", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&data.Presence)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export user_presence: %w", err)
+	}
+	return data, nil
+}
+
+// personalBoards returns the boards the user owns or is a member of, each with a "role"
+func (db *DB) personalBoards(ctx context.Context, userID uuid.UUID, memberships []backup.Row) ([]backup.Row, error) {
+	boards, err := db.selectRows(ctx, "boards", "owner_id", []string{userID.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	roles := make(map[string]interface{}, len(memberships))
+	for _, membership := range memberships {
+		if boardID, ok := membership["board_id"].(string); ok {
+			roles[boardID] = membership["role"]
+		}
+	}
+	for _, board := range boards {
+		board["role"] = models.RoleOwner
+		delete(roles, board["id"].(string))
+	}
+
+	joinedIDs := make([]string, 0, len(roles))
+	for boardID := range roles {
+		joinedIDs = append(joinedIDs, boardID)
+	}
+	joined, err := db.selectRows(ctx, "boards", "id", joinedIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, board := range joined {
+		board["role"] = roles[board["id"].(string)]
+	}
+	return append(boards, joined...), nil
+}
+
+// personalTasks returns the tasks assigned to the user and those the user created, which
+// tasks do not record themselves and are found through the user's task_create activity
+func (db *DB) personalTasks(ctx context.Context, userID uuid.UUID, activity []backup.Row) ([]backup.Row, error) {
+	id := []string{userID.String()}
+	tasks, err := db.selectRows(ctx, "tasks", "assigned_to", id)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(tasks))
+	for _, taskID := range rowIDs(tasks) {
+		seen[taskID] = true
+	}
+
+	var missing []string
+	add := func(value interface{}) {
+		if taskID, ok := value.(string); ok && !seen[taskID] {
+			seen[taskID] = true
+			missing = append(missing, taskID)
+		}
+	}
+
+	assignments, err := db.selectRows(ctx, "task_assignees", "user_id", id)
+	if err != nil {
+		return nil, err
+	}
+	for _, assignment := range assignments {
+		add(assignment["task_id"])
+	}
+	for _, entry := range activity {
+		if entry["action"] == "task_create" {
+			add(entry["task_id"])
+		}
+	}
+
+	more, err := db.selectRows(ctx, "tasks", "id", missing)
+	if err != nil {
+		return nil, err
+	}
+	return append(tasks, more...), nil
+}
@@ -0,0 +1,100 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+)
+
+func TestPersonalData(t *testing.T) {
+	db, store := newFakeDB(t)
+	userID, otherID := uuid.NewString(), uuid.NewString()
+	encrypted, err := db.crypto.EncryptEmail("ada@example.com")
+	if err != nil {
+		t.Fatalf("EncryptEmail failed: %v", err)
+	}
+	store.insert("users",
+		map[string]interface{}{"id": userID, "email": encrypted, "email_hash": "hash"},
+		map[string]interface{}{"id": otherID, "email": "other"},
+	)
+
+	owned, joined := uuid.NewString(), uuid.NewString()
+	store.insert("boards",
+		map[string]interface{}{"id": owned, "owner_id": userID},
+		map[string]interface{}{"id": joined, "owner_id": otherID},
+		map[string]interface{}{"id": uuid.NewString(), "owner_id": otherID},
+	)
+	store.insert("board_members",
+		map[string]interface{}{"id": uuid.NewString(), "board_id": owned, "user_id": userID, "role": "owner"},
+		map[string]interface{}{"id": uuid.NewString(), "board_id": joined, "user_id": userID, "role": "member"},
+	)
+
+	assigned, coAssigned, created := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	store.insert("tasks",
+		map[string]interface{}{"id": assigned, "assigned_to": userID},
+		map[string]interface{}{"id": coAssigned, "assigned_to": otherID},
+		map[string]interface{}{"id": created, "assigned_to": nil},
+		map[string]interface{}{"id": uuid.NewString(), "assigned_to": otherID},
+	)
+	store.insert("task_assignees",
+		map[string]interface{}{"id": uuid.NewString(), "task_id": assigned, "user_id": userID},
+		map[string]interface{}{"id": uuid.NewString(), "task_id": coAssigned, "user_id": userID},
+	)
+	store.insert("activity_log",
+		map[string]interface{}{"id": uuid.NewString(), "user_id": userID, "action": "task_create", "task_id": created},
+		map[string]interface{}{"id": uuid.NewString(), "user_id": otherID, "action": "task_create", "task_id": uuid.NewString()},
+	)
+	store.insert("comments", map[string]interface{}{"id": uuid.NewString(), "user_id": userID})
+	store.insert("user_presence", map[string]interface{}{"user_id": userID, "board_id": joined})
+
+	data, err := db.PersonalData(context.Background(), uuid.MustParse(userID))
+	if err != nil {
+		t.Fatalf("PersonalData failed: %v", err)
+	}
+
+	if data.Profile["email"] != "ada@example.com" || data.Profile["email_hash"] != nil {
+		t.Errorf("profile = %v", data.Profile)
+	}
+	if len(data.Boards) != 2 || data.Boards[0]["role"] != "owner" || data.Boards[1]["role"] != "member" {
+		t.Errorf("boards = %v", data.Boards)
+	}
+	if len(data.Tasks) != 3 {
+		t.Errorf("got %d tasks, want the assigned, co-assigned and created ones", len(data.Tasks))
+	}
+	if len(data.Activity) != 1 || len(data.Comments) != 1 || len(data.Presence) != 1 || len(data.Sessions) != 0 {
+		t.Errorf("activity = %v, comments = %v, presence = %v, sessions = %v",
+			data.Activity, data.Comments, data.Presence, data.Sessions)
+	}
+}
+
+func TestCreateDataExportInProgress(t *testing.T) {
+	status, body := http.StatusConflict, `{"code":"23505","message":"duplicate key value violates unique constraint \"idx_data_exports_active\""}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+	client, err := supabase.NewClient(server.URL, "test-key", nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	db := &DB{client: client}
+
+	export := &models.DataExport{ID: uuid.New(), UserID: uuid.New(), DownloadURL: "https://example.com"}
+	if _, err := db.CreateDataExport(context.Background(), export); !errors.Is(err, ErrDataExportInProgress) {
+		t.Errorf("CreateDataExport = %v, want ErrDataExportInProgress", err)
+	}
+
+	status, body = http.StatusBadRequest, `{"code":"23503","message":"insert or update violates foreign key constraint"}`
+	if _, err := db.CreateDataExport(context.Background(), export); err == nil || errors.Is(err, ErrDataExportInProgress) {
+		t.Errorf("CreateDataExport = %v, want a plain error", err)
+	}
+}
@@ -2,57 +2,88 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/supabase-community/postgrest-go"
 	"github.com/supabase-community/supabase-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 
+	"sudo/internal/cache"
+	"sudo/internal/config"
 	"sudo/internal/models"
 	"sudo/internal/security"
+	"sudo/internal/tracing"
 )
 
+// ErrUserNotFound is returned by user lookups that matched no row
+var ErrUserNotFound = errors.New("user not found")
+
 type DB struct {
 	client *supabase.Client
 	crypto *security.CryptoService
-}
+	cache  cache.Store // nil when caching is off
 
-func NewDB() *DB {
-	url := os.Getenv("SUPABASE_URL")
-	key := os.Getenv("SUPABASE_SERVICE_KEY")
+	legacyEmails legacyEmailGate
+}
 
-	if url == "" || key == "" {
-		log.Fatal("SUPABASE_URL and SUPABASE_SERVICE_KEY must be set")
+// startSpan traces a DB method as a child of the operation in ctx. Calls made outside a
+// traced request or job are not recorded, so polling loops do not start traces.
+func startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx, noop.Span{}
 	}
+	return tracing.Start(ctx, "DB."+method, trace.WithAttributes(attribute.String("db.system", "postgrest")))
+}
 
+// NewDB connects to the configured Supabase project
+func NewDB(cfg *config.Config) *DB {
 	// Configure client with explicit schema
 	opts := &supabase.ClientOptions{
 		Schema: "public", // Explicitly set schema to public
 	}
 
-	client, err := supabase.NewClient(url, key, opts)
+	client, err := supabase.NewClient(cfg.Database.SupabaseURL, cfg.Database.SupabaseServiceKey, opts)
 	if err != nil {
 		log.Fatal("Failed to initialize Supabase client:", err)
 	}
 
 	// Initialize crypto service
-	crypto, err := security.NewCryptoService()
+	crypto, err := security.NewCryptoService(cfg.Encryption)
 	if err != nil {
 		log.Fatal("Failed to initialize crypto service:", err)
 	}
 
+	// Initialize read-through cache for users, boards and memberships
+	store, err := cache.NewStore(cfg.Cache)
+	if err != nil {
+		log.Fatal("Failed to initialize cache:", err)
+	}
+	if store != nil {
+		log.Printf("Caching users and board permissions in %s store", store.Name())
+	}
+	if _, ok := store.(*cache.MemoryStore); ok {
+		log.Printf("The memory cache is not shared; run a single instance or set REDIS_URL")
+	}
+
 	return &DB{
 		client: client,
 		crypto: crypto,
+		cache:  store,
 	}
 }
 
 // User operations
 func (db *DB) CreateUser(ctx context.Context, email, name string) (*models.User, error) {
+	ctx, span := startSpan(ctx, "CreateUser")
+	defer span.End()
+
 	// Encrypt email before storing
 	encryptedEmail, err := db.crypto.EncryptEmail(email)
 	if err != nil {
@@ -61,7 +92,8 @@ func (db *DB) CreateUser(ctx context.Context, email, name string) (*models.User,
 
 	// Use map instead of struct to avoid UUID issues
 	userData := map[string]interface{}{
-		"email": encryptedEmail,
+		"email":      encryptedEmail,
+		"email_hash": db.crypto.EmailBlindIndex(email),
 	}
 
 	// Only add name if it's not empty
@@ -87,20 +119,27 @@ func (db *DB) CreateUser(ctx context.Context, email, name string) (*models.User,
 }
 
 func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	// Encrypt email to search for it (deterministic encryption allows this)
-	encryptedEmail, err := db.crypto.EncryptEmail(email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt email for search: %w", err)
-	}
+	ctx, span := startSpan(ctx, "GetUserByEmail")
+	defer span.End()
 
+	// Look the email up by its blind index. Every known key is tried so users not yet
+	// rotated onto the current key are still found.
 	var users []models.User
-	_, err = db.client.From("users").Select("*", "", false).Eq("email", encryptedEmail).ExecuteTo(&users)
+	_, err := db.client.From("users").
+		Select("*", "", false).
+		In("email_hash", db.crypto.EmailBlindIndexes(email)).
+		ExecuteTo(&users)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		// Fall back to the legacy deterministic ciphertext for rows created before the blind
+		// index, but only while such rows exist; the lookup derives a key per version
+		if !db.legacyEmailsRemain(ctx) {
+			return nil, ErrUserNotFound
+		}
+		return db.getLegacyUserByEmail(ctx, email)
 	}
 
 	// Decrypt email for return value
@@ -110,80 +149,139 @@ func (db *DB) GetUserByEmail(ctx context.Context, email string) (*models.User, e
 	return &user, nil
 }
 
-func (db *DB) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+// getLegacyUserByEmail finds a user whose email predates the blind index and upgrades the row
+func (db *DB) getLegacyUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	lookupValues, err := db.crypto.LegacyEmailLookupValues(email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt email for search: %w", err)
+	}
+
 	var users []models.User
-	_, err := db.client.From("users").Select("*", "", false).Eq("id", userID.String()).ExecuteTo(&users)
+	_, err = db.client.From("users").
+		Select("*", "", false).
+		In("email", lookupValues).
+		Is("email_hash", "null").
+		ExecuteTo(&users)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get user by ID: %w", err)
+		return nil, fmt.Errorf("failed to get user by email: %w", err)
 	}
 
 	if len(users) == 0 {
-		return nil, fmt.Errorf("user not found")
+		return nil, ErrUserNotFound
 	}
 
-	// Decrypt email for return value
 	user := users[0]
-	if user.Email != "" {
-		decryptedEmail, err := db.crypto.DecryptEmail(user.Email)
+	user.DecryptedEmail = email
+
+	// Upgrade to the randomized format so the next lookup uses the blind index
+	encryptedEmail, err := db.crypto.EncryptEmail(email)
+	if err != nil {
+		log.Printf("Failed to upgrade email encryption for user %s: %v", user.ID.String(), err)
+		return &user, nil
+	}
+	_, err = db.client.From("users").
+		Update(map[string]interface{}{
+			"email":      encryptedEmail,
+			"email_hash": db.crypto.EmailBlindIndex(email),
+		}, "", "").
+		Eq("id", user.ID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		log.Printf("Failed to upgrade email encryption for user %s: %v", user.ID.String(), err)
+		return &user, nil
+	}
+	db.invalidate(ctx, userCacheKey(user.ID))
+	user.Email = encryptedEmail
+
+	return &user, nil
+}
+
+func (db *DB) GetUserByID(ctx context.Context, userID uuid.UUID) (*models.User, error) {
+	ctx, span := startSpan(ctx, "GetUserByID")
+	defer span.End()
+
+	if loader := userLoaderFrom(ctx); loader != nil {
+		users, err := loader.LoadMany(ctx, []uuid.UUID{userID})
 		if err != nil {
-			log.Printf("Warning: Failed to decrypt email for user %s: %v", userID, err)
-			// Don't fail the entire operation, just leave email encrypted
-		} else {
-			user.DecryptedEmail = decryptedEmail
+			return nil, fmt.Errorf("failed to get user by ID: %w", err)
 		}
+		if users[userID] == nil {
+			return nil, ErrUserNotFound
+		}
+		return users[userID], nil
 	}
 
+	// The cache holds the row as stored, with the email still encrypted
+	var user models.User
+	if gen, ok := db.cacheGet(ctx, userCacheKey(userID), &user); !ok {
+		var users []models.User
+		_, err := db.client.From("users").Select("*", "", false).Eq("id", userID.String()).ExecuteTo(&users)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user by ID: %w", err)
+		}
+
+		if len(users) == 0 {
+			return nil, ErrUserNotFound
+		}
+		user = users[0]
+		db.cacheSet(ctx, userCacheKey(userID), gen, user)
+	}
+
+	// Decrypt email for return value
+	db.decryptUserEmail(&user)
+
 	return &user, nil
 }
 
 // Board operations
+
+// CreateBoard creates the board together with its owner membership and default columns
 func (db *DB) CreateBoard(ctx context.Context, title, description string, ownerID uuid.UUID, parentBoardID *uuid.UUID) (*models.Board, error) {
-	// Use map instead of struct to let database generate UUID
-	boardData := map[string]interface{}{
-		"title":       title,
-		"description": description,
-		"owner_id":    ownerID.String(),
-	}
+	ctx, span := startSpan(ctx, "CreateBoard")
+	defer span.End()
 
+	params := map[string]interface{}{
+		"p_title":       title,
+		"p_description": description,
+		"p_owner_id":    ownerID.String(),
+	}
 	if parentBoardID != nil {
-		boardData["parent_board_id"] = parentBoardID.String()
+		params["p_parent_board_id"] = parentBoardID.String()
 	}
 
-	var result []models.Board
-	_, err := db.client.From("boards").Insert(boardData, false, "", "", "").ExecuteTo(&result)
-	if err != nil {
+	var board models.Board
+	if err := db.rpc("create_board", params, &board); err != nil {
 		return nil, fmt.Errorf("failed to create board: %w", err)
 	}
 
-	if len(result) > 0 {
-		boardID := result[0].ID
+	return &board, nil
+}
 
-		// Add the owner as a board member with 'owner' role
-		// NOTE: This is redundant with the database trigger (trg_ensure_board_owner_membership)
-		// but kept for defensive programming. The trigger should fire first, and this will
-		// silently handle duplicates via ON CONFLICT (once Upsert is implemented).
-		err := db.AddBoardMember(ctx, boardID, ownerID, "owner")
-		if err != nil {
-			log.Printf("Warning: Failed to explicitly add owner as board member (trigger should have handled this): %v", err)
-			// Continue anyway - the database trigger should have added the owner
-		}
+// CreateNestedBoard creates a sub-board of the task's board and links it to the task
+func (db *DB) CreateNestedBoard(ctx context.Context, task *models.Task, title string, ownerID uuid.UUID) (*models.Board, error) {
+	ctx, span := startSpan(ctx, "CreateNestedBoard")
+	defer span.End()
 
-		// Create default columns
-		defaultColumns := []string{"To Do", "In Progress", "Review", "Done"}
-		for i, colTitle := range defaultColumns {
-			_, err := db.CreateColumn(ctx, boardID, colTitle, i)
-			if err != nil {
-				log.Printf("Failed to create default column %s: %v", colTitle, err)
-			}
-		}
+	params := map[string]interface{}{
+		"p_title":           title,
+		"p_description":     task.Description,
+		"p_owner_id":        ownerID.String(),
+		"p_parent_board_id": task.BoardID.String(),
+		"p_parent_task_id":  task.ID.String(),
+	}
 
-		return &result[0], nil
+	var board models.Board
+	if err := db.rpc("create_board", params, &board); err != nil {
+		return nil, fmt.Errorf("failed to create nested board: %w", err)
 	}
 
-	return nil, fmt.Errorf("failed to get created board data")
+	return &board, nil
 }
 
 func (db *DB) GetUserBoards(ctx context.Context, userID uuid.UUID) ([]models.Board, error) {
+	ctx, span := startSpan(ctx, "GetUserBoards")
+	defer span.End()
+
 	var ownedBoards []models.Board
 	var memberBoards []models.Board
 
@@ -215,23 +313,22 @@ func (db *DB) GetUserBoards(ctx context.Context, userID uuid.UUID) ([]models.Boa
 		ownedBoardIDs[board.ID.String()] = true
 	}
 
-	// Get board details for each membership (excluding owned boards)
+	// Get the member boards (excluding owned boards) in one query
+	var memberBoardIDs []string
 	for _, membership := range memberships {
 		if !ownedBoardIDs[membership.BoardID.String()] {
-			var board []models.Board
-			_, err = db.client.From("boards").
-				Select("*", "", false).
-				Eq("id", membership.BoardID.String()).
-				ExecuteTo(&board)
-
-			if err != nil {
-				log.Printf("Failed to get member board %s: %v", membership.BoardID.String(), err)
-				continue
-			}
+			memberBoardIDs = append(memberBoardIDs, membership.BoardID.String())
+		}
+	}
+	if len(memberBoardIDs) > 0 {
+		_, err = db.client.From("boards").
+			Select("*", "", false).
+			In("id", memberBoardIDs).
+			Order("created_at", nil).
+			ExecuteTo(&memberBoards)
 
-			if len(board) > 0 {
-				memberBoards = append(memberBoards, board[0])
-			}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get member boards: %w", err)
 		}
 	}
 
@@ -242,6 +339,9 @@ func (db *DB) GetUserBoards(ctx context.Context, userID uuid.UUID) ([]models.Boa
 }
 
 func (db *DB) GetNestedBoards(ctx context.Context, parentBoardID uuid.UUID) ([]models.Board, error) {
+	ctx, span := startSpan(ctx, "GetNestedBoards")
+	defer span.End()
+
 	var nestedBoards []models.Board
 
 	// Get boards where parent_board_id matches the given ID
@@ -258,7 +358,26 @@ func (db *DB) GetNestedBoards(ctx context.Context, parentBoardID uuid.UUID) ([]m
 	return nestedBoards, nil
 }
 
+// GetBoard loads a board row without its columns or members
+func (db *DB) GetBoard(ctx context.Context, boardID uuid.UUID) (*models.Board, error) {
+	ctx, span := startSpan(ctx, "GetBoard")
+	defer span.End()
+
+	var boards []models.Board
+	_, err := db.client.From("boards").Select("*", "", false).Eq("id", boardID.String()).ExecuteTo(&boards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board: %w", err)
+	}
+	if len(boards) == 0 {
+		return nil, fmt.Errorf("board not found")
+	}
+	return &boards[0], nil
+}
+
 func (db *DB) GetBoardWithColumns(ctx context.Context, boardID uuid.UUID) (*models.Board, error) {
+	ctx, span := startSpan(ctx, "GetBoardWithColumns")
+	defer span.End()
+
 	var boards []models.Board
 	_, err := db.client.From("boards").Select("*", "", false).Eq("id", boardID.String()).ExecuteTo(&boards)
 	if err != nil {
@@ -322,6 +441,9 @@ func (db *DB) GetBoardWithColumns(ctx context.Context, boardID uuid.UUID) (*mode
 }
 
 func (db *DB) UpdateBoard(ctx context.Context, boardID uuid.UUID, updates map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "UpdateBoard")
+	defer span.End()
+
 	updates["updated_at"] = time.Now()
 
 	_, err := db.client.From("boards").
@@ -332,37 +454,39 @@ func (db *DB) UpdateBoard(ctx context.Context, boardID uuid.UUID, updates map[st
 	if err != nil {
 		return fmt.Errorf("failed to update board: %w", err)
 	}
+	db.invalidateBoards(ctx, boardID)
 
 	return nil
 }
 
+// DeleteBoard unlinks the board from its parent task and deletes it
 func (db *DB) DeleteBoard(ctx context.Context, boardID uuid.UUID) error {
-	_, err := db.client.From("boards").
-		Delete("", "").
-		Eq("id", boardID.String()).
-		ExecuteTo(nil)
+	ctx, span := startSpan(ctx, "DeleteBoard")
+	defer span.End()
 
+	err := db.rpc("delete_board", map[string]interface{}{"p_board_id": boardID.String()}, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete board: %w", err)
 	}
+	db.invalidateBoards(ctx, boardID)
 
 	return nil
 }
 
 func (db *DB) HasBoardAccess(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
-	// Check if user is owner
-	var boards []models.Board
-	_, err := db.client.From("boards").
-		Select("id, parent_board_id", "", false).
-		Eq("id", boardID.String()).
-		Eq("owner_id", userID.String()).
-		ExecuteTo(&boards)
+	ctx, span := startSpan(ctx, "HasBoardAccess")
+	defer span.End()
 
+	board, err := db.getBoardAccess(ctx, boardID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check board ownership: %w", err)
 	}
+	if board == nil {
+		return false, nil
+	}
 
-	if len(boards) > 0 {
+	// Check if user is owner
+	if board.OwnerID == userID {
 		return true, nil
 	}
 
@@ -377,39 +501,30 @@ func (db *DB) HasBoardAccess(ctx context.Context, userID, boardID uuid.UUID) (bo
 	}
 
 	// If this is a sub-board, check if user has access to the parent board
-	_, err = db.client.From("boards").
-		Select("id, parent_board_id", "", false).
-		Eq("id", boardID.String()).
-		ExecuteTo(&boards)
-
-	if err != nil {
-		return false, fmt.Errorf("failed to get board info: %w", err)
-	}
-
-	if len(boards) > 0 && boards[0].ParentBoardID != nil {
+	if board.ParentBoardID != nil {
 		// Recursively check access to parent board
-		return db.HasBoardAccess(ctx, userID, *boards[0].ParentBoardID)
+		return db.HasBoardAccess(ctx, userID, *board.ParentBoardID)
 	}
 
 	return false, nil
 }
 
 func (db *DB) IsBoardOwner(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
-	var boards []models.Board
-	_, err := db.client.From("boards").
-		Select("id", "", false).
-		Eq("id", boardID.String()).
-		Eq("owner_id", userID.String()).
-		ExecuteTo(&boards)
+	ctx, span := startSpan(ctx, "IsBoardOwner")
+	defer span.End()
 
+	board, err := db.getBoardAccess(ctx, boardID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check board ownership: %w", err)
 	}
 
-	return len(boards) > 0, nil
+	return board != nil && board.OwnerID == userID, nil
 }
 
 func (db *DB) IsBoardAdmin(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
+	ctx, span := startSpan(ctx, "IsBoardAdmin")
+	defer span.End()
+
 	// Check if user is owner first
 	isOwner, err := db.IsBoardOwner(ctx, userID, boardID)
 	if err != nil {
@@ -421,38 +536,32 @@ func (db *DB) IsBoardAdmin(ctx context.Context, userID, boardID uuid.UUID) (bool
 	}
 
 	// Check if user is admin member
-	var members []models.BoardMember
-	_, err = db.client.From("board_members").
-		Select("id", "", false).
-		Eq("board_id", boardID.String()).
-		Eq("user_id", userID.String()).
-		Eq("role", "admin").
-		ExecuteTo(&members)
-
+	roles, err := db.getBoardRoles(ctx, boardID)
 	if err != nil {
 		return false, fmt.Errorf("failed to check board admin status: %w", err)
 	}
 
-	return len(members) > 0, nil
+	return roles[userID] == "admin", nil
 }
 
 // Board member operations
 func (db *DB) IsBoardMember(ctx context.Context, boardID, userID uuid.UUID) (bool, error) {
-	var members []models.BoardMember
-	_, err := db.client.From("board_members").
-		Select("id", "", false).
-		Eq("board_id", boardID.String()).
-		Eq("user_id", userID.String()).
-		ExecuteTo(&members)
+	ctx, span := startSpan(ctx, "IsBoardMember")
+	defer span.End()
 
+	roles, err := db.getBoardRoles(ctx, boardID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check board membership: %w", err)
+		return false, err
 	}
 
-	return len(members) > 0, nil
+	_, ok := roles[userID]
+	return ok, nil
 }
 
 func (db *DB) AddBoardMember(ctx context.Context, boardID, userID uuid.UUID, role string) error {
+	ctx, span := startSpan(ctx, "AddBoardMember")
+	defer span.End()
+
 	member := map[string]interface{}{
 		"board_id": boardID.String(),
 		"user_id":  userID.String(),
@@ -466,11 +575,15 @@ func (db *DB) AddBoardMember(ctx context.Context, boardID, userID uuid.UUID, rol
 	if err != nil {
 		return fmt.Errorf("failed to add/update board member: %w", err)
 	}
+	db.invalidate(ctx, membersCacheKey(boardID))
 
 	return nil
 }
 
 func (db *DB) RemoveBoardMember(ctx context.Context, boardID, userID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RemoveBoardMember")
+	defer span.End()
+
 	_, err := db.client.From("board_members").
 		Delete("", "").
 		Eq("board_id", boardID.String()).
@@ -480,11 +593,15 @@ func (db *DB) RemoveBoardMember(ctx context.Context, boardID, userID uuid.UUID)
 	if err != nil {
 		return fmt.Errorf("failed to remove board member: %w", err)
 	}
+	db.invalidate(ctx, membersCacheKey(boardID))
 
 	return nil
 }
 
 func (db *DB) GetBoardMembers(ctx context.Context, boardID uuid.UUID) ([]models.BoardMember, error) {
+	ctx, span := startSpan(ctx, "GetBoardMembers")
+	defer span.End()
+
 	// First get all board members with their user info
 	var members []models.BoardMember
 	_, err := db.client.From("board_members").
@@ -496,17 +613,25 @@ func (db *DB) GetBoardMembers(ctx context.Context, boardID uuid.UUID) ([]models.
 		return nil, fmt.Errorf("failed to get board members: %w", err)
 	}
 
-	// Populate user details for each member
+	// Populate user details for all members at once
+	userIDs := make([]uuid.UUID, len(members))
 	for i := range members {
-		user, err := db.GetUserByID(context.Background(), members[i].UserID)
-		if err != nil {
-			log.Printf("Failed to get user %s: %v", members[i].UserID, err)
+		userIDs[i] = members[i].UserID
+	}
+	users, err := db.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		log.Printf("Failed to get users for board %s: %v", boardID, err)
+		users = map[uuid.UUID]*models.User{}
+	}
+	for i := range members {
+		user := users[members[i].UserID]
+		if user == nil {
+			log.Printf("Failed to get user %s", members[i].UserID)
 			// Create placeholder user instead of skipping - ensures member remains assignable
-			members[i].User = &models.User{
+			user = &models.User{
 				ID:   members[i].UserID,
 				Name: "Unknown User",
 			}
-			continue
 		}
 		members[i].User = user
 	}
@@ -516,6 +641,9 @@ func (db *DB) GetBoardMembers(ctx context.Context, boardID uuid.UUID) ([]models.
 
 // GetBoardMembersWithRoles returns board members with their roles in API format
 func (db *DB) GetBoardMembersWithRoles(ctx context.Context, boardID uuid.UUID) ([]map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "GetBoardMembersWithRoles")
+	defer span.End()
+
 	var members []models.BoardMember
 	_, err := db.client.From("board_members").
 		Select("user_id, role", "", false).
@@ -526,12 +654,21 @@ func (db *DB) GetBoardMembersWithRoles(ctx context.Context, boardID uuid.UUID) (
 		return nil, fmt.Errorf("failed to get board members: %w", err)
 	}
 
-	// Get user details for each member and format for API
+	// Get user details for all members and format for API
+	userIDs := make([]uuid.UUID, len(members))
+	for i := range members {
+		userIDs[i] = members[i].UserID
+	}
+	users, err := db.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board member users: %w", err)
+	}
+
 	var membersData []map[string]interface{}
 	for _, member := range members {
-		user, err := db.GetUserByID(ctx, member.UserID)
-		if err != nil {
-			log.Printf("Failed to get user %s: %v", member.UserID, err)
+		user := users[member.UserID]
+		if user == nil {
+			log.Printf("Failed to get user %s", member.UserID)
 			continue
 		}
 
@@ -547,6 +684,9 @@ func (db *DB) GetBoardMembersWithRoles(ctx context.Context, boardID uuid.UUID) (
 
 // Column operations
 func (db *DB) CreateColumn(ctx context.Context, boardID uuid.UUID, title string, position int) (*models.Column, error) {
+	ctx, span := startSpan(ctx, "CreateColumn")
+	defer span.End()
+
 	// Use map instead of struct to let database generate UUID
 	columnData := map[string]interface{}{
 		"board_id": boardID.String(),
@@ -568,6 +708,9 @@ func (db *DB) CreateColumn(ctx context.Context, boardID uuid.UUID, title string,
 }
 
 func (db *DB) GetBoardColumns(ctx context.Context, boardID uuid.UUID) ([]models.Column, error) {
+	ctx, span := startSpan(ctx, "GetBoardColumns")
+	defer span.End()
+
 	var columns []models.Column
 	_, err := db.client.From("columns").
 		Select("*", "", false).
@@ -579,20 +722,56 @@ func (db *DB) GetBoardColumns(ctx context.Context, boardID uuid.UUID) ([]models.
 		return nil, fmt.Errorf("failed to get board columns: %w", err)
 	}
 
-	// Get tasks for each column
+	// Get the tasks of all columns at once
+	var tasks []models.Task
+	_, err = db.client.From("tasks").
+		Select("*", "", false).
+		Eq("board_id", boardID.String()).
+		Order("position", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&tasks)
+
+	if err != nil {
+		log.Printf("Failed to get tasks for board %s: %v", boardID, err)
+		return columns, nil
+	}
+	db.attachTaskDetails(ctx, tasks)
+
+	byColumn := make(map[uuid.UUID][]models.Task, len(columns))
+	for _, task := range tasks {
+		byColumn[task.ColumnID] = append(byColumn[task.ColumnID], task)
+	}
 	for i := range columns {
-		tasks, err := db.GetColumnTasks(ctx, columns[i].ID)
-		if err != nil {
-			log.Printf("Failed to get tasks for column %s: %v", columns[i].ID, err)
-			continue
-		}
-		columns[i].Tasks = tasks
+		columns[i].Tasks = byColumn[columns[i].ID]
 	}
 
 	return columns, nil
 }
 
+func (db *DB) GetColumn(ctx context.Context, columnID uuid.UUID) (*models.Column, error) {
+	ctx, span := startSpan(ctx, "GetColumn")
+	defer span.End()
+
+	var columns []models.Column
+	_, err := db.client.From("columns").
+		Select("*", "", false).
+		Eq("id", columnID.String()).
+		ExecuteTo(&columns)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get column: %w", err)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("column not found")
+	}
+
+	return &columns[0], nil
+}
+
 func (db *DB) UpdateColumn(ctx context.Context, columnID uuid.UUID, updates map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "UpdateColumn")
+	defer span.End()
+
 	updates["updated_at"] = time.Now()
 
 	_, err := db.client.From("columns").
@@ -608,6 +787,9 @@ func (db *DB) UpdateColumn(ctx context.Context, columnID uuid.UUID, updates map[
 }
 
 func (db *DB) DeleteColumn(ctx context.Context, columnID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteColumn")
+	defer span.End()
+
 	_, err := db.client.From("columns").
 		Delete("", "").
 		Eq("id", columnID.String()).
@@ -622,6 +804,9 @@ func (db *DB) DeleteColumn(ctx context.Context, columnID uuid.UUID) error {
 
 // Task operations
 func (db *DB) CreateTask(ctx context.Context, title, description string, columnID, boardID uuid.UUID, priority string) (*models.Task, error) {
+	ctx, span := startSpan(ctx, "CreateTask")
+	defer span.End()
+
 	// Get next position
 	var tasks []models.Task
 	_, _ = db.client.From("tasks").
@@ -653,6 +838,10 @@ func (db *DB) CreateTask(ctx context.Context, title, description string, columnI
 	}
 
 	if len(result) > 0 {
+		// Analytics count the task from its first column
+		if err := db.RecordColumnEvent(ctx, result[0].ID, boardID, nil, columnID, nil); err != nil {
+			log.Printf("Failed to record creation of task %s: %v", result[0].ID.String(), err)
+		}
 		return &result[0], nil
 	}
 
@@ -660,6 +849,9 @@ func (db *DB) CreateTask(ctx context.Context, title, description string, columnI
 }
 
 func (db *DB) GetTask(ctx context.Context, taskID uuid.UUID) (*models.Task, error) {
+	ctx, span := startSpan(ctx, "GetTask")
+	defer span.End()
+
 	var tasks []models.Task
 	_, err := db.client.From("tasks").
 		Select("*", "", false).
@@ -676,21 +868,15 @@ func (db *DB) GetTask(ctx context.Context, taskID uuid.UUID) (*models.Task, erro
 
 	task := &tasks[0]
 
-	// Load multiple assignees
-	assignees, err := db.GetTaskAssignees(ctx, task.ID)
-	if err != nil {
-		log.Printf("Warning: Failed to get assignees for task %s: %v", task.ID.String(), err)
-	} else {
-		task.Assignees = assignees
-	}
+	// Dependency links for badges and the blocked-move check, checklist and assignees
+	db.attachTaskDetails(ctx, tasks)
 
-	// Keep backward compatibility with single assignee
-	if task.AssignedTo != nil {
-		assignee, err := db.GetUserByID(ctx, *task.AssignedTo)
+	if task.RecurrenceID != nil {
+		recurrence, err := db.GetTaskRecurrence(ctx, *task.RecurrenceID)
 		if err != nil {
-			log.Printf("Warning: Failed to get assignee for task %s: %v", task.ID.String(), err)
+			log.Printf("Warning: Failed to get recurrence for task %s: %v", task.ID.String(), err)
 		} else {
-			task.Assignee = assignee
+			task.Recurrence = recurrence
 		}
 	}
 
@@ -698,6 +884,9 @@ func (db *DB) GetTask(ctx context.Context, taskID uuid.UUID) (*models.Task, erro
 }
 
 func (db *DB) GetTaskByNestedBoardID(ctx context.Context, nestedBoardID uuid.UUID) (*models.Task, error) {
+	ctx, span := startSpan(ctx, "GetTaskByNestedBoardID")
+	defer span.End()
+
 	var tasks []models.Task
 	_, err := db.client.From("tasks").
 		Select("*", "", false).
@@ -716,6 +905,9 @@ func (db *DB) GetTaskByNestedBoardID(ctx context.Context, nestedBoardID uuid.UUI
 }
 
 func (db *DB) GetColumnTasks(ctx context.Context, columnID uuid.UUID) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "GetColumnTasks")
+	defer span.End()
+
 	var tasks []models.Task
 	_, err := db.client.From("tasks").
 		Select("*", "", false).
@@ -727,33 +919,77 @@ func (db *DB) GetColumnTasks(ctx context.Context, columnID uuid.UUID) ([]models.
 		return nil, fmt.Errorf("failed to get column tasks: %w", err)
 	}
 
-	// Populate assignee information for each task
+	db.attachTaskDetails(ctx, tasks)
+
+	return tasks, nil
+}
+
+// attachTaskDetails loads dependencies, checklists and assignees for all the tasks with
+// a fixed number of queries. Failures are logged and leave the details empty.
+func (db *DB) attachTaskDetails(ctx context.Context, tasks []models.Task) {
+	if len(tasks) == 0 {
+		return
+	}
+	if err := db.attachDependencies(ctx, tasks); err != nil {
+		log.Printf("Warning: Failed to get dependencies for %d tasks: %v", len(tasks), err)
+	}
+	if err := db.attachChecklists(ctx, tasks); err != nil {
+		log.Printf("Warning: Failed to get checklists for %d tasks: %v", len(tasks), err)
+	}
+	if err := db.attachAssignees(ctx, tasks); err != nil {
+		log.Printf("Warning: Failed to get assignees for %d tasks: %v", len(tasks), err)
+	}
+}
+
+// attachAssignees sets Assignees and, for backward compatibility, the single Assignee
+func (db *DB) attachAssignees(ctx context.Context, tasks []models.Task) error {
+	taskIDs := make([]string, len(tasks))
 	for i := range tasks {
-		// Load multiple assignees
-		assignees, err := db.GetTaskAssignees(ctx, tasks[i].ID)
-		if err != nil {
-			log.Printf("Warning: Failed to get assignees for task %s: %v", tasks[i].ID.String(), err)
-		} else {
-			tasks[i].Assignees = assignees
+		taskIDs[i] = tasks[i].ID.String()
+	}
+
+	var assignees []models.TaskAssignee
+	_, err := db.client.From("task_assignees").
+		Select("*", "", false).
+		In("task_id", taskIDs).
+		Order("assigned_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&assignees)
+	if err != nil {
+		return fmt.Errorf("failed to get task assignees: %w", err)
+	}
+
+	var userIDs []uuid.UUID
+	for _, assignee := range assignees {
+		userIDs = append(userIDs, assignee.UserID)
+	}
+	for _, task := range tasks {
+		if task.AssignedTo != nil {
+			userIDs = append(userIDs, *task.AssignedTo)
 		}
+	}
+	users, err := db.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return err
+	}
 
-		// Keep backward compatibility with single assignee
+	byTask := make(map[uuid.UUID][]models.TaskAssignee)
+	for _, assignee := range assignees {
+		assignee.User = users[assignee.UserID]
+		byTask[assignee.TaskID] = append(byTask[assignee.TaskID], assignee)
+	}
+	for i := range tasks {
+		tasks[i].Assignees = byTask[tasks[i].ID]
 		if tasks[i].AssignedTo != nil {
-			assignee, err := db.GetUserByID(ctx, *tasks[i].AssignedTo)
-			if err != nil {
-				log.Printf("Warning: Failed to get assignee %s for task %s: %v",
-					tasks[i].AssignedTo.String(), tasks[i].ID.String(), err)
-				// Continue without assignee data rather than failing
-				continue
-			}
-			tasks[i].Assignee = assignee
+			tasks[i].Assignee = users[*tasks[i].AssignedTo]
 		}
 	}
-
-	return tasks, nil
+	return nil
 }
 
 func (db *DB) UpdateTask(ctx context.Context, taskID uuid.UUID, updates map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "UpdateTask")
+	defer span.End()
+
 	updates["updated_at"] = time.Now()
 
 	// First get current version, then increment it
@@ -780,6 +1016,9 @@ func (db *DB) UpdateTask(ctx context.Context, taskID uuid.UUID, updates map[stri
 }
 
 func (db *DB) MoveTask(ctx context.Context, taskID, newColumnID uuid.UUID, newPosition int) error {
+	ctx, span := startSpan(ctx, "MoveTask")
+	defer span.End()
+
 	updates := map[string]interface{}{
 		"column_id":  newColumnID,
 		"position":   newPosition,
@@ -809,12 +1048,12 @@ func (db *DB) MoveTask(ctx context.Context, taskID, newColumnID uuid.UUID, newPo
 	return nil
 }
 
+// DeleteTask deletes the task and its nested board, if it has one
 func (db *DB) DeleteTask(ctx context.Context, taskID uuid.UUID) error {
-	_, err := db.client.From("tasks").
-		Delete("", "").
-		Eq("id", taskID.String()).
-		ExecuteTo(nil)
+	ctx, span := startSpan(ctx, "DeleteTask")
+	defer span.End()
 
+	err := db.rpc("delete_task", map[string]interface{}{"p_task_id": taskID.String()}, nil)
 	if err != nil {
 		return fmt.Errorf("failed to delete task: %w", err)
 	}
@@ -823,6 +1062,9 @@ func (db *DB) DeleteTask(ctx context.Context, taskID uuid.UUID) error {
 }
 
 func (db *DB) AssignTask(ctx context.Context, taskID, userID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "AssignTask")
+	defer span.End()
+
 	updates := map[string]interface{}{
 		"assigned_to": userID,
 		"updated_at":  time.Now(),
@@ -852,6 +1094,9 @@ func (db *DB) AssignTask(ctx context.Context, taskID, userID uuid.UUID) error {
 }
 
 func (db *DB) UnassignTask(ctx context.Context, taskID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "UnassignTask")
+	defer span.End()
+
 	updates := map[string]interface{}{
 		"assigned_to": nil,
 		"updated_at":  time.Now(),
@@ -882,6 +1127,9 @@ func (db *DB) UnassignTask(ctx context.Context, taskID uuid.UUID) error {
 
 // Task Assignees operations (multiple assignees support)
 func (db *DB) AddTaskAssignee(ctx context.Context, taskID, userID, assignedBy uuid.UUID) error {
+	ctx, span := startSpan(ctx, "AddTaskAssignee")
+	defer span.End()
+
 	assigneeData := map[string]interface{}{
 		"task_id":     taskID.String(),
 		"user_id":     userID.String(),
@@ -902,6 +1150,9 @@ func (db *DB) AddTaskAssignee(ctx context.Context, taskID, userID, assignedBy uu
 }
 
 func (db *DB) RemoveTaskAssignee(ctx context.Context, taskID, userID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RemoveTaskAssignee")
+	defer span.End()
+
 	_, err := db.client.From("task_assignees").
 		Delete("", "").
 		Eq("task_id", taskID.String()).
@@ -916,6 +1167,9 @@ func (db *DB) RemoveTaskAssignee(ctx context.Context, taskID, userID uuid.UUID)
 }
 
 func (db *DB) GetTaskAssignees(ctx context.Context, taskID uuid.UUID) ([]models.TaskAssignee, error) {
+	ctx, span := startSpan(ctx, "GetTaskAssignees")
+	defer span.End()
+
 	var assignees []models.TaskAssignee
 	_, err := db.client.From("task_assignees").
 		Select("*", "", false).
@@ -929,16 +1183,22 @@ func (db *DB) GetTaskAssignees(ctx context.Context, taskID uuid.UUID) ([]models.
 
 	log.Printf("DEBUG GetTaskAssignees: Found %d raw assignee records for task %s", len(assignees), taskID.String())
 
-	// Load user info for each assignee
+	// Load user info for all assignees
+	userIDs := make([]uuid.UUID, len(assignees))
 	for i := range assignees {
-		log.Printf("DEBUG GetTaskAssignees: Loading user %s for assignee %d", assignees[i].UserID.String(), i)
-		user, err := db.GetUserByID(ctx, assignees[i].UserID)
-		if err != nil {
-			log.Printf("Warning: Failed to get user %s for task assignee: %v", assignees[i].UserID, err)
+		userIDs[i] = assignees[i].UserID
+	}
+	users, err := db.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		log.Printf("Warning: Failed to get users for task assignees: %v", err)
+		users = map[uuid.UUID]*models.User{}
+	}
+	for i := range assignees {
+		if users[assignees[i].UserID] == nil {
+			log.Printf("Warning: Failed to get user %s for task assignee", assignees[i].UserID)
 			continue
 		}
-		assignees[i].User = user
-		log.Printf("DEBUG GetTaskAssignees: Loaded user %s", user.GetDisplayName())
+		assignees[i].User = users[assignees[i].UserID]
 	}
 
 	log.Printf("DEBUG GetTaskAssignees: Returning %d assignees with user data", len(assignees))
@@ -946,6 +1206,9 @@ func (db *DB) GetTaskAssignees(ctx context.Context, taskID uuid.UUID) ([]models.
 }
 
 func (db *DB) UpdateTaskAssigneeCompletion(ctx context.Context, taskID, userID uuid.UUID, completed bool) error {
+	ctx, span := startSpan(ctx, "UpdateTaskAssigneeCompletion")
+	defer span.End()
+
 	updates := map[string]interface{}{
 		"completed":  completed,
 		"updated_at": time.Now(),
@@ -970,9 +1233,61 @@ func (db *DB) UpdateTaskAssigneeCompletion(ctx context.Context, taskID, userID u
 	return nil
 }
 
+// Comment operations
+func (db *DB) CreateComment(ctx context.Context, taskID, userID uuid.UUID, content string) (*models.Comment, error) {
+	ctx, span := startSpan(ctx, "CreateComment")
+	defer span.End()
+
+	commentData := map[string]interface{}{
+		"task_id": taskID.String(),
+		"user_id": userID.String(),
+		"content": content,
+	}
+
+	var result []models.Comment
+	_, err := db.client.From("comments").Insert(commentData, false, "", "", "").ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create comment: %w", err)
+	}
+
+	if len(result) > 0 {
+		return &result[0], nil
+	}
+
+	return nil, fmt.Errorf("failed to get created comment data")
+}
+
+// GetTaskComments loads the comments of the given tasks, oldest first
+func (db *DB) GetTaskComments(ctx context.Context, taskIDs []uuid.UUID) ([]models.Comment, error) {
+	ctx, span := startSpan(ctx, "GetTaskComments")
+	defer span.End()
+
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+
+	var comments []models.Comment
+	_, err := db.client.From("comments").
+		Select("*", "", false).
+		In("task_id", ids).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&comments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comments: %w", err)
+	}
+	return comments, nil
+}
+
 // OTP operations
 func (db *DB) CreateOTP(ctx context.Context, email, token string, expiresAt time.Time) error {
-	log.Printf("CreateOTP called with email=%s, token=%s", email, token)
+	ctx, span := startSpan(ctx, "CreateOTP")
+	defer span.End()
+
+	log.Printf("CreateOTP called with email=%s", email)
 
 	// Encrypt email for storage
 	encryptedEmail, err := db.crypto.EncryptEmail(email)
@@ -982,6 +1297,23 @@ func (db *DB) CreateOTP(ctx context.Context, email, token string, expiresAt time
 	}
 	log.Printf("Email encrypted successfully")
 
+	emailHash := db.crypto.EmailBlindIndex(email)
+
+	// Refuse to issue codes while locked out or inside the resend cooldown
+	if err := db.checkOTPSendAllowed(ctx, email, emailHash); err != nil {
+		return err
+	}
+
+	// Only the newest code is valid, so resending does not multiply an attacker's chances
+	_, err = db.client.From("otp_tokens").
+		Update(map[string]interface{}{"used": true}, "", "").
+		In("email_hash", db.crypto.EmailBlindIndexes(email)).
+		Eq("used", "false").
+		ExecuteTo(nil)
+	if err != nil {
+		log.Printf("Failed to invalidate previous OTPs: %v", err)
+	}
+
 	// Hash OTP for storage
 	hashedToken, err := db.crypto.HashOTP(token)
 	if err != nil {
@@ -993,6 +1325,7 @@ func (db *DB) CreateOTP(ctx context.Context, email, token string, expiresAt time
 	// Create a map instead of struct to avoid UUID issues
 	otp := map[string]interface{}{
 		"email":      encryptedEmail,
+		"email_hash": emailHash,
 		"token":      hashedToken,
 		"expires_at": expiresAt.UTC(),
 	}
@@ -1005,24 +1338,34 @@ func (db *DB) CreateOTP(ctx context.Context, email, token string, expiresAt time
 	}
 
 	log.Printf("OTP created successfully")
+
+	if err := db.recordOTPSent(ctx, emailHash, time.Now().UTC()); err != nil {
+		log.Printf("Failed to record OTP send time: %v", err)
+	}
+
 	return nil
 }
 
 func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.User, error) {
-	log.Printf("ValidateOTP called with email=%s, token=%s", email, token)
+	ctx, span := startSpan(ctx, "ValidateOTP")
+	defer span.End()
 
-	// Encrypt email to search for matching OTPs
-	encryptedEmail, err := db.crypto.EncryptEmail(email)
-	if err != nil {
-		return nil, fmt.Errorf("failed to encrypt email for search: %w", err)
+	log.Printf("ValidateOTP called with email=%s", email)
+
+	// OTPs are looked up by the email's blind index
+	emailHash := db.crypto.EmailBlindIndex(email)
+
+	if err := db.checkOTPVerifyAllowed(ctx, email, emailHash); err != nil {
+		return nil, err
 	}
 
 	var otps []models.OTPToken
 
-	// Get all OTPs for this email (we'll verify the token hash manually)
-	_, err = db.client.From("otp_tokens").
+	// Get all OTPs for this email (we'll verify the token hash manually).
+	// Codes may have been issued under a previous key during a rotation.
+	_, err := db.client.From("otp_tokens").
 		Select("*", "", false).
-		Eq("email", encryptedEmail).
+		In("email_hash", db.crypto.EmailBlindIndexes(email)).
 		ExecuteTo(&otps)
 
 	if err != nil {
@@ -1039,6 +1382,7 @@ func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.Use
 
 	// Check each OTP to find a valid one that matches the provided token
 	validOTP := (*models.OTPToken)(nil)
+	var activeOTPs []models.OTPToken
 	now := time.Now().UTC()
 
 	for i := range otps {
@@ -1049,6 +1393,7 @@ func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.Use
 		if otps[i].Used || otps[i].ExpiresAt.Before(now) {
 			continue
 		}
+		activeOTPs = append(activeOTPs, otps[i])
 
 		// Verify the token hash
 		isValid, verifyErr := db.crypto.VerifyOTP(token, otps[i].Token)
@@ -1066,27 +1411,27 @@ func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.Use
 
 	if validOTP == nil {
 		log.Printf("No valid OTP found - all are either used, expired, or don't match")
+		if err := db.recordOTPFailure(ctx, email, emailHash, activeOTPs); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("OTP is invalid, used, or expired")
 	}
 
-	// Mark OTP as used
+	// Burn the code; a concurrent submission or lockout may have got there first
 	log.Printf("Marking OTP as used: %s", validOTP.ID.String())
-	_, err = db.client.From("otp_tokens").
-		Update(map[string]interface{}{"used": true}, "", "").
-		Eq("id", validOTP.ID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to mark OTP as used: %v", err)
-		return nil, fmt.Errorf("failed to mark OTP as used: %w", err)
+	if err := db.consumeOTP(ctx, email, emailHash, validOTP.ID); err != nil {
+		return nil, err
 	}
-
 	log.Printf("OTP marked as used successfully")
 
 	// Get or create user
 	log.Printf("Looking up user by email: %s", email)
 	user, err := db.GetUserByEmail(ctx, email)
-	if err != nil {
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		// A failed lookup must not create a second account for the same email
+		return nil, err
+	}
+	if errors.Is(err, ErrUserNotFound) {
 		log.Printf("User not found, creating new user: %s", email)
 		// Create new user
 		user, err = db.CreateUser(ctx, email, "")
@@ -1104,7 +1449,7 @@ func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.Use
 			// Delete the broken user record by encrypted email
 			_, deleteErr := db.client.From("users").
 				Delete("", "").
-				Eq("email", encryptedEmail).
+				Eq("email", user.Email).
 				ExecuteTo(nil)
 			if deleteErr != nil {
 				log.Printf("Failed to delete broken user record: %v", deleteErr)
@@ -1126,6 +1471,9 @@ func (db *DB) ValidateOTP(ctx context.Context, email, token string) (*models.Use
 
 // User profile operations
 func (db *DB) UpdateUserProfile(ctx context.Context, userID uuid.UUID, updates map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "UpdateUserProfile")
+	defer span.End()
+
 	updates["updated_at"] = time.Now()
 
 	_, err := db.client.From("users").
@@ -1136,6 +1484,7 @@ func (db *DB) UpdateUserProfile(ctx context.Context, userID uuid.UUID, updates m
 	if err != nil {
 		return fmt.Errorf("failed to update user profile: %w", err)
 	}
+	db.invalidate(ctx, userCacheKey(userID))
 
 	return nil
 }
@@ -1143,6 +1492,9 @@ func (db *DB) UpdateUserProfile(ctx context.Context, userID uuid.UUID, updates m
 // Contact management operations
 // GetUserContacts returns all users that have been invited to any board by the current user
 func (db *DB) GetUserContacts(ctx context.Context, userID uuid.UUID) ([]map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "GetUserContacts")
+	defer span.End()
+
 	// Get all boards owned by the user
 	var ownedBoards []models.Board
 	_, err := db.client.From("boards").
@@ -1241,6 +1593,9 @@ func (db *DB) GetUserContacts(ctx context.Context, userID uuid.UUID) ([]map[stri
 
 // GetContactBoards returns all boards where a specific contact is a member, owned by the current user
 func (db *DB) GetContactBoards(ctx context.Context, userID, contactID uuid.UUID) ([]map[string]interface{}, error) {
+	ctx, span := startSpan(ctx, "GetContactBoards")
+	defer span.End()
+
 	// Get all boards owned by the user
 	var ownedBoards []models.Board
 	_, err := db.client.From("boards").
@@ -1282,6 +1637,9 @@ func (db *DB) GetContactBoards(ctx context.Context, userID, contactID uuid.UUID)
 
 // RemoveContactFromAllBoards removes a contact from all boards owned by the current user
 func (db *DB) RemoveContactFromAllBoards(ctx context.Context, userID, contactID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RemoveContactFromAllBoards")
+	defer span.End()
+
 	// Get all boards owned by the user
 	var ownedBoards []models.Board
 	_, err := db.client.From("boards").
@@ -1305,136 +1663,41 @@ func (db *DB) RemoveContactFromAllBoards(ctx context.Context, userID, contactID
 	return nil
 }
 
-// DeleteUserAccount permanently deletes a user and ALL associated data
+// DeleteUserAccount permanently deletes a user and ALL associated data in one transaction
 // This is a destructive operation that cannot be undone
 func (db *DB) DeleteUserAccount(ctx context.Context, userID uuid.UUID) error {
-	log.Printf("Starting account deletion for user %s", userID.String())
-
-	// Step 1: Get all boards owned by the user (need to delete these first)
-	var ownedBoards []models.Board
-	_, err := db.client.From("boards").
-		Select("id", "", false).
-		Eq("owner_id", userID.String()).
-		ExecuteTo(&ownedBoards)
-
-	if err != nil {
-		log.Printf("Failed to get owned boards for deletion: %v", err)
-		// Continue anyway
-	}
-
-	// Step 2: Delete all owned boards (this will CASCADE delete columns, tasks, etc.)
-	for _, board := range ownedBoards {
-		log.Printf("Deleting owned board %s", board.ID.String())
-		err = db.DeleteBoard(ctx, board.ID)
-		if err != nil {
-			log.Printf("Failed to delete board %s: %v", board.ID.String(), err)
-			// Continue deleting other boards
-		}
-	}
+	ctx, span := startSpan(ctx, "DeleteUserAccount")
+	defer span.End()
 
-	// Step 3: Remove user from all board memberships where they're not the owner
-	_, err = db.client.From("board_members").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete board memberships: %v", err)
-	}
+	log.Printf("Starting account deletion for user %s", userID.String())
 
-	// Step 4: Delete all OTP tokens for this user
-	// First get the encrypted email
+	// OTP tokens are keyed by the email's blind indexes, which only we can compute
 	user, err := db.GetUserByID(ctx, userID)
-	if err == nil && user != nil && user.Email != "" {
-		_, err = db.client.From("otp_tokens").
-			Delete("", "").
-			Eq("email", user.Email).
-			ExecuteTo(nil)
-
-		if err != nil {
-			log.Printf("Failed to delete OTP tokens: %v", err)
-		}
-	}
-
-	// Step 5: Delete all user presence records
-	_, err = db.client.From("user_presence").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
 	if err != nil {
-		log.Printf("Failed to delete user presence: %v", err)
+		return fmt.Errorf("failed to get user for deletion: %w", err)
 	}
-
-	// Step 6: Delete all realtime sessions
-	_, err = db.client.From("realtime_sessions").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete realtime sessions: %v", err)
+	emailHashes := []string{}
+	if user.DecryptedEmail != "" {
+		emailHashes = db.crypto.EmailBlindIndexes(user.DecryptedEmail)
 	}
 
-	// Step 7: Delete all activity logs
-	_, err = db.client.From("activity_log").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
+	// Boards whose cached owner or members change with the account
+	boards, err := db.GetUserBoards(ctx, userID)
 	if err != nil {
-		log.Printf("Failed to delete activity logs: %v", err)
+		log.Printf("Warning: Failed to list boards of user %s, their cache entries will expire instead: %v", userID.String(), err)
 	}
 
-	// Step 8: Delete all comments by this user
-	_, err = db.client.From("comments").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete comments: %v", err)
+	params := map[string]interface{}{
+		"p_user_id":      userID.String(),
+		"p_email_hashes": emailHashes,
 	}
-
-	// Step 9: Delete all task assignees for this user
-	_, err = db.client.From("task_assignees").
-		Delete("", "").
-		Eq("user_id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete task assignees: %v", err)
-	}
-
-	// Step 10: Delete all proposed edits by this user
-	_, err = db.client.From("proposed_edits").
-		Delete("", "").
-		Eq("proposed_by", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete proposed edits: %v", err)
-	}
-
-	// Step 11: Delete all approval notifications for this user
-	_, err = db.client.From("approval_notifications").
-		Delete("", "").
-		Eq("recipient_id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		log.Printf("Failed to delete approval notifications: %v", err)
+	if err := db.rpc("delete_user_account", params, nil); err != nil {
+		return fmt.Errorf("failed to delete user account: %w", err)
 	}
 
-	// Step 12: Finally, delete the user record itself
-	// This will CASCADE delete any remaining references
-	_, err = db.client.From("users").
-		Delete("", "").
-		Eq("id", userID.String()).
-		ExecuteTo(nil)
-
-	if err != nil {
-		return fmt.Errorf("failed to delete user account: %w", err)
+	db.invalidate(ctx, userCacheKey(userID))
+	for _, board := range boards {
+		db.invalidateBoards(ctx, board.ID)
 	}
 
 	log.Printf("Successfully deleted all data for user %s", userID.String())
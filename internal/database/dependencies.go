@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxDependencyWalk bounds the cycle check on very large dependency graphs
+const maxDependencyWalk = 5000
+
+func (db *DB) CreateTaskDependency(ctx context.Context, sourceTaskID, targetTaskID uuid.UUID, dependencyType string, createdBy uuid.UUID) (*models.TaskDependency, error) {
+	ctx, span := startSpan(ctx, "CreateTaskDependency")
+	defer span.End()
+
+	dependency := map[string]interface{}{
+		"source_task_id": sourceTaskID.String(),
+		"target_task_id": targetTaskID.String(),
+		"type":           dependencyType,
+		"created_by":     createdBy.String(),
+	}
+
+	var result []models.TaskDependency
+	_, err := db.client.From("task_dependencies").
+		Insert(dependency, false, "", "", "").
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task dependency: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created task dependency")
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) GetTaskDependency(ctx context.Context, dependencyID uuid.UUID) (*models.TaskDependency, error) {
+	ctx, span := startSpan(ctx, "GetTaskDependency")
+	defer span.End()
+
+	var dependencies []models.TaskDependency
+	_, err := db.client.From("task_dependencies").
+		Select("*", "", false).
+		Eq("id", dependencyID.String()).
+		ExecuteTo(&dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task dependency: %w", err)
+	}
+	if len(dependencies) == 0 {
+		return nil, fmt.Errorf("task dependency not found")
+	}
+
+	return &dependencies[0], nil
+}
+
+func (db *DB) DeleteTaskDependency(ctx context.Context, dependencyID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteTaskDependency")
+	defer span.End()
+
+	_, err := db.client.From("task_dependencies").
+		Delete("", "").
+		Eq("id", dependencyID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete task dependency: %w", err)
+	}
+
+	return nil
+}
+
+// TaskDependencyExists reports whether the two tasks are already linked with this type,
+// in either direction
+func (db *DB) TaskDependencyExists(ctx context.Context, taskA, taskB uuid.UUID, dependencyType string) (bool, error) {
+	ctx, span := startSpan(ctx, "TaskDependencyExists")
+	defer span.End()
+
+	var dependencies []models.TaskDependency
+	_, err := db.client.From("task_dependencies").
+		Select("id", "", false).
+		Eq("type", dependencyType).
+		Or(fmt.Sprintf("and(source_task_id.eq.%s,target_task_id.eq.%s),and(source_task_id.eq.%s,target_task_id.eq.%s)",
+			taskA.String(), taskB.String(), taskB.String(), taskA.String()), "").
+		ExecuteTo(&dependencies)
+	if err != nil {
+		return false, fmt.Errorf("failed to check task dependency: %w", err)
+	}
+
+	return len(dependencies) > 0, nil
+}
+
+// GetTaskDependencies returns every link of a task, with the linked tasks (and their
+// columns, so done-ness can be checked) filled in
+func (db *DB) GetTaskDependencies(ctx context.Context, taskID uuid.UUID) ([]models.TaskDependency, error) {
+	ctx, span := startSpan(ctx, "GetTaskDependencies")
+	defer span.End()
+
+	byTask, err := db.getDependenciesForTasks(ctx, []uuid.UUID{taskID})
+	if err != nil {
+		return nil, err
+	}
+	return byTask[taskID], nil
+}
+
+// attachDependencies fills in Dependencies for a batch of tasks with three queries in total
+func (db *DB) attachDependencies(ctx context.Context, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	taskIDs := make([]uuid.UUID, len(tasks))
+	for i := range tasks {
+		taskIDs[i] = tasks[i].ID
+	}
+
+	byTask, err := db.getDependenciesForTasks(ctx, taskIDs)
+	if err != nil {
+		return err
+	}
+	for i := range tasks {
+		tasks[i].Dependencies = byTask[tasks[i].ID]
+	}
+	return nil
+}
+
+func (db *DB) getDependenciesForTasks(ctx context.Context, taskIDs []uuid.UUID) (map[uuid.UUID][]models.TaskDependency, error) {
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+	idList := strings.Join(ids, ",")
+
+	var dependencies []models.TaskDependency
+	_, err := db.client.From("task_dependencies").
+		Select("*", "", false).
+		Or(fmt.Sprintf("source_task_id.in.(%s),target_task_id.in.(%s)", idList, idList), "").
+		ExecuteTo(&dependencies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task dependencies: %w", err)
+	}
+
+	byTask := make(map[uuid.UUID][]models.TaskDependency)
+	if len(dependencies) == 0 {
+		return byTask, nil
+	}
+
+	seen := make(map[uuid.UUID]bool)
+	var linkedIDs []string
+	for _, dependency := range dependencies {
+		for _, id := range []uuid.UUID{dependency.SourceTaskID, dependency.TargetTaskID} {
+			if !seen[id] {
+				seen[id] = true
+				linkedIDs = append(linkedIDs, id.String())
+			}
+		}
+	}
+
+	var linked []models.Task
+	_, err = db.client.From("tasks").
+		Select("id, title, board_id, column_id, priority, completed", "", false).
+		In("id", linkedIDs).
+		ExecuteTo(&linked)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get linked tasks: %w", err)
+	}
+
+	columnIDs := make([]string, 0, len(linked))
+	for _, task := range linked {
+		columnIDs = append(columnIDs, task.ColumnID.String())
+	}
+	var columns []models.Column
+	_, err = db.client.From("columns").
+		Select("id, board_id, title, settings", "", false).
+		In("id", columnIDs).
+		ExecuteTo(&columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get linked task columns: %w", err)
+	}
+
+	columnsByID := make(map[uuid.UUID]*models.Column, len(columns))
+	for i := range columns {
+		columnsByID[columns[i].ID] = &columns[i]
+	}
+	tasksByID := make(map[uuid.UUID]*models.Task, len(linked))
+	for i := range linked {
+		linked[i].Column = columnsByID[linked[i].ColumnID]
+		tasksByID[linked[i].ID] = &linked[i]
+	}
+
+	for _, dependency := range dependencies {
+		dependency.SourceTask = tasksByID[dependency.SourceTaskID]
+		dependency.TargetTask = tasksByID[dependency.TargetTaskID]
+		byTask[dependency.SourceTaskID] = append(byTask[dependency.SourceTaskID], dependency)
+		byTask[dependency.TargetTaskID] = append(byTask[dependency.TargetTaskID], dependency)
+	}
+
+	return byTask, nil
+}
+
+// BlocksTransitively reports whether from already blocks to, directly or through a chain
+// of "blocks" links. Adding "to blocks from" would then close a cycle.
+func (db *DB) BlocksTransitively(ctx context.Context, from, to uuid.UUID) (bool, error) {
+	ctx, span := startSpan(ctx, "BlocksTransitively")
+	defer span.End()
+
+	visited := map[uuid.UUID]bool{from: true}
+	frontier := []string{from.String()}
+
+	for len(frontier) > 0 {
+		var edges []models.TaskDependency
+		_, err := db.client.From("task_dependencies").
+			Select("source_task_id, target_task_id", "", false).
+			Eq("type", models.DependencyBlocks).
+			In("source_task_id", frontier).
+			ExecuteTo(&edges)
+		if err != nil {
+			return false, fmt.Errorf("failed to walk task dependencies: %w", err)
+		}
+
+		frontier = frontier[:0]
+		for _, edge := range edges {
+			if edge.TargetTaskID == to {
+				return true, nil
+			}
+			if visited[edge.TargetTaskID] {
+				continue
+			}
+			visited[edge.TargetTaskID] = true
+			frontier = append(frontier, edge.TargetTaskID.String())
+		}
+
+		if len(visited) > maxDependencyWalk {
+			return false, fmt.Errorf("dependency graph too large to check for cycles")
+		}
+	}
+
+	return false, nil
+}
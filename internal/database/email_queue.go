@@ -0,0 +1,271 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// Encryption context for queued email bodies
+const emailPayloadContext = "email-queue"
+
+type emailPayload struct {
+	HTML    string `json:"html"`
+	Text    string `json:"text,omitempty"`
+	ReplyTo string `json:"reply_to,omitempty"`
+}
+
+// EnqueueEmail stores a rendered email for the delivery worker. The recipient and bodies are
+// encrypted at rest since they can contain login codes.
+func (db *DB) EnqueueEmail(ctx context.Context, job *models.EmailJob) (*models.EmailJob, error) {
+	ctx, span := startSpan(ctx, "EnqueueEmail")
+	defer span.End()
+
+	recipient, err := db.crypto.EncryptEmail(job.To)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt email recipient: %w", err)
+	}
+
+	payloadJSON, err := json.Marshal(emailPayload{HTML: job.HTMLBody, Text: job.TextBody, ReplyTo: job.ReplyTo})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal email payload: %w", err)
+	}
+	payload, err := db.crypto.EncryptRecord(string(payloadJSON), emailPayloadContext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt email payload: %w", err)
+	}
+
+	data := map[string]interface{}{
+		"kind":            job.Kind,
+		"recipient":       recipient,
+		"subject":         job.Subject,
+		"payload":         payload,
+		"status":          models.EmailStatusPending,
+		"next_attempt_at": time.Now().UTC(),
+	}
+	if job.ExpiresAt != nil {
+		data["expires_at"] = job.ExpiresAt.UTC()
+	}
+
+	var result []models.EmailJob
+	_, err = db.client.From("email_queue").Insert(data, false, "", "", "").ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enqueue email: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get enqueued email data")
+	}
+
+	queued := result[0]
+	queued.To, queued.HTMLBody, queued.TextBody, queued.ReplyTo = job.To, job.HTMLBody, job.TextBody, job.ReplyTo
+	return &queued, nil
+}
+
+// ClaimEmailJobs leases up to limit due jobs to the caller for the lease duration. A job is only
+// handed to one worker; jobs whose worker died are picked up again once their lease runs out.
+func (db *DB) ClaimEmailJobs(ctx context.Context, limit int, lease time.Duration) ([]models.EmailJob, error) {
+	ctx, span := startSpan(ctx, "ClaimEmailJobs")
+	defer span.End()
+
+	now := time.Now().UTC()
+
+	// Release jobs left behind by a worker that never reported back
+	_, err := db.client.From("email_queue").
+		Update(map[string]interface{}{"status": models.EmailStatusPending, "locked_until": nil}, "", "").
+		Eq("status", models.EmailStatusSending).
+		Lt("locked_until", now.Format(time.RFC3339)).
+		ExecuteTo(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to release expired email leases: %w", err)
+	}
+
+	var due []models.EmailJob
+	_, err = db.client.From("email_queue").
+		Select("*", "", false).
+		Eq("status", models.EmailStatusPending).
+		Lte("next_attempt_at", now.Format(time.RFC3339)).
+		Order("next_attempt_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(limit, "").
+		ExecuteTo(&due)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load due emails: %w", err)
+	}
+
+	lockedUntil := now.Add(lease)
+	claimed := make([]models.EmailJob, 0, len(due))
+	for _, job := range due {
+		// Only claim the job if no other worker changed its status in the meantime
+		var rows []models.EmailJob
+		_, err := db.client.From("email_queue").
+			Update(map[string]interface{}{
+				"status":       models.EmailStatusSending,
+				"locked_until": lockedUntil,
+			}, "", "").
+			Eq("id", job.ID.String()).
+			Eq("status", models.EmailStatusPending).
+			ExecuteTo(&rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to claim email %s: %w", job.ID.String(), err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		job = rows[0]
+		if err := db.decryptEmailJob(&job); err != nil {
+			// Undecryptable jobs can never be delivered
+			if failErr := db.FailEmailJob(ctx, job.ID, job.Attempts, time.Time{}, err.Error(), true); failErr != nil {
+				return nil, failErr
+			}
+			continue
+		}
+		claimed = append(claimed, job)
+	}
+
+	return claimed, nil
+}
+
+// CompleteEmailJob removes a delivered job, so sent bodies are not kept around
+func (db *DB) CompleteEmailJob(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "CompleteEmailJob")
+	defer span.End()
+
+	return db.DeleteEmailJob(ctx, id)
+}
+
+// FailEmailJob records a failed attempt and either schedules the next one or moves the job to the dead letters
+func (db *DB) FailEmailJob(ctx context.Context, id uuid.UUID, attempts int, nextAttempt time.Time, lastError string, dead bool) error {
+	ctx, span := startSpan(ctx, "FailEmailJob")
+	defer span.End()
+
+	updates := map[string]interface{}{
+		"attempts":     attempts,
+		"last_error":   lastError,
+		"locked_until": nil,
+	}
+	if dead {
+		updates["status"] = models.EmailStatusDead
+	} else {
+		updates["status"] = models.EmailStatusPending
+		updates["next_attempt_at"] = nextAttempt.UTC()
+	}
+
+	_, err := db.client.From("email_queue").
+		Update(updates, "", "").
+		Eq("id", id.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to record email failure: %w", err)
+	}
+	return nil
+}
+
+// ListDeadEmailJobs returns the dead letters, newest first, with the recipient decrypted
+func (db *DB) ListDeadEmailJobs(ctx context.Context, limit int) ([]models.EmailJob, error) {
+	ctx, span := startSpan(ctx, "ListDeadEmailJobs")
+	defer span.End()
+
+	var jobs []models.EmailJob
+	_, err := db.client.From("email_queue").
+		Select("id, kind, recipient, subject, status, attempts, next_attempt_at, expires_at, last_error, created_at, updated_at", "", false).
+		Eq("status", models.EmailStatusDead).
+		Order("updated_at", &postgrest.OrderOpts{Ascending: false}).
+		Limit(limit, "").
+		ExecuteTo(&jobs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dead emails: %w", err)
+	}
+
+	for i := range jobs {
+		if to, err := db.crypto.DecryptEmail(jobs[i].Recipient); err == nil {
+			jobs[i].To = to
+		}
+	}
+	return jobs, nil
+}
+
+// RetryEmailJob puts a dead letter back in the queue with a fresh attempt budget
+func (db *DB) RetryEmailJob(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RetryEmailJob")
+	defer span.End()
+
+	var rows []models.EmailJob
+	_, err := db.client.From("email_queue").
+		Update(map[string]interface{}{
+			"status":          models.EmailStatusPending,
+			"attempts":        0,
+			"next_attempt_at": time.Now().UTC(),
+			"expires_at":      nil,
+		}, "", "").
+		Eq("id", id.String()).
+		Eq("status", models.EmailStatusDead).
+		ExecuteTo(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to retry email: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("dead email %s not found", id.String())
+	}
+	return nil
+}
+
+// DeleteEmailJob removes a job from the queue
+func (db *DB) DeleteEmailJob(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteEmailJob")
+	defer span.End()
+
+	_, err := db.client.From("email_queue").
+		Delete("", "").
+		Eq("id", id.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete email: %w", err)
+	}
+	return nil
+}
+
+// DiscardDeadEmailJob deletes a dead letter; jobs still in the queue are left alone
+func (db *DB) DiscardDeadEmailJob(ctx context.Context, id uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DiscardDeadEmailJob")
+	defer span.End()
+
+	var rows []models.EmailJob
+	_, err := db.client.From("email_queue").
+		Delete("", "").
+		Eq("id", id.String()).
+		Eq("status", models.EmailStatusDead).
+		ExecuteTo(&rows)
+	if err != nil {
+		return fmt.Errorf("failed to discard email: %w", err)
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("dead email %s not found", id.String())
+	}
+	return nil
+}
+
+func (db *DB) decryptEmailJob(job *models.EmailJob) error {
+	to, err := db.crypto.DecryptEmail(job.Recipient)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt email recipient: %w", err)
+	}
+
+	payloadJSON, err := db.crypto.DecryptRecord(job.Payload, emailPayloadContext)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt email payload: %w", err)
+	}
+
+	var payload emailPayload
+	if err := json.Unmarshal([]byte(payloadJSON), &payload); err != nil {
+		return fmt.Errorf("failed to parse email payload: %w", err)
+	}
+
+	job.To, job.HTMLBody, job.TextBody, job.ReplyTo = to, payload.HTML, payload.Text, payload.ReplyTo
+	return nil
+}
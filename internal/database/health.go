@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// Ping runs a minimal query against PostgREST. The client does not take a context,
+// so a slow database is cut off by returning when ctx is done.
+func (db *DB) Ping(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		var rows []map[string]interface{}
+		_, err := db.client.From("schema_migrations").
+			Select("version", "", false).
+			Limit(1, "").
+			ExecuteTo(&rows)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("failed to query database: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("database did not answer: %w", ctx.Err())
+	}
+}
+
+// CheckCrypto verifies the email encryption key works
+func (db *DB) CheckCrypto() error {
+	if err := db.crypto.SelfTest(); err != nil {
+		return fmt.Errorf("encryption key check failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/supabase-community/supabase-go"
+)
+
+func TestPing(t *testing.T) {
+	db, store := newFakeDB(t)
+	if err := db.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping failed: %v", err)
+	}
+	if store.count() != 1 {
+		t.Errorf("Ping made %d queries, want 1", store.count())
+	}
+	if err := db.CheckCrypto(); err != nil {
+		t.Errorf("CheckCrypto failed: %v", err)
+	}
+
+	// A database that never answers is reported once the deadline passes
+	release := make(chan struct{})
+	hung := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(hung.Close)
+	t.Cleanup(func() { close(release) })
+	client, err := supabase.NewClient(hung.URL, "test-key", nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	db.client = client
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := db.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ping of a hung database = %v, want a deadline error", err)
+	}
+}
@@ -0,0 +1,80 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+type boardInboundToken struct {
+	ID    uuid.UUID `json:"id"`
+	Token *string   `json:"inbound_email_token"`
+}
+
+// GetBoardInboundToken returns the secret token in the board's inbound email address,
+// creating it the first time it is asked for
+func (db *DB) GetBoardInboundToken(ctx context.Context, boardID uuid.UUID) (string, error) {
+	ctx, span := startSpan(ctx, "GetBoardInboundToken")
+	defer span.End()
+
+	var rows []boardInboundToken
+	_, err := db.client.From("boards").
+		Select("id, inbound_email_token", "", false).
+		Eq("id", boardID.String()).
+		ExecuteTo(&rows)
+	if err != nil {
+		return "", fmt.Errorf("failed to get board inbound token: %w", err)
+	}
+	if len(rows) == 0 {
+		return "", fmt.Errorf("board not found")
+	}
+	if rows[0].Token != nil && *rows[0].Token != "" {
+		return *rows[0].Token, nil
+	}
+
+	tokenBytes := make([]byte, 15)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return "", fmt.Errorf("failed to generate inbound token: %w", err)
+	}
+	token := strings.ToLower(base32.StdEncoding.EncodeToString(tokenBytes))
+
+	// Only set the token if no concurrent request beat us to it
+	_, err = db.client.From("boards").
+		Update(map[string]interface{}{"inbound_email_token": token}, "", "").
+		Eq("id", boardID.String()).
+		Is("inbound_email_token", "null").
+		ExecuteTo(&rows)
+	if err != nil {
+		return "", fmt.Errorf("failed to save board inbound token: %w", err)
+	}
+	if len(rows) == 0 || rows[0].Token == nil {
+		return db.GetBoardInboundToken(ctx, boardID)
+	}
+	return *rows[0].Token, nil
+}
+
+// GetBoardByInboundToken finds the board an inbound email address belongs to
+func (db *DB) GetBoardByInboundToken(ctx context.Context, token string) (*models.Board, error) {
+	ctx, span := startSpan(ctx, "GetBoardByInboundToken")
+	defer span.End()
+
+	var boards []models.Board
+	_, err := db.client.From("boards").
+		Select("*", "", false).
+		Eq("inbound_email_token", strings.ToLower(token)).
+		Eq("archived", "false").
+		ExecuteTo(&boards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board by inbound token: %w", err)
+	}
+	if len(boards) == 0 {
+		return nil, fmt.Errorf("board not found")
+	}
+	return &boards[0], nil
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// EmailKeyRotationTables are the tables holding encrypted emails, in the order they are rotated
+var EmailKeyRotationTables = []string{"users", "otp_tokens"}
+
+// KeyRotationBatch summarises one batch of RotateEmailBatch
+type KeyRotationBatch struct {
+	Table   string
+	Scanned int
+	Rotated int
+	Failed  int
+	// LastID is the cursor to pass as afterID for the next batch; empty when the table is done
+	LastID string
+}
+
+type encryptedEmailRow struct {
+	ID    uuid.UUID `json:"id"`
+	Email string    `json:"email"`
+}
+
+// legacyEmailRecheck is how long an answer of legacyEmailsRemain is reused
+const legacyEmailRecheck = time.Minute
+
+// legacyEmailGate remembers whether users without a blind index are left. Rows are only
+// ever moved off the legacy format, so once none remain the answer is final.
+type legacyEmailGate struct {
+	mu        sync.Mutex
+	done      bool
+	remain    bool
+	checkedAt time.Time
+}
+
+// legacyEmailsRemain reports whether some users still have no email_hash, so lookups that
+// miss the blind index must try the legacy ciphertexts. RotateEmailBatch clears the
+// flag when it finds no legacy users; otherwise the table is checked at most once per
+// legacyEmailRecheck. A failed check keeps the fallback on.
+func (db *DB) legacyEmailsRemain(ctx context.Context) bool {
+	g := &db.legacyEmails
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.done {
+		return false
+	}
+	if !g.checkedAt.IsZero() && time.Since(g.checkedAt) < legacyEmailRecheck {
+		return g.remain
+	}
+
+	var rows []encryptedEmailRow
+	_, err := db.client.From("users").
+		Select("id", "", false).
+		Is("email_hash", "null").
+		Limit(1, "").
+		ExecuteTo(&rows)
+	if err != nil {
+		log.Printf("Failed to check for legacy email rows: %v", err)
+		return true
+	}
+
+	g.checkedAt = time.Now()
+	g.remain = len(rows) > 0
+	g.done = !g.remain
+	if g.done {
+		log.Printf("All users have an email blind index; legacy email lookups are off")
+	}
+	return g.remain
+}
+
+// markLegacyEmailsDone turns the legacy lookup off after a rotation left no legacy users
+func (db *DB) markLegacyEmailsDone() {
+	db.legacyEmails.mu.Lock()
+	defer db.legacyEmails.mu.Unlock()
+	db.legacyEmails.done = true
+}
+
+// CurrentKeyVersion returns the encryption key version used for new ciphertexts
+func (db *DB) CurrentKeyVersion() int {
+	return db.crypto.KeyVersion()
+}
+
+// RotateEmailBatch re-encrypts up to batchSize emails in table that are not yet on the current key
+// and randomized format, filling in the blind index as it goes. Rows are ordered by id, starting
+// after afterID. Rows that are already rotated no longer match, so a rotation can be resumed from
+// the last reported cursor or simply started again.
+func (db *DB) RotateEmailBatch(ctx context.Context, table, afterID string, batchSize int, dryRun bool) (*KeyRotationBatch, error) {
+	ctx, span := startSpan(ctx, "RotateEmailBatch")
+	defer span.End()
+
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size must be positive")
+	}
+
+	query := db.client.From(table).
+		Select("id, email", "", false).
+		Not("email", "like", db.crypto.CurrentEmailPrefix()+"*")
+	if afterID != "" {
+		query = query.Gt("id", afterID)
+	}
+
+	var rows []encryptedEmailRow
+	_, err := query.
+		Order("id", &postgrest.OrderOpts{Ascending: true}).
+		Limit(batchSize, "").
+		ExecuteTo(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s for key rotation: %w", table, err)
+	}
+
+	batch := &KeyRotationBatch{Table: table, Scanned: len(rows)}
+	for _, row := range rows {
+		batch.LastID = row.ID.String()
+
+		email, err := db.crypto.DecryptEmail(row.Email)
+		if err != nil {
+			log.Printf("Key rotation: failed to decrypt %s %s: %v", table, row.ID.String(), err)
+			batch.Failed++
+			continue
+		}
+
+		reencrypted, err := db.crypto.EncryptEmail(email)
+		if err != nil {
+			log.Printf("Key rotation: failed to re-encrypt %s %s: %v", table, row.ID.String(), err)
+			batch.Failed++
+			continue
+		}
+
+		if !dryRun {
+			_, err = db.client.From(table).
+				Update(map[string]interface{}{
+					"email":      reencrypted,
+					"email_hash": db.crypto.EmailBlindIndex(email),
+				}, "", "").
+				Eq("id", row.ID.String()).
+				ExecuteTo(nil)
+			if err != nil {
+				log.Printf("Key rotation: failed to update %s %s: %v", table, row.ID.String(), err)
+				batch.Failed++
+				continue
+			}
+			if table == "users" {
+				db.invalidate(ctx, userCacheKey(row.ID))
+			}
+		}
+		batch.Rotated++
+	}
+
+	if len(rows) < batchSize {
+		batch.LastID = ""
+		// A full pass over users that found nothing left to rotate ends the legacy lookup
+		if table == "users" && afterID == "" && len(rows) == 0 && !dryRun {
+			db.markLegacyEmailsDone()
+		}
+	}
+	return batch, nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestLegacyEmailLookupStopsWhenNoLegacyRowsRemain(t *testing.T) {
+	db, store := newFakeDB(t)
+	store.insert("users", map[string]interface{}{"id": uuid.NewString(), "email": "v2:abc", "email_hash": "hash"})
+
+	if _, err := db.GetUserByEmail(context.Background(), "nobody@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUserByEmail = %v, want ErrUserNotFound", err)
+	}
+	// One blind index lookup plus the check for legacy rows
+	if n := store.count(); n != 2 {
+		t.Errorf("first miss made %d queries, want 2", n)
+	}
+
+	before := store.count()
+	if _, err := db.GetUserByEmail(context.Background(), "typo@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Fatalf("GetUserByEmail = %v, want ErrUserNotFound", err)
+	}
+	if n := store.count() - before; n != 1 {
+		t.Errorf("miss without legacy rows made %d queries, want only the blind index lookup", n)
+	}
+}
+
+func TestLegacyEmailLookupWhileLegacyRowsRemain(t *testing.T) {
+	db, store := newFakeDB(t)
+	store.insert("users", map[string]interface{}{"id": uuid.NewString(), "email": "legacy", "email_hash": nil})
+
+	if !db.legacyEmailsRemain(context.Background()) {
+		t.Fatal("legacyEmailsRemain = false with a legacy row present")
+	}
+	before := store.count()
+	if !db.legacyEmailsRemain(context.Background()) || store.count() != before {
+		t.Error("the answer should be reused until the recheck interval passes")
+	}
+
+	// A rotation pass over users that finds nothing left turns the fallback off for good
+	store.tables["users"] = nil
+	if _, err := db.RotateEmailBatch(context.Background(), "users", "", 10, false); err != nil {
+		t.Fatalf("RotateEmailBatch failed: %v", err)
+	}
+	if db.legacyEmailsRemain(context.Background()) {
+		t.Error("legacyEmailsRemain = true after a rotation found no legacy rows")
+	}
+}
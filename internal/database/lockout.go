@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sudo/internal/logging"
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// MaxOTPAttempts is how many wrong guesses a single code survives (matches the otp_tokens.attempts CHECK)
+	MaxOTPAttempts = 5
+	// MaxOTPFailures is how many wrong guesses an email gets across codes before it is locked out
+	MaxOTPFailures = 5
+	// OTPResendCooldown is the minimum delay between two codes sent to the same email
+	OTPResendCooldown = time.Minute
+
+	// Lockouts double from the base duration on every repeat, up to the cap.
+	// record_otp_failure applies the schedule.
+	otpBaseLockout = time.Minute
+	otpMaxLockout  = 24 * time.Hour
+)
+
+// OTPThrottleError is returned when an email is locked out or must wait before requesting another code
+type OTPThrottleError struct {
+	Locked     bool
+	RetryAfter time.Duration
+}
+
+func (e *OTPThrottleError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("too many failed attempts, try again in %s", e.RetryAfter.Round(time.Second))
+	}
+	return fmt.Sprintf("please wait %s before requesting another code", e.RetryAfter.Round(time.Second))
+}
+
+// RateLimitKey exposes the crypto service's keyed hash so limiters never store plaintext emails
+func (db *DB) RateLimitKey(identifier string) string {
+	return db.crypto.RateLimitKey(identifier)
+}
+
+// getOTPLockout loads the lockout row for an email blind index, or nil when there is none
+func (db *DB) getOTPLockout(ctx context.Context, emailHash string) (*models.OTPLockout, error) {
+	var lockouts []models.OTPLockout
+	_, err := db.client.From("otp_lockouts").
+		Select("*", "", false).
+		Eq("email_hash", emailHash).
+		ExecuteTo(&lockouts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OTP lockout: %w", err)
+	}
+
+	if len(lockouts) == 0 {
+		return nil, nil
+	}
+	return &lockouts[0], nil
+}
+
+// recordOTPSent stores when the last code went out. Only last_sent_at is written so a
+// send never overwrites counters that record_otp_failure changed in the meantime.
+func (db *DB) recordOTPSent(ctx context.Context, emailHash string, sentAt time.Time) error {
+	data := map[string]interface{}{
+		"email_hash":   emailHash,
+		"last_sent_at": sentAt,
+	}
+
+	_, err := db.client.From("otp_lockouts").Upsert(data, "email_hash", "", "").ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to record OTP send time: %w", err)
+	}
+	return nil
+}
+
+// checkOTPSendAllowed enforces the lockout and resend cooldown before a new code is issued
+func (db *DB) checkOTPSendAllowed(ctx context.Context, email, emailHash string) error {
+	lockout, err := db.getOTPLockout(ctx, emailHash)
+	if err != nil || lockout == nil {
+		return err
+	}
+
+	if lockout.IsLocked() {
+		logging.LogSecurityEvent("", "otp_send_blocked", fmt.Sprintf("key=%s reason=locked", db.RateLimitKey(email)))
+		return &OTPThrottleError{Locked: true, RetryAfter: time.Until(*lockout.LockedUntil)}
+	}
+
+	if lockout.LastSentAt != nil {
+		if wait := OTPResendCooldown - time.Since(*lockout.LastSentAt); wait > 0 {
+			logging.LogSecurityEvent("", "otp_send_blocked", fmt.Sprintf("key=%s reason=cooldown", db.RateLimitKey(email)))
+			return &OTPThrottleError{RetryAfter: wait}
+		}
+	}
+
+	return nil
+}
+
+// checkOTPVerifyAllowed rejects verification while the email is locked out
+func (db *DB) checkOTPVerifyAllowed(ctx context.Context, email, emailHash string) error {
+	lockout, err := db.getOTPLockout(ctx, emailHash)
+	if err != nil {
+		return err
+	}
+
+	if lockout.IsLocked() {
+		logging.LogSecurityEvent("", "otp_verify_blocked", fmt.Sprintf("key=%s", db.RateLimitKey(email)))
+		return &OTPThrottleError{Locked: true, RetryAfter: time.Until(*lockout.LockedUntil)}
+	}
+	return nil
+}
+
+// recordOTPFailure counts a wrong guess against every active code and the email itself.
+// Codes are invalidated after MaxOTPAttempts; the email is locked after MaxOTPFailures.
+// The counting and the lockout decision happen in one record_otp_failure call, so
+// parallel guesses cannot read the same count and slip past the limit.
+func (db *DB) recordOTPFailure(ctx context.Context, email, emailHash string, active []models.OTPToken) error {
+	ids := make([]string, 0, len(active))
+	for _, otp := range active {
+		ids = append(ids, otp.ID.String())
+		if otp.Attempts+1 >= MaxOTPAttempts {
+			logging.LogSecurityEvent("", "otp_invalidated", fmt.Sprintf("key=%s otp_id=%s", db.RateLimitKey(email), otp.ID.String()))
+		}
+	}
+
+	var lockout models.OTPLockout
+	err := db.rpc("record_otp_failure", map[string]interface{}{
+		"p_email_hash":   emailHash,
+		"p_token_ids":    ids,
+		"p_max_attempts": MaxOTPAttempts,
+		"p_max_failures": MaxOTPFailures,
+		"p_base_lockout": int(otpBaseLockout / time.Second),
+		"p_max_lockout":  int(otpMaxLockout / time.Second),
+	}, &lockout)
+	if err != nil {
+		return fmt.Errorf("failed to record OTP failure: %w", err)
+	}
+
+	// The function resets the counter exactly when this guess caused the lockout
+	if lockout.FailedAttempts > 0 || !lockout.IsLocked() {
+		logging.LogSecurityEvent("", "otp_verify_failed", fmt.Sprintf("key=%s failures=%d", db.RateLimitKey(email), lockout.FailedAttempts))
+		return nil
+	}
+
+	duration := time.Until(*lockout.LockedUntil)
+	logging.LogSecurityEvent("", "otp_verify_failed", fmt.Sprintf("key=%s failures=%d", db.RateLimitKey(email), MaxOTPFailures))
+	logging.LogSecurityEvent("", "otp_lockout", fmt.Sprintf("key=%s lockout_count=%d duration=%s",
+		db.RateLimitKey(email), lockout.LockoutCount, duration.Round(time.Second)))
+	return &OTPThrottleError{Locked: true, RetryAfter: duration}
+}
+
+// consumeOTP burns a matching code and clears the email's counters in one consume_otp
+// call. It fails when the code was already used, has expired, or the email was locked
+// out in the meantime.
+func (db *DB) consumeOTP(ctx context.Context, email, emailHash string, tokenID uuid.UUID) error {
+	var consumed bool
+	err := db.rpc("consume_otp", map[string]interface{}{
+		"p_token_id":   tokenID.String(),
+		"p_email_hash": emailHash,
+	}, &consumed)
+	if err != nil {
+		return fmt.Errorf("failed to mark OTP as used: %w", err)
+	}
+	if consumed {
+		return nil
+	}
+
+	if err := db.checkOTPVerifyAllowed(ctx, email, emailHash); err != nil {
+		return err
+	}
+	logging.LogSecurityEvent("", "otp_replayed", fmt.Sprintf("key=%s otp_id=%s", db.RateLimitKey(email), tokenID.String()))
+	return fmt.Errorf("OTP is invalid, used, or expired")
+}
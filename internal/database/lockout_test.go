@@ -0,0 +1,174 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestRecordOTPFailure(t *testing.T) {
+	db, store := newFakeDB(t)
+	tokenID := uuid.New()
+	active := []models.OTPToken{{ID: tokenID, Attempts: 1}}
+
+	var params map[string]interface{}
+	var result map[string]interface{}
+	store.rpcs["record_otp_failure"] = func(p map[string]interface{}) interface{} {
+		params = p
+		return result
+	}
+
+	t.Run("below the threshold", func(t *testing.T) {
+		result = map[string]interface{}{"email_hash": "hash", "failed_attempts": MaxOTPFailures - 1, "lockout_count": 0}
+		if err := db.recordOTPFailure(context.Background(), "ada@example.com", "hash", active); err != nil {
+			t.Fatalf("recordOTPFailure = %v, want nil", err)
+		}
+		ids, _ := params["p_token_ids"].([]interface{})
+		if params["p_email_hash"] != "hash" || len(ids) != 1 || ids[0] != tokenID.String() {
+			t.Errorf("record_otp_failure called with %v", params)
+		}
+		if params["p_max_failures"] != float64(MaxOTPFailures) || params["p_max_attempts"] != float64(MaxOTPAttempts) ||
+			params["p_base_lockout"] != otpBaseLockout.Seconds() || params["p_max_lockout"] != otpMaxLockout.Seconds() {
+			t.Errorf("record_otp_failure limits = %v", params)
+		}
+	})
+
+	t.Run("guess that reaches the threshold", func(t *testing.T) {
+		lockedUntil := time.Now().Add(2 * time.Minute).UTC()
+		result = map[string]interface{}{"email_hash": "hash", "failed_attempts": 0, "lockout_count": 2, "locked_until": lockedUntil}
+		err := db.recordOTPFailure(context.Background(), "ada@example.com", "hash", active)
+
+		var throttle *OTPThrottleError
+		if !errors.As(err, &throttle) || !throttle.Locked {
+			t.Fatalf("recordOTPFailure = %v, want a lockout", err)
+		}
+		if throttle.RetryAfter <= time.Minute || throttle.RetryAfter > 2*time.Minute {
+			t.Errorf("RetryAfter = %s, want about 2m", throttle.RetryAfter)
+		}
+	})
+
+	t.Run("expired lock from an earlier round", func(t *testing.T) {
+		result = map[string]interface{}{"email_hash": "hash", "failed_attempts": 1, "lockout_count": 1,
+			"locked_until": time.Now().Add(-time.Hour).UTC()}
+		if err := db.recordOTPFailure(context.Background(), "ada@example.com", "hash", nil); err != nil {
+			t.Errorf("recordOTPFailure = %v, want nil", err)
+		}
+	})
+
+	t.Run("function error", func(t *testing.T) {
+		result = map[string]interface{}{"code": "40001", "message": "could not serialize access"}
+		var rpcErr *RPCError
+		if err := db.recordOTPFailure(context.Background(), "ada@example.com", "hash", active); !errors.As(err, &rpcErr) {
+			t.Errorf("recordOTPFailure = %v, want the RPC error", err)
+		}
+	})
+}
+
+func TestOTPLockoutExpiry(t *testing.T) {
+	now := time.Now().UTC()
+	tests := []struct {
+		name       string
+		lockout    map[string]interface{}
+		sendLocked bool
+		sendWait   bool
+		verifyErr  bool
+	}{
+		{name: "no row"},
+		{name: "active lock", lockout: map[string]interface{}{"locked_until": now.Add(time.Minute)},
+			sendLocked: true, verifyErr: true},
+		{name: "expired lock", lockout: map[string]interface{}{"locked_until": now.Add(-time.Second)}},
+		{name: "inside resend cooldown", lockout: map[string]interface{}{"last_sent_at": now.Add(-10 * time.Second)},
+			sendWait: true},
+		{name: "after resend cooldown", lockout: map[string]interface{}{"last_sent_at": now.Add(-OTPResendCooldown)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, store := newFakeDB(t)
+			if tt.lockout != nil {
+				tt.lockout["email_hash"] = "hash"
+				store.insert("otp_lockouts", tt.lockout)
+			}
+
+			var throttle *OTPThrottleError
+			err := db.checkOTPVerifyAllowed(context.Background(), "ada@example.com", "hash")
+			if tt.verifyErr != errors.As(err, &throttle) {
+				t.Errorf("checkOTPVerifyAllowed = %v", err)
+			}
+
+			throttle = nil
+			err = db.checkOTPSendAllowed(context.Background(), "ada@example.com", "hash")
+			switch {
+			case tt.sendLocked || tt.sendWait:
+				if !errors.As(err, &throttle) || throttle.Locked != tt.sendLocked || throttle.RetryAfter <= 0 {
+					t.Errorf("checkOTPSendAllowed = %v, want locked=%v", err, tt.sendLocked)
+				}
+			case err != nil:
+				t.Errorf("checkOTPSendAllowed = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestValidateOTPDoesNotCreateUserOnLookupError(t *testing.T) {
+	db, store := newFakeDB(t)
+	hashed, err := db.crypto.HashOTP("123456")
+	if err != nil {
+		t.Fatalf("HashOTP failed: %v", err)
+	}
+	store.insert("otp_tokens", map[string]interface{}{
+		"id":         uuid.NewString(),
+		"email_hash": db.crypto.EmailBlindIndex("ada@example.com"),
+		"token":      hashed,
+		"used":       false,
+		"expires_at": time.Now().Add(time.Minute).UTC(),
+	})
+	store.rpcs["consume_otp"] = func(map[string]interface{}) interface{} { return true }
+	store.failing["users"] = "upstream timeout"
+
+	_, err = db.ValidateOTP(context.Background(), "ada@example.com", "123456")
+	if err == nil || !strings.Contains(err.Error(), "upstream timeout") || strings.Contains(err.Error(), "create user") {
+		t.Errorf("ValidateOTP = %v, want the lookup error", err)
+	}
+}
+
+func TestConsumeOTP(t *testing.T) {
+	db, store := newFakeDB(t)
+	tokenID := uuid.New()
+
+	var params map[string]interface{}
+	consumed := true
+	store.rpcs["consume_otp"] = func(p map[string]interface{}) interface{} {
+		params = p
+		return consumed
+	}
+
+	if err := db.consumeOTP(context.Background(), "ada@example.com", "hash", tokenID); err != nil {
+		t.Fatalf("consumeOTP = %v, want nil", err)
+	}
+	if params["p_token_id"] != tokenID.String() || params["p_email_hash"] != "hash" {
+		t.Errorf("consume_otp called with %v", params)
+	}
+
+	// Already used by a concurrent submission
+	consumed = false
+	err := db.consumeOTP(context.Background(), "ada@example.com", "hash", tokenID)
+	var throttle *OTPThrottleError
+	if err == nil || errors.As(err, &throttle) {
+		t.Errorf("consumeOTP = %v, want an invalid code error", err)
+	}
+
+	// Burned by a lockout that landed first
+	store.insert("otp_lockouts", map[string]interface{}{"email_hash": "hash", "failed_attempts": 0, "lockout_count": 1,
+		"locked_until": time.Now().Add(time.Minute).UTC()})
+	err = db.consumeOTP(context.Background(), "ada@example.com", "hash", tokenID)
+	if !errors.As(err, &throttle) || !throttle.Locked {
+		t.Errorf("consumeOTP = %v, want a lockout", err)
+	}
+}
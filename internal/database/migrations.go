@@ -0,0 +1,31 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"sudo/internal/migrations"
+
+	"github.com/supabase-community/postgrest-go"
+)
+
+// AppliedMigrations lists the rows of schema_migrations in version order
+func (db *DB) AppliedMigrations(ctx context.Context) ([]migrations.Applied, error) {
+	ctx, span := startSpan(ctx, "AppliedMigrations")
+	defer span.End()
+
+	var applied []migrations.Applied
+	_, err := db.client.From("schema_migrations").
+		Select("*", "", false).
+		Order("version", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&applied)
+	if err != nil {
+		// PostgREST reports a table it does not know as PGRST205 (42P01 from Postgres)
+		if strings.Contains(err.Error(), "PGRST205") || strings.Contains(err.Error(), "42P01") {
+			return nil, migrations.ErrNotBootstrapped
+		}
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
@@ -0,0 +1,290 @@
+package database
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sudo/internal/cache"
+	"sudo/internal/config"
+	"sudo/internal/models"
+	"sudo/internal/security"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/supabase-go"
+)
+
+// fakeStore is an in-memory PostgREST that understands selects and deletes with the eq,
+// in and is filters and counts the queries made against it. Functions in rpcs answer
+// calls to /rpc/<name> with their result.
+type fakeStore struct {
+	mu     sync.Mutex
+	tables map[string][]map[string]interface{}
+	rpcs   map[string]func(params map[string]interface{}) interface{}
+	// failing maps a table to the PostgREST error every request for it gets
+	failing map[string]string
+	queries int
+}
+
+func (s *fakeStore) insert(table string, rows ...interface{}) {
+	for _, row := range rows {
+		data, _ := json.Marshal(row)
+		var fields map[string]interface{}
+		_ = json.Unmarshal(data, &fields)
+		s.tables[table] = append(s.tables[table], fields)
+	}
+}
+
+func (s *fakeStore) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queries
+}
+
+func (s *fakeStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries++
+
+	table := strings.TrimPrefix(r.URL.Path, "/rest/v1/")
+	w.Header().Set("Content-Type", "application/json")
+	if name, ok := strings.CutPrefix(table, "rpc/"); ok {
+		var params map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&params)
+		_ = json.NewEncoder(w).Encode(s.rpcs[name](params))
+		return
+	}
+
+	if message, ok := s.failing[table]; ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_ = json.NewEncoder(w).Encode(map[string]string{"code": "PGRST000", "message": message})
+		return
+	}
+
+	rows := []map[string]interface{}{}
+	kept := s.tables[table][:0]
+	for _, row := range s.tables[table] {
+		if matches(row, r.URL.Query()) {
+			rows = append(rows, row)
+			if r.Method == http.MethodDelete {
+				continue
+			}
+		}
+		kept = append(kept, row)
+	}
+	s.tables[table] = kept
+	_ = json.NewEncoder(w).Encode(rows)
+}
+
+func matches(row map[string]interface{}, query map[string][]string) bool {
+	for column, values := range query {
+		value := values[0]
+		field := fmt.Sprint(row[column])
+		switch {
+		case strings.HasPrefix(value, "eq."):
+			if field != strings.TrimPrefix(value, "eq.") {
+				return false
+			}
+		case strings.HasPrefix(value, "in.("):
+			list := strings.Split(strings.TrimSuffix(strings.TrimPrefix(value, "in.("), ")"), ",")
+			found := false
+			for _, item := range list {
+				found = found || field == item
+			}
+			if !found {
+				return false
+			}
+		case value == "is.null":
+			if row[column] != nil {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func newFakeDB(t testing.TB) (*DB, *fakeStore) {
+	crypto, err := security.NewCryptoService(config.Encryption{
+		MasterKey:  base64.StdEncoding.EncodeToString(make([]byte, 32)),
+		KeyVersion: 1,
+	})
+	if err != nil {
+		t.Fatalf("NewCryptoService failed: %v", err)
+	}
+
+	store := &fakeStore{
+		tables:  make(map[string][]map[string]interface{}),
+		rpcs:    make(map[string]func(params map[string]interface{}) interface{}),
+		failing: make(map[string]string),
+	}
+	server := httptest.NewServer(store)
+	t.Cleanup(server.Close)
+
+	client, err := supabase.NewClient(server.URL, "test-key", nil)
+	if err != nil {
+		t.Fatalf("NewClient failed: %v", err)
+	}
+	return &DB{client: client, crypto: crypto}, store
+}
+
+// seedBoard creates a board with the given number of columns, tasks per column and
+// members; every task has one of the members assigned
+func seedBoard(store *fakeStore, columns, tasksPerColumn, members int) uuid.UUID {
+	owner := models.User{ID: uuid.New(), Name: "Owner"}
+	board := models.Board{ID: uuid.New(), Title: "Board", OwnerID: owner.ID}
+	store.insert("users", owner)
+	store.insert("boards", board)
+	store.insert("board_members", models.BoardMember{ID: uuid.New(), BoardID: board.ID, UserID: owner.ID, Role: "owner"})
+
+	userIDs := []uuid.UUID{owner.ID}
+	for i := 1; i < members; i++ {
+		user := models.User{ID: uuid.New(), Name: fmt.Sprintf("Member %d", i)}
+		store.insert("users", user)
+		store.insert("board_members", models.BoardMember{ID: uuid.New(), BoardID: board.ID, UserID: user.ID, Role: "collaborator"})
+		userIDs = append(userIDs, user.ID)
+	}
+
+	for c := 0; c < columns; c++ {
+		column := models.Column{ID: uuid.New(), BoardID: board.ID, Title: fmt.Sprintf("Column %d", c), Position: c}
+		store.insert("columns", column)
+		for p := 0; p < tasksPerColumn; p++ {
+			assignee := userIDs[(c+p)%len(userIDs)]
+			task := models.Task{ID: uuid.New(), Title: "Task", BoardID: board.ID, ColumnID: column.ID, Position: p, AssignedTo: &assignee}
+			store.insert("tasks", task)
+			store.insert("task_assignees", models.TaskAssignee{ID: uuid.New(), TaskID: task.ID, UserID: assignee})
+		}
+	}
+	return board.ID
+}
+
+// loadBoardPage makes the database calls of the board page for its owner
+func loadBoardPage(db *DB, boardID uuid.UUID) (*models.Board, error) {
+	ctx := WithUserLoader(context.Background(), db.NewUserLoader())
+	board, err := db.GetBoardWithColumns(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.GetNestedBoards(ctx, boardID); err != nil {
+		return nil, err
+	}
+	if _, err := db.GetUserByID(ctx, board.OwnerID); err != nil {
+		return nil, err
+	}
+	if _, err := db.GetUserBoards(ctx, board.OwnerID); err != nil {
+		return nil, err
+	}
+	return board, nil
+}
+
+func TestBoardPageQueryCountIsBounded(t *testing.T) {
+	counts := make(map[string]int)
+	for _, size := range []struct{ columns, tasks, members int }{{1, 1, 1}, {4, 10, 5}, {8, 50, 30}} {
+		db, store := newFakeDB(t)
+		boardID := seedBoard(store, size.columns, size.tasks, size.members)
+
+		board, err := loadBoardPage(db, boardID)
+		if err != nil {
+			t.Fatalf("loadBoardPage failed: %v", err)
+		}
+
+		loaded := 0
+		for _, column := range board.Columns {
+			for _, task := range column.Tasks {
+				if task.Assignee == nil || len(task.Assignees) != 1 || task.Assignees[0].User == nil {
+					t.Fatalf("task %s is missing its assignees", task.ID)
+				}
+				loaded++
+			}
+		}
+		if loaded != size.columns*size.tasks || len(board.Members) != size.members {
+			t.Fatalf("loaded %d tasks and %d members, want %d and %d", loaded, len(board.Members), size.columns*size.tasks, size.members)
+		}
+		counts[fmt.Sprintf("%+v", size)] = store.count()
+	}
+
+	want := -1
+	for size, count := range counts {
+		if want == -1 {
+			want = count
+		}
+		if count != want || count > 12 {
+			t.Errorf("board page for %s took %d queries; all sizes: %v", size, count, counts)
+		}
+	}
+}
+
+func TestUserLoaderCachesPerRequest(t *testing.T) {
+	db, store := newFakeDB(t)
+	user := models.User{ID: uuid.New(), Name: "Ada"}
+	store.insert("users", user)
+	missing := uuid.New()
+
+	ctx := WithUserLoader(context.Background(), db.NewUserLoader())
+	users, err := db.GetUsersByIDs(ctx, []uuid.UUID{user.ID, missing})
+	if err != nil || users[user.ID] == nil || users[missing] != nil {
+		t.Fatalf("GetUsersByIDs = %v, %v", users, err)
+	}
+	if _, err := db.GetUserByID(ctx, user.ID); err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if _, err := db.GetUserByID(ctx, missing); err == nil {
+		t.Error("GetUserByID should fail for an unknown user")
+	}
+	if got := store.count(); got != 1 {
+		t.Errorf("made %d queries, want 1", got)
+	}
+}
+
+func TestAccessChecksAreCachedUntilMembershipChanges(t *testing.T) {
+	db, store := newFakeDB(t)
+	db.cache = cache.NewMemoryStore(100, time.Minute)
+	boardID := seedBoard(store, 1, 1, 2)
+	var memberID uuid.UUID
+	for _, row := range store.tables["board_members"] {
+		if row["role"] == "collaborator" {
+			memberID = uuid.MustParse(row["user_id"].(string))
+		}
+	}
+	ctx := context.Background()
+
+	if ok, err := db.HasBoardAccess(ctx, memberID, boardID); err != nil || !ok {
+		t.Fatalf("HasBoardAccess = %v, %v", ok, err)
+	}
+	before := store.count()
+	ok, _ := db.HasBoardAccess(ctx, memberID, boardID)
+	isMember, _ := db.IsBoardMember(ctx, boardID, memberID)
+	isAdmin, _ := db.IsBoardAdmin(ctx, memberID, boardID)
+	if !ok || !isMember || isAdmin {
+		t.Errorf("access %v, member %v, admin %v", ok, isMember, isAdmin)
+	}
+	if got := store.count() - before; got != 0 {
+		t.Errorf("cached checks made %d queries", got)
+	}
+
+	if err := db.RemoveBoardMember(ctx, boardID, memberID); err != nil {
+		t.Fatalf("RemoveBoardMember failed: %v", err)
+	}
+	if ok, err := db.HasBoardAccess(ctx, memberID, boardID); err != nil || ok {
+		t.Errorf("HasBoardAccess after removal = %v, %v", ok, err)
+	}
+}
+
+func BenchmarkBoardPage(b *testing.B) {
+	db, store := newFakeDB(b)
+	boardID := seedBoard(store, 6, 40, 20)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := loadBoardPage(db, boardID); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(store.count())/float64(b.N), "queries/op")
+}
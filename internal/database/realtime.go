@@ -13,6 +13,9 @@ import (
 
 // Real-time specific database operations
 func (db *DB) CreateRealtimeSession(ctx context.Context, userID uuid.UUID, boardID uuid.UUID, connectionID string, userAgent string) error {
+	ctx, span := startSpan(ctx, "CreateRealtimeSession")
+	defer span.End()
+
 	sessionData := map[string]interface{}{
 		"user_id":       userID.String(),
 		"board_id":      boardID.String(),
@@ -26,6 +29,9 @@ func (db *DB) CreateRealtimeSession(ctx context.Context, userID uuid.UUID, board
 }
 
 func (db *DB) UpdateSessionPing(ctx context.Context, connectionID string) error {
+	ctx, span := startSpan(ctx, "UpdateSessionPing")
+	defer span.End()
+
 	updates := map[string]interface{}{
 		"last_ping": time.Now(),
 	}
@@ -39,6 +45,9 @@ func (db *DB) UpdateSessionPing(ctx context.Context, connectionID string) error
 }
 
 func (db *DB) RemoveRealtimeSession(ctx context.Context, connectionID string) error {
+	ctx, span := startSpan(ctx, "RemoveRealtimeSession")
+	defer span.End()
+
 	_, err := db.client.From("realtime_sessions").
 		Delete("", "").
 		Eq("connection_id", connectionID).
@@ -48,6 +57,9 @@ func (db *DB) RemoveRealtimeSession(ctx context.Context, connectionID string) er
 }
 
 func (db *DB) LogActivity(ctx context.Context, userID, boardID uuid.UUID, taskID *uuid.UUID, action, description string, metadata map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "LogActivity")
+	defer span.End()
+
 	activityData := map[string]interface{}{
 		"user_id":     userID.String(),
 		"board_id":    boardID.String(),
@@ -66,6 +78,9 @@ func (db *DB) LogActivity(ctx context.Context, userID, boardID uuid.UUID, taskID
 
 // Get recent board activities for real-time feed
 func (db *DB) GetRecentBoardActivities(ctx context.Context, boardID uuid.UUID, limit int) ([]models.Activity, error) {
+	ctx, span := startSpan(ctx, "GetRecentBoardActivities")
+	defer span.End()
+
 	var activities []models.Activity
 	_, err := db.client.From("activity_log").
 		Select("*, users!inner(name, email)", "", false).
@@ -79,6 +94,9 @@ func (db *DB) GetRecentBoardActivities(ctx context.Context, boardID uuid.UUID, l
 
 // Enhanced task operations with real-time support
 func (db *DB) MoveTaskWithOptimisticLock(ctx context.Context, taskID, columnID uuid.UUID, position, expectedVersion int) (*models.Task, error) {
+	ctx, span := startSpan(ctx, "MoveTaskWithOptimisticLock")
+	defer span.End()
+
 	// For now, use regular task move since we don't have the secure function
 	// This would need to be implemented as a database function first
 	err := db.MoveTask(ctx, taskID, columnID, position)
@@ -92,6 +110,9 @@ func (db *DB) MoveTaskWithOptimisticLock(ctx context.Context, taskID, columnID u
 
 // User presence operations
 func (db *DB) UpdateUserPresence(ctx context.Context, userID, boardID uuid.UUID, cursorX, cursorY *int, focusedElement *string, isTyping bool) error {
+	ctx, span := startSpan(ctx, "UpdateUserPresence")
+	defer span.End()
+
 	presenceData := map[string]interface{}{
 		"user_id":       userID.String(),
 		"board_id":      boardID.String(),
@@ -116,6 +137,9 @@ func (db *DB) UpdateUserPresence(ctx context.Context, userID, boardID uuid.UUID,
 }
 
 func (db *DB) RemoveUserPresence(ctx context.Context, userID, boardID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RemoveUserPresence")
+	defer span.End()
+
 	_, err := db.client.From("user_presence").
 		Delete("", "").
 		Eq("user_id", userID.String()).
@@ -126,6 +150,9 @@ func (db *DB) RemoveUserPresence(ctx context.Context, userID, boardID uuid.UUID)
 }
 
 func (db *DB) GetBoardPresence(ctx context.Context, boardID uuid.UUID) ([]models.UserPresence, error) {
+	ctx, span := startSpan(ctx, "GetBoardPresence")
+	defer span.End()
+
 	var presence []models.UserPresence
 	_, err := db.client.From("user_presence").
 		Select("*, users!inner(name, email)", "", false).
@@ -136,6 +163,9 @@ func (db *DB) GetBoardPresence(ctx context.Context, boardID uuid.UUID) ([]models
 }
 
 func (db *DB) CleanupStalePresence(ctx context.Context, olderThan time.Time) error {
+	ctx, span := startSpan(ctx, "CleanupStalePresence")
+	defer span.End()
+
 	_, err := db.client.From("user_presence").
 		Delete("", "").
 		Lt("last_activity", olderThan.UTC().Format(time.RFC3339)).
@@ -0,0 +1,143 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// CreateTaskRecurrence stores a new series and makes the given task its first instance
+func (db *DB) CreateTaskRecurrence(ctx context.Context, taskID uuid.UUID, recurrence *models.TaskRecurrence) (*models.TaskRecurrence, error) {
+	ctx, span := startSpan(ctx, "CreateTaskRecurrence")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"board_id":                recurrence.BoardID.String(),
+		"rule":                    recurrence.Rule,
+		"starts_at":               recurrence.StartsAt.UTC(),
+		"deadline_offset_seconds": recurrence.DeadlineOffset,
+		"occurrences":             recurrence.Occurrences,
+		"next_occurrence_at":      recurrence.NextOccurrenceAt,
+		"current_task_id":         taskID.String(),
+		"active":                  true,
+	}
+	if recurrence.CreatedBy != nil {
+		data["created_by"] = recurrence.CreatedBy.String()
+	}
+
+	var result []models.TaskRecurrence
+	_, err := db.client.From("task_recurrences").Insert(data, false, "", "", "").ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create task recurrence: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created task recurrence")
+	}
+
+	if err := db.UpdateTask(ctx, taskID, map[string]interface{}{"recurrence_id": result[0].ID.String()}); err != nil {
+		return nil, err
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) GetTaskRecurrence(ctx context.Context, recurrenceID uuid.UUID) (*models.TaskRecurrence, error) {
+	ctx, span := startSpan(ctx, "GetTaskRecurrence")
+	defer span.End()
+
+	var recurrences []models.TaskRecurrence
+	_, err := db.client.From("task_recurrences").
+		Select("*", "", false).
+		Eq("id", recurrenceID.String()).
+		ExecuteTo(&recurrences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task recurrence: %w", err)
+	}
+	if len(recurrences) == 0 {
+		return nil, fmt.Errorf("task recurrence not found")
+	}
+
+	return &recurrences[0], nil
+}
+
+// ListDueRecurrences returns active series whose next occurrence is at or before now
+func (db *DB) ListDueRecurrences(ctx context.Context, now time.Time, limit int) ([]models.TaskRecurrence, error) {
+	ctx, span := startSpan(ctx, "ListDueRecurrences")
+	defer span.End()
+
+	var recurrences []models.TaskRecurrence
+	_, err := db.client.From("task_recurrences").
+		Select("*", "", false).
+		Eq("active", "true").
+		Lte("next_occurrence_at", now.UTC().Format(time.RFC3339)).
+		Order("next_occurrence_at", &postgrest.OrderOpts{Ascending: true}).
+		Limit(limit, "").
+		ExecuteTo(&recurrences)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list due recurrences: %w", err)
+	}
+
+	return recurrences, nil
+}
+
+// AdvanceTaskRecurrence applies updates only if the series has not moved past the given
+// occurrence count in the meantime, so two workers cannot both generate the same instance.
+// It reports whether this caller won.
+func (db *DB) AdvanceTaskRecurrence(ctx context.Context, recurrenceID uuid.UUID, occurrences int, updates map[string]interface{}) (bool, error) {
+	ctx, span := startSpan(ctx, "AdvanceTaskRecurrence")
+	defer span.End()
+
+	var result []models.TaskRecurrence
+	_, err := db.client.From("task_recurrences").
+		Update(updates, "", "").
+		Eq("id", recurrenceID.String()).
+		Eq("occurrences", fmt.Sprintf("%d", occurrences)).
+		ExecuteTo(&result)
+	if err != nil {
+		return false, fmt.Errorf("failed to advance task recurrence: %w", err)
+	}
+
+	return len(result) > 0, nil
+}
+
+func (db *DB) UpdateTaskRecurrence(ctx context.Context, recurrenceID uuid.UUID, updates map[string]interface{}) error {
+	ctx, span := startSpan(ctx, "UpdateTaskRecurrence")
+	defer span.End()
+
+	_, err := db.client.From("task_recurrences").
+		Update(updates, "", "").
+		Eq("id", recurrenceID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to update task recurrence: %w", err)
+	}
+
+	return nil
+}
+
+// GetFirstColumn returns the leftmost column of a board, without its tasks
+func (db *DB) GetFirstColumn(ctx context.Context, boardID uuid.UUID) (*models.Column, error) {
+	ctx, span := startSpan(ctx, "GetFirstColumn")
+	defer span.End()
+
+	var columns []models.Column
+	_, err := db.client.From("columns").
+		Select("*", "", false).
+		Eq("board_id", boardID.String()).
+		Order("position", &postgrest.OrderOpts{Ascending: true}).
+		Limit(1, "").
+		ExecuteTo(&columns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get first column: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("board has no columns")
+	}
+
+	return &columns[0], nil
+}
@@ -0,0 +1,52 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// RPCError is an error raised by a Postgres function. The whole call was rolled back.
+type RPCError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details string `json:"details"`
+	Hint    string `json:"hint"`
+}
+
+func (e *RPCError) Error() string {
+	if e.Details != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Message, e.Code, e.Details)
+	}
+	return fmt.Sprintf("%s (%s)", e.Message, e.Code)
+}
+
+// rpc calls a Postgres function, which PostgREST runs in a single transaction, and
+// decodes its result into out unless out is nil. The functions always return a value,
+// so an empty body means the request itself failed.
+func (db *DB) rpc(name string, params map[string]interface{}, out interface{}) error {
+	body := db.client.Rpc(name, "", params)
+	if body == "" {
+		return fmt.Errorf("no response from %s", name)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(body), "{") {
+		var rpcErr RPCError
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(body), &fields); err == nil {
+			_, hasCode := fields["code"]
+			_, hasMessage := fields["message"]
+			if hasCode && hasMessage && json.Unmarshal([]byte(body), &rpcErr) == nil {
+				return &rpcErr
+			}
+		}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(body), out); err != nil {
+		return fmt.Errorf("failed to decode %s result: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+func (db *DB) CreateSprint(ctx context.Context, sprint *models.Sprint) (*models.Sprint, error) {
+	ctx, span := startSpan(ctx, "CreateSprint")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"board_id":  sprint.BoardID.String(),
+		"name":      sprint.Name,
+		"goal":      sprint.Goal,
+		"starts_at": sprint.StartsAt.UTC(),
+		"ends_at":   sprint.EndsAt.UTC(),
+	}
+	if sprint.CreatedBy != nil {
+		data["created_by"] = sprint.CreatedBy.String()
+	}
+
+	var result []models.Sprint
+	_, err := db.client.From("sprints").
+		Insert(data, false, "", "", "").
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sprint: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created sprint")
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) GetSprint(ctx context.Context, sprintID uuid.UUID) (*models.Sprint, error) {
+	ctx, span := startSpan(ctx, "GetSprint")
+	defer span.End()
+
+	var sprints []models.Sprint
+	_, err := db.client.From("sprints").
+		Select("*", "", false).
+		Eq("id", sprintID.String()).
+		ExecuteTo(&sprints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprint: %w", err)
+	}
+	if len(sprints) == 0 {
+		return nil, fmt.Errorf("sprint not found")
+	}
+
+	return &sprints[0], nil
+}
+
+// GetBoardSprints lists the board's sprints in order of their planned start
+func (db *DB) GetBoardSprints(ctx context.Context, boardID uuid.UUID) ([]models.Sprint, error) {
+	ctx, span := startSpan(ctx, "GetBoardSprints")
+	defer span.End()
+
+	var sprints []models.Sprint
+	_, err := db.client.From("sprints").
+		Select("*", "", false).
+		Eq("board_id", boardID.String()).
+		Order("starts_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&sprints)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprints: %w", err)
+	}
+
+	return sprints, nil
+}
+
+// UpdateSprint applies updates if the sprint still has the given status. It returns nil
+// without an error if the status changed in the meantime.
+func (db *DB) UpdateSprint(ctx context.Context, sprintID uuid.UUID, status string, updates map[string]interface{}) (*models.Sprint, error) {
+	ctx, span := startSpan(ctx, "UpdateSprint")
+	defer span.End()
+
+	updates["updated_at"] = time.Now()
+
+	var result []models.Sprint
+	_, err := db.client.From("sprints").
+		Update(updates, "", "").
+		Eq("id", sprintID.String()).
+		Eq("status", status).
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update sprint: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) DeleteSprint(ctx context.Context, sprintID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteSprint")
+	defer span.End()
+
+	_, err := db.client.From("sprints").
+		Delete("", "").
+		Eq("id", sprintID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete sprint: %w", err)
+	}
+
+	return nil
+}
+
+// GetSprintTasks returns the tasks currently in the sprint, without relationships
+func (db *DB) GetSprintTasks(ctx context.Context, sprintID uuid.UUID) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "GetSprintTasks")
+	defer span.End()
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("*", "", false).
+		Eq("sprint_id", sprintID.String()).
+		Order("position", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprint tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// GetTasksByIDs returns the tasks without relationships; missing IDs are skipped
+func (db *DB) GetTasksByIDs(ctx context.Context, taskIDs []uuid.UUID) ([]models.Task, error) {
+	ctx, span := startSpan(ctx, "GetTasksByIDs")
+	defer span.End()
+
+	if len(taskIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("*", "", false).
+		In("id", ids).
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks: %w", err)
+	}
+
+	return tasks, nil
+}
+
+// SetTaskSprint moves the task into sprintID, or out of any sprint if it is nil
+func (db *DB) SetTaskSprint(ctx context.Context, taskID uuid.UUID, sprintID *uuid.UUID) error {
+	ctx, span := startSpan(ctx, "SetTaskSprint")
+	defer span.End()
+
+	var value interface{}
+	if sprintID != nil {
+		value = sprintID.String()
+	}
+	return db.UpdateTask(ctx, taskID, map[string]interface{}{"sprint_id": value})
+}
+
+// RecordSprintChange records the task joining (added) or leaving the sprint
+func (db *DB) RecordSprintChange(ctx context.Context, sprintID, taskID uuid.UUID, added bool, userID *uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RecordSprintChange")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"sprint_id":   sprintID.String(),
+		"task_id":     taskID.String(),
+		"added":       added,
+		"occurred_at": time.Now().UTC(),
+	}
+	if userID != nil {
+		data["user_id"] = userID.String()
+	}
+
+	_, err := db.client.From("sprint_task_changes").
+		Insert(data, false, "", "", "").
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to record sprint change: %w", err)
+	}
+
+	return nil
+}
+
+// GetSprintChanges returns the sprint's scope changes, oldest first
+func (db *DB) GetSprintChanges(ctx context.Context, sprintID uuid.UUID) ([]models.SprintChange, error) {
+	ctx, span := startSpan(ctx, "GetSprintChanges")
+	defer span.End()
+
+	var changes []models.SprintChange
+	_, err := db.client.From("sprint_task_changes").
+		Select("*", "", false).
+		Eq("sprint_id", sprintID.String()).
+		Order("occurred_at", &postgrest.OrderOpts{Ascending: true}).
+		ExecuteTo(&changes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sprint changes: %w", err)
+	}
+
+	return changes, nil
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/supabase-community/postgrest-go"
+)
+
+// CreateTimeEntry inserts a finished entry, or a running timer if entry.EndedAt is nil. The
+// database rejects a second running timer for the same user.
+func (db *DB) CreateTimeEntry(ctx context.Context, entry *models.TimeEntry) (*models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "CreateTimeEntry")
+	defer span.End()
+
+	data := map[string]interface{}{
+		"task_id":    entry.TaskID.String(),
+		"board_id":   entry.BoardID.String(),
+		"user_id":    entry.UserID.String(),
+		"started_at": entry.StartedAt.UTC(),
+		"note":       entry.Note,
+	}
+	if entry.EndedAt != nil {
+		data["ended_at"] = entry.EndedAt.UTC()
+	}
+
+	var result []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Insert(data, false, "", "", "").
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create time entry: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("failed to get created time entry")
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) GetTimeEntry(ctx context.Context, entryID uuid.UUID) (*models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "GetTimeEntry")
+	defer span.End()
+
+	var entries []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Select("*", "", false).
+		Eq("id", entryID.String()).
+		ExecuteTo(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get time entry: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("time entry not found")
+	}
+
+	return &entries[0], nil
+}
+
+// GetRunningTimer returns the user's running timer, or nil if there is none
+func (db *DB) GetRunningTimer(ctx context.Context, userID uuid.UUID) (*models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "GetRunningTimer")
+	defer span.End()
+
+	var entries []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Select("*", "", false).
+		Eq("user_id", userID.String()).
+		Is("ended_at", "null").
+		ExecuteTo(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get running timer: %w", err)
+	}
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	return &entries[0], nil
+}
+
+// StopTimeEntry ends a running timer. It returns nil without an error if the timer was
+// already stopped, e.g. from another tab.
+func (db *DB) StopTimeEntry(ctx context.Context, entryID uuid.UUID, endedAt time.Time) (*models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "StopTimeEntry")
+	defer span.End()
+
+	var result []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Update(map[string]interface{}{"ended_at": endedAt.UTC(), "updated_at": time.Now()}, "", "").
+		Eq("id", entryID.String()).
+		Is("ended_at", "null").
+		ExecuteTo(&result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stop timer: %w", err)
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+
+	return &result[0], nil
+}
+
+func (db *DB) DeleteTimeEntry(ctx context.Context, entryID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "DeleteTimeEntry")
+	defer span.End()
+
+	_, err := db.client.From("time_entries").
+		Delete("", "").
+		Eq("id", entryID.String()).
+		ExecuteTo(nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete time entry: %w", err)
+	}
+
+	return nil
+}
+
+// GetTaskTimeEntries lists a task's entries, newest first, with their users
+func (db *DB) GetTaskTimeEntries(ctx context.Context, taskID uuid.UUID) ([]models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "GetTaskTimeEntries")
+	defer span.End()
+
+	var entries []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Select("*", "", false).
+		Eq("task_id", taskID.String()).
+		Order("started_at", &postgrest.OrderOpts{Ascending: false}).
+		ExecuteTo(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get time entries: %w", err)
+	}
+
+	userIDs := make([]uuid.UUID, len(entries))
+	for i := range entries {
+		userIDs[i] = entries[i].UserID
+	}
+	users, err := db.GetUsersByIDs(ctx, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get time entry users: %w", err)
+	}
+	for i := range entries {
+		entries[i].User = users[entries[i].UserID]
+	}
+
+	return entries, nil
+}
+
+// ListTimeEntries returns the entries of a board or of a user (whichever ID is not nil) that
+// overlap [from, to), including running timers
+func (db *DB) ListTimeEntries(ctx context.Context, boardID, userID *uuid.UUID, from, to time.Time) ([]models.TimeEntry, error) {
+	ctx, span := startSpan(ctx, "ListTimeEntries")
+	defer span.End()
+
+	query := db.client.From("time_entries").
+		Select("*", "", false).
+		Lt("started_at", to.UTC().Format(time.RFC3339)).
+		Or(fmt.Sprintf(`ended_at.gte."%s",ended_at.is.null`, from.UTC().Format(time.RFC3339)), "")
+	if boardID != nil {
+		query = query.Eq("board_id", boardID.String())
+	}
+	if userID != nil {
+		query = query.Eq("user_id", userID.String())
+	}
+
+	var entries []models.TimeEntry
+	_, err := query.Order("started_at", &postgrest.OrderOpts{Ascending: true}).ExecuteTo(&entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list time entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// RecalculateActualHours sets the task's actual_hours to the sum of its finished entries
+func (db *DB) RecalculateActualHours(ctx context.Context, taskID uuid.UUID) error {
+	ctx, span := startSpan(ctx, "RecalculateActualHours")
+	defer span.End()
+
+	var entries []models.TimeEntry
+	_, err := db.client.From("time_entries").
+		Select("started_at, ended_at", "", false).
+		Eq("task_id", taskID.String()).
+		Not("ended_at", "is", "null").
+		ExecuteTo(&entries)
+	if err != nil {
+		return fmt.Errorf("failed to get time entries: %w", err)
+	}
+
+	var total time.Duration
+	for _, entry := range entries {
+		total += entry.EndedAt.Sub(entry.StartedAt)
+	}
+
+	// actual_hours must be positive, so an untracked task has none
+	var actualHours interface{}
+	if hours := math.Round(total.Hours()*100) / 100; hours > 0 {
+		actualHours = hours
+	}
+
+	return db.UpdateTask(ctx, taskID, map[string]interface{}{"actual_hours": actualHours})
+}
+
+// GetTaskTitles maps task IDs to titles, e.g. to label report rows
+func (db *DB) GetTaskTitles(ctx context.Context, taskIDs []uuid.UUID) (map[uuid.UUID]string, error) {
+	ctx, span := startSpan(ctx, "GetTaskTitles")
+	defer span.End()
+
+	titles := make(map[uuid.UUID]string, len(taskIDs))
+	if len(taskIDs) == 0 {
+		return titles, nil
+	}
+	ids := make([]string, len(taskIDs))
+	for i, id := range taskIDs {
+		ids[i] = id.String()
+	}
+
+	var tasks []models.Task
+	_, err := db.client.From("tasks").
+		Select("id, title", "", false).
+		In("id", ids).
+		ExecuteTo(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get task titles: %w", err)
+	}
+	for _, task := range tasks {
+		titles[task.ID] = task.Title
+	}
+
+	return titles, nil
+}
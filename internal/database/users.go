@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"sudo/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// UserLoader batches user lookups and caches them for the lifetime of one request.
+// Attach it with WithUserLoader; GetUserByID and GetUsersByIDs then go through it.
+type UserLoader struct {
+	db    *DB
+	mu    sync.Mutex
+	users map[uuid.UUID]*models.User
+}
+
+type userLoaderKey struct{}
+
+func (db *DB) NewUserLoader() *UserLoader {
+	return &UserLoader{db: db, users: make(map[uuid.UUID]*models.User)}
+}
+
+// WithUserLoader returns a context whose database calls share the loader's cache
+func WithUserLoader(ctx context.Context, loader *UserLoader) context.Context {
+	return context.WithValue(ctx, userLoaderKey{}, loader)
+}
+
+func userLoaderFrom(ctx context.Context) *UserLoader {
+	loader, _ := ctx.Value(userLoaderKey{}).(*UserLoader)
+	return loader
+}
+
+// LoadMany returns the users that exist among ids, fetching the uncached ones in one query
+func (l *UserLoader) LoadMany(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var missing []uuid.UUID
+	for _, id := range ids {
+		if _, ok := l.users[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		fetched, err := l.db.fetchUsers(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range missing {
+			// Unknown IDs are cached as nil so they are not fetched again
+			l.users[id] = fetched[id]
+		}
+	}
+
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	for _, id := range ids {
+		if user := l.users[id]; user != nil {
+			users[id] = user
+		}
+	}
+	return users, nil
+}
+
+// GetUsersByIDs returns the users that exist among ids in a single query
+func (db *DB) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	ctx, span := startSpan(ctx, "GetUsersByIDs")
+	defer span.End()
+
+	if loader := userLoaderFrom(ctx); loader != nil {
+		return loader.LoadMany(ctx, ids)
+	}
+	return db.fetchUsers(ctx, ids)
+}
+
+func (db *DB) fetchUsers(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	seen := make(map[uuid.UUID]bool, len(ids))
+	idStrings := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			idStrings = append(idStrings, id.String())
+		}
+	}
+
+	var rows []models.User
+	_, err := db.client.From("users").Select("*", "", false).In("id", idStrings).ExecuteTo(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+
+	for i := range rows {
+		db.decryptUserEmail(&rows[i])
+		users[rows[i].ID] = &rows[i]
+	}
+	return users, nil
+}
+
+// decryptUserEmail fills in DecryptedEmail, leaving the email encrypted if that fails
+func (db *DB) decryptUserEmail(user *models.User) {
+	if user.Email == "" {
+		return
+	}
+	decryptedEmail, err := db.crypto.DecryptEmail(user.Email)
+	if err != nil {
+		log.Printf("Warning: Failed to decrypt email for user %s: %v", user.ID, err)
+		return
+	}
+	user.DecryptedEmail = decryptedEmail
+}
@@ -0,0 +1,170 @@
+// Package dataexport builds "Download my data" archives: a ZIP file with one JSON file
+// per kind of personal data and an index.html that summarises them for people.
+package dataexport
+
+import (
+	"archive/zip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+
+	"sudo/internal/models"
+)
+
+//go:embed index.html
+var indexFS embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(indexFS, "index.html"))
+
+// Section is one JSON file of the archive
+type Section struct {
+	File        string
+	Title       string
+	Description string
+	// Columns are shown in the HTML index; the JSON file has every column
+	Columns []string
+	rows    func(d *models.PersonalData) []map[string]interface{}
+}
+
+// Sections lists the archive's JSON files besides profile.json
+var Sections = []Section{
+	{
+		File: "boards.json", Title: "Boards",
+		Description: "Boards you own or are a member of, with your role on each.",
+		Columns:     []string{"title", "role", "description", "created_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Boards },
+	},
+	{
+		File: "board_memberships.json", Title: "Board memberships",
+		Description: "When you joined each board and who invited you.",
+		Columns:     []string{"board_id", "role", "invited_by", "joined_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Memberships },
+	},
+	{
+		File: "tasks.json", Title: "Tasks",
+		Description: "Tasks you created or that are assigned to you.",
+		Columns:     []string{"title", "priority", "completed", "deadline", "created_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Tasks },
+	},
+	{
+		File: "comments.json", Title: "Comments",
+		Description: "Comments you wrote on tasks.",
+		Columns:     []string{"content", "task_id", "created_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Comments },
+	},
+	{
+		File: "activity.json", Title: "Activity log",
+		Description: "Changes you made, as recorded in board activity feeds.",
+		Columns:     []string{"action", "description", "created_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Activity },
+	},
+	{
+		File: "sessions.json", Title: "Sessions",
+		Description: "Open live connections to boards, with the browser and address they came from.",
+		Columns:     []string{"board_id", "user_agent", "ip_address", "last_ping", "created_at"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Sessions },
+	},
+	{
+		File: "presence.json", Title: "Presence",
+		Description: "What you were last doing on each board, as shown to other members.",
+		Columns:     []string{"board_id", "focused_element", "active_task_id", "last_activity"},
+		rows:        func(d *models.PersonalData) []map[string]interface{} { return d.Presence },
+	},
+}
+
+type indexSection struct {
+	Section
+	Rows [][]string
+}
+
+type indexData struct {
+	GeneratedAt string
+	Profile     [][2]string
+	Sections    []indexSection
+}
+
+// Write stores the personal data as a ZIP archive
+func Write(w io.Writer, d *models.PersonalData, generatedAt time.Time) error {
+	archive := zip.NewWriter(w)
+
+	if err := writeJSON(archive, "profile.json", d.Profile); err != nil {
+		return err
+	}
+	index := indexData{GeneratedAt: generatedAt.UTC().Format("January 2, 2006 15:04 MST")}
+	for _, column := range sortedKeys(d.Profile) {
+		index.Profile = append(index.Profile, [2]string{column, formatValue(d.Profile[column])})
+	}
+
+	for _, section := range Sections {
+		rows := section.rows(d)
+		if rows == nil {
+			rows = []map[string]interface{}{}
+		}
+		if err := writeJSON(archive, section.File, rows); err != nil {
+			return err
+		}
+
+		summary := indexSection{Section: section}
+		for _, row := range rows {
+			cells := make([]string, len(section.Columns))
+			for i, column := range section.Columns {
+				cells[i] = formatValue(row[column])
+			}
+			summary.Rows = append(summary.Rows, cells)
+		}
+		index.Sections = append(index.Sections, summary)
+	}
+
+	file, err := archive.Create("index.html")
+	if err != nil {
+		return fmt.Errorf("failed to add index.html: %w", err)
+	}
+	if err := indexTemplate.Execute(file, index); err != nil {
+		return fmt.Errorf("failed to write index.html: %w", err)
+	}
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, value interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %w", name, err)
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// formatValue renders a column for the HTML index
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool, float64, json.Number:
+		return fmt.Sprint(v)
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	}
+}
+
+func sortedKeys(row map[string]interface{}) []string {
+	keys := make([]string, 0, len(row))
+	for key := range row {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,63 @@
+package dataexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"sudo/internal/models"
+)
+
+func readFile(t *testing.T, archive *zip.Reader, name string) []byte {
+	t.Helper()
+	file, err := archive.Open(name)
+	if err != nil {
+		t.Fatalf("archive is missing %s: %v", name, err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	return data
+}
+
+func TestWrite(t *testing.T) {
+	data := &models.PersonalData{
+		Profile: map[string]interface{}{"id": "u1", "email": "ada@example.com", "name": "Ada"},
+		Boards:  []map[string]interface{}{{"id": "b1", "title": "<Roadmap>", "role": "owner"}},
+		Tasks:   []map[string]interface{}{{"id": "t1", "title": "Ship", "completed": true, "tags": []interface{}{"a"}}},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, data, time.Date(2025, 4, 28, 12, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("not a ZIP archive: %v", err)
+	}
+
+	var profile map[string]interface{}
+	if err := json.Unmarshal(readFile(t, archive, "profile.json"), &profile); err != nil || profile["email"] != "ada@example.com" {
+		t.Errorf("profile.json = %v (%v)", profile, err)
+	}
+
+	for _, section := range Sections {
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(readFile(t, archive, section.File), &rows); err != nil || rows == nil {
+			t.Errorf("%s should hold a JSON array: %v", section.File, err)
+		}
+	}
+
+	index := string(readFile(t, archive, "index.html"))
+	for _, want := range []string{"ada@example.com", "&lt;Roadmap&gt;", "Tasks (1)", "Comments (0)", "April 28, 2025"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html does not contain %q", want)
+		}
+	}
+}
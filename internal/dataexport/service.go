@@ -0,0 +1,224 @@
+package dataexport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"sudo/internal/database"
+	"sudo/internal/email"
+	"sudo/internal/models"
+	"sudo/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Retention is how long a finished archive can be downloaded
+	Retention = 7 * 24 * time.Hour
+
+	pollInterval = time.Minute
+	batchSize    = 5
+	// How long a worker may hold an export before another worker can pick it up again
+	lease = 15 * time.Minute
+)
+
+var (
+	ErrInProgress = errors.New("an export is already being prepared")
+	ErrNotFound   = errors.New("data export not found")
+	ErrNotReady   = errors.New("data export is not ready or has expired")
+)
+
+// Service queues personal data exports and builds them in the background. Archives
+// are kept in blob storage under exports/<user id>/ until they expire.
+type Service struct {
+	db     *database.DB
+	store  storage.Store
+	emails *email.EmailService
+	wake   chan struct{}
+	now    func() time.Time
+}
+
+func NewService(db *database.DB, store storage.Store, emailService *email.EmailService) *Service {
+	return &Service{
+		db:     db,
+		store:  store,
+		emails: emailService,
+		wake:   make(chan struct{}, 1),
+		now:    time.Now,
+	}
+}
+
+// Request queues an export for the user; downloadBase is the site URL the emailed
+// download link starts with
+func (s *Service) Request(ctx context.Context, userID uuid.UUID, downloadBase string) (*models.DataExport, error) {
+	id := uuid.New()
+	export, err := s.db.CreateDataExport(ctx, &models.DataExport{
+		ID:          id,
+		UserID:      userID,
+		DownloadURL: fmt.Sprintf("%s/settings/data-export/%s", downloadBase, id.String()),
+	})
+	if errors.Is(err, database.ErrDataExportInProgress) {
+		return nil, ErrInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[EXPORT] User %s requested data export %s", userID.String(), export.ID.String())
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return export, nil
+}
+
+// Latest returns the user's most recent export, or nil when there is none
+func (s *Service) Latest(ctx context.Context, userID uuid.UUID) (*models.DataExport, error) {
+	exports, err := s.db.ListDataExports(ctx, userID)
+	if err != nil || len(exports) == 0 {
+		return nil, err
+	}
+	return &exports[0], nil
+}
+
+// Open returns the archive of one of the user's exports; the caller closes the reader
+func (s *Service) Open(ctx context.Context, userID, exportID uuid.UUID) (io.ReadCloser, int64, *models.DataExport, error) {
+	export, err := s.db.GetDataExport(ctx, exportID)
+	if err != nil || export.UserID != userID {
+		return nil, 0, nil, ErrNotFound
+	}
+	if !export.Downloadable() {
+		return nil, 0, export, ErrNotReady
+	}
+
+	reader, size, err := s.store.Get(ctx, *export.BlobKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, 0, export, ErrNotReady
+	}
+	if err != nil {
+		return nil, 0, export, fmt.Errorf("failed to open data export: %w", err)
+	}
+	return reader, size, export, nil
+}
+
+// DeleteArchives removes the stored archives of exports whose rows were deleted with
+// their user's account
+func (s *Service) DeleteArchives(ctx context.Context, exports ...models.DataExport) {
+	for _, export := range exports {
+		s.deleteArchive(ctx, &export)
+	}
+}
+
+// Run builds queued exports and deletes expired ones until ctx is cancelled
+func (s *Service) Run(ctx context.Context) {
+	log.Printf("[EXPORT] Worker started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processPending(ctx)
+		s.deleteExpired(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("[EXPORT] Worker stopped")
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+func (s *Service) processPending(ctx context.Context) {
+	for ctx.Err() == nil {
+		exports, err := s.db.ClaimDataExports(ctx, batchSize, lease)
+		if err != nil {
+			log.Printf("[EXPORT] Failed to claim data exports: %v", err)
+			return
+		}
+
+		for i := range exports {
+			if err := s.build(ctx, &exports[i]); err != nil {
+				log.Printf("[EXPORT] Failed to build data export %s: %v", exports[i].ID.String(), err)
+				if failErr := s.db.FailDataExport(ctx, exports[i].ID, err.Error(), s.now().Add(Retention)); failErr != nil {
+					log.Printf("[EXPORT] %v", failErr)
+				}
+			}
+		}
+
+		if len(exports) < batchSize {
+			return
+		}
+	}
+}
+
+// build writes the archive to storage and emails the download link
+func (s *Service) build(ctx context.Context, export *models.DataExport) error {
+	data, err := s.db.PersonalData(ctx, export.UserID)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, data, s.now()); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%s/%s.zip", export.UserID.String(), export.ID.String())
+	if err := s.store.Put(ctx, key, buf.Bytes(), "application/zip"); err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	expiresAt := s.now().Add(Retention)
+	if err := s.db.CompleteDataExport(ctx, export.ID, key, int64(buf.Len()), expiresAt); err != nil {
+		if deleteErr := s.store.Delete(ctx, key); deleteErr != nil {
+			log.Printf("[EXPORT] Failed to delete archive %s: %v", key, deleteErr)
+		}
+		return err
+	}
+	log.Printf("[EXPORT] Built data export %s (%d bytes)", export.ID.String(), buf.Len())
+
+	// The export stays downloadable from the settings page if the email cannot be queued
+	to, _ := data.Profile["email"].(string)
+	if err := s.emails.SendDataExportReady(to, export.DownloadURL, expiresAt); err != nil {
+		log.Printf("[EXPORT] Failed to queue ready email for data export %s: %v", export.ID.String(), err)
+	}
+	return nil
+}
+
+func (s *Service) deleteExpired(ctx context.Context) {
+	for ctx.Err() == nil {
+		expired, err := s.db.ListExpiredDataExports(ctx, s.now(), batchSize)
+		if err != nil {
+			log.Printf("[EXPORT] Failed to list expired data exports: %v", err)
+			return
+		}
+
+		for i := range expired {
+			s.deleteArchive(ctx, &expired[i])
+			if err := s.db.DeleteDataExport(ctx, expired[i].ID); err != nil {
+				log.Printf("[EXPORT] %v", err)
+				return
+			}
+		}
+
+		if len(expired) < batchSize {
+			return
+		}
+	}
+}
+
+func (s *Service) deleteArchive(ctx context.Context, export *models.DataExport) {
+	if export.BlobKey == nil {
+		return
+	}
+	if err := s.store.Delete(ctx, *export.BlobKey); err != nil {
+		log.Printf("[EXPORT] Failed to delete archive %s: %v", *export.BlobKey, err)
+	}
+}
@@ -0,0 +1,190 @@
+package email
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// MaxDeliveryAttempts is how often a job is tried before it becomes a dead letter
+	MaxDeliveryAttempts = 6
+
+	queuePollInterval = 10 * time.Second
+	queueBatchSize    = 20
+	// How long a worker may hold a job before another worker can pick it up again
+	queueLease = 2 * time.Minute
+
+	// Retries back off exponentially from the base delay, up to the cap
+	retryBaseDelay = 30 * time.Second
+	retryMaxDelay  = time.Hour
+)
+
+// Queue is the persistent outbound email queue and its delivery worker
+type Queue struct {
+	db        *database.DB
+	transport Transport
+	wake      chan struct{}
+}
+
+// NewQueue creates a queue delivering through transport; call Run to start the worker
+func NewQueue(db *database.DB, transport Transport) *Queue {
+	return &Queue{
+		db:        db,
+		transport: transport,
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Enqueue stores msg for delivery and wakes the worker. A non-zero ttl drops the email
+// instead of delivering it late, for content such as login codes that expire.
+func (q *Queue) Enqueue(ctx context.Context, kind string, msg *Message, ttl time.Duration) error {
+	job := &models.EmailJob{
+		Kind:     kind,
+		To:       msg.To,
+		Subject:  msg.Subject,
+		HTMLBody: msg.HTML,
+		TextBody: msg.Text,
+		ReplyTo:  msg.ReplyTo,
+	}
+	if ttl > 0 {
+		expiresAt := time.Now().Add(ttl)
+		job.ExpiresAt = &expiresAt
+	}
+
+	queued, err := q.db.EnqueueEmail(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[EMAIL] Queued %s email %s", kind, queued.ID.String())
+	q.Wake()
+	return nil
+}
+
+// Wake makes the worker check for due jobs now instead of at the next poll
+func (q *Queue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers due jobs until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	log.Printf("[EMAIL] Delivery worker started (transport: %s)", q.transport.Name())
+
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		q.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("[EMAIL] Delivery worker stopped")
+			return
+		case <-ticker.C:
+		case <-q.wake:
+		}
+	}
+}
+
+// processDue claims and delivers batches until no due jobs are left
+func (q *Queue) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		jobs, err := q.db.ClaimEmailJobs(ctx, queueBatchSize, queueLease)
+		if err != nil {
+			log.Printf("[EMAIL] Failed to claim queued emails: %v", err)
+			return
+		}
+
+		for i := range jobs {
+			q.deliver(ctx, &jobs[i])
+		}
+
+		if len(jobs) < queueBatchSize {
+			return
+		}
+	}
+}
+
+func (q *Queue) deliver(ctx context.Context, job *models.EmailJob) {
+	ctx, span := tracing.Start(ctx, "email.send "+job.Kind,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("email.kind", job.Kind),
+			attribute.String("email.transport", q.transport.Name()),
+			attribute.Int("email.attempt", job.Attempts+1),
+		))
+	defer span.End()
+
+	if job.ExpiresAt != nil && time.Now().After(*job.ExpiresAt) {
+		log.Printf("[EMAIL] Dropping expired %s email %s after %d attempts", job.Kind, job.ID.String(), job.Attempts)
+		if err := q.db.DeleteEmailJob(ctx, job.ID); err != nil {
+			log.Printf("[EMAIL] Failed to drop expired email %s: %v", job.ID.String(), err)
+		}
+		return
+	}
+
+	msg := &Message{
+		To:      job.To,
+		Subject: job.Subject,
+		HTML:    job.HTMLBody,
+		Text:    job.TextBody,
+		ReplyTo: job.ReplyTo,
+	}
+
+	sendErr := q.transport.Send(ctx, msg)
+	tracing.RecordError(span, sendErr)
+	if sendErr == nil {
+		log.Printf("[EMAIL] Delivered %s email %s via %s", job.Kind, job.ID.String(), q.transport.Name())
+		if err := q.db.CompleteEmailJob(ctx, job.ID); err != nil {
+			log.Printf("[EMAIL] Failed to remove delivered email %s: %v", job.ID.String(), err)
+		}
+		return
+	}
+
+	attempts := job.Attempts + 1
+	nextAttempt := time.Now().Add(retryDelay(attempts))
+	dead := attempts >= MaxDeliveryAttempts
+
+	// Expiring emails are not worth a dead letter; they simply stop being retried
+	if job.ExpiresAt != nil && nextAttempt.After(*job.ExpiresAt) {
+		log.Printf("[EMAIL] Giving up on expiring %s email %s: %v", job.Kind, job.ID.String(), sendErr)
+		if err := q.db.DeleteEmailJob(ctx, job.ID); err != nil {
+			log.Printf("[EMAIL] Failed to drop expired email %s: %v", job.ID.String(), err)
+		}
+		return
+	}
+
+	if dead {
+		log.Printf("[EMAIL] %s email %s failed %d times, moving to dead letters: %v", job.Kind, job.ID.String(), attempts, sendErr)
+	} else {
+		log.Printf("[EMAIL] Failed to deliver %s email %s (attempt %d), retrying at %s: %v",
+			job.Kind, job.ID.String(), attempts, nextAttempt.Format(time.RFC3339), sendErr)
+	}
+
+	if err := q.db.FailEmailJob(ctx, job.ID, attempts, nextAttempt, sendErr.Error(), dead); err != nil {
+		log.Printf("[EMAIL] Failed to record delivery failure for %s: %v", job.ID.String(), err)
+	}
+}
+
+// retryDelay doubles the base delay for every attempt already made, up to retryMaxDelay
+func retryDelay(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= retryMaxDelay {
+			return retryMaxDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,60 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// Every email has an HTML template (templates/<name>.html) and a plain-text
+// alternative (templates/<name>.txt) rendered from the same data
+//
+//go:embed templates/*.html templates/*.txt
+var templateFS embed.FS
+
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.ParseFS(templateFS, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.ParseFS(templateFS, "templates/*.txt"))
+)
+
+type otpEmailData struct {
+	Code             string
+	ExpiresInMinutes int
+	Year             int
+}
+
+type invitationEmailData struct {
+	InviterName string
+	BoardName   string
+	InviteLink  string
+	Year        int
+}
+
+type taskCreatedEmailData struct {
+	TaskTitle       string
+	BoardName       string
+	AttachmentCount int
+	Year            int
+}
+
+type dataExportReadyEmailData struct {
+	DownloadLink string
+	ExpiresAt    string
+	Year         int
+}
+
+// render executes the HTML and text templates called name with data
+func render(name string, data interface{}) (string, string, error) {
+	var htmlBody, textBody bytes.Buffer
+
+	if err := htmlTemplates.ExecuteTemplate(&htmlBody, name+".html", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	if err := textTemplates.ExecuteTemplate(&textBody, name+".txt", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s text email: %w", name, err)
+	}
+
+	return htmlBody.String(), textBody.String(), nil
+}
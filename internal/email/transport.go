@@ -0,0 +1,317 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"sudo/internal/config"
+)
+
+// Transport delivers a rendered message. Implementations must be safe for concurrent use.
+type Transport interface {
+	Name() string
+	Send(ctx context.Context, msg *Message) error
+}
+
+// NewTransport picks the transport for cfg.Transport (resend, smtp or file). When unset
+// it uses Resend if an API key is configured, SMTP if credentials are, and otherwise
+// writes every email to the local mbox sink for development.
+func NewTransport(cfg config.Email) (Transport, error) {
+	from := fmt.Sprintf("%s <%s>", cfg.FromName, cfg.FromEmail)
+
+	kind := cfg.Transport
+	if kind == "" {
+		switch {
+		case cfg.ResendAPIKey != "":
+			kind = "resend"
+		case cfg.SMTPUsername != "" && cfg.SMTPPassword != "":
+			kind = "smtp"
+		default:
+			kind = "file"
+		}
+	}
+
+	switch kind {
+	case "resend":
+		if cfg.ResendAPIKey == "" {
+			return nil, fmt.Errorf("EMAIL_TRANSPORT=resend requires RESEND_API_KEY")
+		}
+		return &resendTransport{
+			apiKey: cfg.ResendAPIKey,
+			from:   from,
+			client: &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case "smtp":
+		return &smtpTransport{
+			host:      cfg.SMTPHost,
+			port:      cfg.SMTPPort,
+			username:  cfg.SMTPUsername,
+			password:  cfg.SMTPPassword,
+			from:      from,
+			fromEmail: cfg.FromEmail,
+		}, nil
+	case "file":
+		return NewFileTransport(cfg.SinkPath, from), nil
+	default:
+		return nil, fmt.Errorf("unknown EMAIL_TRANSPORT %q (expected resend, smtp or file)", kind)
+	}
+}
+
+// resendTransport sends through the Resend HTTP API
+type resendTransport struct {
+	apiKey string
+	from   string
+	client *http.Client
+}
+
+func (t *resendTransport) Name() string { return "resend" }
+
+func (t *resendTransport) Send(ctx context.Context, msg *Message) error {
+	type ResendEmail struct {
+		From    string   `json:"from"`
+		To      []string `json:"to"`
+		Subject string   `json:"subject"`
+		HTML    string   `json:"html"`
+		Text    string   `json:"text,omitempty"`
+		ReplyTo string   `json:"reply_to,omitempty"`
+	}
+
+	jsonData, err := json.Marshal(ResendEmail{
+		From:    t.from,
+		To:      []string{msg.To},
+		Subject: msg.Subject,
+		HTML:    msg.HTML,
+		Text:    msg.Text,
+		ReplyTo: msg.ReplyTo,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal email: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.resend.com/emails", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", t.apiKey))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("resend API returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+	return nil
+}
+
+// smtpTransport sends through an SMTP relay, using implicit TLS on 465 and STARTTLS on 587
+type smtpTransport struct {
+	host      string
+	port      string
+	username  string
+	password  string
+	from      string
+	fromEmail string
+}
+
+func (t *smtpTransport) Name() string { return "smtp" }
+
+func (t *smtpTransport) Send(ctx context.Context, msg *Message) error {
+	message, err := msg.Bytes(t.from)
+	if err != nil {
+		return err
+	}
+
+	auth := smtp.PlainAuth("", t.username, t.password, t.host)
+	addr := fmt.Sprintf("%s:%s", t.host, t.port)
+	to := []string{msg.To}
+
+	// Use TLS for port 587 (STARTTLS)
+	if t.port == "587" {
+		return t.sendWithTLS(ctx, addr, auth, to, message)
+	}
+
+	// Use SSL/TLS for port 465
+	if t.port == "465" {
+		return t.sendWithSSL(ctx, addr, auth, to, message)
+	}
+
+	// Fallback to basic SMTP for other ports
+	err = smtp.SendMail(addr, auth, t.fromEmail, to, message)
+	if err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+
+	return nil
+}
+
+func (t *smtpTransport) sendWithTLS(ctx context.Context, addr string, auth smtp.Auth, to []string, msg []byte) error {
+	// Connect to SMTP server with 30 second timeout
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close()
+
+	// Set deadline for entire operation (60 seconds total)
+	if deadlineErr := conn.SetDeadline(time.Now().Add(60 * time.Second)); deadlineErr != nil {
+		return fmt.Errorf("failed to set deadline: %w", deadlineErr)
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer func() {
+		_ = client.Quit()
+	}()
+
+	tlsConfig := &tls.Config{
+		ServerName: t.host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if err = client.StartTLS(tlsConfig); err != nil {
+		return fmt.Errorf("failed to start TLS: %w", err)
+	}
+
+	return t.deliver(client, auth, to, msg)
+}
+
+func (t *smtpTransport) sendWithSSL(ctx context.Context, addr string, auth smtp.Auth, to []string, msg []byte) error {
+	// Connect directly with TLS (for port 465)
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: 30 * time.Second},
+		Config: &tls.Config{
+			ServerName: t.host,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect via SSL/TLS: %w", err)
+	}
+	defer conn.Close()
+
+	// Set deadline for entire operation
+	if deadlineErr := conn.SetDeadline(time.Now().Add(60 * time.Second)); deadlineErr != nil {
+		return fmt.Errorf("failed to set deadline: %w", deadlineErr)
+	}
+
+	client, err := smtp.NewClient(conn, t.host)
+	if err != nil {
+		return fmt.Errorf("failed to create client: %w", err)
+	}
+	defer func() {
+		_ = client.Quit()
+	}()
+
+	return t.deliver(client, auth, to, msg)
+}
+
+// deliver authenticates and sends the message on an established connection
+func (t *smtpTransport) deliver(client *smtp.Client, auth smtp.Auth, to []string, msg []byte) error {
+	if err := client.Auth(auth); err != nil {
+		return fmt.Errorf("authentication failed: %w", err)
+	}
+
+	if err := client.Mail(t.fromEmail); err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("failed to set recipient: %w", err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to get data writer: %w", err)
+	}
+
+	if _, err = w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("failed to close writer: %w", err)
+	}
+	return nil
+}
+
+// FileTransport appends every message to a local mbox file instead of sending it.
+// Open the file with any mail client (or `mail -f`) to read what would have been sent.
+type FileTransport struct {
+	path string
+	from string
+	mu   sync.Mutex
+}
+
+// NewFileTransport creates a sink writing to the mbox file at path
+func NewFileTransport(path, from string) *FileTransport {
+	return &FileTransport{path: path, from: from}
+}
+
+func (t *FileTransport) Name() string { return "file" }
+
+// Path returns the mbox file messages are written to
+func (t *FileTransport) Path() string { return t.path }
+
+func (t *FileTransport) Send(ctx context.Context, msg *Message) error {
+	message, err := msg.Bytes(t.from)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create mail sink directory: %w", err)
+	}
+
+	f, err := os.OpenFile(t.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open mail sink: %w", err)
+	}
+	defer f.Close()
+
+	// mboxrd: a separator line per message, LF line endings and ">"-quoted "From " lines
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From sudo@localhost %s\n", time.Now().UTC().Format("Mon Jan _2 15:04:05 2006"))
+	for _, line := range strings.Split(strings.ReplaceAll(string(message), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		buf.WriteString(line + "\n")
+	}
+	buf.WriteString("\n")
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write to mail sink: %w", err)
+	}
+
+	log.Printf("[EMAIL] Wrote %q for %s to %s", msg.Subject, msg.To, t.path)
+	return nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/email"
+	"sudo/internal/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// AdminHandler serves instance-wide operations to the users listed in ADMIN_EMAILS
+type AdminHandler struct {
+	db           *database.DB
+	emailService *email.EmailService
+	admins       map[string]bool
+}
+
+func NewAdminHandler(db *database.DB, emailService *email.EmailService, cfg *config.Config) *AdminHandler {
+	admins := make(map[string]bool)
+	for _, address := range cfg.AdminEmails {
+		admins[address] = true
+	}
+
+	return &AdminHandler{
+		db:           db,
+		emailService: emailService,
+		admins:       admins,
+	}
+}
+
+// requireAdmin aborts with 403 unless the session user is an instance admin
+func (h *AdminHandler) requireAdmin(c *gin.Context) (uuid.UUID, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, false
+	}
+
+	user, err := h.db.GetUserByID(c.Request.Context(), userID)
+	if err != nil || !h.admins[strings.ToLower(user.DecryptedEmail)] {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// DeadLetters lists emails the queue gave up on
+func (h *AdminHandler) DeadLetters(c *gin.Context) {
+	if _, ok := h.requireAdmin(c); !ok {
+		return
+	}
+
+	jobs, err := h.emailService.DeadLetters(c.Request.Context(), 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load dead letters"})
+		return
+	}
+
+	letters := make([]gin.H, 0, len(jobs))
+	for _, job := range jobs {
+		lastError := ""
+		if job.LastError != nil {
+			lastError = *job.LastError
+		}
+		letters = append(letters, gin.H{
+			"id":         job.ID,
+			"kind":       job.Kind,
+			"to":         job.To,
+			"subject":    job.Subject,
+			"attempts":   job.Attempts,
+			"last_error": lastError,
+			"created_at": job.CreatedAt,
+			"failed_at":  job.UpdatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dead_letters": letters})
+}
+
+// RetryDeadLetter puts a dead letter back in the delivery queue
+func (h *AdminHandler) RetryDeadLetter(c *gin.Context) {
+	userID, ok := h.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return
+	}
+
+	if err := h.emailService.RetryDeadLetter(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+
+	logging.LogSecurityEvent(userID.String(), "email_dead_letter_retried", "email_id="+id.String())
+	c.JSON(http.StatusOK, gin.H{"status": "queued"})
+}
+
+// DiscardDeadLetter deletes a dead letter without sending it
+func (h *AdminHandler) DiscardDeadLetter(c *gin.Context) {
+	userID, ok := h.requireAdmin(c)
+	if !ok {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return
+	}
+
+	if err := h.emailService.DiscardDeadLetter(c.Request.Context(), id); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dead letter not found"})
+		return
+	}
+
+	logging.LogSecurityEvent(userID.String(), "email_dead_letter_discarded", "email_id="+id.String())
+	c.JSON(http.StatusOK, gin.H{"status": "discarded"})
+}
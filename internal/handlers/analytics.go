@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"sudo/internal/analytics"
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/templates/pages"
+
+	"github.com/a-h/templ"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const defaultAnalyticsSpan = 30 * 24 * time.Hour
+
+type AnalyticsHandler struct {
+	db *database.DB
+}
+
+func NewAnalyticsHandler(db *database.DB) *AnalyticsHandler {
+	return &AnalyticsHandler{db: db}
+}
+
+// GetBoardAnalytics returns the board's flow metrics as JSON. See boardReport for the
+// query parameters.
+func (h *AnalyticsHandler) GetBoardAnalytics(c *gin.Context) {
+	_, report, ok := h.boardReport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// AnalyticsPage renders the analytics dashboard of a board
+func (h *AnalyticsHandler) AnalyticsPage(c *gin.Context) {
+	board, report, ok := h.boardReport(c)
+	if !ok {
+		return
+	}
+
+	filters := pages.AnalyticsFilters{
+		From:     report.From.Format("2006-01-02"),
+		To:       report.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Assignee: c.Query("assignee"),
+		TimeZone: c.DefaultQuery("tz", "UTC"),
+	}
+
+	component := pages.BoardAnalytics(*board, report, filters)
+	handler := templ.Handler(component)
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+// boardReport builds the report for the board in :id over the dateRange parameters (the
+// last 30 days by default), optionally only for tasks assigned to the assignee user ID
+func (h *AnalyticsHandler) boardReport(c *gin.Context) (*models.Board, *analytics.Report, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return nil, nil, false
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return nil, nil, false
+	}
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, nil, false
+	}
+
+	from, to, ok := dateRange(c, defaultAnalyticsSpan)
+	if !ok {
+		return nil, nil, false
+	}
+
+	var assignee *uuid.UUID
+	if assigneeStr := c.Query("assignee"); assigneeStr != "" {
+		id, err := uuid.Parse(assigneeStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee"})
+			return nil, nil, false
+		}
+		assignee = &id
+	}
+
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+		return nil, nil, false
+	}
+
+	tasks, err := h.analyticsTasks(c.Request.Context(), boardID, assignee)
+	if err != nil {
+		log.Printf("Failed to load analytics data: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build analytics"})
+		return nil, nil, false
+	}
+
+	columns := make([]analytics.Column, 0, len(board.Columns))
+	for i := range board.Columns {
+		columns = append(columns, analytics.Column{
+			ID:   board.Columns[i].ID.String(),
+			Name: board.Columns[i].Title,
+			Done: board.Columns[i].IsDone(),
+		})
+	}
+
+	report, err := analytics.Build(columns, tasks, from, to, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, nil, false
+	}
+
+	return board, report, true
+}
+
+// analyticsTasks loads the board's tasks with their column history up to now; the flow
+// diagram only looks at the history, lead and cycle times count current completions
+func (h *AnalyticsHandler) analyticsTasks(ctx context.Context, boardID uuid.UUID, assignee *uuid.UUID) ([]analytics.Task, error) {
+	summaries, err := h.db.GetBoardTaskSummaries(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	var assigned map[uuid.UUID]bool
+	if assignee != nil {
+		if assigned, err = h.db.GetAssignedTaskIDs(ctx, summaries, *assignee); err != nil {
+			return nil, err
+		}
+	}
+
+	events, err := h.db.GetBoardColumnEvents(ctx, boardID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	transitions := make(map[uuid.UUID][]analytics.Transition)
+	for _, event := range events {
+		transitions[event.TaskID] = append(transitions[event.TaskID], analytics.Transition{
+			At:     event.OccurredAt,
+			Column: event.ToColumnID.String(),
+		})
+	}
+
+	tasks := make([]analytics.Task, 0, len(summaries))
+	for _, summary := range summaries {
+		if assigned != nil && !assigned[summary.ID] {
+			continue
+		}
+		history, ok := transitions[summary.ID]
+		if !ok {
+			// No recorded history: assume the task has been in its column since creation
+			history = []analytics.Transition{{At: summary.CreatedAt, Column: summary.ColumnID.String()}}
+		}
+		tasks = append(tasks, analytics.Task{ID: summary.ID.String(), Title: summary.Title, Transitions: history})
+	}
+
+	return tasks, nil
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"sudo/internal/attachments"
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/realtime"
+	"sudo/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Content types browsers may render inline; everything else is served as a download
+var inlineContentTypes = map[string]bool{
+	"image/png":       true,
+	"image/jpeg":      true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+type AttachmentHandler struct {
+	db          *database.DB
+	attachments *attachments.Service
+	realtime    *realtime.RealtimeService
+}
+
+func NewAttachmentHandler(db *database.DB, attachmentService *attachments.Service, rt *realtime.RealtimeService) *AttachmentHandler {
+	return &AttachmentHandler{
+		db:          db,
+		attachments: attachmentService,
+		realtime:    rt,
+	}
+}
+
+// taskForMember loads the task in the :id parameter if the current user is a member of its board
+func (h *AttachmentHandler) taskForMember(c *gin.Context) (uuid.UUID, *models.Task, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, nil, false
+	}
+
+	taskID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return uuid.Nil, nil, false
+	}
+
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return uuid.Nil, nil, false
+	}
+
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return uuid.Nil, nil, false
+	}
+
+	return userID, task, true
+}
+
+// UploadAttachment stores the multipart "file" field as a new attachment
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file provided"})
+		return
+	}
+	if fileHeader.Size > h.attachments.MaxFileSize() {
+		h.writeError(c, attachments.ErrTooLarge)
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.attachments.MaxFileSize()+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	attachment, err := h.attachments.Add(c.Request.Context(), task.ID, userID, fileHeader.Filename, data)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "attachment_add",
+		fmt.Sprintf("Attached %s to: %s", attachment.Filename, task.Title), map[string]interface{}{
+			"task_title": task.Title,
+			"filename":   attachment.Filename,
+			"size":       attachment.Size,
+		})
+	if err != nil {
+		log.Printf("Failed to log attachment activity: %v", err)
+	}
+	h.broadcast(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// DownloadAttachment streams an attachment; ?thumbnail=1 returns the image preview instead
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	_, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	thumbnail := c.Query("thumbnail") == "1"
+	reader, size, attachment, err := h.attachments.Open(c.Request.Context(), task, c.Param("attachmentId"), thumbnail)
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	contentType := attachment.ContentType
+	if thumbnail && attachment.ThumbnailKey != "" {
+		contentType = storage.ThumbnailContentType(attachment.ContentType)
+	}
+
+	disposition := "attachment"
+	if inlineContentTypes[contentType] {
+		disposition = "inline"
+	}
+
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	// Uploaded files are untrusted: never let them run script in our origin
+	c.Header("Content-Security-Policy", "default-src 'none'; img-src 'self'; style-src 'unsafe-inline'; sandbox")
+	c.Header("Cache-Control", "private, max-age=3600")
+	c.DataFromReader(http.StatusOK, size, contentType, reader, nil)
+}
+
+// DeleteAttachment removes an attachment from a task
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	attachment, err := h.attachments.Remove(c.Request.Context(), task.ID, c.Param("attachmentId"))
+	if err != nil {
+		h.writeError(c, err)
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "attachment_delete",
+		fmt.Sprintf("Removed %s from: %s", attachment.Filename, task.Title), map[string]interface{}{
+			"task_title": task.Title,
+			"filename":   attachment.Filename,
+		})
+	if err != nil {
+		log.Printf("Failed to log attachment activity: %v", err)
+	}
+	h.broadcast(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// Avatar serves a stored avatar image to signed-in users
+func (h *AttachmentHandler) Avatar(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	reader, size, contentType, err := h.attachments.OpenAvatar(c.Request.Context(), userID, c.Param("name"))
+	if err != nil {
+		if !errors.Is(err, attachments.ErrNotFound) {
+			log.Printf("Failed to open avatar: %v", err)
+		}
+		c.Status(http.StatusNotFound)
+		return
+	}
+	defer reader.Close()
+
+	// Avatar names are random and change on every upload, so they can be cached for long
+	c.Header("Cache-Control", "private, max-age=604800, immutable")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.DataFromReader(http.StatusOK, size, contentType, reader, nil)
+}
+
+func (h *AttachmentHandler) broadcast(ctx context.Context, taskID uuid.UUID) {
+	if h.realtime == nil {
+		return
+	}
+	if task, err := h.db.GetTask(ctx, taskID); err == nil {
+		h.realtime.BroadcastTaskUpdate(ctx, task.BoardID.String(), task, "updated")
+	}
+}
+
+func (h *AttachmentHandler) writeError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, attachments.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, attachments.ErrTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("File is too large (maximum %d MB)", h.attachments.MaxFileSize()>>20)})
+	case errors.Is(err, attachments.ErrTooMany), errors.Is(err, attachments.ErrEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, attachments.ErrQuotaExceeded):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Attachment operation failed: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Attachment operation failed"})
+	}
+}
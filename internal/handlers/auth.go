@@ -1,17 +1,22 @@
 package handlers
 
 import (
-	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
 	"math/big"
 	"net/http"
-	"os"
 	"regexp"
 	"strings"
 	"time"
 
+	"sudo/internal/config"
 	"sudo/internal/database"
 	"sudo/internal/email"
+	"sudo/internal/logging"
+	"sudo/internal/middleware"
+	"sudo/internal/models"
 	"sudo/templates/components"
 
 	"github.com/a-h/templ"
@@ -22,12 +27,21 @@ import (
 type AuthHandler struct {
 	db           *database.DB
 	emailService *email.EmailService
+	// secureCookies marks session cookies HTTPS-only, as in production
+	secureCookies bool
+
+	// Per-email limiters keyed by CryptoService.RateLimitKey, complementing the per-IP middleware
+	sendLimiter   *middleware.RateLimiter
+	verifyLimiter *middleware.RateLimiter
 }
 
-func NewAuthHandler(db *database.DB, emailService *email.EmailService) *AuthHandler {
+func NewAuthHandler(db *database.DB, emailService *email.EmailService, cfg *config.Config) *AuthHandler {
 	return &AuthHandler{
-		db:           db,
-		emailService: emailService,
+		db:            db,
+		emailService:  emailService,
+		secureCookies: cfg.Production(),
+		sendLimiter:   middleware.NewRateLimiter(5, time.Hour),
+		verifyLimiter: middleware.NewRateLimiter(10, time.Hour),
 	}
 }
 
@@ -56,6 +70,15 @@ func (h *AuthHandler) SendOTP(c *gin.Context) {
 		return
 	}
 
+	// Per-email limit that holds regardless of how many IPs the requests come from
+	if key := h.db.RateLimitKey(email); !h.sendLimiter.Allow(key) {
+		logging.LogSecurityEvent("", "otp_send_rate_limited", "key="+key)
+		component := components.AuthError("Too many codes requested for this email. Please try again later.")
+		handler := templ.Handler(component)
+		handler.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
 	// Generate 6-digit OTP
 	otp, err := generateOTP()
 	if err != nil {
@@ -67,18 +90,26 @@ func (h *AuthHandler) SendOTP(c *gin.Context) {
 
 	// Save OTP to database (expires in 10 minutes)
 	expiresAt := time.Now().Add(10 * time.Minute)
-	err = h.db.CreateOTP(context.Background(), email, otp, expiresAt)
+	err = h.db.CreateOTP(c.Request.Context(), email, otp, expiresAt)
 	if err != nil {
+		var throttle *database.OTPThrottleError
+		if errors.As(err, &throttle) {
+			component := components.AuthError(throttleMessage(throttle))
+			handler := templ.Handler(component)
+			handler.ServeHTTP(c.Writer, c.Request)
+			return
+		}
 		component := components.AuthError("Failed to create OTP. Please try again.")
 		handler := templ.Handler(component)
 		handler.ServeHTTP(c.Writer, c.Request)
 		return
 	}
 
-	// Send OTP email using the email service
+	// Queue the OTP email; delivery and retries happen in the background
 	err = h.emailService.SendOTP(email, otp)
 	if err != nil {
-		component := components.AuthError("Failed to send email. Please check your email address and try again.")
+		log.Printf("Failed to queue OTP email: %v", err)
+		component := components.AuthError("Failed to send email. Please try again.")
 		handler := templ.Handler(component)
 		handler.ServeHTTP(c.Writer, c.Request)
 		return
@@ -91,7 +122,7 @@ func (h *AuthHandler) SendOTP(c *gin.Context) {
 }
 
 func (h *AuthHandler) VerifyOTP(c *gin.Context) {
-	email := c.PostForm("email")
+	email := strings.TrimSpace(strings.ToLower(c.PostForm("email")))
 	otp := c.PostForm("otp")
 
 	if email == "" || otp == "" {
@@ -101,9 +132,24 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 		return
 	}
 
+	if key := h.db.RateLimitKey(email); !h.verifyLimiter.Allow(key) {
+		logging.LogSecurityEvent("", "otp_verify_rate_limited", "key="+key)
+		component := components.AuthError("Too many attempts for this email. Please try again later.")
+		handler := templ.Handler(component)
+		handler.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
 	// Validate OTP
-	user, err := h.db.ValidateOTP(context.Background(), email, otp)
+	user, err := h.db.ValidateOTP(c.Request.Context(), email, otp)
 	if err != nil {
+		var throttle *database.OTPThrottleError
+		if errors.As(err, &throttle) {
+			component := components.AuthError(throttleMessage(throttle))
+			handler := templ.Handler(component)
+			handler.ServeHTTP(c.Writer, c.Request)
+			return
+		}
 		component := components.AuthError("Invalid or expired OTP. Please try again.")
 		handler := templ.Handler(component)
 		handler.ServeHTTP(c.Writer, c.Request)
@@ -111,6 +157,22 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 	}
 
 	// Create session
+	err = startUserSession(c, user, h.secureCookies)
+	if err != nil {
+		component := components.AuthError("Failed to create session. Please try again.")
+		handler := templ.Handler(component)
+		handler.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	// Use window.location instead of HX-Redirect to ensure session cookies are sent
+	c.Header("Content-Type", "text/html")
+	c.String(http.StatusOK, `<script>window.location.href = "/dashboard";</script>`)
+}
+
+// startUserSession stores the signed-in user in the session cookie; secure limits the
+// cookie to HTTPS
+func startUserSession(c *gin.Context, user *models.User, secure bool) error {
 	session := sessions.Default(c)
 	session.Set("user_id", user.ID.String())
 	session.Set("user_email", user.Email)
@@ -120,22 +182,12 @@ func (h *AuthHandler) VerifyOTP(c *gin.Context) {
 	session.Options(sessions.Options{
 		MaxAge:   86400 * 30, // 30 days
 		HttpOnly: true,
-		Secure:   os.Getenv("APP_ENV") == "production", // Enable HTTPS in production
+		Secure:   secure,
 		SameSite: http.SameSiteLaxMode,
 		Path:     "/",
 	})
 
-	err = session.Save()
-	if err != nil {
-		component := components.AuthError("Failed to create session. Please try again.")
-		handler := templ.Handler(component)
-		handler.ServeHTTP(c.Writer, c.Request)
-		return
-	}
-
-	// Use window.location instead of HX-Redirect to ensure session cookies are sent
-	c.Header("Content-Type", "text/html")
-	c.String(http.StatusOK, `<script>window.location.href = "/dashboard";</script>`)
+	return session.Save()
 }
 
 func (h *AuthHandler) Logout(c *gin.Context) {
@@ -144,7 +196,7 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	session.Options(sessions.Options{
 		MaxAge:   -1,
 		HttpOnly: true,
-		Secure:   os.Getenv("APP_ENV") == "production",
+		Secure:   h.secureCookies,
 		SameSite: http.SameSiteLaxMode,
 		Path:     "/",
 	})
@@ -159,6 +211,18 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 	c.String(http.StatusOK, `<script>setTimeout(function(){ window.location.href = "/"; }, 100);</script>`)
 }
 
+// throttleMessage turns a lockout or cooldown into a user-facing message
+func throttleMessage(throttle *database.OTPThrottleError) string {
+	wait := throttle.RetryAfter.Round(time.Second)
+	if wait < time.Second {
+		wait = time.Second
+	}
+	if throttle.Locked {
+		return fmt.Sprintf("Too many failed attempts. Please try again in %s.", wait)
+	}
+	return fmt.Sprintf("Please wait %s before requesting another code.", wait)
+}
+
 func generateOTP() (string, error) {
 	const digits = "0123456789"
 	otp := make([]byte, 6)
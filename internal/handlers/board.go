@@ -8,6 +8,8 @@ import (
 	"strconv"
 	"strings"
 
+	"sudo/internal/attachments"
+	"sudo/internal/customfields"
 	"sudo/internal/database"
 	"sudo/internal/email"
 	"sudo/internal/models"
@@ -25,13 +27,15 @@ type BoardHandler struct {
 	db           *database.DB
 	emailService *email.EmailService
 	realtime     *realtime.RealtimeService
+	attachments  *attachments.Service
 }
 
-func NewBoardHandler(db *database.DB, realtime *realtime.RealtimeService) *BoardHandler {
+func NewBoardHandler(db *database.DB, realtime *realtime.RealtimeService, emailService *email.EmailService, attachmentService *attachments.Service) *BoardHandler {
 	return &BoardHandler{
 		db:           db,
-		emailService: email.NewEmailService(),
+		emailService: emailService,
 		realtime:     realtime,
+		attachments:  attachmentService,
 	}
 }
 
@@ -45,7 +49,7 @@ func (h *BoardHandler) Dashboard(c *gin.Context) {
 
 	fmt.Printf("Loading dashboard for user: %s (%s)\n", user.Email, user.ID.String())
 
-	boards, err := h.db.GetUserBoards(context.Background(), user.ID)
+	boards, err := h.db.GetUserBoards(c.Request.Context(), user.ID)
 	if err != nil {
 		fmt.Printf("Failed to load boards: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to load boards: %v", err)
@@ -61,7 +65,7 @@ func (h *BoardHandler) Dashboard(c *gin.Context) {
 	for _, board := range boards {
 		// Get full board data with columns and members
 		// GetBoardWithColumns now also populates board.Members automatically
-		fullBoard, err := h.db.GetBoardWithColumns(context.Background(), board.ID)
+		fullBoard, err := h.db.GetBoardWithColumns(c.Request.Context(), board.ID)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get full data for board %s: %v\n", board.ID.String(), err)
 			// Use basic board data if full data fetch fails
@@ -122,7 +126,7 @@ func (h *BoardHandler) CreateBoard(c *gin.Context) {
 		}
 	}
 
-	board, err := h.db.CreateBoard(context.Background(), title, description, user.ID, parentBoardID)
+	board, err := h.db.CreateBoard(c.Request.Context(), title, description, user.ID, parentBoardID)
 	if err != nil {
 		fmt.Printf("Database error: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to create board: %v", err)
@@ -130,7 +134,7 @@ func (h *BoardHandler) CreateBoard(c *gin.Context) {
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), user.ID, board.ID, nil, "board_create",
+	err = h.db.LogActivity(c.Request.Context(), user.ID, board.ID, nil, "board_create",
 		fmt.Sprintf("Created board: %s", board.Title), map[string]interface{}{
 			"board_title": board.Title,
 			"description": description,
@@ -168,14 +172,17 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 		return
 	}
 
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	// Users are looked up once per request, however many places reference them
+	ctx := database.WithUserLoader(c.Request.Context(), h.db.NewUserLoader())
+
+	board, err := h.db.GetBoardWithColumns(ctx, boardID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Board not found: %v", err)
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(userID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -189,7 +196,7 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 	// Get parent board if this is a nested board
 	var parentBoard *models.Board
 	if board.ParentBoardID != nil {
-		parentBoard, err = h.db.GetBoardWithColumns(context.Background(), *board.ParentBoardID)
+		parentBoard, err = h.db.GetBoard(ctx, *board.ParentBoardID)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get parent board: %v\n", err)
 			// Continue without parent board info
@@ -197,7 +204,7 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 	}
 
 	// Get nested boards for this board
-	nestedBoards, err := h.db.GetNestedBoards(context.Background(), boardID)
+	nestedBoards, err := h.db.GetNestedBoards(ctx, boardID)
 	if err != nil {
 		fmt.Printf("Warning: Failed to get nested boards: %v\n", err)
 		// Continue with empty nested boards list
@@ -205,14 +212,14 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 	}
 
 	// Get current user data
-	user, err := h.db.GetUserByID(context.Background(), userID)
+	user, err := h.db.GetUserByID(ctx, userID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get user data: %v", err)
 		return
 	}
 
 	// Get all user boards for the invite modal
-	allUserBoards, err := h.db.GetUserBoards(context.Background(), userID)
+	allUserBoards, err := h.db.GetUserBoards(ctx, userID)
 	if err != nil {
 		fmt.Printf("Warning: Failed to get user boards for invite modal: %v\n", err)
 		allUserBoards = []models.Board{} // Continue with empty list
@@ -228,7 +235,7 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 	}
 
 	// Check if current user is board owner/admin to show online users
-	isOwnerOrAdmin, err := h.checkBoardOwnership(userID, boardID)
+	isOwnerOrAdmin, err := h.checkBoardOwnership(c.Request.Context(), userID, boardID)
 	if err != nil {
 		fmt.Printf("Warning: Failed to check board ownership: %v\n", err)
 		isOwnerOrAdmin = false
@@ -237,10 +244,22 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 	// Get online users for this board (only if user is owner/admin)
 	onlineUsers := []models.User{}
 	if isOwnerOrAdmin {
-		presenceData, err := h.db.GetBoardPresence(context.Background(), boardID)
+		presenceData, err := h.db.GetBoardPresence(ctx, boardID)
 		if err != nil {
 			fmt.Printf("Warning: Failed to get board presence: %v\n", err)
 		} else {
+			// Fallback: fetch user data directly if the relationship wasn't populated
+			var missing []uuid.UUID
+			for _, presence := range presenceData {
+				if memberIDs[presence.UserID] && presence.User == nil {
+					missing = append(missing, presence.UserID)
+				}
+			}
+			fallbackUsers, err := h.db.GetUsersByIDs(ctx, missing)
+			if err != nil {
+				fmt.Printf("Warning: Failed to get user data for presence: %v\n", err)
+			}
+
 			// Convert presence data to user data, but only for board members
 			for _, presence := range presenceData {
 				// Only include users who are actual board members
@@ -258,20 +277,13 @@ func (h *BoardHandler) ViewBoard(c *gin.Context) {
 					user.Email = presence.User.Email
 					user.AvatarURL = presence.User.AvatarURL
 					user.DecryptedEmail = presence.User.DecryptedEmail
+				} else if userData := fallbackUsers[presence.UserID]; userData != nil {
+					user.Name = userData.Name
+					user.Email = userData.Email
+					user.AvatarURL = userData.AvatarURL
+					user.DecryptedEmail = userData.DecryptedEmail
 				} else {
-					// Fallback: fetch user data directly if relationship wasn't populated
-					userData, err := h.db.GetUserByID(context.Background(), presence.UserID)
-					if err != nil {
-						fmt.Printf("Warning: Failed to get user data for presence: %v\n", err)
-						user.Name = "Unknown User"
-						user.Email = ""
-						user.AvatarURL = ""
-					} else {
-						user.Name = userData.Name
-						user.Email = userData.Email
-						user.AvatarURL = userData.AvatarURL
-						user.DecryptedEmail = userData.DecryptedEmail
-					}
+					user.Name = "Unknown User"
 				}
 
 				onlineUsers = append(onlineUsers, user)
@@ -309,7 +321,7 @@ func (h *BoardHandler) CreateColumn(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(user.ID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), user.ID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -321,7 +333,7 @@ func (h *BoardHandler) CreateColumn(c *gin.Context) {
 	}
 
 	// Get position (add to end)
-	columns, err := h.db.GetBoardColumns(context.Background(), boardID)
+	columns, err := h.db.GetBoardColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get columns: %v", err)
 		return
@@ -329,14 +341,14 @@ func (h *BoardHandler) CreateColumn(c *gin.Context) {
 
 	position := len(columns)
 
-	column, err := h.db.CreateColumn(context.Background(), boardID, title, position)
+	column, err := h.db.CreateColumn(c.Request.Context(), boardID, title, position)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to create column: %v", err)
 		return
 	}
 
 	// Get board with members populated (includes owner fallback)
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get board: %v", err)
 		return
@@ -394,7 +406,7 @@ func (h *BoardHandler) InviteMember(c *gin.Context) {
 	}
 
 	// Check if user owns this board
-	isOwner, err := h.checkBoardOwnership(userID, boardID)
+	isOwner, err := h.checkBoardOwnership(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board ownership: %v", err)
 		return
@@ -406,24 +418,24 @@ func (h *BoardHandler) InviteMember(c *gin.Context) {
 	}
 
 	// Get board details for email
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get board details: %v", err)
 		return
 	}
 
 	// Get current user details
-	currentUser, err := h.db.GetUserByID(context.Background(), userID)
+	currentUser, err := h.db.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get user details: %v", err)
 		return
 	}
 
 	// Check if user already exists
-	invitedUser, err := h.db.GetUserByEmail(context.Background(), email)
+	invitedUser, err := h.db.GetUserByEmail(c.Request.Context(), email)
 	if err != nil {
 		// User doesn't exist, create them
-		invitedUser, err = h.db.CreateUser(context.Background(), email, "")
+		invitedUser, err = h.db.CreateUser(c.Request.Context(), email, "")
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Failed to create user: %v", err)
 			return
@@ -431,7 +443,7 @@ func (h *BoardHandler) InviteMember(c *gin.Context) {
 	}
 
 	// Check if user is already a member
-	isMember, err := h.db.IsBoardMember(context.Background(), boardID, invitedUser.ID)
+	isMember, err := h.db.IsBoardMember(c.Request.Context(), boardID, invitedUser.ID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check membership: %v", err)
 		return
@@ -443,7 +455,7 @@ func (h *BoardHandler) InviteMember(c *gin.Context) {
 	}
 
 	// Add user to board
-	err = h.db.AddBoardMember(context.Background(), boardID, invitedUser.ID, role)
+	err = h.db.AddBoardMember(c.Request.Context(), boardID, invitedUser.ID, role)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to add board member: %v", err)
 		return
@@ -459,7 +471,7 @@ func (h *BoardHandler) InviteMember(c *gin.Context) {
 	err = h.emailService.SendInvitation(email, currentUser.Name, board.Title, inviteURL)
 	if err != nil {
 		// Log error but don't fail the request
-		fmt.Printf("Failed to send invitation email: %v\n", err)
+		log.Printf("Failed to queue invitation email: %v", err)
 	}
 
 	c.String(http.StatusOK, "Invitation sent successfully")
@@ -480,7 +492,7 @@ func (h *BoardHandler) UpdateBoard(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(userID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -502,19 +514,39 @@ func (h *BoardHandler) UpdateBoard(c *gin.Context) {
 		updates["description"] = description
 	}
 
+	// Board rules are kept in settings and only admins may change them
+	if requireChecklist, set := c.GetPostForm("require_checklist"); set {
+		isAdmin, err := h.checkBoardAdmin(c.Request.Context(), userID, boardID)
+		if err != nil || !isAdmin {
+			c.String(http.StatusForbidden, "Only board admins can change board rules")
+			return
+		}
+		board, err := h.db.GetBoard(c.Request.Context(), boardID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "Failed to get board: %v", err)
+			return
+		}
+		settings := board.Settings
+		if settings == nil {
+			settings = map[string]interface{}{}
+		}
+		settings["require_checklist"] = requireChecklist == "true"
+		updates["settings"] = settings
+	}
+
 	if len(updates) == 0 {
 		c.String(http.StatusBadRequest, "No updates provided")
 		return
 	}
 
-	err = h.db.UpdateBoard(context.Background(), boardID, updates)
+	err = h.db.UpdateBoard(c.Request.Context(), boardID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to update board: %v", err)
 		return
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, boardID, nil, "board_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, boardID, nil, "board_update",
 		"Updated board settings", updates)
 	if err != nil {
 		fmt.Printf("Failed to log board update activity: %v\n", err)
@@ -544,7 +576,7 @@ func (h *BoardHandler) DeleteBoard(c *gin.Context) {
 
 	// Check if user owns this board
 	fmt.Printf("Checking ownership for user %s on board %s\n", user.ID.String(), boardID.String())
-	isOwner, err := h.checkBoardOwnership(user.ID, boardID)
+	isOwner, err := h.checkBoardOwnership(c.Request.Context(), user.ID, boardID)
 	if err != nil {
 		fmt.Printf("Error checking board ownership: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to check board ownership: %v", err)
@@ -561,47 +593,31 @@ func (h *BoardHandler) DeleteBoard(c *gin.Context) {
 	fmt.Printf("Deleting board: %s by user %s\n", boardID.String(), user.Email)
 
 	// Get board info before deletion for logging
-	board, _ := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, _ := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	boardTitle := "Board"
 	if board != nil {
 		boardTitle = board.Title
 	}
 
-	// Check if this board is a nested board (has a parent task)
-	parentTask, err := h.db.GetTaskByNestedBoardID(context.Background(), boardID)
+	// Check if this board is a nested board (has a parent task); it is unlinked on deletion
+	parentTask, err := h.db.GetTaskByNestedBoardID(c.Request.Context(), boardID)
 	if err != nil {
 		fmt.Printf("Error checking for parent task: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to check for parent task: %v", err)
 		return
 	}
 
-	if parentTask != nil {
-		fmt.Printf("Board %s has parent task %s, unlinking before deletion\n", boardID.String(), parentTask.ID.String())
-		// Unlink the parent task from this board
-		updates := map[string]interface{}{
-			"nested_board_id": nil,
-		}
-
-		err = h.db.UpdateTask(context.Background(), parentTask.ID, updates)
-		if err != nil {
-			fmt.Printf("Failed to unlink parent task %s: %v\n", parentTask.ID.String(), err)
-			c.String(http.StatusInternalServerError, "Failed to unlink parent task: %v", err)
-			return
-		}
-		fmt.Printf("Successfully unlinked parent task %s from board %s\n", parentTask.ID.String(), boardID.String())
-	} else {
-		fmt.Printf("Board %s has no parent task, proceeding with deletion\n", boardID.String())
-	}
-
-	err = h.db.DeleteBoard(context.Background(), boardID)
+	boardAttachments := h.attachments.BoardAttachments(c.Request.Context(), boardID)
+	err = h.db.DeleteBoard(c.Request.Context(), boardID)
 	if err != nil {
 		fmt.Printf("Failed to delete board: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to delete board: %v", err)
 		return
 	}
+	h.attachments.DeleteBlobs(c.Request.Context(), boardAttachments...)
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), user.ID, boardID, nil, "board_delete",
+	err = h.db.LogActivity(c.Request.Context(), user.ID, boardID, nil, "board_delete",
 		fmt.Sprintf("Deleted board: %s", boardTitle), map[string]interface{}{
 			"board_id":        boardID.String(),
 			"board_title":     boardTitle,
@@ -650,7 +666,7 @@ func (h *BoardHandler) GetBoardMembers(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(userID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -662,7 +678,7 @@ func (h *BoardHandler) GetBoardMembers(c *gin.Context) {
 	}
 
 	// Get board members with their roles
-	boardMembersWithRoles, err := h.db.GetBoardMembersWithRoles(context.Background(), boardID)
+	boardMembersWithRoles, err := h.db.GetBoardMembersWithRoles(c.Request.Context(), boardID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get board members"})
 		return
@@ -695,7 +711,7 @@ func (h *BoardHandler) UpdateColumn(c *gin.Context) {
 		"title": title,
 	}
 
-	err = h.db.UpdateColumn(context.Background(), columnID, updates)
+	err = h.db.UpdateColumn(c.Request.Context(), columnID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to update column: %v", err)
 		return
@@ -720,7 +736,7 @@ func (h *BoardHandler) DeleteColumn(c *gin.Context) {
 	}
 
 	fmt.Printf("Deleting column: %s by user %s\n", columnID.String(), user.Email)
-	err = h.db.DeleteColumn(context.Background(), columnID)
+	err = h.db.DeleteColumn(c.Request.Context(), columnID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to delete column: %v", err)
 		return
@@ -757,7 +773,7 @@ func (h *BoardHandler) RemoveBoardMember(c *gin.Context) {
 	}
 
 	// Check if user is admin or owner of this board
-	isAdmin, err := h.checkBoardAdmin(userID, boardID)
+	isAdmin, err := h.checkBoardAdmin(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board permissions: %v", err)
 		return
@@ -768,7 +784,7 @@ func (h *BoardHandler) RemoveBoardMember(c *gin.Context) {
 		return
 	}
 
-	err = h.db.RemoveBoardMember(context.Background(), boardID, memberID)
+	err = h.db.RemoveBoardMember(c.Request.Context(), boardID, memberID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to remove board member: %v", err)
 		return
@@ -797,7 +813,7 @@ func (h *BoardHandler) GetBoardTasks(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(userID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -808,16 +824,23 @@ func (h *BoardHandler) GetBoardTasks(c *gin.Context) {
 		return
 	}
 
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get board: %v", err)
 		return
 	}
 
-	// Flatten all tasks from all columns
+	// Flatten all tasks from all columns, keeping those that match the
+	// field[<name or ID>]=<filter> custom field filters
+	fields := board.CustomFields()
+	fieldFilters := c.QueryMap("field")
 	var allTasks []models.Task
 	for _, column := range board.Columns {
-		allTasks = append(allTasks, column.Tasks...)
+		for _, task := range column.Tasks {
+			if customfields.MatchFilters(fields, task.CustomFields, fieldFilters) {
+				allTasks = append(allTasks, task)
+			}
+		}
 	}
 
 	// Ensure we never return null, always return empty array if no tasks
@@ -843,7 +866,7 @@ func (h *BoardHandler) GetNestedBoards(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.checkBoardAccess(userID, boardID)
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -854,7 +877,7 @@ func (h *BoardHandler) GetNestedBoards(c *gin.Context) {
 		return
 	}
 
-	nestedBoards, err := h.db.GetNestedBoards(context.Background(), boardID)
+	nestedBoards, err := h.db.GetNestedBoards(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get nested boards: %v", err)
 		return
@@ -871,13 +894,15 @@ func (h *BoardHandler) SearchContent(c *gin.Context) {
 	}
 
 	query := c.Query("q")
-	if query == "" {
+	// field[<name or ID>]=<filter> narrows task results by custom field values
+	fieldFilters := c.QueryMap("field")
+	if query == "" && len(fieldFilters) == 0 {
 		c.JSON(http.StatusOK, gin.H{"results": []gin.H{}})
 		return
 	}
 
 	// Get user's boards
-	boards, err := h.db.GetUserBoards(context.Background(), userID)
+	boards, err := h.db.GetUserBoards(c.Request.Context(), userID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to search: %v", err)
 		return
@@ -888,7 +913,7 @@ func (h *BoardHandler) SearchContent(c *gin.Context) {
 
 	for _, board := range boards {
 		// Search board titles and descriptions
-		if strings.Contains(strings.ToLower(board.Title), strings.ToLower(query)) ||
+		if len(fieldFilters) == 0 && strings.Contains(strings.ToLower(board.Title), strings.ToLower(query)) ||
 			strings.Contains(strings.ToLower(board.Description), strings.ToLower(query)) {
 			results = append(results, gin.H{
 				"type":        "board",
@@ -899,15 +924,22 @@ func (h *BoardHandler) SearchContent(c *gin.Context) {
 		}
 
 		// Search tasks in this board
-		boardWithColumns, err := h.db.GetBoardWithColumns(context.Background(), board.ID)
+		boardWithColumns, err := h.db.GetBoardWithColumns(c.Request.Context(), board.ID)
 		if err != nil {
 			continue
 		}
 
+		fields := boardWithColumns.CustomFields()
+		userNames := memberNames(boardWithColumns.Members)
+
 		for _, column := range boardWithColumns.Columns {
 			for _, task := range column.Tasks {
+				if !customfields.MatchFilters(fields, task.CustomFields, fieldFilters) {
+					continue
+				}
 				if strings.Contains(strings.ToLower(task.Title), strings.ToLower(query)) ||
-					strings.Contains(strings.ToLower(task.Description), strings.ToLower(query)) {
+					strings.Contains(strings.ToLower(task.Description), strings.ToLower(query)) ||
+					customFieldsContain(fields, task.CustomFields, userNames, query) {
 					results = append(results, gin.H{
 						"type":        "task",
 						"id":          task.ID.String(),
@@ -931,16 +963,16 @@ func (h *BoardHandler) HandleWebSocket(c *gin.Context) {
 }
 
 // Helper functions
-func (h *BoardHandler) checkBoardAccess(userID, boardID uuid.UUID) (bool, error) {
-	return h.db.HasBoardAccess(context.Background(), userID, boardID)
+func (h *BoardHandler) checkBoardAccess(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
+	return h.db.HasBoardAccess(ctx, userID, boardID)
 }
 
-func (h *BoardHandler) checkBoardOwnership(userID, boardID uuid.UUID) (bool, error) {
-	return h.db.IsBoardOwner(context.Background(), userID, boardID)
+func (h *BoardHandler) checkBoardOwnership(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
+	return h.db.IsBoardOwner(ctx, userID, boardID)
 }
 
-func (h *BoardHandler) checkBoardAdmin(userID, boardID uuid.UUID) (bool, error) {
-	return h.db.IsBoardAdmin(context.Background(), userID, boardID)
+func (h *BoardHandler) checkBoardAdmin(ctx context.Context, userID, boardID uuid.UUID) (bool, error) {
+	return h.db.IsBoardAdmin(ctx, userID, boardID)
 }
 
 func getUserFromSession(c *gin.Context) (uuid.UUID, error) {
@@ -969,7 +1001,7 @@ func (h *BoardHandler) validateUserSession(c *gin.Context) (*models.User, error)
 	}
 
 	// Verify user exists in database
-	user, err := h.db.GetUserByID(context.Background(), userID)
+	user, err := h.db.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		// User doesn't exist - clear the invalid session
 		session := sessions.Default(c)
@@ -1025,14 +1057,14 @@ func (h *BoardHandler) MoveTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -1045,7 +1077,7 @@ func (h *BoardHandler) MoveTask(c *gin.Context) {
 
 	// Perform optimistic task move
 	updatedTask, err := h.db.MoveTaskWithOptimisticLock(
-		context.Background(), taskID, columnID, position, expectedVersion)
+		c.Request.Context(), taskID, columnID, position, expectedVersion)
 	if err != nil {
 		c.JSON(http.StatusConflict, gin.H{
 			"error":   "Conflict detected",
@@ -1057,6 +1089,7 @@ func (h *BoardHandler) MoveTask(c *gin.Context) {
 	// Broadcast real-time update to all connected clients
 	if h.realtime != nil {
 		h.realtime.BroadcastTaskUpdate(
+			c.Request.Context(),
 			updatedTask.BoardID.String(),
 			updatedTask,
 			"moved",
@@ -1109,14 +1142,14 @@ func (h *BoardHandler) CreateTaskWithBroadcast(c *gin.Context) {
 	}
 
 	// Check board access
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, boardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil || !hasAccess {
 		c.String(http.StatusForbidden, "Access denied")
 		return
 	}
 
 	// Create task
-	task, err := h.db.CreateTask(context.Background(), title, description, columnID, boardID, priority)
+	task, err := h.db.CreateTask(c.Request.Context(), title, description, columnID, boardID, priority)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to create task: %v", err)
 		return
@@ -1124,7 +1157,7 @@ func (h *BoardHandler) CreateTaskWithBroadcast(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		h.realtime.BroadcastTaskUpdate(boardIDStr, task, "created")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), boardIDStr, task, "created")
 	}
 
 	// Return new task component
@@ -1145,7 +1178,7 @@ func (h *BoardHandler) GetBoardWithPresence(c *gin.Context) {
 		return
 	}
 
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Board not found")
 		return
@@ -1185,7 +1218,7 @@ func (h *BoardHandler) GetBoardColumns(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, boardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check board access"})
 		return
@@ -1197,7 +1230,7 @@ func (h *BoardHandler) GetBoardColumns(c *gin.Context) {
 	}
 
 	// Get board with columns
-	board, err := h.db.GetBoardWithColumns(context.Background(), boardID)
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
 		return
@@ -1224,13 +1257,13 @@ func (h *BoardHandler) GetCollaboratorsCount(c *gin.Context) {
 	}
 
 	// Get all boards owned by or accessible to the user
-	mainBoards, err := h.db.GetUserBoards(context.Background(), user.ID)
+	mainBoards, err := h.db.GetUserBoards(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get boards"})
 		return
 	}
 
-	nestedBoards, err := h.db.GetNestedBoards(context.Background(), user.ID)
+	nestedBoards, err := h.db.GetNestedBoards(c.Request.Context(), user.ID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get nested boards"})
 		return
@@ -1244,7 +1277,7 @@ func (h *BoardHandler) GetCollaboratorsCount(c *gin.Context) {
 
 	for _, board := range allBoards {
 		// Get board members for each board
-		members, err := h.db.GetBoardMembers(context.Background(), board.ID)
+		members, err := h.db.GetBoardMembers(c.Request.Context(), board.ID)
 		if err != nil {
 			continue // Skip this board if we can't get members
 		}
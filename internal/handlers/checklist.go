@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sudo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const maxChecklistItemLength = 500
+
+// AddChecklistItem appends an item with the given content, optionally assigned_to a member
+func (h *TaskHandler) AddChecklistItem(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	content := strings.TrimSpace(c.PostForm("content"))
+	if content == "" || len(content) > maxChecklistItemLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content must be 1-%d characters", maxChecklistItemLength)})
+		return
+	}
+
+	assignedTo, ok := h.checklistAssignee(c, task)
+	if !ok {
+		return
+	}
+
+	item, err := h.db.CreateChecklistItem(c.Request.Context(), task.ID, content, assignedTo, userID)
+	if err != nil {
+		log.Printf("Failed to create checklist item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add checklist item"})
+		return
+	}
+
+	h.logChecklistActivity(c.Request.Context(), userID, task, fmt.Sprintf("Added checklist item to %s: %s", task.Title, content), item.ID)
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateChecklistItem changes any of content, checked ("true"/"false") and assigned_to
+// (empty to unassign) of an item
+func (h *TaskHandler) UpdateChecklistItem(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+	item, ok := h.checklistItemForTask(c, task)
+	if !ok {
+		return
+	}
+
+	updates := make(map[string]interface{})
+	if content, set := c.GetPostForm("content"); set {
+		content = strings.TrimSpace(content)
+		if content == "" || len(content) > maxChecklistItemLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Content must be 1-%d characters", maxChecklistItemLength)})
+			return
+		}
+		updates["content"] = content
+	}
+	if checked, set := c.GetPostForm("checked"); set {
+		isChecked := checked == "true"
+		if isChecked != item.Checked {
+			updates["checked"] = isChecked
+			updates["checked_at"] = nil
+			updates["checked_by"] = nil
+			if isChecked {
+				updates["checked_at"] = time.Now()
+				updates["checked_by"] = userID.String()
+			}
+		}
+	}
+	if _, set := c.GetPostForm("assigned_to"); set {
+		assignedTo, ok := h.checklistAssignee(c, task)
+		if !ok {
+			return
+		}
+		updates["assigned_to"] = nil
+		if assignedTo != nil {
+			updates["assigned_to"] = assignedTo.String()
+		}
+	}
+
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, item)
+		return
+	}
+
+	updated, err := h.db.UpdateChecklistItem(c.Request.Context(), item.ID, updates)
+	if err != nil {
+		log.Printf("Failed to update checklist item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update checklist item"})
+		return
+	}
+
+	description := fmt.Sprintf("Updated checklist item of %s: %s", task.Title, updated.Content)
+	if checked, changed := updates["checked"].(bool); changed {
+		if checked {
+			description = fmt.Sprintf("Checked off in %s: %s", task.Title, updated.Content)
+		} else {
+			description = fmt.Sprintf("Unchecked in %s: %s", task.Title, updated.Content)
+		}
+	}
+	h.logChecklistActivity(c.Request.Context(), userID, task, description, item.ID)
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteChecklistItem removes an item from the task's checklist
+func (h *TaskHandler) DeleteChecklistItem(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+	item, ok := h.checklistItemForTask(c, task)
+	if !ok {
+		return
+	}
+
+	if err := h.db.DeleteChecklistItem(c.Request.Context(), item.ID); err != nil {
+		log.Printf("Failed to delete checklist item: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove checklist item"})
+		return
+	}
+
+	h.logChecklistActivity(c.Request.Context(), userID, task, fmt.Sprintf("Removed checklist item from %s: %s", task.Title, item.Content), item.ID)
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ReorderChecklist puts the task's checklist in the order of item_ids[], which must list
+// every item once
+func (h *TaskHandler) ReorderChecklist(c *gin.Context) {
+	_, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	var itemIDs []uuid.UUID
+	for _, idStr := range c.PostFormArray("item_ids[]") {
+		id, err := uuid.Parse(idStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checklist item ID"})
+			return
+		}
+		itemIDs = append(itemIDs, id)
+	}
+
+	if err := h.db.ReorderChecklistItems(c.Request.Context(), task.ID, itemIDs); err != nil {
+		log.Printf("Failed to reorder checklist: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Checklist changed in the meantime, please reload"})
+		return
+	}
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// checklistItemForTask loads the item in the :itemId parameter if it belongs to task
+func (h *TaskHandler) checklistItemForTask(c *gin.Context, task *models.Task) (*models.ChecklistItem, bool) {
+	itemID, err := uuid.Parse(c.Param("itemId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid checklist item ID"})
+		return nil, false
+	}
+
+	item, err := h.db.GetChecklistItem(c.Request.Context(), itemID)
+	if err != nil || item.TaskID != task.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Checklist item not found"})
+		return nil, false
+	}
+	return item, true
+}
+
+// checklistAssignee parses the optional assigned_to form value, which must be a board member
+func (h *TaskHandler) checklistAssignee(c *gin.Context, task *models.Task) (*uuid.UUID, bool) {
+	assignedToStr := c.PostForm("assigned_to")
+	if assignedToStr == "" {
+		return nil, true
+	}
+
+	assignedTo, err := uuid.Parse(assignedToStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid assignee"})
+		return nil, false
+	}
+	isMember, err := h.db.HasBoardAccess(c.Request.Context(), assignedTo, task.BoardID)
+	if err != nil || !isMember {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Assignee is not a board member"})
+		return nil, false
+	}
+	return &assignedTo, true
+}
+
+// uncheckedItems returns how many checklist items keep task from being completed under
+// its board's require_checklist rule
+func (h *TaskHandler) uncheckedItems(ctx context.Context, task *models.Task) int {
+	checked, total := task.ChecklistProgress()
+	if checked == total {
+		return 0
+	}
+
+	board, err := h.db.GetBoard(ctx, task.BoardID)
+	if err != nil {
+		log.Printf("Failed to load board for checklist rule: %v", err)
+		return 0
+	}
+	if !board.RequiresChecklist() {
+		return 0
+	}
+	return total - checked
+}
+
+func (h *TaskHandler) logChecklistActivity(ctx context.Context, userID uuid.UUID, task *models.Task, description string, itemID uuid.UUID) {
+	err := h.db.LogActivity(ctx, userID, task.BoardID, &task.ID, "task_update",
+		description, map[string]interface{}{
+			"checklist_item_id": itemID.String(),
+		})
+	if err != nil {
+		log.Printf("Failed to log checklist activity: %v", err)
+	}
+}
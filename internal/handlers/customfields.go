@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"sudo/internal/customfields"
+	"sudo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// GetCustomFields lists the custom field definitions of a board
+func (h *BoardHandler) GetCustomFields(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return
+	}
+
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	board, err := h.db.GetBoard(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+		return
+	}
+
+	fields := board.CustomFields()
+	if fields == nil {
+		fields = []models.CustomField{}
+	}
+	c.JSON(http.StatusOK, gin.H{"fields": fields})
+}
+
+// UpdateCustomFields replaces the custom field definitions of a board with the JSON body
+// {"fields": [...]}. Fields without an ID are created; values of removed fields are dropped
+// from tasks the next time they are saved.
+func (h *BoardHandler) UpdateCustomFields(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return
+	}
+
+	isAdmin, err := h.checkBoardAdmin(c.Request.Context(), userID, boardID)
+	if err != nil || !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only board admins can change custom fields"})
+		return
+	}
+
+	var request struct {
+		Fields []models.CustomField `json:"fields"`
+	}
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	fields, err := customfields.ValidateDefinitions(request.Fields)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	board, err := h.db.GetBoard(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+		return
+	}
+
+	settings := board.Settings
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	settings["custom_fields"] = fields
+
+	if err := h.db.UpdateBoard(c.Request.Context(), boardID, map[string]interface{}{"settings": settings}); err != nil {
+		log.Printf("Failed to update custom fields: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update custom fields"})
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, boardID, nil, "board_update",
+		"Updated custom fields", map[string]interface{}{"custom_fields": len(fields)})
+	if err != nil {
+		log.Printf("Failed to log custom field activity: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"fields": fields})
+}
+
+// customFieldsFromForm decodes the optional "custom_fields" form value, a JSON object of
+// values keyed by field ID
+func customFieldsFromForm(c *gin.Context) (map[string]interface{}, error) {
+	raw := c.PostForm("custom_fields")
+	if raw == "" {
+		return nil, nil
+	}
+
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(raw), &values); err != nil {
+		return nil, fmt.Errorf("%w: custom_fields must be a JSON object", customfields.ErrInvalid)
+	}
+	return values, nil
+}
+
+// customFieldStatus maps a custom field error to a response status
+func customFieldStatus(err error) int {
+	if errors.Is(err, customfields.ErrInvalid) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// customFieldsContain reports whether any custom field value contains query
+func customFieldsContain(fields []models.CustomField, values map[string]interface{}, userNames map[string]string, query string) bool {
+	if query == "" {
+		return false
+	}
+	query = strings.ToLower(query)
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(customfields.Format(field, values[field.ID], userNames)), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// memberNames maps the user IDs of board members to their display names
+func memberNames(members []models.BoardMember) map[string]string {
+	names := make(map[string]string, len(members))
+	for _, member := range members {
+		if member.User != nil {
+			names[member.UserID.String()] = member.User.GetDisplayName()
+		}
+	}
+	return names
+}
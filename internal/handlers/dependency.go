@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"sudo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// taskForMember loads the task in the :id parameter if the current user can access its board
+func (h *TaskHandler) taskForMember(c *gin.Context) (uuid.UUID, *models.Task, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, nil, false
+	}
+
+	taskID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return uuid.Nil, nil, false
+	}
+
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return uuid.Nil, nil, false
+	}
+
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return uuid.Nil, nil, false
+	}
+
+	return userID, task, true
+}
+
+// GetTaskDependencies lists the links of a task, leaving out tasks on boards the user
+// cannot see
+func (h *TaskHandler) GetTaskDependencies(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	access := map[uuid.UUID]bool{task.BoardID: true}
+	dependencies := make([]models.TaskDependency, 0, len(task.Dependencies))
+	for _, dependency := range task.Dependencies {
+		other := dependency.Other(task.ID)
+		if other == nil {
+			continue
+		}
+		allowed, checked := access[other.BoardID]
+		if !checked {
+			allowed, _ = h.db.HasBoardAccess(c.Request.Context(), userID, other.BoardID)
+			access[other.BoardID] = allowed
+		}
+		if allowed {
+			dependencies = append(dependencies, dependency)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dependencies":  dependencies,
+		"open_blockers": task.OpenBlockers(),
+	})
+}
+
+// AddTaskDependency links the task to target_task_id. type is one of blocks, blocked_by
+// (stored as the inverse "blocks" link), relates_to or duplicates.
+func (h *TaskHandler) AddTaskDependency(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	targetID, err := uuid.Parse(c.PostForm("target_task_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target task ID"})
+		return
+	}
+	if targetID == task.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A task cannot depend on itself"})
+		return
+	}
+
+	target, err := h.db.GetTask(c.Request.Context(), targetID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Target task not found"})
+		return
+	}
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, target.BoardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied to target task"})
+		return
+	}
+
+	source := task
+	dependencyType := c.PostForm("type")
+	switch dependencyType {
+	case models.DependencyBlocks, models.DependencyRelatesTo, models.DependencyDuplicates:
+	case "blocked_by":
+		source, target = target, task
+		dependencyType = models.DependencyBlocks
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dependency type"})
+		return
+	}
+
+	exists, err := h.db.TaskDependencyExists(c.Request.Context(), source.ID, target.ID, dependencyType)
+	if err != nil {
+		log.Printf("Failed to check task dependency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependency"})
+		return
+	}
+	if exists {
+		c.JSON(http.StatusConflict, gin.H{"error": "These tasks are already linked"})
+		return
+	}
+
+	if dependencyType == models.DependencyBlocks {
+		// source blocks target closes a cycle if target already (indirectly) blocks source
+		cycle, err := h.db.BlocksTransitively(c.Request.Context(), target.ID, source.ID)
+		if err != nil {
+			log.Printf("Failed to check dependency cycle: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependency"})
+			return
+		}
+		if cycle {
+			c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%q already depends on %q; this link would create a cycle", source.Title, target.Title)})
+			return
+		}
+	}
+
+	dependency, err := h.db.CreateTaskDependency(c.Request.Context(), source.ID, target.ID, dependencyType, userID)
+	if err != nil {
+		log.Printf("Failed to create task dependency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add dependency"})
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "dependency_add",
+		fmt.Sprintf("Linked %s %s %s", source.Title, dependencyType, target.Title), map[string]interface{}{
+			"dependency_id":  dependency.ID.String(),
+			"type":           dependencyType,
+			"source_task_id": source.ID.String(),
+			"target_task_id": target.ID.String(),
+		})
+	if err != nil {
+		log.Printf("Failed to log dependency activity: %v", err)
+	}
+	h.broadcastTasks(c.Request.Context(), source.ID, target.ID)
+
+	c.JSON(http.StatusCreated, dependency)
+}
+
+// RemoveTaskDependency deletes one of the task's links
+func (h *TaskHandler) RemoveTaskDependency(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	dependencyID, err := uuid.Parse(c.Param("dependencyId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid dependency ID"})
+		return
+	}
+
+	dependency, err := h.db.GetTaskDependency(c.Request.Context(), dependencyID)
+	if err != nil || (dependency.SourceTaskID != task.ID && dependency.TargetTaskID != task.ID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Dependency not found"})
+		return
+	}
+
+	if err := h.db.DeleteTaskDependency(c.Request.Context(), dependencyID); err != nil {
+		log.Printf("Failed to delete task dependency: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove dependency"})
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "dependency_remove",
+		fmt.Sprintf("Removed a %s link from: %s", dependency.Type, task.Title), map[string]interface{}{
+			"dependency_id":  dependency.ID.String(),
+			"type":           dependency.Type,
+			"source_task_id": dependency.SourceTaskID.String(),
+			"target_task_id": dependency.TargetTaskID.String(),
+		})
+	if err != nil {
+		log.Printf("Failed to log dependency activity: %v", err)
+	}
+	h.broadcastTasks(c.Request.Context(), dependency.SourceTaskID, dependency.TargetTaskID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// broadcastTasks re-renders the given tasks on their boards, e.g. after their links changed
+func (h *TaskHandler) broadcastTasks(ctx context.Context, taskIDs ...uuid.UUID) {
+	if h.realtime == nil {
+		return
+	}
+	for _, taskID := range taskIDs {
+		if task, err := h.db.GetTask(ctx, taskID); err == nil {
+			h.realtime.BroadcastTaskUpdate(ctx, task.BoardID.String(), task, "updated")
+		}
+	}
+}
+
+// broadcastBlockedTasks refreshes the tasks waiting on task, whose "blocked by" badges
+// depend on whether task is resolved
+func (h *TaskHandler) broadcastBlockedTasks(ctx context.Context, task *models.Task) {
+	var blocked []uuid.UUID
+	for _, dependency := range task.Dependencies {
+		if dependency.Type == models.DependencyBlocks && dependency.SourceTaskID == task.ID {
+			blocked = append(blocked, dependency.TargetTaskID)
+		}
+	}
+	h.broadcastTasks(ctx, blocked...)
+}
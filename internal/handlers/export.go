@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sudo/internal/customfields"
+	"sudo/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// exportOptions are the choices of the export modal
+type exportOptions struct {
+	includeCompleted   bool
+	includeComments    bool
+	includeAssignments bool
+	includeTimestamps  bool
+	from, to           *time.Time
+}
+
+type exportComment struct {
+	Author    string    `json:"author"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportTask struct {
+	ID           string                 `json:"id"`
+	Title        string                 `json:"title"`
+	Description  string                 `json:"description"`
+	Column       string                 `json:"column"`
+	Priority     string                 `json:"priority"`
+	Completed    bool                   `json:"completed"`
+	Deadline     *time.Time             `json:"deadline,omitempty"`
+	Tags         []string               `json:"tags,omitempty"`
+	CustomFields map[string]interface{} `json:"custom_fields,omitempty"` // Keyed by field name
+	Assignees    []string               `json:"assignees,omitempty"`
+	Comments     []exportComment        `json:"comments,omitempty"`
+	CreatedAt    *time.Time             `json:"created_at,omitempty"`
+	UpdatedAt    *time.Time             `json:"updated_at,omitempty"`
+	CompletedAt  *time.Time             `json:"completed_at,omitempty"`
+
+	columnID uuid.UUID
+	// Values formatted for text exports, in field order
+	customFieldText []string
+}
+
+// ExportBoard downloads the board's tasks as json, csv or markdown. Query options:
+// includeCompleted, includeComments, includeAssignments and includeTimestamps ("true" or
+// "false"), and fromDate/toDate (YYYY-MM-DD) on the task creation date.
+func (h *BoardHandler) ExportBoard(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.String(http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid board ID")
+		return
+	}
+
+	hasAccess, err := h.checkBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.String(http.StatusForbidden, "You don't have access to this board")
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	switch format {
+	case "json", "csv", "markdown":
+	case "pdf":
+		c.String(http.StatusNotImplemented, "PDF export is not supported yet")
+		return
+	default:
+		c.String(http.StatusBadRequest, "Unsupported export format")
+		return
+	}
+
+	options := exportOptions{
+		includeCompleted:   c.DefaultQuery("includeCompleted", "true") == "true",
+		includeComments:    c.Query("includeComments") == "true",
+		includeAssignments: c.DefaultQuery("includeAssignments", "true") == "true",
+		includeTimestamps:  c.Query("includeTimestamps") == "true",
+	}
+	for param, bound := range map[string]**time.Time{"fromDate": &options.from, "toDate": &options.to} {
+		if value := c.Query(param); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.String(http.StatusBadRequest, "Invalid %s", param)
+				return
+			}
+			*bound = &date
+		}
+	}
+
+	board, err := h.db.GetBoardWithColumns(c.Request.Context(), boardID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "Failed to get board: %v", err)
+		return
+	}
+
+	fields := board.CustomFields()
+	tasks, err := h.exportTasks(c.Request.Context(), board, fields, options)
+	if err != nil {
+		log.Printf("Failed to export board %s: %v", boardID.String(), err)
+		c.String(http.StatusInternalServerError, "Failed to export board")
+		return
+	}
+
+	filename := fmt.Sprintf("board-export-%s", boardID.String())
+	switch format {
+	case "json":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".json"))
+		c.JSON(http.StatusOK, gin.H{
+			"board": gin.H{
+				"id":          board.ID,
+				"title":       board.Title,
+				"description": board.Description,
+			},
+			"custom_fields": fields,
+			"tasks":         tasks,
+			"exported_at":   time.Now().UTC(),
+		})
+	case "csv":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		if err := writeExportCSV(c, fields, tasks, options); err != nil {
+			log.Printf("Failed to write CSV export: %v", err)
+		}
+	case "markdown":
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".md"))
+		c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(exportMarkdown(board, fields, tasks, options)))
+	}
+}
+
+// exportTasks collects the board's tasks that match options, in column order
+func (h *BoardHandler) exportTasks(ctx context.Context, board *models.Board, fields []models.CustomField, options exportOptions) ([]exportTask, error) {
+	userNames := memberNames(board.Members)
+
+	var selected []models.Task
+	columns := make(map[uuid.UUID]string)
+	for _, column := range board.Columns {
+		columns[column.ID] = column.Title
+		for _, task := range column.Tasks {
+			if task.Completed && !options.includeCompleted {
+				continue
+			}
+			if options.from != nil && task.CreatedAt.Before(*options.from) {
+				continue
+			}
+			if options.to != nil && !task.CreatedAt.Before(options.to.AddDate(0, 0, 1)) {
+				continue
+			}
+			selected = append(selected, task)
+		}
+	}
+
+	comments := make(map[uuid.UUID][]exportComment)
+	if options.includeComments && len(selected) > 0 {
+		taskIDs := make([]uuid.UUID, len(selected))
+		for i, task := range selected {
+			taskIDs[i] = task.ID
+		}
+		taskComments, err := h.db.GetTaskComments(ctx, taskIDs)
+		if err != nil {
+			return nil, err
+		}
+		for _, comment := range taskComments {
+			author, ok := userNames[comment.UserID.String()]
+			if !ok {
+				author = "Former member"
+			}
+			comments[comment.TaskID] = append(comments[comment.TaskID], exportComment{
+				Author:    author,
+				Content:   comment.Content,
+				CreatedAt: comment.CreatedAt,
+			})
+		}
+	}
+
+	tasks := make([]exportTask, 0, len(selected))
+	for _, task := range selected {
+		exported := exportTask{
+			ID:          task.ID.String(),
+			Title:       task.Title,
+			Description: task.Description,
+			Column:      columns[task.ColumnID],
+			columnID:    task.ColumnID,
+			Priority:    task.Priority,
+			Completed:   task.Completed,
+			Deadline:    task.Deadline,
+			Tags:        task.Tags,
+			Comments:    comments[task.ID],
+		}
+
+		for _, field := range fields {
+			value := task.CustomFields[field.ID]
+			exported.customFieldText = append(exported.customFieldText, customfields.Format(field, value, userNames))
+			if value == nil {
+				continue
+			}
+			if exported.CustomFields == nil {
+				exported.CustomFields = make(map[string]interface{})
+			}
+			if field.Type == models.CustomFieldUser {
+				value = customfields.Format(field, value, userNames)
+			}
+			exported.CustomFields[field.Name] = value
+		}
+
+		if options.includeAssignments {
+			for _, assignee := range task.Assignees {
+				if assignee.User != nil {
+					exported.Assignees = append(exported.Assignees, assignee.User.GetDisplayName())
+				}
+			}
+		}
+
+		if options.includeTimestamps {
+			createdAt, updatedAt := task.CreatedAt, task.UpdatedAt
+			exported.CreatedAt = &createdAt
+			exported.UpdatedAt = &updatedAt
+			exported.CompletedAt = task.CompletedAt
+		}
+
+		tasks = append(tasks, exported)
+	}
+
+	return tasks, nil
+}
+
+func writeExportCSV(c *gin.Context, fields []models.CustomField, tasks []exportTask, options exportOptions) error {
+	writer := csv.NewWriter(c.Writer)
+
+	header := []string{"ID", "Title", "Description", "Column", "Priority", "Completed", "Deadline", "Tags"}
+	for _, field := range fields {
+		header = append(header, field.Name)
+	}
+	if options.includeAssignments {
+		header = append(header, "Assignees")
+	}
+	if options.includeComments {
+		header = append(header, "Comments")
+	}
+	if options.includeTimestamps {
+		header = append(header, "Created", "Updated", "Completed At")
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write CSV header: %w", err)
+	}
+
+	for _, task := range tasks {
+		row := []string{
+			task.ID, task.Title, task.Description, task.Column, task.Priority,
+			strconv.FormatBool(task.Completed), formatExportTime(task.Deadline), strings.Join(task.Tags, ", "),
+		}
+		row = append(row, task.customFieldText...)
+		if options.includeAssignments {
+			row = append(row, strings.Join(task.Assignees, ", "))
+		}
+		if options.includeComments {
+			lines := make([]string, len(task.Comments))
+			for i, comment := range task.Comments {
+				lines[i] = comment.Author + ": " + comment.Content
+			}
+			row = append(row, strings.Join(lines, "\n"))
+		}
+		if options.includeTimestamps {
+			row = append(row, formatExportTime(task.CreatedAt), formatExportTime(task.UpdatedAt), formatExportTime(task.CompletedAt))
+		}
+		if err := writer.Write(row); err != nil {
+			return fmt.Errorf("failed to write CSV row: %w", err)
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func exportMarkdown(board *models.Board, fields []models.CustomField, tasks []exportTask, options exportOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", board.Title)
+	if board.Description != "" {
+		fmt.Fprintf(&b, "%s\n\n", board.Description)
+	}
+
+	for _, column := range board.Columns {
+		fmt.Fprintf(&b, "## %s\n\n", column.Title)
+		empty := true
+		for _, task := range tasks {
+			if task.columnID != column.ID {
+				continue
+			}
+			empty = false
+
+			check := " "
+			if task.Completed {
+				check = "x"
+			}
+			fmt.Fprintf(&b, "- [%s] **%s** (%s)\n", check, task.Title, task.Priority)
+			if task.Description != "" {
+				fmt.Fprintf(&b, "  %s\n", strings.ReplaceAll(task.Description, "\n", "\n  "))
+			}
+			if task.Deadline != nil {
+				fmt.Fprintf(&b, "  - Deadline: %s\n", formatExportTime(task.Deadline))
+			}
+			if len(task.Tags) > 0 {
+				fmt.Fprintf(&b, "  - Tags: %s\n", strings.Join(task.Tags, ", "))
+			}
+			for i, field := range fields {
+				if task.customFieldText[i] != "" {
+					fmt.Fprintf(&b, "  - %s: %s\n", field.Name, task.customFieldText[i])
+				}
+			}
+			if len(task.Assignees) > 0 {
+				fmt.Fprintf(&b, "  - Assignees: %s\n", strings.Join(task.Assignees, ", "))
+			}
+			if options.includeTimestamps {
+				fmt.Fprintf(&b, "  - Created: %s, updated: %s\n", formatExportTime(task.CreatedAt), formatExportTime(task.UpdatedAt))
+			}
+			for _, comment := range task.Comments {
+				fmt.Fprintf(&b, "  > %s: %s\n", comment.Author, strings.ReplaceAll(comment.Content, "\n", " "))
+			}
+		}
+		if empty {
+			b.WriteString("_No tasks_\n")
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
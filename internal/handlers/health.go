@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"sudo/internal/buildinfo"
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/email"
+	"sudo/internal/realtime"
+
+	"github.com/gin-gonic/gin"
+)
+
+// How long readiness waits for the database before reporting it unreachable
+const readinessDBTimeout = 2 * time.Second
+
+// HealthHandler serves the probes load balancers and orchestrators poll: /livez says
+// the process is up, /readyz whether it can serve users
+type HealthHandler struct {
+	db           *database.DB
+	rt           *realtime.RealtimeService
+	emailService *email.EmailService
+	production   bool
+	started      time.Time
+}
+
+func NewHealthHandler(db *database.DB, rt *realtime.RealtimeService, emailService *email.EmailService, cfg *config.Config) *HealthHandler {
+	return &HealthHandler{
+		db:           db,
+		rt:           rt,
+		emailService: emailService,
+		production:   cfg.Production(),
+		started:      time.Now(),
+	}
+}
+
+// Livez answers as long as the process can handle requests; it checks no dependencies,
+// so a database outage does not get every instance restarted
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "ok",
+		"build":  buildinfo.Get(),
+	})
+}
+
+// Readyz checks the database, the encryption key, the realtime hub and the email
+// transport, and answers 503 when any of them fails so the instance is taken out of rotation.
+// The endpoint is public, so each check only reports ok or fail; the reason is logged.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	checks := gin.H{}
+	ready := true
+	record := func(name string, err error, detail string) {
+		checks[name] = "ok"
+		if err != nil {
+			checks[name] = "fail"
+			ready = false
+			log.Printf("[HEALTH] Readiness check %s failed (%s): %v", name, detail, err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessDBTimeout)
+	defer cancel()
+	start := time.Now()
+	err := h.db.Ping(ctx)
+	record("database", err, fmt.Sprintf("after %dms", time.Since(start).Milliseconds()))
+
+	record("encryption", h.db.CheckCrypto(), "encryption key")
+
+	stats := h.rt.Stats()
+	record("realtime", hubError(stats), fmt.Sprintf("hub %+v", stats))
+
+	record("email", h.emailService.CheckTransport(h.production), "transport "+h.emailService.TransportName())
+
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "degraded", http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(code, gin.H{
+		"status":         status,
+		"build":          buildinfo.Get(),
+		"uptime_seconds": int64(time.Since(h.started).Seconds()),
+		"checks":         checks,
+	})
+}
+
+var (
+	errHubShuttingDown = errors.New("shutting down")
+	errHubBacklogged   = errors.New("broadcast queue is full")
+)
+
+// hubError fails readiness while the hub drains for shutdown or cannot keep up with broadcasts
+func hubError(stats realtime.HubStats) error {
+	switch {
+	case stats.ShuttingDown:
+		return errHubShuttingDown
+	case stats.BroadcastQueue >= stats.BroadcastCapacity:
+		return errHubBacklogged
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/inbound"
+	"sudo/internal/security"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// InboundHandler receives raw emails from a mail provider webhook or relay and
+// tells board members which address to send them to
+type InboundHandler struct {
+	db        *database.DB
+	processor *inbound.Processor
+	secret    string
+}
+
+func NewInboundHandler(db *database.DB, processor *inbound.Processor, cfg *config.Config) *InboundHandler {
+	return &InboundHandler{
+		db:        db,
+		processor: processor,
+		secret:    cfg.Inbound.Secret,
+	}
+}
+
+// ReceiveEmail accepts a raw RFC 5322 message as the request body. The envelope recipients
+// can be passed as ?recipient= parameters; otherwise the To/Cc headers are used.
+// Requires "Authorization: Bearer $INBOUND_EMAIL_SECRET".
+func (h *InboundHandler) ReceiveEmail(c *gin.Context) {
+	if !h.processor.Enabled() || h.secret == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email is not enabled"})
+		return
+	}
+
+	token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !security.SecureCompare(token, h.secret) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(c.Request.Body, inbound.MaxMessageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read message"})
+		return
+	}
+	if len(raw) > inbound.MaxMessageSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Message too large"})
+		return
+	}
+
+	result, err := h.processor.Process(c.Request.Context(), raw, c.QueryArray("recipient"))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, result)
+	case errors.Is(err, inbound.ErrUnknownRecipient):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, inbound.ErrNotAuthorized), errors.Is(err, inbound.ErrUnauthenticated):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, inbound.ErrEmptyMessage):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Failed to process inbound email: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to process message"})
+	}
+}
+
+// BoardAddress returns the address that creates tasks on a board
+func (h *InboundHandler) BoardAddress(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return
+	}
+
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	if !h.processor.Enabled() {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbound email is not enabled"})
+		return
+	}
+
+	address, err := h.processor.BoardAddress(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get board address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"address": address})
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/oidc"
+	"sudo/templates/pages"
+
+	"github.com/a-h/templ"
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// Session keys holding the in-flight authorization request
+const (
+	oidcSessionProvider = "oidc_provider"
+	oidcSessionState    = "oidc_state"
+	oidcSessionNonce    = "oidc_nonce"
+	oidcSessionVerifier = "oidc_verifier"
+)
+
+type OIDCHandler struct {
+	db            *database.DB
+	providers     *oidc.Manager
+	secureCookies bool
+}
+
+func NewOIDCHandler(db *database.DB, providers *oidc.Manager, cfg *config.Config) *OIDCHandler {
+	return &OIDCHandler{
+		db:            db,
+		providers:     providers,
+		secureCookies: cfg.Production(),
+	}
+}
+
+// Login starts the authorization-code + PKCE flow for the requested provider
+func (h *OIDCHandler) Login(c *gin.Context) {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		h.renderLoginError(c, http.StatusNotFound, "Unknown sign-in provider")
+		return
+	}
+
+	state, err := oidc.RandomToken()
+	if err != nil {
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to start sign-in. Please try again.")
+		return
+	}
+	nonce, err := oidc.RandomToken()
+	if err != nil {
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to start sign-in. Please try again.")
+		return
+	}
+	verifier, err := oidc.RandomToken()
+	if err != nil {
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to start sign-in. Please try again.")
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(c.Request.Context(), h.redirectURL(c, provider), state, nonce, verifier)
+	if err != nil {
+		log.Printf("OIDC login failed for provider %s: %v", provider.Name, err)
+		h.renderLoginError(c, http.StatusBadGateway, "Sign-in provider is unavailable. Please try again later.")
+		return
+	}
+
+	session := sessions.Default(c)
+	session.Set(oidcSessionProvider, provider.Name)
+	session.Set(oidcSessionState, state)
+	session.Set(oidcSessionNonce, nonce)
+	session.Set(oidcSessionVerifier, verifier)
+	if err := session.Save(); err != nil {
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to start sign-in. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback completes the flow, maps the verified email onto a user and signs them in
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	provider, ok := h.providers.Get(c.Param("provider"))
+	if !ok {
+		h.renderLoginError(c, http.StatusNotFound, "Unknown sign-in provider")
+		return
+	}
+
+	// The pending request is single use regardless of the outcome
+	session := sessions.Default(c)
+	expectedProvider, _ := session.Get(oidcSessionProvider).(string)
+	expectedState, _ := session.Get(oidcSessionState).(string)
+	nonce, _ := session.Get(oidcSessionNonce).(string)
+	verifier, _ := session.Get(oidcSessionVerifier).(string)
+	session.Delete(oidcSessionProvider)
+	session.Delete(oidcSessionState)
+	session.Delete(oidcSessionNonce)
+	session.Delete(oidcSessionVerifier)
+	session.Save()
+
+	if errCode := c.Query("error"); errCode != "" {
+		log.Printf("OIDC provider %s returned error: %s %s", provider.Name, errCode, c.Query("error_description"))
+		h.renderLoginError(c, http.StatusUnauthorized, "Sign-in was cancelled or denied.")
+		return
+	}
+
+	state := c.Query("state")
+	if expectedState == "" || expectedProvider != provider.Name ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		h.renderLoginError(c, http.StatusBadRequest, "Sign-in session expired. Please try again.")
+		return
+	}
+
+	code := c.Query("code")
+	if code == "" {
+		h.renderLoginError(c, http.StatusBadRequest, "Missing authorization code.")
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), h.redirectURL(c, provider), code, verifier, nonce)
+	if err != nil {
+		log.Printf("OIDC token exchange failed for provider %s: %v", provider.Name, err)
+		h.renderLoginError(c, http.StatusUnauthorized, "Could not verify your identity. Please try again.")
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(claims.Email))
+	if email == "" || !bool(claims.EmailVerified) || !isValidEmail(email) {
+		h.renderLoginError(c, http.StatusForbidden, "Your account does not have a verified email address.")
+		return
+	}
+
+	ctx := c.Request.Context()
+	user, err := h.db.GetUserByEmail(ctx, email)
+	if err != nil && !errors.Is(err, database.ErrUserNotFound) {
+		log.Printf("Failed to look up OIDC user %s: %v", email, err)
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to sign you in. Please try again.")
+		return
+	}
+	if user == nil {
+		// Only new sign-ups are restricted to the allowed domains
+		if !provider.EmailAllowed(email) {
+			log.Printf("OIDC sign-up rejected for %s via %s: domain not allowed", email, provider.Name)
+			h.renderLoginError(c, http.StatusForbidden, "Sign-ups are not allowed for your email domain.")
+			return
+		}
+
+		name := claims.Name
+		if name == "" {
+			name = claims.PreferredUsername
+		}
+		user, err = h.db.CreateUser(ctx, email, name)
+		if err != nil {
+			log.Printf("Failed to create OIDC user %s: %v", email, err)
+			h.renderLoginError(c, http.StatusInternalServerError, "Failed to create your account. Please try again.")
+			return
+		}
+	}
+
+	if err := startUserSession(c, user, h.secureCookies); err != nil {
+		h.renderLoginError(c, http.StatusInternalServerError, "Failed to create session. Please try again.")
+		return
+	}
+
+	c.Redirect(http.StatusFound, "/dashboard")
+}
+
+// redirectURL prefers the configured callback and falls back to the current host
+func (h *OIDCHandler) redirectURL(c *gin.Context, provider *oidc.Provider) string {
+	if provider.RedirectURL != "" {
+		return provider.RedirectURL
+	}
+	return getBaseURL(c) + "/auth/oidc/" + provider.Name + "/callback"
+}
+
+func (h *OIDCHandler) renderLoginError(c *gin.Context, status int, message string) {
+	component := pages.Login(h.providers.Providers(), message)
+	handler := templ.Handler(component, templ.WithStatus(status))
+	handler.ServeHTTP(c.Writer, c.Request)
+}
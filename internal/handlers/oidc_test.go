@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/oidc"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-contrib/sessions/cookie"
+	"github.com/gin-gonic/gin"
+)
+
+// newTestIdentityProvider serves discovery, JWKS and a token endpoint that issues an
+// ID token for ada@example.com with the nonce the test asks for
+func newTestIdentityProvider(t *testing.T, nonce *string) *httptest.Server {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 server.URL,
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/token",
+			"jwks_uri":               server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256"})
+		payload, _ := json.Marshal(map[string]interface{}{
+			"iss":            server.URL,
+			"sub":            "ada",
+			"aud":            "sudo-client",
+			"exp":            time.Now().Add(time.Hour).Unix(),
+			"nonce":          *nonce,
+			"email":          "ada@example.com",
+			"email_verified": true,
+		})
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		json.NewEncoder(w).Encode(map[string]string{
+			"id_token": signed + "." + base64.RawURLEncoding.EncodeToString(signature),
+		})
+	})
+
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dbCalls counts the requests that reached the test database
+type dbCalls struct {
+	reads, writes atomic.Int32
+}
+
+// oidcTestRouter wires the OIDC handler to a database whose every request fails
+func oidcTestRouter(t *testing.T, issuer string) (*gin.Engine, *dbCalls) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	calls := &dbCalls{}
+	failingDB := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			calls.reads.Add(1)
+		} else {
+			calls.writes.Add(1)
+		}
+		http.Error(w, `{"message":"database unavailable"}`, http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(failingDB.Close)
+
+	cfg := &config.Config{
+		Env:      config.EnvDevelopment,
+		Database: config.Database{SupabaseURL: failingDB.URL, SupabaseServiceKey: "test-key"},
+		Encryption: config.Encryption{
+			MasterKey:  base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			KeyVersion: 1,
+		},
+		Cache: config.Cache{Driver: "off"},
+	}
+	providers, err := oidc.NewManager(config.OIDC{Providers: []config.OIDCProvider{{
+		Name: "mock", Issuer: issuer, ClientID: "sudo-client",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewOIDCHandler(database.NewDB(cfg), providers, cfg)
+
+	r := gin.New()
+	r.Use(sessions.Sessions("test-session", cookie.NewStore([]byte("test-secret-test-secret-test-secret"))))
+	r.GET("/auth/oidc/:provider/login", handler.Login)
+	r.GET("/auth/oidc/:provider/callback", handler.Callback)
+	return r, calls
+}
+
+// startLogin runs the login redirect and returns the state and the session cookie
+func startLogin(t *testing.T, r *gin.Engine) (string, []*http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login returned %d: %s", w.Code, w.Body.String())
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("state"), w.Result().Cookies()
+}
+
+func callback(r *gin.Engine, query string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/callback?"+query, nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCCallback(t *testing.T) {
+	nonce := ""
+	idp := newTestIdentityProvider(t, &nonce)
+
+	t.Run("state mismatch", func(t *testing.T) {
+		r, dbRequests := oidcTestRouter(t, idp.URL)
+		_, cookies := startLogin(t, r)
+		if w := callback(r, "state=forged&code=abc", cookies); w.Code != http.StatusBadRequest {
+			t.Errorf("forged state returned %d, want 400", w.Code)
+		}
+		if dbRequests.reads.Load()+dbRequests.writes.Load() != 0 {
+			t.Error("a forged state must not reach the database")
+		}
+	})
+
+	t.Run("no pending login", func(t *testing.T) {
+		r, _ := oidcTestRouter(t, idp.URL)
+		state, _ := startLogin(t, r)
+		if w := callback(r, "state="+url.QueryEscape(state)+"&code=abc", nil); w.Code != http.StatusBadRequest {
+			t.Errorf("callback without the login session returned %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("nonce mismatch", func(t *testing.T) {
+		r, dbRequests := oidcTestRouter(t, idp.URL)
+		state, cookies := startLogin(t, r)
+		nonce = "replayed-nonce"
+		if w := callback(r, "state="+url.QueryEscape(state)+"&code=abc", cookies); w.Code != http.StatusUnauthorized {
+			t.Errorf("token with another nonce returned %d, want 401", w.Code)
+		}
+		if dbRequests.reads.Load()+dbRequests.writes.Load() != 0 {
+			t.Error("an unverified token must not reach the database")
+		}
+	})
+
+	t.Run("database error is not treated as a new user", func(t *testing.T) {
+		r, dbRequests := oidcTestRouter(t, idp.URL)
+
+		// The login stores its nonce in the session; read it back from the authorize URL
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/mock/login", nil))
+		location, _ := url.Parse(w.Header().Get("Location"))
+		nonce = location.Query().Get("nonce")
+
+		resp := callback(r, "state="+url.QueryEscape(location.Query().Get("state"))+"&code=abc", w.Result().Cookies())
+		if resp.Code != http.StatusInternalServerError {
+			t.Errorf("failed user lookup returned %d, want 500", resp.Code)
+		}
+		if dbRequests.reads.Load() == 0 {
+			t.Error("the user lookup never reached the database")
+		}
+		if dbRequests.writes.Load() != 0 {
+			t.Error("a failed lookup must not create a user")
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sudo/internal/recurrence"
+	"sudo/internal/rrule"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetTaskRecurrence makes the task the first instance of a recurring series. The rule is
+// either a raw "rrule" or built from freq (daily, weekly, monthly, yearly), interval,
+// byday (e.g. "MO,WE"), and an optional count or until (YYYY-MM-DD).
+func (h *TaskHandler) SetTaskRecurrence(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	ruleText := c.PostForm("rrule")
+	if ruleText == "" {
+		parts := []string{"FREQ=" + strings.ToUpper(c.PostForm("freq"))}
+		if interval := c.PostForm("interval"); interval != "" && interval != "1" {
+			parts = append(parts, "INTERVAL="+interval)
+		}
+		if byDay := c.PostForm("byday"); byDay != "" {
+			parts = append(parts, "BYDAY="+byDay)
+		}
+		if count := c.PostForm("count"); count != "" {
+			parts = append(parts, "COUNT="+count)
+		}
+		if until := c.PostForm("until"); until != "" {
+			parts = append(parts, "UNTIL="+strings.ReplaceAll(until, "-", ""))
+		}
+		ruleText = strings.Join(parts, ";")
+	}
+
+	rule, err := rrule.Parse(ruleText)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid recurrence: %v", err)})
+		return
+	}
+
+	startsAt := time.Now().UTC().Truncate(time.Minute)
+	if startsAtStr := c.PostForm("starts_at"); startsAtStr != "" {
+		startsAt, err = time.Parse("2006-01-02T15:04", startsAtStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time"})
+			return
+		}
+	}
+
+	series, err := h.recurrences.Start(c.Request.Context(), task, rule, startsAt, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, recurrence.ErrAlreadyRecurring):
+			c.JSON(http.StatusConflict, gin.H{"error": "Task already repeats; stop the series first"})
+		case errors.Is(err, recurrence.ErrNoOccurrences):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The rule never repeats"})
+		default:
+			log.Printf("Failed to start recurrence: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set recurrence"})
+		}
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "task_update",
+		fmt.Sprintf("Made task recurring: %s (%s)", task.Title, rule.Describe()), map[string]interface{}{
+			"recurrence_id": series.ID.String(),
+			"rule":          series.Rule,
+		})
+	if err != nil {
+		log.Printf("Failed to log recurrence activity: %v", err)
+	}
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusCreated, series)
+}
+
+// SkipTaskRecurrence drops the next occurrence of the task's series
+func (h *TaskHandler) SkipTaskRecurrence(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+	if task.Recurrence == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task does not repeat"})
+		return
+	}
+
+	skipped := task.Recurrence.NextOccurrenceAt
+	series, err := h.recurrences.Skip(c.Request.Context(), task.Recurrence)
+	if err != nil {
+		if errors.Is(err, recurrence.ErrNotActive) {
+			c.JSON(http.StatusConflict, gin.H{"error": "The series has ended"})
+			return
+		}
+		log.Printf("Failed to skip occurrence: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to skip occurrence"})
+		return
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "task_update",
+		fmt.Sprintf("Skipped the next occurrence of: %s", task.Title), map[string]interface{}{
+			"recurrence_id": series.ID.String(),
+			"skipped_at":    skipped,
+		})
+	if err != nil {
+		log.Printf("Failed to log recurrence activity: %v", err)
+	}
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, series)
+}
+
+// StopTaskRecurrence ends the task's series; existing instances are kept
+func (h *TaskHandler) StopTaskRecurrence(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+	if task.Recurrence == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task does not repeat"})
+		return
+	}
+
+	if err := h.recurrences.Stop(c.Request.Context(), task.Recurrence); err != nil {
+		log.Printf("Failed to stop recurrence: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop recurrence"})
+		return
+	}
+
+	err := h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "task_update",
+		fmt.Sprintf("Stopped the recurrence of: %s", task.Title), map[string]interface{}{
+			"recurrence_id": task.Recurrence.ID.String(),
+		})
+	if err != nil {
+		log.Printf("Failed to log recurrence activity: %v", err)
+	}
+	h.broadcastTasks(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
-	"context"
+	"errors"
 	"fmt"
+	"log"
+	"mime"
 	"net/http"
+	"strings"
 
+	"sudo/internal/attachments"
 	"sudo/internal/database"
+	"sudo/internal/dataexport"
 	"sudo/internal/models"
 	"sudo/internal/realtime"
 	"sudo/templates/pages"
@@ -17,14 +22,18 @@ import (
 )
 
 type SettingsHandler struct {
-	db       *database.DB
-	realtime *realtime.RealtimeService
+	db          *database.DB
+	realtime    *realtime.RealtimeService
+	attachments *attachments.Service
+	exports     *dataexport.Service
 }
 
-func NewSettingsHandler(db *database.DB, rt *realtime.RealtimeService) *SettingsHandler {
+func NewSettingsHandler(db *database.DB, rt *realtime.RealtimeService, attachmentService *attachments.Service, exportService *dataexport.Service) *SettingsHandler {
 	return &SettingsHandler{
-		db:       db,
-		realtime: rt,
+		db:          db,
+		realtime:    rt,
+		attachments: attachmentService,
+		exports:     exportService,
 	}
 }
 
@@ -37,27 +46,32 @@ func (h *SettingsHandler) SettingsPage(c *gin.Context) {
 	}
 
 	// Get current user
-	user, err := h.db.GetUserByID(context.Background(), userID)
+	user, err := h.db.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get user: %v", err)
 		return
 	}
 
 	// Get user's boards for invite functionality
-	boards, err := h.db.GetUserBoards(context.Background(), userID)
+	boards, err := h.db.GetUserBoards(c.Request.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to get user boards: %v\n", err)
 		boards = []models.Board{} // Continue with empty list
 	}
 
 	// Get user contacts
-	contacts, err := h.db.GetUserContacts(context.Background(), userID)
+	contacts, err := h.db.GetUserContacts(c.Request.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to get contacts: %v\n", err)
 		contacts = []map[string]interface{}{} // Continue with empty list
 	}
 
-	component := pages.Settings(*user, boards, contacts)
+	latestExport, err := h.exports.Latest(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get latest data export: %v", err)
+	}
+
+	component := pages.Settings(*user, boards, contacts, latestExport)
 	handler := templ.Handler(component)
 	handler.ServeHTTP(c.Writer, c.Request)
 }
@@ -88,7 +102,7 @@ func (h *SettingsHandler) UpdateProfile(c *gin.Context) {
 		return
 	}
 
-	err = h.db.UpdateUserProfile(context.Background(), userID, updates)
+	err = h.db.UpdateUserProfile(c.Request.Context(), userID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to update profile: %v", err)
 		return
@@ -97,7 +111,7 @@ func (h *SettingsHandler) UpdateProfile(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-// UploadAvatar handles avatar file uploads (base64 images)
+// UploadAvatar stores an uploaded avatar (sent as a base64 data URL) in blob storage
 func (h *SettingsHandler) UploadAvatar(c *gin.Context) {
 	userID, err := getUserIDFromSession(c)
 	if err != nil {
@@ -116,47 +130,36 @@ func (h *SettingsHandler) UploadAvatar(c *gin.Context) {
 		return
 	}
 
-	// Validate we have image data
-	if requestData.ImageData == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No image data provided"})
-		return
-	}
-
-	// Validate base64 data starts with data:image
-	if len(requestData.ImageData) < 22 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image data too short"})
-		return
-	}
-
 	// Check if it starts with data:image/
-	if len(requestData.ImageData) >= 11 && requestData.ImageData[:11] != "data:image/" {
+	if !strings.HasPrefix(requestData.ImageData, "data:image/") {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image format - must be a data URL"})
 		return
 	}
 
-	fmt.Printf("Uploading avatar for user %s, data length: %d bytes\n", userID, len(requestData.ImageData))
-
-	// Check if the image is too large (database TEXT field limit)
-	// Most databases limit TEXT to ~65KB, so we'll limit to 500KB for base64
-	if len(requestData.ImageData) > 500000 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Image too large. Please use a smaller image or an image hosting service."})
+	data, err := attachments.DecodeDataURL(requestData.ImageData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image data"})
 		return
 	}
 
-	// Store the base64 data URL directly
-	updates := map[string]interface{}{
-		"avatar_url": requestData.ImageData,
-	}
+	fmt.Printf("Uploading avatar for user %s, data length: %d bytes\n", userID, len(data))
 
-	err = h.db.UpdateUserProfile(context.Background(), userID, updates)
-	if err != nil {
-		fmt.Printf("Failed to update profile: %v\n", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update profile: %v", err)})
+	avatarURL, err := h.attachments.SetAvatar(c.Request.Context(), userID, data)
+	switch {
+	case errors.Is(err, attachments.ErrTooLarge):
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Image too large. Maximum size is %d MB.", attachments.MaxAvatarSize>>20)})
+		return
+	case errors.Is(err, attachments.ErrNotImage), errors.Is(err, attachments.ErrEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		fmt.Printf("Failed to store avatar: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
 	fmt.Printf("Avatar uploaded successfully for user %s\n", userID)
-	c.JSON(http.StatusOK, gin.H{"success": true})
+	c.JSON(http.StatusOK, gin.H{"success": true, "avatar_url": avatarURL})
 }
 
 // GetContacts returns the list of contacts for the current user
@@ -167,7 +170,7 @@ func (h *SettingsHandler) GetContacts(c *gin.Context) {
 		return
 	}
 
-	contacts, err := h.db.GetUserContacts(context.Background(), userID)
+	contacts, err := h.db.GetUserContacts(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get contacts"})
 		return
@@ -191,7 +194,7 @@ func (h *SettingsHandler) GetContactBoards(c *gin.Context) {
 		return
 	}
 
-	boards, err := h.db.GetContactBoards(context.Background(), userID, contactID)
+	boards, err := h.db.GetContactBoards(c.Request.Context(), userID, contactID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get contact boards"})
 		return
@@ -229,7 +232,7 @@ func (h *SettingsHandler) RemoveContactFromBoard(c *gin.Context) {
 	}
 
 	// Verify user owns this board
-	isOwner, err := h.db.IsBoardOwner(context.Background(), userID, boardID)
+	isOwner, err := h.db.IsBoardOwner(c.Request.Context(), userID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board ownership: %v", err)
 		return
@@ -241,7 +244,7 @@ func (h *SettingsHandler) RemoveContactFromBoard(c *gin.Context) {
 	}
 
 	// Remove the contact from the board
-	err = h.db.RemoveBoardMember(context.Background(), boardID, contactID)
+	err = h.db.RemoveBoardMember(c.Request.Context(), boardID, contactID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to remove contact from board: %v", err)
 		return
@@ -278,10 +281,10 @@ func (h *SettingsHandler) RemoveContactCompletely(c *gin.Context) {
 	// Get all boards owned by the user to broadcast member removal
 	var ownedBoards []struct{ ID uuid.UUID }
 	if h.realtime != nil {
-		boards, boardsErr := h.db.GetUserBoards(context.Background(), userID)
+		boards, boardsErr := h.db.GetUserBoards(c.Request.Context(), userID)
 		if boardsErr == nil {
 			for _, board := range boards {
-				isOwner, _ := h.db.IsBoardOwner(context.Background(), userID, board.ID)
+				isOwner, _ := h.db.IsBoardOwner(c.Request.Context(), userID, board.ID)
 				if isOwner {
 					ownedBoards = append(ownedBoards, struct{ ID uuid.UUID }{board.ID})
 				}
@@ -290,7 +293,7 @@ func (h *SettingsHandler) RemoveContactCompletely(c *gin.Context) {
 	}
 
 	// Remove contact from all boards
-	err = h.db.RemoveContactFromAllBoards(context.Background(), userID, contactID)
+	err = h.db.RemoveContactFromAllBoards(c.Request.Context(), userID, contactID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to remove contact: %v", err)
 		return
@@ -321,7 +324,7 @@ func (h *SettingsHandler) CompleteOnboarding(c *gin.Context) {
 		"onboarding_completed": true,
 	}
 
-	err = h.db.UpdateUserProfile(context.Background(), userID, updates)
+	err = h.db.UpdateUserProfile(c.Request.Context(), userID, updates)
 	if err != nil {
 		fmt.Printf("Failed to complete onboarding: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to complete onboarding"})
@@ -367,13 +370,34 @@ func (h *SettingsHandler) DeleteAccount(c *gin.Context) {
 
 	fmt.Printf("User %s requested account deletion\n", userID.String())
 
+	// Remember the stored files of the user's boards, avatar and data exports; the rows are deleted below
+	var ownedAttachments []models.Task
+	avatarURL := ""
+	if user, err := h.db.GetUserByID(c.Request.Context(), userID); err == nil {
+		avatarURL = user.AvatarURL
+	}
+	if boards, err := h.db.GetUserBoards(c.Request.Context(), userID); err == nil {
+		for _, board := range boards {
+			if board.OwnerID == userID {
+				ownedAttachments = append(ownedAttachments, h.attachments.BoardAttachments(c.Request.Context(), board.ID)...)
+			}
+		}
+	}
+	exports, err := h.db.ListDataExports(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to list data exports: %v", err)
+	}
+
 	// Delete the account and all associated data
-	err = h.db.DeleteUserAccount(context.Background(), userID)
+	err = h.db.DeleteUserAccount(c.Request.Context(), userID)
 	if err != nil {
 		fmt.Printf("Failed to delete account: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account. Please try again."})
 		return
 	}
+	h.attachments.DeleteBlobs(c.Request.Context(), ownedAttachments...)
+	h.attachments.DeleteAvatar(c.Request.Context(), avatarURL)
+	h.exports.DeleteArchives(c.Request.Context(), exports...)
 
 	// Clear the session
 	session := sessions.Default(c)
@@ -387,6 +411,64 @@ func (h *SettingsHandler) DeleteAccount(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"success": true, "message": "Account deleted successfully"})
 }
 
+// RequestDataExport queues a copy of the user's personal data; the user is emailed when it is ready
+func (h *SettingsHandler) RequestDataExport(c *gin.Context) {
+	userID, err := getUserIDFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	export, err := h.exports.Request(c.Request.Context(), userID, getBaseURL(c))
+	switch {
+	case errors.Is(err, dataexport.ErrInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": "Your data export is already being prepared. We'll email you when it's ready."})
+		return
+	case err != nil:
+		log.Printf("Failed to request data export: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request data export. Please try again."})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true, "export": export})
+}
+
+// DownloadDataExport streams a finished data export archive to its owner
+func (h *SettingsHandler) DownloadDataExport(c *gin.Context) {
+	userID, err := getUserIDFromSession(c)
+	if err != nil {
+		c.Redirect(http.StatusSeeOther, "/")
+		return
+	}
+
+	exportID, err := uuid.Parse(c.Param("exportId"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "Invalid export ID")
+		return
+	}
+
+	reader, size, export, err := h.exports.Open(c.Request.Context(), userID, exportID)
+	switch {
+	case errors.Is(err, dataexport.ErrNotFound):
+		c.String(http.StatusNotFound, "Data export not found")
+		return
+	case errors.Is(err, dataexport.ErrNotReady):
+		c.String(http.StatusGone, "This data export is not available anymore. You can request a new one in your settings.")
+		return
+	case err != nil:
+		log.Printf("Failed to open data export: %v", err)
+		c.String(http.StatusInternalServerError, "Failed to download data export")
+		return
+	}
+	defer reader.Close()
+
+	filename := fmt.Sprintf("sudo-data-export-%s.zip", export.CreatedAt.Format("2006-01-02"))
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", "private, no-store")
+	c.DataFromReader(http.StatusOK, size, "application/zip", reader, nil)
+}
+
 // Helper function to get user ID from session
 func getUserIDFromSession(c *gin.Context) (uuid.UUID, error) {
 	session := sessions.Default(c)
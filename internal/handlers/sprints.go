@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"sudo/internal/analytics"
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/realtime"
+	"sudo/internal/sprints"
+	"sudo/templates/pages"
+
+	"github.com/a-h/templ"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxSprintName = 100
+	maxSprintGoal = 1000
+)
+
+type SprintHandler struct {
+	db       *database.DB
+	realtime *realtime.RealtimeService
+}
+
+func NewSprintHandler(db *database.DB, rt *realtime.RealtimeService) *SprintHandler {
+	return &SprintHandler{
+		db:       db,
+		realtime: rt,
+	}
+}
+
+// ListSprints returns the board's sprints in order of their planned start
+func (h *SprintHandler) ListSprints(c *gin.Context) {
+	_, boardID, ok := h.boardForMember(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.db.GetBoardSprints(c.Request.Context(), boardID)
+	if err != nil {
+		log.Printf("Failed to get sprints: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sprints"})
+		return
+	}
+	if list == nil {
+		list = []models.Sprint{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sprints": list})
+}
+
+// CreateSprint plans a sprint from name, goal, starts_on and ends_on (YYYY-MM-DD, inclusive)
+func (h *SprintHandler) CreateSprint(c *gin.Context) {
+	userID, boardID, ok := h.boardForMember(c)
+	if !ok {
+		return
+	}
+	if isAdmin, err := h.db.IsBoardAdmin(c.Request.Context(), userID, boardID); err != nil || !isAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only board admins can plan sprints"})
+		return
+	}
+
+	sprint := &models.Sprint{BoardID: boardID, CreatedBy: &userID}
+	if !sprintFromForm(c, sprint) {
+		return
+	}
+
+	created, err := h.db.CreateSprint(c.Request.Context(), sprint)
+	if err != nil {
+		log.Printf("Failed to create sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create sprint"})
+		return
+	}
+
+	h.logSprintActivity(c.Request.Context(), userID, created, fmt.Sprintf("Planned sprint: %s", created.Name))
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// UpdateSprint changes the name, goal or dates of a sprint that has not closed
+func (h *SprintHandler) UpdateSprint(c *gin.Context) {
+	userID, sprint, ok := h.sprintForMember(c, true)
+	if !ok {
+		return
+	}
+	if !sprint.IsOpen() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Closed sprints cannot be changed"})
+		return
+	}
+
+	if !sprintFromForm(c, sprint) {
+		return
+	}
+
+	updated, err := h.db.UpdateSprint(c.Request.Context(), sprint.ID, sprint.Status, map[string]interface{}{
+		"name":      sprint.Name,
+		"goal":      sprint.Goal,
+		"starts_at": sprint.StartsAt.UTC(),
+		"ends_at":   sprint.EndsAt.UTC(),
+	})
+	if err != nil {
+		log.Printf("Failed to update sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update sprint"})
+		return
+	}
+	if updated == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sprint changed in the meantime, please reload"})
+		return
+	}
+
+	h.logSprintActivity(c.Request.Context(), userID, updated, fmt.Sprintf("Updated sprint: %s", updated.Name))
+
+	c.JSON(http.StatusOK, updated)
+}
+
+// DeleteSprint removes a planned sprint; its tasks go back to the backlog
+func (h *SprintHandler) DeleteSprint(c *gin.Context) {
+	userID, sprint, ok := h.sprintForMember(c, true)
+	if !ok {
+		return
+	}
+	if sprint.Status != models.SprintPlanned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only planned sprints can be deleted"})
+		return
+	}
+
+	if err := h.db.DeleteSprint(c.Request.Context(), sprint.ID); err != nil {
+		log.Printf("Failed to delete sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete sprint"})
+		return
+	}
+
+	h.logSprintActivity(c.Request.Context(), userID, sprint, fmt.Sprintf("Deleted sprint: %s", sprint.Name))
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// StartSprint makes a planned sprint the board's active one
+func (h *SprintHandler) StartSprint(c *gin.Context) {
+	userID, sprint, ok := h.sprintForMember(c, true)
+	if !ok {
+		return
+	}
+	if sprint.Status != models.SprintPlanned {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only planned sprints can be started"})
+		return
+	}
+	if active, err := h.activeSprint(c.Request.Context(), sprint.BoardID); err != nil || active != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Close the active sprint first"})
+		return
+	}
+
+	started, err := h.db.UpdateSprint(c.Request.Context(), sprint.ID, models.SprintPlanned, map[string]interface{}{
+		"status":     models.SprintActive,
+		"started_at": time.Now(),
+	})
+	if err != nil || started == nil {
+		// Most likely another sprint was started in the meantime
+		log.Printf("Failed to start sprint %s: %v", sprint.ID.String(), err)
+		c.JSON(http.StatusConflict, gin.H{"error": "Sprint could not be started, please reload"})
+		return
+	}
+
+	h.logSprintActivity(c.Request.Context(), userID, started, fmt.Sprintf("Started sprint: %s", started.Name))
+
+	c.JSON(http.StatusOK, started)
+}
+
+// CloseSprint closes the active sprint and stores its report. Incomplete tasks either
+// return to the backlog (incomplete=backlog, the default) or roll over (incomplete=rollover)
+// into next_sprint_id, by default the next planned sprint.
+func (h *SprintHandler) CloseSprint(c *gin.Context) {
+	userID, sprint, ok := h.sprintForMember(c, true)
+	if !ok {
+		return
+	}
+	if sprint.Status != models.SprintActive || sprint.StartedAt == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Only the active sprint can be closed"})
+		return
+	}
+
+	disposition := c.DefaultPostForm("incomplete", "backlog")
+	var next *models.Sprint
+	switch disposition {
+	case "backlog":
+	case "rollover":
+		var ok bool
+		if next, ok = h.rolloverTarget(c, sprint); !ok {
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "incomplete must be backlog or rollover"})
+		return
+	}
+
+	items, err := h.sprintItems(c.Request.Context(), sprint)
+	if err != nil {
+		log.Printf("Failed to load sprint history: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close sprint"})
+		return
+	}
+
+	now := time.Now()
+	report := sprints.Summarize(*sprint.StartedAt, now, items)
+	report.Disposition = disposition
+	if next != nil {
+		report.RolledOverTo = next.ID.String()
+	}
+
+	closed, err := h.db.UpdateSprint(c.Request.Context(), sprint.ID, models.SprintActive, map[string]interface{}{
+		"status":    models.SprintClosed,
+		"closed_at": now,
+		"report":    report,
+	})
+	if err != nil {
+		log.Printf("Failed to close sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close sprint"})
+		return
+	}
+	if closed == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Sprint was closed in the meantime"})
+		return
+	}
+
+	// The closed sprint's history ends here, so leaving it is not recorded
+	for _, ref := range report.IncompleteTasks {
+		taskID, err := uuid.Parse(ref.ID)
+		if err != nil {
+			continue
+		}
+		var target *uuid.UUID
+		if next != nil {
+			target = &next.ID
+		}
+		if err := h.db.SetTaskSprint(c.Request.Context(), taskID, target); err != nil {
+			log.Printf("Failed to move task %s out of closed sprint: %v", ref.ID, err)
+			continue
+		}
+		if next != nil {
+			if err := h.db.RecordSprintChange(c.Request.Context(), next.ID, taskID, true, &userID); err != nil {
+				log.Printf("Failed to record sprint change: %v", err)
+			}
+		}
+	}
+
+	description := fmt.Sprintf("Closed sprint %s: %d of %d task(s) done", closed.Name, report.Completed.Tasks, report.Completed.Tasks+report.Incomplete.Tasks)
+	if next != nil {
+		description += fmt.Sprintf(", the rest rolled over to %s", next.Name)
+	}
+	h.logSprintActivity(c.Request.Context(), userID, closed, description)
+
+	c.JSON(http.StatusOK, closed)
+}
+
+// rolloverTarget picks the planned sprint that incomplete tasks roll over into
+func (h *SprintHandler) rolloverTarget(c *gin.Context, sprint *models.Sprint) (*models.Sprint, bool) {
+	if nextIDStr := c.PostForm("next_sprint_id"); nextIDStr != "" {
+		nextID, err := uuid.Parse(nextIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid next sprint ID"})
+			return nil, false
+		}
+		next, err := h.db.GetSprint(c.Request.Context(), nextID)
+		if err != nil || next.BoardID != sprint.BoardID || next.Status != models.SprintPlanned {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tasks can only roll over into a planned sprint of this board"})
+			return nil, false
+		}
+		return next, true
+	}
+
+	list, err := h.db.GetBoardSprints(c.Request.Context(), sprint.BoardID)
+	if err != nil {
+		log.Printf("Failed to get sprints: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to close sprint"})
+		return nil, false
+	}
+	for i := range list {
+		if list[i].Status == models.SprintPlanned {
+			return &list[i], true
+		}
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Plan the next sprint to roll tasks over into"})
+	return nil, false
+}
+
+// GetBurndown returns the sprint's burndown and burnup data; unit is count (default) or hours
+func (h *SprintHandler) GetBurndown(c *gin.Context) {
+	_, sprint, ok := h.sprintForMember(c, false)
+	if !ok {
+		return
+	}
+
+	unit, err := sprints.ParseUnit(c.Query("unit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unit must be count or hours"})
+		return
+	}
+
+	chart, err := h.burndown(c.Request.Context(), sprint, unit)
+	if err != nil {
+		log.Printf("Failed to build burndown: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build burndown"})
+		return
+	}
+
+	c.JSON(http.StatusOK, chart)
+}
+
+// SetTaskSprint moves the task in :id into sprint_id, or back to the backlog if it is empty
+func (h *SprintHandler) SetTaskSprint(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+	taskID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return
+	}
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return
+	}
+	if hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID); err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	var target *models.Sprint
+	if sprintIDStr := c.PostForm("sprint_id"); sprintIDStr != "" {
+		sprintID, err := uuid.Parse(sprintIDStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sprint ID"})
+			return
+		}
+		target, err = h.db.GetSprint(c.Request.Context(), sprintID)
+		if err != nil || target.BoardID != task.BoardID || !target.IsOpen() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Tasks can only join a planned or active sprint of their board"})
+			return
+		}
+	}
+
+	if (target == nil && task.SprintID == nil) || (target != nil && task.SprintID != nil && *task.SprintID == target.ID) {
+		c.JSON(http.StatusOK, gin.H{"success": true})
+		return
+	}
+
+	var targetID *uuid.UUID
+	if target != nil {
+		targetID = &target.ID
+	}
+	if err := h.db.SetTaskSprint(c.Request.Context(), task.ID, targetID); err != nil {
+		log.Printf("Failed to set task sprint: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move task"})
+		return
+	}
+
+	// Closed sprints keep the scope they closed with
+	if task.SprintID != nil {
+		if previous, err := h.db.GetSprint(c.Request.Context(), *task.SprintID); err == nil && previous.IsOpen() {
+			if err := h.db.RecordSprintChange(c.Request.Context(), previous.ID, task.ID, false, &userID); err != nil {
+				log.Printf("Failed to record sprint change: %v", err)
+			}
+		}
+	}
+	description := fmt.Sprintf("Moved %s to the backlog", task.Title)
+	if target != nil {
+		if err := h.db.RecordSprintChange(c.Request.Context(), target.ID, task.ID, true, &userID); err != nil {
+			log.Printf("Failed to record sprint change: %v", err)
+		}
+		description = fmt.Sprintf("Added %s to sprint %s", task.Title, target.Name)
+	}
+
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &task.ID, "task_update", description, nil)
+	if err != nil {
+		log.Printf("Failed to log sprint activity: %v", err)
+	}
+	if h.realtime != nil {
+		if updated, err := h.db.GetTask(c.Request.Context(), task.ID); err == nil {
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updated, "updated")
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// SprintsPage renders the board's sprints with the burndown of the selected one (sprint,
+// by default the active or latest sprint) and its report once closed
+func (h *SprintHandler) SprintsPage(c *gin.Context) {
+	userID, boardID, ok := h.boardForMember(c)
+	if !ok {
+		return
+	}
+
+	unit, err := sprints.ParseUnit(c.Query("unit"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unit must be count or hours"})
+		return
+	}
+
+	board, err := h.db.GetBoard(c.Request.Context(), boardID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Board not found"})
+		return
+	}
+	list, err := h.db.GetBoardSprints(c.Request.Context(), boardID)
+	if err != nil {
+		log.Printf("Failed to get sprints: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get sprints"})
+		return
+	}
+	isAdmin, _ := h.db.IsBoardAdmin(c.Request.Context(), userID, boardID)
+
+	var selected *models.Sprint
+	for i := range list {
+		if list[i].ID.String() == c.Query("sprint") || (c.Query("sprint") == "" && list[i].Status == models.SprintActive) {
+			selected = &list[i]
+		}
+	}
+	if selected == nil && c.Query("sprint") == "" && len(list) > 0 {
+		selected = &list[len(list)-1]
+	}
+
+	var chart *sprints.Chart
+	var tasks []models.Task
+	if selected != nil {
+		if chart, err = h.burndown(c.Request.Context(), selected, unit); err != nil {
+			log.Printf("Failed to build burndown: %v", err)
+		}
+		if tasks, err = h.db.GetSprintTasks(c.Request.Context(), selected.ID); err != nil {
+			log.Printf("Failed to get sprint tasks: %v", err)
+		}
+	}
+
+	component := pages.BoardSprints(*board, list, selected, tasks, chart, isAdmin)
+	handler := templ.Handler(component)
+	handler.ServeHTTP(c.Writer, c.Request)
+}
+
+func (h *SprintHandler) burndown(ctx context.Context, sprint *models.Sprint, unit sprints.Unit) (*sprints.Chart, error) {
+	items, err := h.sprintItems(ctx, sprint)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if sprint.ClosedAt != nil {
+		now = *sprint.ClosedAt
+	}
+	return sprints.Burndown(unit, sprint.StartsAt, sprint.EndsAt, now, items)
+}
+
+// sprintItems loads every task that was ever in the sprint with its scope changes and when
+// it was finished: completed, or moved into a done column, whichever came first
+func (h *SprintHandler) sprintItems(ctx context.Context, sprint *models.Sprint) ([]sprints.Item, error) {
+	changes, err := h.db.GetSprintChanges(ctx, sprint.ID)
+	if err != nil {
+		return nil, err
+	}
+	byTask := make(map[uuid.UUID][]sprints.Change)
+	var taskIDs []uuid.UUID
+	for _, change := range changes {
+		if _, seen := byTask[change.TaskID]; !seen {
+			taskIDs = append(taskIDs, change.TaskID)
+		}
+		byTask[change.TaskID] = append(byTask[change.TaskID], sprints.Change{At: change.OccurredAt, In: change.Added})
+	}
+
+	tasks, err := h.db.GetTasksByIDs(ctx, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+	columns, err := h.db.GetBoardColumns(ctx, sprint.BoardID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := h.db.GetTaskColumnEvents(ctx, taskIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool, len(columns))
+	for i := range columns {
+		done[columns[i].ID.String()] = columns[i].IsDone()
+	}
+	transitions := make(map[uuid.UUID][]analytics.Transition)
+	for _, event := range events {
+		transitions[event.TaskID] = append(transitions[event.TaskID], analytics.Transition{At: event.OccurredAt, Column: event.ToColumnID.String()})
+	}
+
+	items := make([]sprints.Item, 0, len(tasks))
+	for _, task := range tasks {
+		item := sprints.Item{
+			ID:       task.ID.String(),
+			Title:    task.Title,
+			Estimate: task.EstimatedHours,
+			Changes:  byTask[task.ID],
+		}
+		if task.Completed && task.CompletedAt != nil {
+			completedAt := *task.CompletedAt
+			item.DoneAt = &completedAt
+		}
+		history := analytics.Task{Transitions: transitions[task.ID]}
+		if movedAt, ok := analytics.Completion(history, func(columnID string) bool { return done[columnID] }); ok {
+			if item.DoneAt == nil || movedAt.Before(*item.DoneAt) {
+				item.DoneAt = &movedAt
+			}
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func (h *SprintHandler) activeSprint(ctx context.Context, boardID uuid.UUID) (*models.Sprint, error) {
+	list, err := h.db.GetBoardSprints(ctx, boardID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		if list[i].Status == models.SprintActive {
+			return &list[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// boardForMember reads the board in :id if the current user is a member of it
+func (h *SprintHandler) boardForMember(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, boardID, true
+}
+
+// sprintForMember loads the sprint in :id if the current user is a member, or with
+// adminOnly an admin, of its board
+func (h *SprintHandler) sprintForMember(c *gin.Context, adminOnly bool) (uuid.UUID, *models.Sprint, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, nil, false
+	}
+
+	sprintID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sprint ID"})
+		return uuid.Nil, nil, false
+	}
+	sprint, err := h.db.GetSprint(c.Request.Context(), sprintID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Sprint not found"})
+		return uuid.Nil, nil, false
+	}
+
+	if adminOnly {
+		isAdmin, err := h.db.IsBoardAdmin(c.Request.Context(), userID, sprint.BoardID)
+		if err != nil || !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only board admins can manage sprints"})
+			return uuid.Nil, nil, false
+		}
+	} else if hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, sprint.BoardID); err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return uuid.Nil, nil, false
+	}
+
+	return userID, sprint, true
+}
+
+// sprintFromForm reads name, goal, starts_on and ends_on into sprint, keeping the
+// current values of fields that are not posted
+func sprintFromForm(c *gin.Context, sprint *models.Sprint) bool {
+	if name, set := c.GetPostForm("name"); set || sprint.Name == "" {
+		name = strings.TrimSpace(name)
+		if name == "" || len(name) > maxSprintName {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Name must be 1-%d characters", maxSprintName)})
+			return false
+		}
+		sprint.Name = name
+	}
+	if goal, set := c.GetPostForm("goal"); set {
+		goal = strings.TrimSpace(goal)
+		if len(goal) > maxSprintGoal {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Goals are limited to %d characters", maxSprintGoal)})
+			return false
+		}
+		sprint.Goal = goal
+	}
+
+	for _, field := range []struct {
+		name  string
+		value *time.Time
+	}{{"starts_on", &sprint.StartsAt}, {"ends_on", &sprint.EndsAt}} {
+		dateStr, set := c.GetPostForm(field.name)
+		if !set && !field.value.IsZero() {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", dateStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid %s date", field.name)})
+			return false
+		}
+		*field.value = date
+	}
+
+	days := int(sprint.EndsAt.Sub(sprint.StartsAt).Hours()/24) + 1
+	if days < 1 || days > sprints.MaxDays {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Sprints must last 1 to %d days", sprints.MaxDays)})
+		return false
+	}
+
+	return true
+}
+
+func (h *SprintHandler) logSprintActivity(ctx context.Context, userID uuid.UUID, sprint *models.Sprint, description string) {
+	err := h.db.LogActivity(ctx, userID, sprint.BoardID, nil, "board_update",
+		description, map[string]interface{}{
+			"sprint_id": sprint.ID.String(),
+		})
+	if err != nil {
+		log.Printf("Failed to log sprint activity: %v", err)
+	}
+}
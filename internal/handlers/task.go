@@ -1,16 +1,18 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
+	"sudo/internal/attachments"
 	"sudo/internal/database"
 	"sudo/internal/models"
 	"sudo/internal/realtime"
+	"sudo/internal/recurrence"
 	"sudo/templates/components"
 
 	"github.com/a-h/templ"
@@ -20,14 +22,18 @@ import (
 )
 
 type TaskHandler struct {
-	db       *database.DB
-	realtime *realtime.RealtimeService
+	db          *database.DB
+	realtime    *realtime.RealtimeService
+	attachments *attachments.Service
+	recurrences *recurrence.Service
 }
 
-func NewTaskHandler(db *database.DB, rt *realtime.RealtimeService) *TaskHandler {
+func NewTaskHandler(db *database.DB, rt *realtime.RealtimeService, attachmentService *attachments.Service, recurrenceService *recurrence.Service) *TaskHandler {
 	return &TaskHandler{
-		db:       db,
-		realtime: rt,
+		db:          db,
+		realtime:    rt,
+		attachments: attachmentService,
+		recurrences: recurrenceService,
 	}
 }
 
@@ -38,7 +44,7 @@ func (h *TaskHandler) validateUserSession(c *gin.Context) (*models.User, error)
 	}
 
 	// Verify user exists in database
-	user, err := h.db.GetUserByID(context.Background(), userID)
+	user, err := h.db.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		// User doesn't exist - clear the invalid session
 		session := sessions.Default(c)
@@ -99,7 +105,7 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, boardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, boardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -124,7 +130,16 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
-	task, err := h.db.CreateTask(context.Background(), title, description, columnID, boardID, priority)
+	customFieldValues, err := customFieldsFromForm(c)
+	if err == nil && customFieldValues != nil {
+		customFieldValues, err = h.db.ApplyCustomFieldValues(c.Request.Context(), boardID, nil, customFieldValues)
+	}
+	if err != nil {
+		c.String(customFieldStatus(err), "%v", err)
+		return
+	}
+
+	task, err := h.db.CreateTask(c.Request.Context(), title, description, columnID, boardID, priority)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to create task: %v", err)
 		return
@@ -137,24 +152,24 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		}
 
 		// Check if assignee has access to the board
-		hasAccess, accessErr := h.db.HasBoardAccess(context.Background(), assigneeID, boardID)
+		hasAccess, accessErr := h.db.HasBoardAccess(c.Request.Context(), assigneeID, boardID)
 		if accessErr != nil || !hasAccess {
 			fmt.Printf("Warning: Assignee %s doesn't have board access\n", assigneeIDStr)
 			continue
 		}
 
 		// Add assignee
-		err = h.db.AddTaskAssignee(context.Background(), task.ID, assigneeID, user.ID)
+		err = h.db.AddTaskAssignee(c.Request.Context(), task.ID, assigneeID, user.ID)
 		if err != nil {
 			fmt.Printf("Warning: Failed to add assignee %s: %v\n", assigneeIDStr, err)
 		}
 	}
 
 	// Reload task to get assignees
-	task, _ = h.db.GetTask(context.Background(), task.ID)
+	task, _ = h.db.GetTask(c.Request.Context(), task.ID)
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), user.ID, boardID, &task.ID, "task_create",
+	err = h.db.LogActivity(c.Request.Context(), user.ID, boardID, &task.ID, "task_create",
 		fmt.Sprintf("Created task: %s", task.Title), map[string]interface{}{
 			"task_title":      task.Title,
 			"column_id":       columnID.String(),
@@ -184,17 +199,21 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		}
 	}
 
-	err = h.db.UpdateTask(context.Background(), task.ID, updates)
+	if len(customFieldValues) > 0 {
+		updates["custom_fields"] = customFieldValues
+	}
+
+	err = h.db.UpdateTask(c.Request.Context(), task.ID, updates)
 	if err != nil {
 		fmt.Printf("Warning: Failed to update task with deadline and tags: %v\n", err)
 	}
 
 	// Reload task to get updated fields
-	task, _ = h.db.GetTask(context.Background(), task.ID)
+	task, _ = h.db.GetTask(c.Request.Context(), task.ID)
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		h.realtime.BroadcastTaskUpdate(boardID.String(), task, "created")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), boardID.String(), task, "created")
 	}
 
 	component := components.TaskCard(*task)
@@ -237,14 +256,14 @@ func (h *TaskHandler) MoveTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check board access"})
 		return
@@ -255,14 +274,41 @@ func (h *TaskHandler) MoveTask(c *gin.Context) {
 		return
 	}
 
-	err = h.db.MoveTask(context.Background(), taskID, columnID, position)
+	column, err := h.db.GetColumn(c.Request.Context(), columnID)
+	if err != nil || column.BoardID != task.BoardID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid column ID"})
+		return
+	}
+
+	// A blocked task only moves into a done column when the user confirms it
+	if column.IsDone() && task.ColumnID != columnID && c.PostForm("force") != "true" {
+		if blockers := task.OpenBlockers(); len(blockers) > 0 {
+			blockedBy := make([]gin.H, 0, len(blockers))
+			for _, blocker := range blockers {
+				blockedBy = append(blockedBy, gin.H{"id": blocker.ID, "title": blocker.Title})
+			}
+			c.JSON(http.StatusConflict, gin.H{
+				"error":      fmt.Sprintf("Task is blocked by %d unfinished task(s)", len(blockers)),
+				"blocked_by": blockedBy,
+			})
+			return
+		}
+	}
+
+	err = h.db.MoveTask(c.Request.Context(), taskID, columnID, position)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to move task"})
 		return
 	}
 
+	if task.ColumnID != columnID {
+		if err := h.db.RecordColumnEvent(c.Request.Context(), taskID, task.BoardID, &task.ColumnID, columnID, &userID); err != nil {
+			fmt.Printf("Failed to record task move: %v\n", err)
+		}
+	}
+
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_move",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_move",
 		fmt.Sprintf("Moved task: %s to position %d", task.Title, position), map[string]interface{}{
 			"from_column_id": task.ColumnID.String(),
 			"to_column_id":   columnID.String(),
@@ -274,10 +320,11 @@ func (h *TaskHandler) MoveTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "moved")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "moved")
 		}
+		h.broadcastBlockedTasks(c.Request.Context(), task)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -307,7 +354,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		fmt.Printf("UpdateTask: Failed to get task: %v\n", err)
 		c.String(http.StatusNotFound, "Task not found")
@@ -315,7 +362,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		fmt.Printf("UpdateTask: Failed to check board access: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
@@ -348,9 +395,27 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		}
 	}
 
+	// An empty estimate clears it
+	if estimate, set := c.GetPostForm("estimated_hours"); set {
+		if estimate = strings.TrimSpace(estimate); estimate == "" {
+			updates["estimated_hours"] = nil
+		} else if hours, parseErr := strconv.ParseFloat(estimate, 64); parseErr == nil && hours > 0 && hours < 1000 {
+			updates["estimated_hours"] = math.Round(hours*100) / 100
+		} else {
+			c.String(http.StatusBadRequest, "Estimated hours must be a number between 0 and 1000")
+			return
+		}
+	}
+
 	// Handle completion status
 	if completed := c.PostForm("completed"); completed != "" {
 		isCompleted := completed == "true"
+		if isCompleted && !task.Completed {
+			if unchecked := h.uncheckedItems(c.Request.Context(), task); unchecked > 0 {
+				c.String(http.StatusConflict, "Check off the remaining %d checklist item(s) before completing this task", unchecked)
+				return
+			}
+		}
 		updates["completed"] = isCompleted
 		// Ensure completed_at is properly set/cleared to maintain DB constraint
 		if isCompleted {
@@ -371,10 +436,20 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 		}
 	}
 
+	customFieldValues, err := customFieldsFromForm(c)
+	if err == nil && customFieldValues != nil {
+		updates["custom_fields"], err = h.db.ApplyCustomFieldValues(c.Request.Context(), task.BoardID, task.CustomFields, customFieldValues)
+	}
+	if err != nil {
+		fmt.Printf("UpdateTask: Invalid custom fields: %v\n", err)
+		c.String(customFieldStatus(err), "%v", err)
+		return
+	}
+
 	fmt.Printf("UpdateTask: Updates to apply: %+v\n", updates)
 
 	// Update task in database
-	err = h.db.UpdateTask(context.Background(), taskID, updates)
+	err = h.db.UpdateTask(c.Request.Context(), taskID, updates)
 	if err != nil {
 		fmt.Printf("UpdateTask: Database update error: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to update task: %v", err)
@@ -382,7 +457,7 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_update",
 		fmt.Sprintf("Updated task: %s", task.Title), updates)
 	if err != nil {
 		fmt.Printf("Failed to log task update activity: %v\n", err)
@@ -390,12 +465,17 @@ func (h *TaskHandler) UpdateTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "updated")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "updated")
 		}
 	}
 
+	// Completing the latest instance of a recurring task creates the next one
+	if c.PostForm("completed") == "true" && !task.Completed {
+		h.recurrences.TaskCompleted(c.Request.Context(), task, userID)
+	}
+
 	fmt.Printf("UpdateTask: Successfully updated task %s\n", taskID.String())
 	c.Status(http.StatusOK)
 }
@@ -416,14 +496,14 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -437,39 +517,27 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 	fmt.Printf("Deleting task: %s by user %s\n", taskID.String(), user.Email)
 
 	var deletedNestedBoardID *uuid.UUID
+	var nestedAttachments []models.Task
 
-	// IMPORTANT: Store nested board ID BEFORE deleting the task
-	// We must delete the TASK first, then the nested board
-	// If we delete the board first, PostgreSQL CASCADE will delete columns and tasks in that board
 	if task.HasNestedBoard() {
 		deletedNestedBoardID = task.NestedBoardID
-		fmt.Printf("Task %s has nested board %s, will delete board after task\n", taskID.String(), task.NestedBoardID.String())
+		nestedAttachments = h.attachments.BoardAttachments(c.Request.Context(), *task.NestedBoardID)
+		fmt.Printf("Task %s has nested board %s, deleting both\n", taskID.String(), task.NestedBoardID.String())
 	}
 
-	// Delete the task FIRST
-	err = h.db.DeleteTask(context.Background(), taskID)
+	// Deletes the nested board in the same transaction
+	err = h.db.DeleteTask(c.Request.Context(), taskID)
 	if err != nil {
 		fmt.Printf("Failed to delete task: %v\n", err)
 		c.String(http.StatusInternalServerError, "Failed to delete task: %v", err)
 		return
 	}
 	fmt.Printf("Successfully deleted task %s\n", taskID.String())
-
-	// Now delete the nested board (if it exists)
-	// This prevents CASCADE deletion conflicts
-	if deletedNestedBoardID != nil {
-		err = h.db.DeleteBoard(context.Background(), *deletedNestedBoardID)
-		if err != nil {
-			fmt.Printf("Failed to delete nested board %s: %v\n", deletedNestedBoardID.String(), err)
-			// Don't fail the whole operation since the task is already deleted
-			// Just log the error
-		} else {
-			fmt.Printf("Successfully deleted nested board %s\n", deletedNestedBoardID.String())
-		}
-	}
+	h.attachments.DeleteBlobs(c.Request.Context(), *task)
+	h.attachments.DeleteBlobs(c.Request.Context(), nestedAttachments...)
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), user.ID, task.BoardID, &taskID, "task_delete",
+	err = h.db.LogActivity(c.Request.Context(), user.ID, task.BoardID, &taskID, "task_delete",
 		fmt.Sprintf("Deleted task: %s", task.Title), map[string]interface{}{
 			"task_title":       task.Title,
 			"had_nested_board": deletedNestedBoardID != nil,
@@ -480,7 +548,8 @@ func (h *TaskHandler) DeleteTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		h.realtime.BroadcastTaskUpdate(task.BoardID.String(), task, "deleted")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), task, "deleted")
+		h.broadcastBlockedTasks(c.Request.Context(), task)
 	}
 
 	fmt.Printf("Successfully deleted task %s\n", taskID.String())
@@ -512,7 +581,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		return
 	}
 
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
@@ -529,7 +598,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -541,7 +610,7 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 	}
 
 	// Get board members for assignment options
-	members, err := h.db.GetBoardMembers(context.Background(), task.BoardID)
+	members, err := h.db.GetBoardMembers(c.Request.Context(), task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get board members: %v", err)
 		return
@@ -557,7 +626,29 @@ func (h *TaskHandler) GetTask(c *gin.Context) {
 		fmt.Printf("  [%d] UserID: %s, User: %s, Role: %s\n", i, member.UserID.String(), userName, member.Role)
 	}
 
-	component := components.TaskDetailsModal(*task, members)
+	var fields []models.CustomField
+	if board, err := h.db.GetBoard(c.Request.Context(), task.BoardID); err == nil {
+		fields = board.CustomFields()
+	} else {
+		fmt.Printf("Warning: Failed to get custom fields for board %s: %v\n", task.BoardID.String(), err)
+	}
+
+	if task.TimeEntries, err = h.db.GetTaskTimeEntries(c.Request.Context(), task.ID); err != nil {
+		fmt.Printf("Warning: Failed to get time entries for task %s: %v\n", task.ID.String(), err)
+	}
+
+	var openSprints []models.Sprint
+	if boardSprints, err := h.db.GetBoardSprints(c.Request.Context(), task.BoardID); err == nil {
+		for _, sprint := range boardSprints {
+			if sprint.IsOpen() {
+				openSprints = append(openSprints, sprint)
+			}
+		}
+	} else {
+		fmt.Printf("Warning: Failed to get sprints for board %s: %v\n", task.BoardID.String(), err)
+	}
+
+	component := components.TaskDetailsModal(*task, members, fields, userID, openSprints)
 	handler := templ.Handler(component)
 	handler.ServeHTTP(c.Writer, c.Request)
 }
@@ -590,14 +681,14 @@ func (h *TaskHandler) AssignTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -609,7 +700,7 @@ func (h *TaskHandler) AssignTask(c *gin.Context) {
 	}
 
 	// Check if assignee has access to the board
-	assigneeAccess, err := h.db.HasBoardAccess(context.Background(), assigneeID, task.BoardID)
+	assigneeAccess, err := h.db.HasBoardAccess(c.Request.Context(), assigneeID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check assignee access: %v", err)
 		return
@@ -620,21 +711,21 @@ func (h *TaskHandler) AssignTask(c *gin.Context) {
 		return
 	}
 
-	err = h.db.AssignTask(context.Background(), taskID, assigneeID)
+	err = h.db.AssignTask(c.Request.Context(), taskID, assigneeID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to assign task: %v", err)
 		return
 	}
 
 	// Get assignee name for logging
-	assignee, _ := h.db.GetUserByID(context.Background(), assigneeID)
+	assignee, _ := h.db.GetUserByID(c.Request.Context(), assigneeID)
 	assigneeName := "Unknown User"
 	if assignee != nil {
 		assigneeName = assignee.GetDisplayName()
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_update",
 		fmt.Sprintf("Assigned task: %s to %s", task.Title, assigneeName), map[string]interface{}{
 			"action":      "assigned",
 			"assigned_to": assigneeID.String(),
@@ -645,9 +736,9 @@ func (h *TaskHandler) AssignTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "assigned")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "assigned")
 		}
 	}
 
@@ -674,14 +765,14 @@ func (h *TaskHandler) UnassignTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -692,14 +783,14 @@ func (h *TaskHandler) UnassignTask(c *gin.Context) {
 		return
 	}
 
-	err = h.db.UnassignTask(context.Background(), taskID)
+	err = h.db.UnassignTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to unassign task: %v", err)
 		return
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_update",
 		fmt.Sprintf("Unassigned task: %s", task.Title), map[string]interface{}{
 			"action": "unassigned",
 		})
@@ -709,9 +800,9 @@ func (h *TaskHandler) UnassignTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "unassigned")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "unassigned")
 		}
 	}
 
@@ -734,14 +825,14 @@ func (h *TaskHandler) CreateNestedBoard(c *gin.Context) {
 	}
 
 	// Get task details
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -754,27 +845,14 @@ func (h *TaskHandler) CreateNestedBoard(c *gin.Context) {
 
 	// Create nested board using task title and description
 	boardTitle := fmt.Sprintf("%s - Sub-board", task.Title)
-	board, err := h.db.CreateBoard(context.Background(), boardTitle, task.Description, userID, &task.BoardID)
+	board, err := h.db.CreateNestedBoard(c.Request.Context(), task, boardTitle, userID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to create nested board: %v", err)
 		return
 	}
 
-	// Link the task to the newly created nested board
-	updates := map[string]interface{}{
-		"nested_board_id": board.ID,
-	}
-
-	err = h.db.UpdateTask(context.Background(), taskID, updates)
-	if err != nil {
-		// If we can't link the task, clean up by deleting the board
-		_ = h.db.DeleteBoard(context.Background(), board.ID) // Ignore cleanup error
-		c.String(http.StatusInternalServerError, "Failed to link task to nested board: %v", err)
-		return
-	}
-
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_update",
 		fmt.Sprintf("Created nested board for task: %s", task.Title), map[string]interface{}{
 			"nested_board_id":    board.ID.String(),
 			"nested_board_title": board.Title,
@@ -805,14 +883,14 @@ func (h *TaskHandler) CompleteTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -823,19 +901,24 @@ func (h *TaskHandler) CompleteTask(c *gin.Context) {
 		return
 	}
 
+	if unchecked := h.uncheckedItems(c.Request.Context(), task); unchecked > 0 {
+		c.String(http.StatusConflict, "Check off the remaining %d checklist item(s) before completing this task", unchecked)
+		return
+	}
+
 	updates := map[string]interface{}{
 		"completed":    true,
 		"completed_at": time.Now(),
 	}
 
-	err = h.db.UpdateTask(context.Background(), taskID, updates)
+	err = h.db.UpdateTask(c.Request.Context(), taskID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to complete task: %v", err)
 		return
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_complete",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_complete",
 		fmt.Sprintf("Completed task: %s", task.Title), map[string]interface{}{
 			"completed_at": time.Now(),
 		})
@@ -845,10 +928,16 @@ func (h *TaskHandler) CompleteTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "completed")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "completed")
 		}
+		h.broadcastBlockedTasks(c.Request.Context(), task)
+	}
+
+	// Completing the latest instance of a recurring task creates the next one
+	if !task.Completed {
+		h.recurrences.TaskCompleted(c.Request.Context(), task, userID)
 	}
 
 	c.Status(http.StatusOK)
@@ -869,14 +958,14 @@ func (h *TaskHandler) ReopenTask(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to check board access: %v", err)
 		return
@@ -892,14 +981,14 @@ func (h *TaskHandler) ReopenTask(c *gin.Context) {
 		"completed_at": nil,
 	}
 
-	err = h.db.UpdateTask(context.Background(), taskID, updates)
+	err = h.db.UpdateTask(c.Request.Context(), taskID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to reopen task: %v", err)
 		return
 	}
 
 	// Log activity
-	err = h.db.LogActivity(context.Background(), userID, task.BoardID, &taskID, "task_update",
+	err = h.db.LogActivity(c.Request.Context(), userID, task.BoardID, &taskID, "task_update",
 		fmt.Sprintf("Reopened task: %s", task.Title), map[string]interface{}{
 			"action": "reopened",
 		})
@@ -909,10 +998,11 @@ func (h *TaskHandler) ReopenTask(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+		updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 		if updatedTask != nil {
-			h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "reopened")
+			h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "reopened")
 		}
+		h.broadcastBlockedTasks(c.Request.Context(), task)
 	}
 
 	c.Status(http.StatusOK)
@@ -948,7 +1038,7 @@ func (h *TaskHandler) AddTaskAssignee(c *gin.Context) {
 	fmt.Printf("DEBUG AddTaskAssignee: Task=%s, Assignee=%s, By=%s\n", taskID.String(), assigneeID.String(), user.ID.String())
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		fmt.Printf("ERROR AddTaskAssignee: Failed to get task %s: %v\n", taskID.String(), err)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
@@ -956,7 +1046,7 @@ func (h *TaskHandler) AddTaskAssignee(c *gin.Context) {
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, task.BoardID)
 	if err != nil {
 		fmt.Printf("ERROR AddTaskAssignee: Failed to check user board access: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check access"})
@@ -969,7 +1059,7 @@ func (h *TaskHandler) AddTaskAssignee(c *gin.Context) {
 	}
 
 	// Check if assignee has board access
-	assigneeAccess, err := h.db.HasBoardAccess(context.Background(), assigneeID, task.BoardID)
+	assigneeAccess, err := h.db.HasBoardAccess(c.Request.Context(), assigneeID, task.BoardID)
 	if err != nil {
 		fmt.Printf("ERROR AddTaskAssignee: Failed to check assignee board access: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check assignee access"})
@@ -982,7 +1072,7 @@ func (h *TaskHandler) AddTaskAssignee(c *gin.Context) {
 	}
 
 	// Add assignee
-	err = h.db.AddTaskAssignee(context.Background(), taskID, assigneeID, user.ID)
+	err = h.db.AddTaskAssignee(c.Request.Context(), taskID, assigneeID, user.ID)
 	if err != nil {
 		fmt.Printf("ERROR AddTaskAssignee: Failed to add assignee to database: %v\n", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add assignee"})
@@ -992,11 +1082,11 @@ func (h *TaskHandler) AddTaskAssignee(c *gin.Context) {
 	fmt.Printf("SUCCESS AddTaskAssignee: Added assignee %s to task %s\n", assigneeID.String(), taskID.String())
 
 	// Get updated task with assignees
-	updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+	updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 
 	// Broadcast real-time update
 	if h.realtime != nil && updatedTask != nil {
-		h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "assignee_added")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "assignee_added")
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -1025,32 +1115,32 @@ func (h *TaskHandler) RemoveTaskAssignee(c *gin.Context) {
 	}
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, task.BoardID)
 	if err != nil || !hasAccess {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
 	// Remove assignee
-	err = h.db.RemoveTaskAssignee(context.Background(), taskID, assigneeID)
+	err = h.db.RemoveTaskAssignee(c.Request.Context(), taskID, assigneeID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove assignee"})
 		return
 	}
 
 	// Get updated task with assignees
-	updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+	updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 
 	// Broadcast real-time update
 	if h.realtime != nil && updatedTask != nil {
-		h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "assignee_removed")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "assignee_removed")
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
@@ -1075,32 +1165,32 @@ func (h *TaskHandler) ToggleAssigneeCompletion(c *gin.Context) {
 	completed := completedStr == "true"
 
 	// Get task to check board access
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, task.BoardID)
 	if err != nil || !hasAccess {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
 	}
 
 	// Update assignee completion status
-	err = h.db.UpdateTaskAssigneeCompletion(context.Background(), taskID, user.ID, completed)
+	err = h.db.UpdateTaskAssigneeCompletion(c.Request.Context(), taskID, user.ID, completed)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update completion status"})
 		return
 	}
 
 	// Get updated task with assignees
-	updatedTask, _ := h.db.GetTask(context.Background(), taskID)
+	updatedTask, _ := h.db.GetTask(c.Request.Context(), taskID)
 
 	// Broadcast real-time update
 	if h.realtime != nil && updatedTask != nil {
-		h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "assignee_completion_updated")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "assignee_completion_updated")
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true, "completed": completed})
@@ -1122,14 +1212,14 @@ func (h *TaskHandler) GetTaskCard(c *gin.Context) {
 	}
 
 	// Get task with all related data
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
 		return
 	}
 
 	// Check if user has access to this board
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), user.ID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), user.ID, task.BoardID)
 	if err != nil || !hasAccess {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 		return
@@ -1158,14 +1248,14 @@ func (h *TaskHandler) UpdateTaskWithBroadcast(c *gin.Context) {
 	}
 
 	// Get current task for board ID
-	task, err := h.db.GetTask(context.Background(), taskID)
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusNotFound, "Task not found")
 		return
 	}
 
 	// Check board access
-	hasAccess, err := h.db.HasBoardAccess(context.Background(), userID, task.BoardID)
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
 	if err != nil || !hasAccess {
 		c.String(http.StatusForbidden, "Access denied")
 		return
@@ -1195,14 +1285,14 @@ func (h *TaskHandler) UpdateTaskWithBroadcast(c *gin.Context) {
 	}
 
 	// Update task
-	err = h.db.UpdateTask(context.Background(), taskID, updates)
+	err = h.db.UpdateTask(c.Request.Context(), taskID, updates)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to update task: %v", err)
 		return
 	}
 
 	// Get updated task
-	updatedTask, err := h.db.GetTask(context.Background(), taskID)
+	updatedTask, err := h.db.GetTask(c.Request.Context(), taskID)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "Failed to get updated task")
 		return
@@ -1210,7 +1300,7 @@ func (h *TaskHandler) UpdateTaskWithBroadcast(c *gin.Context) {
 
 	// Broadcast real-time update
 	if h.realtime != nil {
-		h.realtime.BroadcastTaskUpdate(task.BoardID.String(), updatedTask, "updated")
+		h.realtime.BroadcastTaskUpdate(c.Request.Context(), task.BoardID.String(), updatedTask, "updated")
 	}
 
 	// Return updated task component
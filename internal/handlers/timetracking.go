@@ -0,0 +1,490 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/realtime"
+	"sudo/internal/timesheet"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	maxManualEntry    = 24 * time.Hour
+	maxTimeNote       = 500
+	defaultReportSpan = 7 * 24 * time.Hour
+)
+
+type TimeHandler struct {
+	db       *database.DB
+	realtime *realtime.RealtimeService
+}
+
+func NewTimeHandler(db *database.DB, rt *realtime.RealtimeService) *TimeHandler {
+	return &TimeHandler{
+		db:       db,
+		realtime: rt,
+	}
+}
+
+// taskForMember loads the task in the :id parameter if the current user is a member of its board
+func (h *TimeHandler) taskForMember(c *gin.Context) (uuid.UUID, *models.Task, bool) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return uuid.Nil, nil, false
+	}
+
+	taskID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid task ID"})
+		return uuid.Nil, nil, false
+	}
+
+	task, err := h.db.GetTask(c.Request.Context(), taskID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Task not found"})
+		return uuid.Nil, nil, false
+	}
+
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, task.BoardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return uuid.Nil, nil, false
+	}
+
+	return userID, task, true
+}
+
+// GetRunningTimer returns the current user's running timer, or null
+func (h *TimeHandler) GetRunningTimer(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	timer, err := h.db.GetRunningTimer(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get running timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get running timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"timer": timer})
+}
+
+// StartTimer starts a timer on the task. A timer the user has running elsewhere, on any
+// board, is stopped first.
+func (h *TimeHandler) StartTimer(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	running, err := h.db.GetRunningTimer(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get running timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+	if running != nil && running.TaskID == task.ID {
+		c.JSON(http.StatusOK, gin.H{"timer": running})
+		return
+	}
+
+	now := time.Now()
+	stopped, err := h.stopRunningTimer(c.Request.Context(), userID, now)
+	if err != nil {
+		log.Printf("Failed to stop running timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start timer"})
+		return
+	}
+
+	timer, err := h.db.CreateTimeEntry(c.Request.Context(), &models.TimeEntry{
+		TaskID:    task.ID,
+		BoardID:   task.BoardID,
+		UserID:    userID,
+		StartedAt: now,
+		Note:      strings.TrimSpace(c.PostForm("note")),
+	})
+	if err != nil {
+		// Another request started a timer in the meantime
+		log.Printf("Failed to start timer: %v", err)
+		c.JSON(http.StatusConflict, gin.H{"error": "A timer is already running; stop it first"})
+		return
+	}
+
+	h.broadcastTask(c.Request.Context(), task.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"timer": timer, "stopped": stopped})
+}
+
+// StopTimer stops the current user's running timer on the task
+func (h *TimeHandler) StopTimer(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	timer, err := h.db.GetRunningTimer(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to get running timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+	if timer == nil || timer.TaskID != task.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No timer is running on this task"})
+		return
+	}
+
+	stopped, err := h.stopRunningTimer(c.Request.Context(), userID, time.Now())
+	if err != nil {
+		log.Printf("Failed to stop timer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to stop timer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"entry": stopped})
+}
+
+// stopRunningTimer ends the user's running timer, if any, and updates its task's actual hours
+func (h *TimeHandler) stopRunningTimer(ctx context.Context, userID uuid.UUID, now time.Time) (*models.TimeEntry, error) {
+	timer, err := h.db.GetRunningTimer(ctx, userID)
+	if err != nil || timer == nil {
+		return nil, err
+	}
+
+	stopped, err := h.db.StopTimeEntry(ctx, timer.ID, now)
+	if err != nil || stopped == nil {
+		return nil, err
+	}
+
+	h.entriesChanged(ctx, userID, stopped.TaskID, stopped.BoardID, fmt.Sprintf("Tracked %s", formatTracked(stopped.Duration(now))))
+	return stopped, nil
+}
+
+// GetTimeEntries lists the time tracked on the task
+func (h *TimeHandler) GetTimeEntries(c *gin.Context) {
+	_, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.GetTaskTimeEntries(c.Request.Context(), task.ID)
+	if err != nil {
+		log.Printf("Failed to get time entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get time entries"})
+		return
+	}
+	if entries == nil {
+		entries = []models.TimeEntry{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":         entries,
+		"actual_hours":    task.ActualHours,
+		"estimated_hours": task.EstimatedHours,
+	})
+}
+
+// AddTimeEntry records time by hand: started_at (YYYY-MM-DDTHH:MM, in UTC unless tz is
+// given), minutes, and an optional note
+func (h *TimeHandler) AddTimeEntry(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	location, err := time.LoadLocation(c.DefaultPostForm("tz", "UTC"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+		return
+	}
+	startedAt, err := time.ParseInLocation("2006-01-02T15:04", c.PostForm("started_at"), location)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start time"})
+		return
+	}
+	minutes, err := strconv.Atoi(c.PostForm("minutes"))
+	duration := time.Duration(minutes) * time.Minute
+	if err != nil || duration <= 0 || duration > maxManualEntry {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Minutes must be between 1 and 1440"})
+		return
+	}
+	endedAt := startedAt.Add(duration)
+	if endedAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time entries cannot end in the future"})
+		return
+	}
+	note := strings.TrimSpace(c.PostForm("note"))
+	if len(note) > maxTimeNote {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Notes are limited to %d characters", maxTimeNote)})
+		return
+	}
+
+	entry, err := h.db.CreateTimeEntry(c.Request.Context(), &models.TimeEntry{
+		TaskID:    task.ID,
+		BoardID:   task.BoardID,
+		UserID:    userID,
+		StartedAt: startedAt,
+		EndedAt:   &endedAt,
+		Note:      note,
+	})
+	if err != nil {
+		log.Printf("Failed to create time entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add time entry"})
+		return
+	}
+
+	h.entriesChanged(c.Request.Context(), userID, task.ID, task.BoardID, fmt.Sprintf("Logged %s", formatTracked(duration)))
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+// DeleteTimeEntry removes one of the current user's entries; board admins may remove anyone's
+func (h *TimeHandler) DeleteTimeEntry(c *gin.Context) {
+	userID, task, ok := h.taskForMember(c)
+	if !ok {
+		return
+	}
+
+	entryID, err := uuid.Parse(c.Param("entryId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time entry ID"})
+		return
+	}
+	entry, err := h.db.GetTimeEntry(c.Request.Context(), entryID)
+	if err != nil || entry.TaskID != task.ID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Time entry not found"})
+		return
+	}
+	if entry.UserID != userID {
+		isAdmin, err := h.db.IsBoardAdmin(c.Request.Context(), userID, task.BoardID)
+		if err != nil || !isAdmin {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only remove your own time entries"})
+			return
+		}
+	}
+
+	if err := h.db.DeleteTimeEntry(c.Request.Context(), entry.ID); err != nil {
+		log.Printf("Failed to delete time entry: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove time entry"})
+		return
+	}
+
+	h.entriesChanged(c.Request.Context(), userID, task.ID, task.BoardID, "Removed a time entry")
+
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// entriesChanged recalculates the task's actual hours, logs the change and refreshes the card
+func (h *TimeHandler) entriesChanged(ctx context.Context, userID, taskID, boardID uuid.UUID, description string) {
+	if err := h.db.RecalculateActualHours(ctx, taskID); err != nil {
+		log.Printf("Failed to recalculate actual hours of task %s: %v", taskID.String(), err)
+	}
+
+	err := h.db.LogActivity(ctx, userID, boardID, &taskID, "task_update", description, nil)
+	if err != nil {
+		log.Printf("Failed to log time tracking activity: %v", err)
+	}
+
+	h.broadcastTask(ctx, taskID)
+}
+
+func (h *TimeHandler) broadcastTask(ctx context.Context, taskID uuid.UUID) {
+	if h.realtime == nil {
+		return
+	}
+	if task, err := h.db.GetTask(ctx, taskID); err == nil {
+		h.realtime.BroadcastTaskUpdate(ctx, task.BoardID.String(), task, "updated")
+	}
+}
+
+// BoardTimesheet reports the time tracked on a board per member. See timesheetRange for
+// the query parameters; format=csv downloads the report.
+func (h *TimeHandler) BoardTimesheet(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	boardID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid board ID"})
+		return
+	}
+	hasAccess, err := h.db.HasBoardAccess(c.Request.Context(), userID, boardID)
+	if err != nil || !hasAccess {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+
+	period, from, to, ok := timesheetRange(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.ListTimeEntries(c.Request.Context(), &boardID, nil, from, to)
+	if err != nil {
+		log.Printf("Failed to list time entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build timesheet"})
+		return
+	}
+
+	intervals := timesheetIntervals(entries, func(entry models.TimeEntry) uuid.UUID { return entry.UserID })
+	report, err := timesheet.Build(period, from, to, intervals)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	members, err := h.db.GetBoardMembers(c.Request.Context(), boardID)
+	if err != nil {
+		log.Printf("Failed to get board members for timesheet: %v", err)
+	}
+	report.SetNames(memberNames(members))
+
+	h.writeTimesheet(c, report, fmt.Sprintf("timesheet-board-%s", boardID.String()))
+}
+
+// UserTimesheet reports the current user's tracked time per task, across all boards
+func (h *TimeHandler) UserTimesheet(c *gin.Context) {
+	userID, err := getUserFromSession(c)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	period, from, to, ok := timesheetRange(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.db.ListTimeEntries(c.Request.Context(), nil, &userID, from, to)
+	if err != nil {
+		log.Printf("Failed to list time entries: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build timesheet"})
+		return
+	}
+
+	intervals := timesheetIntervals(entries, func(entry models.TimeEntry) uuid.UUID { return entry.TaskID })
+	report, err := timesheet.Build(period, from, to, intervals)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	taskIDs := make([]uuid.UUID, 0, len(report.Rows))
+	for _, row := range report.Rows {
+		if id, err := uuid.Parse(row.Key); err == nil {
+			taskIDs = append(taskIDs, id)
+		}
+	}
+	titles, err := h.db.GetTaskTitles(c.Request.Context(), taskIDs)
+	if err != nil {
+		log.Printf("Failed to get task titles for timesheet: %v", err)
+	}
+	names := make(map[string]string, len(titles))
+	for id, title := range titles {
+		names[id.String()] = title
+	}
+	report.SetNames(names)
+
+	h.writeTimesheet(c, report, fmt.Sprintf("timesheet-%s", userID.String()))
+}
+
+// timesheetRange reads period (day or week) and the dateRange parameters, by default the
+// last 7 days
+func timesheetRange(c *gin.Context) (timesheet.Period, time.Time, time.Time, bool) {
+	period, err := timesheet.ParsePeriod(c.Query("period"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be day or week"})
+		return "", time.Time{}, time.Time{}, false
+	}
+
+	from, to, ok := dateRange(c, defaultReportSpan)
+	return period, from, to, ok
+}
+
+// dateRange reads from and to (YYYY-MM-DD, both inclusive; the span up to today by
+// default) and tz (an IANA zone, UTC by default). It returns midnights in that zone.
+func dateRange(c *gin.Context, span time.Duration) (time.Time, time.Time, bool) {
+	location, err := time.LoadLocation(c.DefaultQuery("tz", "UTC"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time zone"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	to := timesheet.Day.Start(time.Now().In(location)).AddDate(0, 0, 1)
+	if toStr := c.Query("to"); toStr != "" {
+		day, err := time.ParseInLocation("2006-01-02", toStr, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = day.AddDate(0, 0, 1)
+	}
+	from := to.AddDate(0, 0, -int(span/(24*time.Hour)))
+	if fromStr := c.Query("from"); fromStr != "" {
+		from, err = time.ParseInLocation("2006-01-02", fromStr, location)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must not be after to"})
+		return time.Time{}, time.Time{}, false
+	}
+
+	return from, to, true
+}
+
+// timesheetIntervals turns entries into report intervals keyed by key; running timers
+// count up to now
+func timesheetIntervals(entries []models.TimeEntry, key func(models.TimeEntry) uuid.UUID) []timesheet.Interval {
+	now := time.Now()
+	intervals := make([]timesheet.Interval, 0, len(entries))
+	for _, entry := range entries {
+		end := now
+		if entry.EndedAt != nil {
+			end = *entry.EndedAt
+		}
+		intervals = append(intervals, timesheet.Interval{
+			Key:   key(entry).String(),
+			Start: entry.StartedAt,
+			End:   end,
+		})
+	}
+	return intervals
+}
+
+func (h *TimeHandler) writeTimesheet(c *gin.Context, report *timesheet.Report, filename string) {
+	if c.Query("format") != "csv" {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	if err := report.WriteCSV(c.Writer); err != nil {
+		log.Printf("Failed to write timesheet CSV: %v", err)
+	}
+}
+
+// formatTracked renders a duration like "1h 05m"
+func formatTracked(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%dh %02dm", int(d.Hours()), int(d.Minutes())%60)
+}
@@ -0,0 +1,122 @@
+package inbound
+
+import (
+	"strings"
+)
+
+// authResult is one "method=result property=value ..." entry of an Authentication-Results
+// header (RFC 8601)
+type authResult struct {
+	method     string
+	result     string
+	properties map[string]string
+}
+
+// parseAuthResults splits an Authentication-Results value into its authserv-id and results.
+// Comments in parentheses are dropped and keys are lowercased.
+func parseAuthResults(value string) (string, []authResult) {
+	value = stripComments(value)
+	parts := strings.Split(value, ";")
+
+	// The first part is the authserv-id, optionally followed by a version
+	fields := strings.Fields(parts[0])
+	if len(fields) == 0 {
+		return "", nil
+	}
+	servID := strings.ToLower(fields[0])
+
+	var results []authResult
+	for _, part := range parts[1:] {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		method, result, ok := strings.Cut(fields[0], "=")
+		if !ok {
+			// "none" means no checks were run
+			continue
+		}
+		r := authResult{
+			// Methods may carry a version, as in "dkim/1=pass"
+			method:     strings.ToLower(strings.SplitN(method, "/", 2)[0]),
+			result:     strings.ToLower(result),
+			properties: make(map[string]string),
+		}
+		for _, field := range fields[1:] {
+			key, val, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			r.properties[strings.ToLower(key)] = strings.ToLower(strings.Trim(val, `"`))
+		}
+		results = append(results, r)
+	}
+	return servID, results
+}
+
+// stripComments removes (possibly nested) parenthesized comments outside quoted strings
+func stripComments(value string) string {
+	var b strings.Builder
+	depth, quoted := 0, false
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value) && (quoted || depth > 0):
+			if depth == 0 {
+				b.WriteByte(c)
+				b.WriteByte(value[i+1])
+			}
+			i++
+		case c == '"' && depth == 0:
+			quoted = !quoted
+			b.WriteByte(c)
+		case c == '(' && !quoted:
+			depth++
+		case c == ')' && !quoted && depth > 0:
+			depth--
+			if depth == 0 {
+				b.WriteByte(' ')
+			}
+		case depth == 0:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// senderAuthenticated checks the topmost Authentication-Results header, which the receiving
+// relay adds last, and only when its authserv-id is the configured relay. Headers further
+// down may have been written by the sender. The From domain must pass DMARC, or carry a
+// passing DKIM signature whose d= domain is the From domain. SPF alone is not enough: it
+// vouches for the envelope sender, not the From header the author is taken from.
+func senderAuthenticated(headers []string, authServID, from string) bool {
+	if len(headers) == 0 || authServID == "" {
+		return false
+	}
+	servID, results := parseAuthResults(headers[0])
+	if servID != authServID {
+		return false
+	}
+
+	_, fromDomain, ok := strings.Cut(strings.ToLower(from), "@")
+	if !ok || fromDomain == "" {
+		return false
+	}
+
+	for _, r := range results {
+		if r.result != "pass" {
+			continue
+		}
+		switch r.method {
+		case "dmarc":
+			if d := r.properties["header.from"]; d == "" || d == fromDomain {
+				return true
+			}
+		case "dkim":
+			if strings.TrimSuffix(r.properties["header.d"], ".") == fromDomain {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package inbound
+
+import "testing"
+
+func TestParseAuthResults(t *testing.T) {
+	servID, results := parseAuthResults(`MX.Example.com 1; (checked by the relay)
+		dkim=pass (2048-bit key) header.d=Sender.org header.i=@sender.org header.s="sel1";
+		spf=fail smtp.mailfrom=bounce@other.net; dmarc=pass (p=reject) header.from=sender.org`)
+	if servID != "mx.example.com" {
+		t.Errorf("authserv-id = %q", servID)
+	}
+	if len(results) != 3 {
+		t.Fatalf("results = %+v", results)
+	}
+	if r := results[0]; r.method != "dkim" || r.result != "pass" || r.properties["header.d"] != "sender.org" || r.properties["header.s"] != "sel1" {
+		t.Errorf("dkim = %+v", r)
+	}
+	if r := results[2]; r.method != "dmarc" || r.properties["header.from"] != "sender.org" {
+		t.Errorf("dmarc = %+v", r)
+	}
+
+	if servID, results := parseAuthResults("mx.example.com; none"); servID != "mx.example.com" || len(results) != 0 {
+		t.Errorf("none = %q %+v", servID, results)
+	}
+}
+
+func TestSenderAuthenticated(t *testing.T) {
+	const relay = "mx.example.com"
+	tests := []struct {
+		name    string
+		headers []string
+		from    string
+		want    bool
+	}{
+		{name: "dmarc pass", from: "ada@sender.org",
+			headers: []string{"mx.example.com; dmarc=pass header.from=sender.org"}, want: true},
+		{name: "dkim signed by the From domain", from: "ada@sender.org",
+			headers: []string{"mx.example.com; dkim=pass header.d=sender.org"}, want: true},
+		{name: "dkim signed by another domain", from: "ada@sender.org",
+			headers: []string{"mx.example.com; dkim=pass header.d=attacker.net"}},
+		{name: "dkim signed by a parent domain", from: "ada@mail.sender.org",
+			headers: []string{"mx.example.com; dkim=pass header.d=sender.org"}},
+		{name: "dmarc for another domain", from: "ada@sender.org",
+			headers: []string{"mx.example.com; dmarc=pass header.from=attacker.net"}},
+		{name: "spf alone", from: "ada@sender.org",
+			headers: []string{"mx.example.com; spf=pass smtp.mailfrom=sender.org"}},
+		{name: "dmarc failed", from: "ada@sender.org",
+			headers: []string{"mx.example.com; dkim=fail header.d=sender.org; dmarc=fail header.from=sender.org"}},
+		{name: "pass only inside a comment", from: "ada@sender.org",
+			headers: []string{"mx.example.com; spf=fail (not dmarc=pass header.from=sender.org)"}},
+		{name: "header from another relay", from: "ada@sender.org",
+			headers: []string{"evil.example.net; dmarc=pass header.from=sender.org"}},
+		{name: "forged header below the relay's", from: "ada@sender.org",
+			headers: []string{
+				"mx.example.com; dmarc=fail header.from=sender.org",
+				"mx.example.com; dmarc=pass header.from=sender.org",
+			}},
+		{name: "no header", from: "ada@sender.org"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := senderAuthenticated(tt.headers, relay, tt.from); got != tt.want {
+				t.Errorf("senderAuthenticated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if senderAuthenticated([]string{"; dmarc=pass"}, "", "ada@sender.org") {
+		t.Error("no configured relay must never authenticate")
+	}
+}
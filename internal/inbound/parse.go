@@ -0,0 +1,271 @@
+package inbound
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+const (
+	// MaxMessageSize is the largest raw message accepted over HTTP or SMTP
+	MaxMessageSize = 10 << 20
+	// Larger attachments are dropped (and listed in Message.Skipped) instead of rejecting the mail
+	maxAttachmentSize   = 8 << 20
+	maxAttachmentsTotal = 10 << 20
+	maxMultipartDepth   = 5
+)
+
+// Attachment is a file part of an inbound message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is the parts of an inbound email that tasks and comments are built from
+type Message struct {
+	From        string   // Sender address, lowercased
+	Recipients  []string // Addresses from the envelope or the To/Cc headers
+	Subject     string
+	Text        string // Plain-text body (HTML is converted when there is no text part)
+	Attachments []Attachment
+	// Skipped lists attachments that were dropped for exceeding the size limits
+	Skipped []string
+
+	header mail.Header
+}
+
+var wordDecoder = &mime.WordDecoder{}
+
+// ParseMessage parses a raw RFC 5322 message. envelopeRecipients (from SMTP RCPT TO) take
+// precedence over the headers, which Bcc recipients and mailing lists do not appear in.
+func ParseMessage(raw []byte, envelopeRecipients []string) (*Message, error) {
+	parsed, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse message: %w", err)
+	}
+
+	from, err := mail.ParseAddress(decodeHeader(parsed.Header.Get("From")))
+	if err != nil {
+		return nil, fmt.Errorf("invalid From address: %w", err)
+	}
+
+	msg := &Message{
+		From:    strings.ToLower(from.Address),
+		Subject: strings.TrimSpace(decodeHeader(parsed.Header.Get("Subject"))),
+		header:  parsed.Header,
+	}
+
+	if len(envelopeRecipients) > 0 {
+		for _, rcpt := range envelopeRecipients {
+			msg.Recipients = append(msg.Recipients, strings.ToLower(strings.Trim(rcpt, "<> ")))
+		}
+	} else {
+		for _, key := range []string{"Delivered-To", "X-Original-To", "To", "Cc"} {
+			addresses, err := parsed.Header.AddressList(key)
+			if err != nil {
+				continue
+			}
+			for _, address := range addresses {
+				msg.Recipients = append(msg.Recipients, strings.ToLower(address.Address))
+			}
+		}
+	}
+
+	var html string
+	if err := msg.walk(parsed.Header, parsed.Body, &html, 0); err != nil {
+		return nil, err
+	}
+	if msg.Text == "" && html != "" {
+		msg.Text = htmlToText(html)
+	}
+	msg.Text = strings.TrimSpace(strings.ReplaceAll(msg.Text, "\r\n", "\n"))
+
+	return msg, nil
+}
+
+// Header returns a raw header value of the message
+func (m *Message) Header(key string) string {
+	return m.header.Get(key)
+}
+
+// HeaderValues returns every value of a header, topmost first
+func (m *Message) HeaderValues(key string) []string {
+	return m.header[textproto.CanonicalMIMEHeaderKey(key)]
+}
+
+// partHeader is satisfied by both mail.Header and the headers of multipart parts
+type partHeader interface {
+	Get(key string) string
+}
+
+// walk collects the first text/plain and text/html bodies and every attachment
+func (m *Message) walk(header partHeader, body io.Reader, html *string, depth int) error {
+	if depth > maxMultipartDepth {
+		return fmt.Errorf("message nests too deeply")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read message part: %w", err)
+			}
+			if err := m.walk(part.Header, part, html, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("failed to decode message part: %w", err)
+	}
+
+	disposition, dispParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := decodeHeader(dispParams["filename"])
+	if filename == "" {
+		filename = decodeHeader(params["name"])
+	}
+
+	if disposition == "attachment" || filename != "" {
+		m.addAttachment(filename, mediaType, data)
+		return nil
+	}
+
+	switch mediaType {
+	case "text/plain":
+		if m.Text == "" {
+			m.Text = string(data)
+		}
+	case "text/html":
+		if *html == "" {
+			*html = string(data)
+		}
+	}
+	return nil
+}
+
+func (m *Message) addAttachment(filename, contentType string, data []byte) {
+	if filename == "" {
+		filename = "attachment"
+	}
+
+	total := len(data)
+	for _, attachment := range m.Attachments {
+		total += len(attachment.Data)
+	}
+	if len(data) > maxAttachmentSize || total > maxAttachmentsTotal {
+		m.Skipped = append(m.Skipped, filename)
+		return
+	}
+
+	m.Attachments = append(m.Attachments, Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Data:        data,
+	})
+}
+
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// newlineStripper drops line breaks so base64 bodies wrapped at 76 characters decode
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		count, err := n.r.Read(p)
+		kept := 0
+		for _, b := range p[:count] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[kept] = b
+				kept++
+			}
+		}
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+func decodeHeader(value string) string {
+	decoded, err := wordDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+var (
+	htmlBreaks  = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>|</h[1-6]>`)
+	htmlTags    = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlDropped = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	blankLines  = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText is a rough conversion for HTML-only messages
+func htmlToText(html string) string {
+	text := htmlDropped.ReplaceAllString(html, "")
+	text = htmlBreaks.ReplaceAllString(text, "\n")
+	text = htmlTags.ReplaceAllString(text, "")
+	text = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", "\"", "&#39;", "'").Replace(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return blankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+}
+
+var replyHeader = regexp.MustCompile(`(?m)^(On .+wrote:|-----Original Message-----|From: .+)$`)
+
+// StripQuotedReply keeps only the new text of a reply, dropping the quoted original
+// and the "On ... wrote:" line that mail clients put above it
+func StripQuotedReply(text string) string {
+	if loc := replyHeader.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+
+	var kept []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	// Drop a trailing signature block
+	result := strings.Join(kept, "\n")
+	if i := strings.Index(result, "\n-- \n"); i >= 0 {
+		result = result[:i]
+	}
+	return strings.TrimSpace(result)
+}
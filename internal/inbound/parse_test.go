@@ -0,0 +1,204 @@
+package inbound
+
+import (
+	"strings"
+	"testing"
+)
+
+// crlf turns a message written with \n line endings into wire format
+func crlf(s string) []byte {
+	return []byte(strings.ReplaceAll(s, "\n", "\r\n"))
+}
+
+func TestParseMessage(t *testing.T) {
+	raw := crlf(`From: "Ada Lovelace" <Ada@Sender.org>
+To: board-token@tasks.example.com, someone@else.org
+Cc: Other <board-token+0b7a6f4e-6d8c-4c3e-9a55-0a3c5b0e3f11@tasks.example.com>
+Subject: =?UTF-8?Q?Fix_the_caf=C3=A9_menu?=
+Authentication-Results: mx.example.com; dmarc=pass header.from=sender.org
+Authentication-Results: forged.example.net; dmarc=pass
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset=utf-8
+Content-Transfer-Encoding: quoted-printable
+
+The menu says caf=C3=A9 twice.
+--inner
+Content-Type: text/html
+
+<p>ignored because there is a text part</p>
+--inner--
+--outer
+Content-Type: text/csv; name="prices.csv"
+Content-Disposition: attachment; filename="prices.csv"
+Content-Transfer-Encoding: base64
+
+aXRlbSxwcmljZQpjb2ZmZWUs
+Mw==
+--outer--
+`)
+
+	msg, err := ParseMessage(raw, nil)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+
+	if msg.From != "ada@sender.org" {
+		t.Errorf("From = %q", msg.From)
+	}
+	if msg.Subject != "Fix the café menu" {
+		t.Errorf("Subject = %q", msg.Subject)
+	}
+	if msg.Text != "The menu says café twice." {
+		t.Errorf("Text = %q", msg.Text)
+	}
+	if len(msg.Recipients) != 3 || msg.Recipients[0] != "board-token@tasks.example.com" ||
+		msg.Recipients[2] != "board-token+0b7a6f4e-6d8c-4c3e-9a55-0a3c5b0e3f11@tasks.example.com" {
+		t.Errorf("Recipients = %v", msg.Recipients)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "prices.csv" ||
+		string(msg.Attachments[0].Data) != "item,price\ncoffee,3" {
+		t.Errorf("Attachments = %+v", msg.Attachments)
+	}
+	if results := msg.HeaderValues("authentication-results"); len(results) != 2 || !strings.HasPrefix(results[0], "mx.example.com") {
+		t.Errorf("Authentication-Results = %v, want topmost first", results)
+	}
+}
+
+func TestParseMessageEnvelopeRecipients(t *testing.T) {
+	raw := crlf(`From: ada@sender.org
+To: list@lists.example.org
+Subject: Hello
+
+Body
+`)
+	msg, err := ParseMessage(raw, []string{"<Board-Token@Tasks.Example.com>"})
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if len(msg.Recipients) != 1 || msg.Recipients[0] != "board-token@tasks.example.com" {
+		t.Errorf("Recipients = %v, want only the envelope recipient", msg.Recipients)
+	}
+}
+
+func TestParseMessageHTMLOnly(t *testing.T) {
+	raw := crlf(`From: ada@sender.org
+Subject: Hello
+Content-Type: text/html
+
+<html><head><style>p { color: red }</style></head><body>
+<p>First &amp; foremost</p><div>Second line<br>Third</div>
+<script>alert(1)</script></body></html>
+`)
+	msg, err := ParseMessage(raw, nil)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if msg.Text != "First & foremost\nSecond line\nThird" {
+		t.Errorf("Text = %q", msg.Text)
+	}
+}
+
+func TestParseMessageSkipsOversizedAttachments(t *testing.T) {
+	big := strings.Repeat("x", maxAttachmentSize+1)
+	raw := crlf(`From: ada@sender.org
+Subject: Files
+Content-Type: multipart/mixed; boundary="b"
+
+--b
+Content-Type: text/plain
+
+See attached
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="big.bin"
+
+` + big + `
+--b
+Content-Type: application/octet-stream
+Content-Disposition: attachment; filename="small.bin"
+
+small
+--b--
+`)
+	msg, err := ParseMessage(raw, nil)
+	if err != nil {
+		t.Fatalf("ParseMessage failed: %v", err)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Filename != "small.bin" {
+		t.Errorf("Attachments = %d, want only small.bin", len(msg.Attachments))
+	}
+	if len(msg.Skipped) != 1 || msg.Skipped[0] != "big.bin" {
+		t.Errorf("Skipped = %v", msg.Skipped)
+	}
+}
+
+func TestParseMessageRejectsInvalidInput(t *testing.T) {
+	for name, raw := range map[string]string{
+		"no From":      "Subject: Hello\n\nBody\n",
+		"invalid From": "From: not an address\n\nBody\n",
+		"nested too deeply": "From: ada@sender.org\nContent-Type: multipart/mixed; boundary=a\n\n" +
+			strings.Repeat("--a\nContent-Type: multipart/mixed; boundary=a\n\n", maxMultipartDepth+2),
+	} {
+		if _, err := ParseMessage(crlf(raw), nil); err == nil {
+			t.Errorf("%s: ParseMessage accepted %q", name, raw)
+		}
+	}
+}
+
+func TestStripQuotedReply(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "gmail style",
+			text: "Sounds good, moving it to review.\n\nOn Mon, 5 May 2025 at 10:00, Sudo <noreply@example.com> wrote:\n> Task created\n> Reply to comment",
+			want: "Sounds good, moving it to review.",
+		},
+		{
+			name: "outlook style",
+			text: "Done.\n-----Original Message-----\nFrom: Sudo\nSent: Monday",
+			want: "Done.",
+		},
+		{
+			name: "from header block",
+			text: "Thanks!\n\nFrom: Sudo <noreply@example.com>\nSubject: Task created",
+			want: "Thanks!",
+		},
+		{
+			name: "inline quotes",
+			text: "> Can you check the logs?\nChecked, nothing there.\n> And the metrics?\nThose look fine.",
+			want: "Checked, nothing there.\nThose look fine.",
+		},
+		{
+			name: "signature",
+			text: "On it.\n-- \nAda Lovelace\nAnalytical Engines Ltd",
+			want: "On it.",
+		},
+		{
+			name: "only a quote",
+			text: "> quoted\n> text",
+			want: "",
+		},
+		{
+			name: "plain text",
+			text: "  Nothing quoted here  ",
+			want: "Nothing quoted here",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := StripQuotedReply(tt.text); got != tt.want {
+				t.Errorf("StripQuotedReply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
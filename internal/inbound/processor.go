@@ -0,0 +1,286 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"sudo/internal/attachments"
+	"sudo/internal/config"
+	"sudo/internal/database"
+	"sudo/internal/email"
+	"sudo/internal/logging"
+	"sudo/internal/models"
+	"sudo/internal/realtime"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Match the CHECK constraints on tasks and comments
+	maxTitleLength       = 300
+	maxDescriptionLength = 10000
+	maxCommentLength     = 2000
+)
+
+var (
+	// ErrUnknownRecipient means no recipient is a board or task address on this domain
+	ErrUnknownRecipient = errors.New("no matching board address")
+	// ErrNotAuthorized means the sender is not a member of the board
+	ErrNotAuthorized = errors.New("sender is not allowed to post to this board")
+	// ErrUnauthenticated means the configured relay did not vouch for the sender's domain
+	// (see INBOUND_EMAIL_REQUIRE_AUTH)
+	ErrUnauthenticated = errors.New("sender could not be authenticated")
+	// ErrEmptyMessage means there was nothing to turn into a comment
+	ErrEmptyMessage = errors.New("message has no content")
+)
+
+// Result describes what an inbound message was turned into
+type Result struct {
+	Action    string     `json:"action"` // "task_created" or "comment_created"
+	BoardID   uuid.UUID  `json:"board_id"`
+	TaskID    uuid.UUID  `json:"task_id"`
+	CommentID *uuid.UUID `json:"comment_id,omitempty"`
+}
+
+// Processor turns emails sent to board addresses into tasks and replies into comments.
+// A board's address is <token>@INBOUND_EMAIL_DOMAIN; replies about a task go to
+// <token>+<task id>@INBOUND_EMAIL_DOMAIN.
+type Processor struct {
+	db           *database.DB
+	realtime     *realtime.RealtimeService
+	emailService *email.EmailService
+	attachments  *attachments.Service
+	domain       string
+	requireAuth  bool
+	authServID   string
+}
+
+// NewProcessor configures inbound email. Inbound email is disabled (Enabled reports
+// false) when INBOUND_EMAIL_DOMAIN is not set.
+func NewProcessor(db *database.DB, rt *realtime.RealtimeService, emailService *email.EmailService, attachmentService *attachments.Service, cfg config.Inbound) *Processor {
+	return &Processor{
+		db:           db,
+		realtime:     rt,
+		emailService: emailService,
+		attachments:  attachmentService,
+		domain:       cfg.Domain,
+		requireAuth:  cfg.RequireAuth,
+		authServID:   cfg.AuthServID,
+	}
+}
+
+// Enabled reports whether an inbound domain is configured
+func (p *Processor) Enabled() bool {
+	return p.domain != ""
+}
+
+// BoardAddress returns the address that creates tasks on a board
+func (p *Processor) BoardAddress(ctx context.Context, boardID uuid.UUID) (string, error) {
+	if !p.Enabled() {
+		return "", fmt.Errorf("inbound email is not configured")
+	}
+
+	token, err := p.db.GetBoardInboundToken(ctx, boardID)
+	if err != nil {
+		return "", err
+	}
+	return token + "@" + p.domain, nil
+}
+
+// AcceptsRecipient reports whether address is on the inbound domain, for the SMTP RCPT check
+func (p *Processor) AcceptsRecipient(address string) bool {
+	_, _, ok := p.parseAddress(address)
+	return ok
+}
+
+// parseAddress splits <token>[+<task id>]@domain
+func (p *Processor) parseAddress(address string) (string, *uuid.UUID, bool) {
+	local, domain, ok := strings.Cut(strings.ToLower(strings.TrimSpace(address)), "@")
+	if !ok || domain != p.domain || local == "" {
+		return "", nil, false
+	}
+
+	token, taskPart, hasTask := strings.Cut(local, "+")
+	if !hasTask {
+		return token, nil, true
+	}
+
+	taskID, err := uuid.Parse(taskPart)
+	if err != nil {
+		return "", nil, false
+	}
+	return token, &taskID, true
+}
+
+// Process handles one raw message
+func (p *Processor) Process(ctx context.Context, raw []byte, envelopeRecipients []string) (*Result, error) {
+	if !p.Enabled() {
+		return nil, fmt.Errorf("inbound email is not configured")
+	}
+
+	msg, err := ParseMessage(raw, envelopeRecipients)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.requireAuth && !senderAuthenticated(msg.HeaderValues("Authentication-Results"), p.authServID, msg.From) {
+		logging.LogSecurityEvent("", "inbound_email_unauthenticated", "from_key="+p.db.RateLimitKey(msg.From))
+		return nil, ErrUnauthenticated
+	}
+
+	// Use the first recipient that is one of our addresses
+	var board *models.Board
+	var taskID *uuid.UUID
+	for _, recipient := range msg.Recipients {
+		token, task, ok := p.parseAddress(recipient)
+		if !ok {
+			continue
+		}
+		if board, err = p.db.GetBoardByInboundToken(ctx, token); err == nil {
+			taskID = task
+			break
+		}
+	}
+	if board == nil {
+		return nil, ErrUnknownRecipient
+	}
+
+	sender, err := p.db.GetUserByEmail(ctx, msg.From)
+	if err != nil {
+		logging.LogSecurityEvent("", "inbound_email_rejected", fmt.Sprintf("board=%s reason=unknown_sender", board.ID.String()))
+		return nil, ErrNotAuthorized
+	}
+
+	hasAccess, err := p.db.HasBoardAccess(ctx, sender.ID, board.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check board access: %w", err)
+	}
+	if !hasAccess {
+		logging.LogSecurityEvent(sender.ID.String(), "inbound_email_rejected", fmt.Sprintf("board=%s reason=not_member", board.ID.String()))
+		return nil, ErrNotAuthorized
+	}
+
+	if taskID != nil {
+		return p.createComment(ctx, board, *taskID, sender, msg)
+	}
+	return p.createTask(ctx, board, sender, msg)
+}
+
+func (p *Processor) createTask(ctx context.Context, board *models.Board, sender *models.User, msg *Message) (*Result, error) {
+	columns, err := p.db.GetBoardColumns(ctx, board.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get board columns: %w", err)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("board has no columns")
+	}
+	sort.SliceStable(columns, func(i, j int) bool { return columns[i].Position < columns[j].Position })
+	column := columns[0]
+
+	title := msg.Subject
+	if title == "" {
+		title = "Email from " + msg.From
+	}
+
+	task, err := p.db.CreateTask(ctx, truncate(title, maxTitleLength), truncate(msg.Text, maxDescriptionLength), column.ID, board.ID, "Medium")
+	if err != nil {
+		return nil, err
+	}
+
+	// The sender owns the request until someone else picks it up
+	if err := p.db.AddTaskAssignee(ctx, task.ID, sender.ID, sender.ID); err != nil {
+		log.Printf("Warning: Failed to assign email task to sender: %v", err)
+	}
+
+	stored := 0
+	for _, attachment := range msg.Attachments {
+		if _, err := p.attachments.Add(ctx, task.ID, sender.ID, attachment.Filename, attachment.Data); err != nil {
+			log.Printf("Warning: Failed to save email attachment %q: %v", attachment.Filename, err)
+			msg.Skipped = append(msg.Skipped, attachment.Filename)
+			continue
+		}
+		stored++
+	}
+	if len(msg.Skipped) > 0 {
+		log.Printf("Inbound email for task %s: skipped oversized attachments %v", task.ID.String(), msg.Skipped)
+	}
+
+	err = p.db.LogActivity(ctx, sender.ID, board.ID, &task.ID, "task_create",
+		fmt.Sprintf("Created task by email: %s", task.Title), map[string]interface{}{
+			"task_title":  task.Title,
+			"column_id":   column.ID.String(),
+			"source":      "email",
+			"attachments": stored,
+		})
+	if err != nil {
+		log.Printf("Failed to log email task activity: %v", err)
+	}
+
+	if reloaded, err := p.db.GetTask(ctx, task.ID); err == nil {
+		task = reloaded
+	}
+	if p.realtime != nil {
+		p.realtime.BroadcastTaskUpdate(ctx, board.ID.String(), task, "created")
+	}
+
+	// Confirm with a reply address so follow-ups land on the task as comments
+	if p.emailService != nil {
+		token, err := p.db.GetBoardInboundToken(ctx, board.ID)
+		if err == nil {
+			replyTo := fmt.Sprintf("%s+%s@%s", token, task.ID.String(), p.domain)
+			err = p.emailService.SendTaskCreated(msg.From, task.Title, board.Title, stored, replyTo)
+		}
+		if err != nil {
+			log.Printf("Failed to queue task confirmation email: %v", err)
+		}
+	}
+
+	log.Printf("Inbound email created task %s on board %s", task.ID.String(), board.ID.String())
+	return &Result{Action: "task_created", BoardID: board.ID, TaskID: task.ID}, nil
+}
+
+func (p *Processor) createComment(ctx context.Context, board *models.Board, taskID uuid.UUID, sender *models.User, msg *Message) (*Result, error) {
+	task, err := p.db.GetTask(ctx, taskID)
+	if err != nil || task.BoardID != board.ID {
+		return nil, ErrUnknownRecipient
+	}
+
+	content := StripQuotedReply(msg.Text)
+	if content == "" {
+		return nil, ErrEmptyMessage
+	}
+
+	comment, err := p.db.CreateComment(ctx, task.ID, sender.ID, truncate(content, maxCommentLength))
+	if err != nil {
+		return nil, err
+	}
+
+	err = p.db.LogActivity(ctx, sender.ID, board.ID, &task.ID, "comment_create",
+		fmt.Sprintf("Commented by email on: %s", task.Title), map[string]interface{}{
+			"task_title": task.Title,
+			"source":     "email",
+		})
+	if err != nil {
+		log.Printf("Failed to log email comment activity: %v", err)
+	}
+
+	if p.realtime != nil {
+		p.realtime.BroadcastTaskUpdate(ctx, board.ID.String(), task, "updated")
+	}
+
+	log.Printf("Inbound email added comment %s to task %s", comment.ID.String(), task.ID.String())
+	return &Result{Action: "comment_created", BoardID: board.ID, TaskID: task.ID, CommentID: &comment.ID}, nil
+}
+
+// truncate shortens s to at most max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max])
+}
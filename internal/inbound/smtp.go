@@ -0,0 +1,206 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	smtpMaxRecipients = 20
+	smtpIdleTimeout   = 2 * time.Minute
+)
+
+// SMTPServer is a minimal receive-only SMTP server (RFC 5321 subset, no relaying, no TLS).
+// Run it behind an MTA that checks SPF, DKIM and DMARC; it only accepts connections from
+// AllowedNets and only mail for the inbound domain.
+type SMTPServer struct {
+	Addr        string
+	Processor   *Processor
+	Hostname    string
+	AllowedNets []*net.IPNet
+}
+
+// allowed reports whether the peer at addr is one of the relays in AllowedNets
+func (s *SMTPServer) allowed(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	for _, ipNet := range s.AllowedNets {
+		if ipNet.Contains(tcp.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe accepts connections until ctx is cancelled
+func (s *SMTPServer) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for SMTP: %w", err)
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	log.Printf("Inbound SMTP listening on %s", s.Addr)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			log.Printf("Inbound SMTP accept failed: %v", err)
+			continue
+		}
+		go s.serve(ctx, conn)
+	}
+}
+
+type smtpSession struct {
+	started    bool // MAIL FROM received; the reverse path itself may be empty for bounces
+	recipients []string
+}
+
+func (s *SMTPServer) serve(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	tp := textproto.NewConn(conn)
+	hostname := s.Hostname
+	if hostname == "" {
+		hostname = s.Processor.domain
+	}
+
+	reply := func(code int, message string) bool {
+		_ = conn.SetWriteDeadline(time.Now().Add(smtpIdleTimeout))
+		return tp.PrintfLine("%d %s", code, message) == nil
+	}
+
+	if !s.allowed(conn.RemoteAddr()) {
+		log.Printf("Inbound SMTP refused connection from %s", conn.RemoteAddr())
+		reply(554, "Access denied")
+		return
+	}
+
+	if !reply(220, hostname+" ESMTP ready") {
+		return
+	}
+
+	session := &smtpSession{}
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(smtpIdleTimeout))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		verb, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			reply(250, hostname)
+		case "EHLO":
+			_ = tp.PrintfLine("250-%s", hostname)
+			_ = tp.PrintfLine("250-SIZE %d", MaxMessageSize)
+			reply(250, "8BITMIME")
+		case "MAIL":
+			if _, ok := pathArgument(arg, "FROM:"); !ok {
+				reply(501, "Syntax: MAIL FROM:<address>")
+				continue
+			}
+			session = &smtpSession{started: true}
+			reply(250, "OK")
+		case "RCPT":
+			address, ok := pathArgument(arg, "TO:")
+			switch {
+			case !ok:
+				reply(501, "Syntax: RCPT TO:<address>")
+			case !session.started:
+				reply(503, "Need MAIL first")
+			case len(session.recipients) >= smtpMaxRecipients:
+				reply(452, "Too many recipients")
+			case !s.Processor.AcceptsRecipient(address):
+				reply(550, "No such mailbox here")
+			default:
+				session.recipients = append(session.recipients, address)
+				reply(250, "OK")
+			}
+		case "DATA":
+			if len(session.recipients) == 0 {
+				reply(503, "Need RCPT first")
+				continue
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+
+			_ = conn.SetReadDeadline(time.Now().Add(smtpIdleTimeout))
+			data := tp.DotReader()
+			raw, err := io.ReadAll(io.LimitReader(data, MaxMessageSize+1))
+			if err != nil {
+				return
+			}
+			if len(raw) > MaxMessageSize {
+				// Drain the rest so the connection stays usable
+				_, _ = io.Copy(io.Discard, data)
+				reply(552, "Message too large")
+				session = &smtpSession{}
+				continue
+			}
+
+			code, message := s.deliver(ctx, raw, session.recipients)
+			reply(code, message)
+			session = &smtpSession{}
+		case "RSET":
+			session = &smtpSession{}
+			reply(250, "OK")
+		case "NOOP":
+			reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			reply(502, "Command not implemented")
+		}
+	}
+}
+
+// deliver processes a message and maps the outcome to an SMTP reply
+func (s *SMTPServer) deliver(ctx context.Context, raw []byte, recipients []string) (int, string) {
+	result, err := s.Processor.Process(ctx, raw, recipients)
+	switch {
+	case err == nil:
+		return 250, "OK " + result.Action
+	case errors.Is(err, ErrUnknownRecipient):
+		return 550, "No such mailbox here"
+	case errors.Is(err, ErrNotAuthorized), errors.Is(err, ErrUnauthenticated):
+		return 550, "Sender not allowed to post here"
+	case errors.Is(err, ErrEmptyMessage):
+		return 554, "Message has no content"
+	default:
+		log.Printf("Inbound SMTP failed to process message: %v", err)
+		return 451, "Temporary failure, try again later"
+	}
+}
+
+// pathArgument extracts the address from "FROM:<a@b>" / "TO:<a@b>", ignoring ESMTP parameters
+func pathArgument(arg, prefix string) (string, bool) {
+	if !strings.HasPrefix(strings.ToUpper(arg), prefix) {
+		return "", false
+	}
+	path := strings.TrimSpace(arg[len(prefix):])
+	if i := strings.Index(path, ">"); i >= 0 {
+		path = path[:i+1]
+	}
+	path = strings.Trim(path, "<>")
+	return path, true
+}
@@ -0,0 +1,51 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestSMTPRefusesPeersOutsideAllowedNets(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	_, private, _ := net.ParseCIDR("10.0.0.0/8")
+
+	tests := []struct {
+		name  string
+		nets  []*net.IPNet
+		reply string
+	}{
+		{name: "allowed relay", nets: []*net.IPNet{loopback}, reply: "220 "},
+		{name: "other peer", nets: []*net.IPNet{private}, reply: "554 "},
+		{name: "no nets configured", reply: "554 "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &SMTPServer{Processor: &Processor{domain: "tasks.example.com"}, AllowedNets: tt.nets}
+			listener, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer listener.Close()
+			go func() {
+				accepted, err := listener.Accept()
+				if err == nil {
+					server.serve(context.Background(), accepted)
+				}
+			}()
+
+			peer, err := net.Dial("tcp", listener.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer peer.Close()
+			greeting, err := bufio.NewReader(peer).ReadString('\n')
+			if err != nil || !strings.HasPrefix(greeting, tt.reply) {
+				t.Errorf("greeting = %q, %v; want %q", greeting, err, tt.reply)
+			}
+		})
+	}
+}
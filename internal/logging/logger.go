@@ -8,6 +8,8 @@ import (
 	"path/filepath"
 	"time"
 
+	"sudo/internal/config"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -26,6 +28,9 @@ type AppLogger struct {
 	errorLogger *log.Logger
 	debugLogger *log.Logger
 	warnLogger  *log.Logger
+	debug       bool
+
+	infoFile, errorFile, debugFile io.Writer
 }
 
 // NewAppLogger creates a new application logger
@@ -66,25 +71,36 @@ func NewAppLogger() *AppLogger {
 		debugFile = os.Stdout
 	}
 
+	l := &AppLogger{infoFile: infoFile, errorFile: errorFile, debugFile: debugFile}
+	l.setMode(false, true)
+	return l
+}
+
+// Configure switches the shared logger to the configured environment: production logs
+// only to files and skips debug messages unless LOG_LEVEL is debug
+func Configure(cfg *config.Config) {
+	AppLog.setMode(cfg.Production(), cfg.LogLevel == "debug" || !cfg.Production())
+}
+
+func (l *AppLogger) setMode(production, debug bool) {
 	// Create multi-writers to write to both file and console in development
 	var infoWriter, errorWriter, debugWriter io.Writer
 
-	if os.Getenv("APP_ENV") == "production" {
-		infoWriter = infoFile
-		errorWriter = errorFile
-		debugWriter = debugFile
+	if production {
+		infoWriter = l.infoFile
+		errorWriter = l.errorFile
+		debugWriter = l.debugFile
 	} else {
-		infoWriter = io.MultiWriter(os.Stdout, infoFile)
-		errorWriter = io.MultiWriter(os.Stderr, errorFile)
-		debugWriter = io.MultiWriter(os.Stdout, debugFile)
+		infoWriter = io.MultiWriter(os.Stdout, l.infoFile)
+		errorWriter = io.MultiWriter(os.Stderr, l.errorFile)
+		debugWriter = io.MultiWriter(os.Stdout, l.debugFile)
 	}
 
-	return &AppLogger{
-		infoLogger:  log.New(infoWriter, "[INFO] ", log.LstdFlags|log.Lshortfile),
-		errorLogger: log.New(errorWriter, "[ERROR] ", log.LstdFlags|log.Lshortfile),
-		debugLogger: log.New(debugWriter, "[DEBUG] ", log.LstdFlags|log.Lshortfile),
-		warnLogger:  log.New(infoWriter, "[WARN] ", log.LstdFlags|log.Lshortfile),
-	}
+	l.infoLogger = log.New(infoWriter, "[INFO] ", log.LstdFlags|log.Lshortfile)
+	l.errorLogger = log.New(errorWriter, "[ERROR] ", log.LstdFlags|log.Lshortfile)
+	l.debugLogger = log.New(debugWriter, "[DEBUG] ", log.LstdFlags|log.Lshortfile)
+	l.warnLogger = log.New(infoWriter, "[WARN] ", log.LstdFlags|log.Lshortfile)
+	l.debug = debug
 }
 
 // Info logs info level messages
@@ -99,7 +115,7 @@ func (l *AppLogger) Error(format string, v ...interface{}) {
 
 // Debug logs debug level messages
 func (l *AppLogger) Debug(format string, v ...interface{}) {
-	if os.Getenv("LOG_LEVEL") == "debug" || os.Getenv("APP_ENV") != "production" {
+	if l.debug {
 		l.debugLogger.Printf(format, v...)
 	}
 }
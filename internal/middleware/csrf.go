@@ -1,7 +1,9 @@
 package middleware
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"net/http"
 
@@ -9,22 +11,31 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+type csrfContextKey struct{}
+
+// CSRFToken returns the session's CSRF token stored in the request context by CSRFMiddleware,
+// or an empty string outside of it. Templates use it to embed the token in the page.
+func CSRFToken(ctx context.Context) string {
+	token, _ := ctx.Value(csrfContextKey{}).(string)
+	return token
+}
+
 // CSRFMiddleware provides CSRF protection
 func CSRFMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		session := sessions.Default(c)
 
 		// Generate CSRF token if not exists
-		token := session.Get("csrf_token")
-		if token == nil {
+		tokenStr, _ := session.Get("csrf_token").(string)
+		if tokenStr == "" {
 			tokenBytes := make([]byte, 32)
 			if _, err := rand.Read(tokenBytes); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate CSRF token"})
 				c.Abort()
 				return
 			}
-			token = hex.EncodeToString(tokenBytes)
-			session.Set("csrf_token", token)
+			tokenStr = hex.EncodeToString(tokenBytes)
+			session.Set("csrf_token", tokenStr)
 			if err := session.Save(); err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
 				c.Abort()
@@ -32,36 +43,29 @@ func CSRFMiddleware() gin.HandlerFunc {
 			}
 		}
 
-		// For GET requests, just set the token and continue
-		if c.Request.Method == "GET" {
-			if tokenStr, ok := token.(string); ok {
-				c.Header("X-CSRF-Token", tokenStr)
-			}
+		// Make the token available to templates rendered for this request
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), csrfContextKey{}, tokenStr))
+
+		// Safe methods just expose the token and continue
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Header("X-CSRF-Token", tokenStr)
 			c.Next()
 			return
 		}
 
-		// For POST, PUT, DELETE requests, validate CSRF token
-		if c.Request.Method == "POST" || c.Request.Method == "PUT" || c.Request.Method == "DELETE" {
-			// Skip CSRF check for HTMX requests from the same origin
-			if c.GetHeader("HX-Request") == "true" {
-				c.Next()
-				return
-			}
-
-			requestToken := c.GetHeader("X-CSRF-Token")
-			if requestToken == "" {
-				requestToken = c.PostForm("csrf_token")
-			}
+		// Every state-changing request must echo the token, HTMX included
+		requestToken := c.GetHeader("X-CSRF-Token")
+		if requestToken == "" {
+			requestToken = c.PostForm("csrf_token")
+		}
 
-			tokenStr, ok := token.(string)
-			if !ok || requestToken != tokenStr {
-				c.JSON(http.StatusForbidden, gin.H{
-					"error": "CSRF token mismatch",
-				})
-				c.Abort()
-				return
-			}
+		if subtle.ConstantTimeCompare([]byte(requestToken), []byte(tokenStr)) != 1 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error": "CSRF token mismatch",
+			})
+			c.Abort()
+			return
 		}
 
 		c.Next()
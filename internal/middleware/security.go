@@ -9,32 +9,39 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter stores rate limiting information for IP addresses
+// RateLimiter stores rate limiting information per key (client IP or hashed identifier)
 type RateLimiter struct {
-	requests map[string][]time.Time
-	mutex    sync.RWMutex
-	limit    int
-	window   time.Duration
+	requests    map[string][]time.Time
+	mutex       sync.RWMutex
+	limit       int
+	window      time.Duration
+	lastCleanup time.Time
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
 	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
+		requests:    make(map[string][]time.Time),
+		limit:       limit,
+		window:      window,
+		lastCleanup: time.Now(),
 	}
 }
 
-// Allow checks if a request from the given IP should be allowed
-func (rl *RateLimiter) Allow(ip string) bool {
+// Allow checks if a request for the given key should be allowed
+func (rl *RateLimiter) Allow(key string) bool {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
 	now := time.Now()
 
-	// Get existing requests for this IP
-	requests := rl.requests[ip]
+	// Periodically drop keys with no recent requests so the map cannot grow forever
+	if now.Sub(rl.lastCleanup) >= rl.window {
+		rl.cleanup(now)
+	}
+
+	// Get existing requests for this key
+	requests := rl.requests[key]
 
 	// Filter out requests outside the time window
 	var validRequests []time.Time
@@ -46,16 +53,27 @@ func (rl *RateLimiter) Allow(ip string) bool {
 
 	// Check if we're at the limit
 	if len(validRequests) >= rl.limit {
+		rl.requests[key] = validRequests
 		return false
 	}
 
 	// Add current request
 	validRequests = append(validRequests, now)
-	rl.requests[ip] = validRequests
+	rl.requests[key] = validRequests
 
 	return true
 }
 
+// cleanup removes keys whose most recent request is outside the window. Caller holds the lock.
+func (rl *RateLimiter) cleanup(now time.Time) {
+	for key, requests := range rl.requests {
+		if len(requests) == 0 || now.Sub(requests[len(requests)-1]) >= rl.window {
+			delete(rl.requests, key)
+		}
+	}
+	rl.lastCleanup = now
+}
+
 // RateLimitMiddleware creates a rate limiting middleware
 func RateLimitMiddleware(limit int, window time.Duration) gin.HandlerFunc {
 	limiter := NewRateLimiter(limit, window)
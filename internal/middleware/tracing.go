@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+)
+
+// TracingMiddleware starts a server span for every request, named after the route
+// pattern. A traceparent header from a proxy or the browser continues its trace.
+// Static files and health probes are not traced.
+func TracingMiddleware(service string) gin.HandlerFunc {
+	return otelgin.Middleware(service, otelgin.WithFilter(func(r *http.Request) bool {
+		path := r.URL.Path
+		return !strings.HasPrefix(path, "/static/") && path != "/favicon.ico" &&
+			path != "/livez" && path != "/readyz" && path != "/health"
+	}))
+}
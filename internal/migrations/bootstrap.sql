@@ -0,0 +1,22 @@
+--------------------------------------------------------------------
+-- SCHEMA MIGRATIONS BOOTSTRAP
+-- Description: Run once before the first `go run cmd/migrate/main.go up`,
+--              either with `go run cmd/migrate/main.go bootstrap` or in the
+--              Supabase SQL editor. cmd/migrate applies each migration and
+--              records its version in one transaction over DATABASE_URL; the
+--              server only reads the table through PostgREST. Safe to run again.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version    INTEGER PRIMARY KEY CHECK (version > 0),
+    name       TEXT NOT NULL CHECK (length(name) BETWEEN 1 AND 100),
+    checksum   TEXT NOT NULL,                                  -- SHA-256 of the up script
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- Only the service role reads the table
+ALTER TABLE schema_migrations ENABLE ROW LEVEL SECURITY;
+
+-- Migrations used to be applied through this function over PostgREST. It ran any
+-- SQL it was given as its owner, so it is gone; cmd/migrate connects directly.
+DROP FUNCTION IF EXISTS public.apply_migration(INTEGER, TEXT, TEXT, TEXT, BOOLEAN);
@@ -0,0 +1,336 @@
+// Package migrations holds the numbered schema migrations and applies them in order.
+//
+// Each migration is a pair of files in sql/ named NNNN_name.up.sql and
+// NNNN_name.down.sql. Versions start at 1 and have no gaps. Applied versions are
+// recorded in the schema_migrations table created by bootstrap.sql.
+package migrations
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// Bootstrap creates the schema_migrations table. It has to run once before the first
+// migration.
+//
+//go:embed bootstrap.sql
+var Bootstrap string
+
+// ErrNotBootstrapped means the database has no schema_migrations table yet
+var ErrNotBootstrapped = errors.New("schema_migrations is missing; run `go run cmd/migrate/main.go bootstrap` first")
+
+var fileName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Checksum identifies the up script, so edits to applied migrations can be spotted
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Applied is a row of schema_migrations
+type Applied struct {
+	Version   int       `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Reader reads the recorded schema version
+type Reader interface {
+	AppliedMigrations(ctx context.Context) ([]Applied, error)
+}
+
+// Store reads and changes the recorded schema version
+type Store interface {
+	Reader
+	// ApplyMigration runs sql and records (up) or forgets (down) the version in
+	// one transaction. An empty sql only updates the record.
+	ApplyMigration(ctx context.Context, version int, name, checksum, sql string, up bool) error
+}
+
+// ErrReadOnly is returned when a read-only store is asked to apply a migration
+var ErrReadOnly = errors.New("migrations are applied by cmd/migrate over DATABASE_URL")
+
+// ReadOnly lets a Reader back a Runner that only reports Status and runs Check
+func ReadOnly(r Reader) Store { return readOnly{r} }
+
+type readOnly struct{ Reader }
+
+func (readOnly) ApplyMigration(ctx context.Context, version int, name, checksum, sql string, up bool) error {
+	return ErrReadOnly
+}
+
+// All returns the embedded migrations in version order
+func All() ([]Migration, error) {
+	sub, err := fs.Sub(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+	return Load(sub)
+}
+
+// Load reads migrations from the root of fsys
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		match := fileName.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			return nil, fmt.Errorf("unexpected file %s in migrations", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %04d has two names: %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %04d is missing", i+1)
+		}
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down script", m)
+		}
+	}
+	return migrations, nil
+}
+
+// Status is the state of one migration in a database
+type Status struct {
+	Migration
+	Applied *Applied
+	// Modified means the up script changed after it was applied
+	Modified bool
+	// Unknown means the database has a version this build does not ship
+	Unknown bool
+}
+
+// Runner applies migrations to a store
+type Runner struct {
+	store      Store
+	migrations []Migration
+}
+
+func NewRunner(store Store, migrations []Migration) *Runner {
+	return &Runner{store: store, migrations: migrations}
+}
+
+// Latest is the newest version the runner knows about
+func (r *Runner) Latest() int {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+// Status lists every known migration plus any applied version this build lacks
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.store.AppliedMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]Applied, len(applied))
+	for _, a := range applied {
+		byVersion[a.Version] = a
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := Status{Migration: m}
+		if a, ok := byVersion[m.Version]; ok {
+			status.Applied = &a
+			status.Modified = a.Checksum != m.Checksum()
+			delete(byVersion, m.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for _, a := range applied {
+		if _, ok := byVersion[a.Version]; ok {
+			a := a
+			statuses = append(statuses, Status{Migration: Migration{Version: a.Version, Name: a.Name}, Applied: &a, Unknown: true})
+		}
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations newer than the latest applied version
+func (r *Runner) Pending(ctx context.Context) ([]Migration, error) {
+	current, err := r.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for _, m := range r.migrations {
+		if m.Version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations up to and including target, or all of them when
+// target is 0. It stops at the first failure; earlier migrations stay applied.
+func (r *Runner) Up(ctx context.Context, target int) ([]Migration, error) {
+	return r.forward(ctx, target, true)
+}
+
+// Baseline records the migrations up to target as applied without running them, for
+// databases that were set up from the old database.sql script. That script created
+// what 0001 and 0002 create, so such databases are baselined at 2; a higher target
+// would skip migrations whose objects do not exist.
+func (r *Runner) Baseline(ctx context.Context, target int) ([]Migration, error) {
+	if target < 1 || target > r.Latest() {
+		return nil, fmt.Errorf("baseline version must be between 1 and %d", r.Latest())
+	}
+	return r.forward(ctx, target, false)
+}
+
+func (r *Runner) forward(ctx context.Context, target int, run bool) ([]Migration, error) {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if target > 0 && m.Version > target {
+			break
+		}
+		sql := ""
+		if run {
+			sql = m.Up
+		}
+		if err := r.store.ApplyMigration(ctx, m.Version, m.Name, m.Checksum(), sql, true); err != nil {
+			return done, fmt.Errorf("failed to apply %s: %w", m, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down reverts the latest steps migrations, newest first
+func (r *Runner) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var done []Migration
+	for i := 0; i < steps; i++ {
+		current, err := r.current(ctx)
+		if err != nil {
+			return done, err
+		}
+		if current == 0 {
+			break
+		}
+		m, ok := r.find(current)
+		if !ok {
+			return done, fmt.Errorf("applied migration %04d is not part of this build; revert it with the build that added it", current)
+		}
+		if err := r.store.ApplyMigration(ctx, m.Version, m.Name, m.Checksum(), m.Down, false); err != nil {
+			return done, fmt.Errorf("failed to revert %s: %w", m, err)
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Redo reverts the latest migration and applies it again
+func (r *Runner) Redo(ctx context.Context) (*Migration, error) {
+	reverted, err := r.Down(ctx, 1)
+	if err != nil {
+		return nil, err
+	}
+	if len(reverted) == 0 {
+		return nil, errors.New("no migration has been applied")
+	}
+	m := reverted[0]
+	if err := r.store.ApplyMigration(ctx, m.Version, m.Name, m.Checksum(), m.Up, true); err != nil {
+		return nil, fmt.Errorf("failed to reapply %s: %w", m, err)
+	}
+	return &m, nil
+}
+
+// Check fails when the database is missing migrations that this build ships. A
+// database that is ahead of the build is accepted so that older instances keep
+// running while a rolling deploy finishes.
+func (r *Runner) Check(ctx context.Context) error {
+	pending, err := r.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is at version %d but this build needs %d (%d pending, starting with %s)",
+			pending[0].Version-1, r.Latest(), len(pending), pending[0])
+	}
+	return nil
+}
+
+func (r *Runner) current(ctx context.Context) (int, error) {
+	applied, err := r.store.AppliedMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for _, a := range applied {
+		if a.Version > current {
+			current = a.Version
+		}
+	}
+	return current, nil
+}
+
+func (r *Runner) find(version int) (Migration, bool) {
+	for _, m := range r.migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
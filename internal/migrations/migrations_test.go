@@ -0,0 +1,186 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// fakeStore applies migrations the way apply_migration does and logs the scripts it ran
+type fakeStore struct {
+	applied []Applied
+	ran     []string
+	failOn  string
+}
+
+func (s *fakeStore) AppliedMigrations(ctx context.Context) ([]Applied, error) {
+	return append([]Applied(nil), s.applied...), nil
+}
+
+func (s *fakeStore) ApplyMigration(ctx context.Context, version int, name, checksum, sql string, up bool) error {
+	if sql != "" && sql == s.failOn {
+		return errors.New("syntax error")
+	}
+	latest := 0
+	if len(s.applied) > 0 {
+		latest = s.applied[len(s.applied)-1].Version
+	}
+	if up && version <= latest || !up && version != latest {
+		return errors.New("out of order")
+	}
+	if sql != "" {
+		s.ran = append(s.ran, sql)
+	}
+	if up {
+		s.applied = append(s.applied, Applied{Version: version, Name: name, Checksum: checksum, AppliedAt: time.Now()})
+	} else {
+		s.applied = s.applied[:len(s.applied)-1]
+	}
+	return nil
+}
+
+func testMigrations(t *testing.T) []Migration {
+	t.Helper()
+	all, err := Load(fstest.MapFS{
+		"0001_users.up.sql":     {Data: []byte("create users")},
+		"0001_users.down.sql":   {Data: []byte("drop users")},
+		"0002_boards.up.sql":    {Data: []byte("create boards")},
+		"0002_boards.down.sql":  {Data: []byte("drop boards")},
+		"0003_columns.up.sql":   {Data: []byte("create columns")},
+		"0003_columns.down.sql": {Data: []byte("drop columns")},
+	})
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return all
+}
+
+func TestEmbeddedMigrationsLoad(t *testing.T) {
+	all, err := All()
+	if err != nil {
+		t.Fatalf("All failed: %v", err)
+	}
+	if len(all) == 0 || all[0].Name != "initial_schema" {
+		t.Fatalf("unexpected migrations: %v", all)
+	}
+	if !strings.Contains(Bootstrap, "apply_migration") {
+		t.Error("bootstrap should define apply_migration")
+	}
+}
+
+func TestLoadRejectsBrokenSets(t *testing.T) {
+	for name, files := range map[string]fstest.MapFS{
+		"gap": {
+			"0001_a.up.sql": {Data: []byte("x")}, "0001_a.down.sql": {Data: []byte("x")},
+			"0003_c.up.sql": {Data: []byte("x")}, "0003_c.down.sql": {Data: []byte("x")},
+		},
+		"missing down": {"0001_a.up.sql": {Data: []byte("x")}},
+		"bad name":     {"1_a.up.sql": {Data: []byte("x")}},
+		"two names": {
+			"0001_a.up.sql": {Data: []byte("x")}, "0001_b.down.sql": {Data: []byte("x")},
+		},
+	} {
+		if _, err := Load(files); err == nil {
+			t.Errorf("%s: Load should fail", name)
+		}
+	}
+}
+
+func TestUpDownRedo(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+	runner := NewRunner(store, testMigrations(t))
+
+	if err := runner.Check(ctx); err == nil {
+		t.Error("Check should fail on an empty database")
+	}
+	if done, err := runner.Up(ctx, 2); err != nil || len(done) != 2 {
+		t.Fatalf("Up(2) = %v, %v", done, err)
+	}
+	if done, err := runner.Up(ctx, 0); err != nil || len(done) != 1 || done[0].Version != 3 {
+		t.Fatalf("Up(0) = %v, %v", done, err)
+	}
+	if err := runner.Check(ctx); err != nil {
+		t.Errorf("Check after up: %v", err)
+	}
+
+	if _, err := runner.Redo(ctx); err != nil {
+		t.Fatalf("Redo failed: %v", err)
+	}
+	if done, err := runner.Down(ctx, 2); err != nil || len(done) != 2 || done[0].Version != 3 {
+		t.Fatalf("Down(2) = %v, %v", done, err)
+	}
+
+	want := "create users,create boards,create columns,drop columns,create columns,drop columns,drop boards"
+	if got := strings.Join(store.ran, ","); got != want {
+		t.Errorf("ran %s\nwant %s", got, want)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	store := &fakeStore{failOn: "create boards"}
+	runner := NewRunner(store, testMigrations(t))
+
+	done, err := runner.Up(context.Background(), 0)
+	if err == nil || len(done) != 1 || len(store.applied) != 1 {
+		t.Errorf("Up = %v, %v with %d applied", done, err, len(store.applied))
+	}
+}
+
+func TestBaselineAndStatus(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+	all := testMigrations(t)
+	runner := NewRunner(store, all)
+
+	if _, err := runner.Baseline(ctx, 2); err != nil {
+		t.Fatalf("Baseline failed: %v", err)
+	}
+	if len(store.ran) != 0 {
+		t.Errorf("baseline ran scripts: %v", store.ran)
+	}
+
+	store.applied[0].Checksum = "edited"
+	store.applied = append(store.applied, Applied{Version: 9, Name: "future"})
+	statuses, err := runner.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(statuses) != 4 || !statuses[0].Modified || statuses[1].Modified || statuses[2].Applied != nil || !statuses[3].Unknown {
+		t.Errorf("unexpected status: %+v", statuses)
+	}
+
+	// A database ahead of the build is fine; one behind it is not
+	if err := runner.Check(ctx); err != nil {
+		t.Errorf("Check with a newer database: %v", err)
+	}
+	if _, err := NewRunner(store, all[:1]).Down(ctx, 1); err == nil {
+		t.Error("Down should refuse to revert a migration it does not have")
+	}
+}
+
+func TestReadOnlyRunner(t *testing.T) {
+	ctx := context.Background()
+	store := &fakeStore{}
+	all := testMigrations(t)
+	if _, err := NewRunner(store, all).Up(ctx, 1); err != nil {
+		t.Fatalf("Up failed: %v", err)
+	}
+
+	runner := NewRunner(ReadOnly(store), all)
+	if err := runner.Check(ctx); err == nil || !strings.Contains(err.Error(), "2 pending") {
+		t.Errorf("Check = %v, want 2 pending", err)
+	}
+	if _, err := runner.Up(ctx, 0); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Up = %v, want ErrReadOnly", err)
+	}
+	if _, err := runner.Down(ctx, 1); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Down = %v, want ErrReadOnly", err)
+	}
+	if len(store.applied) != 1 {
+		t.Errorf("a read-only runner changed the store: %+v", store.applied)
+	}
+}
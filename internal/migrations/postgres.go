@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PostgresStore applies migrations over a direct Postgres connection. Migrations run
+// DDL, so they never go through PostgREST, where any holder of the service key could
+// run arbitrary SQL.
+type PostgresStore struct {
+	conn *pgx.Conn
+}
+
+// ConnectPostgres opens a connection to databaseURL, a postgres:// URL of a role that
+// owns the schema (on Supabase, the direct connection string of the postgres user)
+func ConnectPostgres(ctx context.Context, databaseURL string) (*PostgresStore, error) {
+	conn, err := pgx.Connect(ctx, databaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Postgres: %w", err)
+	}
+	return &PostgresStore{conn: conn}, nil
+}
+
+func (s *PostgresStore) Close(ctx context.Context) error {
+	return s.conn.Close(ctx)
+}
+
+// Bootstrap runs bootstrap.sql
+func (s *PostgresStore) Bootstrap(ctx context.Context) error {
+	if _, err := s.conn.Exec(ctx, Bootstrap); err != nil {
+		return fmt.Errorf("failed to bootstrap: %w", err)
+	}
+	return nil
+}
+
+func (s *PostgresStore) AppliedMigrations(ctx context.Context) ([]Applied, error) {
+	rows, err := s.conn.Query(ctx, "SELECT version, name, checksum, applied_at FROM schema_migrations ORDER BY version")
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return nil, ErrNotBootstrapped
+		}
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (Applied, error) {
+		var a Applied
+		err := row.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt)
+		return a, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// ApplyMigration runs sql and records the version in one transaction. Versions are
+// applied in order and only the latest one can be reverted.
+func (s *PostgresStore) ApplyMigration(ctx context.Context, version int, name, checksum, sql string, up bool) error {
+	return pgx.BeginFunc(ctx, s.conn, func(tx pgx.Tx) error {
+		// Concurrent runners wait for each other instead of interleaving
+		if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('schema_migrations'))"); err != nil {
+			return err
+		}
+
+		var latest *int
+		if err := tx.QueryRow(ctx, "SELECT max(version) FROM schema_migrations").Scan(&latest); err != nil {
+			return err
+		}
+		switch {
+		case up && latest != nil && version <= *latest:
+			return fmt.Errorf("migration %d is not newer than the applied version %d", version, *latest)
+		case !up && (latest == nil || *latest != version):
+			return fmt.Errorf("migration %d is not the latest applied migration", version)
+		}
+
+		if sql != "" {
+			// Without arguments pgx uses the simple protocol, which runs every statement
+			// in the script
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if up {
+			_, err = tx.Exec(ctx, "INSERT INTO schema_migrations (version, name, checksum) VALUES ($1, $2, $3)",
+				version, name, checksum)
+		} else {
+			_, err = tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", version)
+		}
+		if err != nil {
+			return err
+		}
+
+		// Let PostgREST pick up new tables and functions right away
+		_, err = tx.Exec(ctx, "NOTIFY pgrst, 'reload schema'")
+		return err
+	})
+}
@@ -0,0 +1,20 @@
+-- Drops the base schema and everything in it. The extensions stay installed.
+DROP VIEW IF EXISTS user_board_permissions;
+DROP VIEW IF EXISTS pending_approvals_summary;
+
+DROP TABLE IF EXISTS
+    comments, activity_log, user_presence, realtime_sessions, approval_notifications,
+    proposed_edits, tasks, columns, board_members, boards, otp_tokens, users
+    CASCADE;
+
+DROP FUNCTION IF EXISTS public.maintenance_cleanup();
+DROP FUNCTION IF EXISTS create_approval_notifications();
+DROP FUNCTION IF EXISTS ensure_board_owner_membership();
+DROP FUNCTION IF EXISTS update_updated_at();
+DROP FUNCTION IF EXISTS public.cleanup_expired_edits();
+DROP FUNCTION IF EXISTS public.apply_proposed_edit(UUID);
+DROP FUNCTION IF EXISTS public.get_user_board_role(UUID, UUID);
+DROP FUNCTION IF EXISTS public.user_can_manage_member(UUID, UUID, TEXT);
+DROP FUNCTION IF EXISTS public.user_can_approve_edits(UUID, UUID);
+DROP FUNCTION IF EXISTS public.user_can_modify_directly(UUID, UUID);
+DROP FUNCTION IF EXISTS public.user_has_board_access(UUID, UUID);
@@ -875,209 +875,3 @@ WHERE b.archived = FALSE
     )
   )
 ORDER BY b.title, role DESC;
-
-
---------------------------------------------------------------------
--- 13. MULTIPLE TASK ASSIGNEES FEATURE
--- Date: 2025-01-15
--- Description: Adds support for multiple assignees per task with individual completion status
---------------------------------------------------------------------
-
--- Create the task_assignees junction table
-CREATE TABLE IF NOT EXISTS task_assignees (
-    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
-    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
-    completed BOOLEAN NOT NULL DEFAULT false,
-    completed_at TIMESTAMPTZ,
-    assigned_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    assigned_by UUID REFERENCES users(id) ON DELETE SET NULL,
-    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-    UNIQUE(task_id, user_id)
-);
-
--- Create indexes for performance
-CREATE INDEX IF NOT EXISTS idx_task_assignees_task_id ON task_assignees(task_id);
-CREATE INDEX IF NOT EXISTS idx_task_assignees_user_id ON task_assignees(user_id);
-CREATE INDEX IF NOT EXISTS idx_task_assignees_completed ON task_assignees(completed);
-CREATE INDEX IF NOT EXISTS idx_task_assignees_task_user ON task_assignees(task_id, user_id);
-
--- Enable RLS
-ALTER TABLE task_assignees ENABLE ROW LEVEL SECURITY;
-
--- RLS Policies (One policy per action to avoid multiple permissive policies warning)
-CREATE POLICY "task_assignees_select_policy"
-ON task_assignees FOR SELECT TO authenticated
-USING (
-    EXISTS (
-        SELECT 1 FROM tasks t
-        INNER JOIN boards b ON t.board_id = b.id
-        LEFT JOIN board_members bm ON b.id = bm.board_id
-        WHERE t.id = task_assignees.task_id
-        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
-    )
-);
-
-CREATE POLICY "task_assignees_insert_policy"
-ON task_assignees FOR INSERT TO authenticated
-WITH CHECK (
-    EXISTS (
-        SELECT 1 FROM tasks t
-        INNER JOIN boards b ON t.board_id = b.id
-        LEFT JOIN board_members bm ON b.id = bm.board_id
-        WHERE t.id = task_assignees.task_id
-        AND (
-            b.owner_id = (select auth.uid())
-            OR (bm.user_id = (select auth.uid()) AND bm.role IN ('owner', 'admin'))
-        )
-    )
-);
-
-CREATE POLICY "task_assignees_update_policy"
-ON task_assignees FOR UPDATE TO authenticated
-USING (
-    -- Assignees can update their own assignment OR owners/admins can update any
-    user_id = (select auth.uid())
-    OR EXISTS (
-        SELECT 1 FROM tasks t
-        INNER JOIN boards b ON t.board_id = b.id
-        LEFT JOIN board_members bm ON b.id = bm.board_id
-        WHERE t.id = task_assignees.task_id
-        AND (
-            b.owner_id = (select auth.uid())
-            OR (bm.user_id = (select auth.uid()) AND bm.role IN ('owner', 'admin'))
-        )
-    )
-)
-WITH CHECK (
-    -- Assignees can only update their own assignment OR owners/admins can update any
-    user_id = (select auth.uid())
-    OR EXISTS (
-        SELECT 1 FROM tasks t
-        INNER JOIN boards b ON t.board_id = b.id
-        LEFT JOIN board_members bm ON b.id = bm.board_id
-        WHERE t.id = task_assignees.task_id
-        AND (
-            b.owner_id = (select auth.uid())
-            OR (bm.user_id = (select auth.uid()) AND bm.role IN ('owner', 'admin'))
-        )
-    )
-);
-
-CREATE POLICY "task_assignees_delete_policy"
-ON task_assignees FOR DELETE TO authenticated
-USING (
-    EXISTS (
-        SELECT 1 FROM tasks t
-        INNER JOIN boards b ON t.board_id = b.id
-        LEFT JOIN board_members bm ON b.id = bm.board_id
-        WHERE t.id = task_assignees.task_id
-        AND (
-            b.owner_id = (select auth.uid())
-            OR (bm.user_id = (select auth.uid()) AND bm.role IN ('owner', 'admin'))
-        )
-    )
-);
-
--- Migrate existing task assignments
-INSERT INTO task_assignees (task_id, user_id, completed, completed_at, assigned_at)
-SELECT
-    t.id as task_id,
-    t.assigned_to as user_id,
-    t.completed,
-    t.completed_at,
-    t.created_at as assigned_at
-FROM tasks t
-WHERE t.assigned_to IS NOT NULL
-ON CONFLICT (task_id, user_id) DO NOTHING;
-
--- Function to automatically update task completion status
-CREATE OR REPLACE FUNCTION update_task_completion_status()
-RETURNS TRIGGER
-LANGUAGE plpgsql
-SECURITY DEFINER
-SET search_path = ''
-AS $$
-BEGIN
-    UPDATE public.tasks
-    SET
-        completed = (
-            SELECT COUNT(*) = COUNT(*) FILTER (WHERE completed = true)
-            FROM public.task_assignees
-            WHERE task_id = COALESCE(NEW.task_id, OLD.task_id)
-            HAVING COUNT(*) > 0
-        ),
-        completed_at = CASE
-            WHEN (
-                SELECT COUNT(*) = COUNT(*) FILTER (WHERE completed = true)
-                FROM public.task_assignees
-                WHERE task_id = COALESCE(NEW.task_id, OLD.task_id)
-            ) THEN NOW()
-            ELSE NULL
-        END,
-        updated_at = NOW()
-    WHERE id = COALESCE(NEW.task_id, OLD.task_id);
-
-    RETURN COALESCE(NEW, OLD);
-END;
-$$;
-
--- Trigger to auto-update task completion
-DROP TRIGGER IF EXISTS trigger_update_task_completion ON task_assignees;
-CREATE TRIGGER trigger_update_task_completion
-AFTER INSERT OR UPDATE OR DELETE ON task_assignees
-FOR EACH ROW
-EXECUTE FUNCTION update_task_completion_status();
-
--- Helper functions
-CREATE OR REPLACE FUNCTION get_task_assignees_count(task_uuid UUID)
-RETURNS INTEGER
-LANGUAGE plpgsql
-SECURITY DEFINER
-SET search_path = ''
-AS $$
-BEGIN
-    RETURN (SELECT COUNT(*) FROM task_assignees WHERE task_id = task_uuid);
-END;
-$$;
-
-CREATE OR REPLACE FUNCTION get_completed_assignees_count(task_uuid UUID)
-RETURNS INTEGER
-LANGUAGE plpgsql
-SECURITY DEFINER
-SET search_path = ''
-AS $$
-BEGIN
-    RETURN (SELECT COUNT(*) FROM task_assignees WHERE task_id = task_uuid AND completed = true);
-END;
-$$;
-
--- View for easy querying
-CREATE OR REPLACE VIEW task_assignees_with_users
-WITH (security_invoker = on, security_barrier = true) AS
-SELECT
-    ta.id,
-    ta.task_id,
-    ta.user_id,
-    ta.completed,
-    ta.completed_at,
-    ta.assigned_at,
-    ta.assigned_by,
-    u.name as user_name,
-    u.email as user_email,
-    u.avatar_url as user_avatar,
-    t.title as task_title,
-    t.board_id
-FROM task_assignees ta
-INNER JOIN users u ON ta.user_id = u.id
-INNER JOIN tasks t ON ta.task_id = t.id;
-
--- Add comments to deprecated columns
-COMMENT ON COLUMN tasks.assigned_to IS 'DEPRECATED: Use task_assignees table instead. Kept for backward compatibility.';
-COMMENT ON COLUMN tasks.completed IS 'Auto-updated based on task_assignees completion status';
-
--- Trigger for updated_at
-CREATE TRIGGER trg_task_assignees_updated_at
-    BEFORE UPDATE ON task_assignees
-    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
\ No newline at end of file
@@ -0,0 +1,19 @@
+-- Keep the earliest assignee of each task on the legacy column
+UPDATE tasks t
+SET assigned_to = first.user_id
+FROM (
+    SELECT DISTINCT ON (task_id) task_id, user_id
+    FROM task_assignees
+    ORDER BY task_id, assigned_at
+) first
+WHERE t.id = first.task_id AND t.assigned_to IS NULL;
+
+DROP VIEW IF EXISTS task_assignees_with_users;
+DROP TABLE IF EXISTS task_assignees;
+
+DROP FUNCTION IF EXISTS get_completed_assignees_count(UUID);
+DROP FUNCTION IF EXISTS get_task_assignees_count(UUID);
+DROP FUNCTION IF EXISTS update_task_completion_status();
+
+COMMENT ON COLUMN tasks.assigned_to IS NULL;
+COMMENT ON COLUMN tasks.completed IS NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS otp_lockouts;
+DROP INDEX IF EXISTS idx_otp_tokens_email_active;
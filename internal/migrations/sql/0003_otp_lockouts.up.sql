@@ -0,0 +1,26 @@
+--------------------------------------------------------------------
+-- OTP BRUTE-FORCE PROTECTION
+-- Date: 2025-02-03
+-- Description: Per-email failed attempt counters, exponential lockouts and resend cooldowns
+--------------------------------------------------------------------
+
+-- One row per (encrypted) email address; only the service role touches this table
+CREATE TABLE IF NOT EXISTS otp_lockouts (
+    email           TEXT PRIMARY KEY
+        CHECK (length(email) > 0 AND length(email) <= 500),  -- Encrypted email, same as otp_tokens.email
+    failed_attempts INTEGER NOT NULL DEFAULT 0 CHECK (failed_attempts >= 0),
+    lockout_count   INTEGER NOT NULL DEFAULT 0 CHECK (lockout_count >= 0),
+    locked_until    TIMESTAMPTZ,
+    last_sent_at    TIMESTAMPTZ,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_otp_lockouts_locked_until ON otp_lockouts(locked_until);
+CREATE INDEX IF NOT EXISTS idx_otp_tokens_email_active ON otp_tokens(email) WHERE used = false;
+
+ALTER TABLE otp_lockouts ENABLE ROW LEVEL SECURITY;
+
+CREATE TRIGGER trg_otp_lockouts_updated_at
+    BEFORE UPDATE ON otp_lockouts
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
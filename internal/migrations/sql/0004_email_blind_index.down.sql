@@ -0,0 +1,13 @@
+-- Emails written since the upgrade use randomized encryption and can only be found
+-- through the blind index, so those users cannot sign in again after this runs.
+DROP POLICY IF EXISTS "Users manage own OTP tokens" ON otp_tokens;
+CREATE POLICY "Users manage own OTP tokens"
+    ON otp_tokens FOR ALL TO authenticated USING (
+        email IN (SELECT email FROM users WHERE id = (select auth.uid()))
+    );
+
+DELETE FROM otp_lockouts;
+ALTER TABLE otp_lockouts RENAME COLUMN email_hash TO email;
+
+ALTER TABLE otp_tokens DROP COLUMN IF EXISTS email_hash;
+ALTER TABLE users DROP COLUMN IF EXISTS email_hash;
@@ -0,0 +1,33 @@
+--------------------------------------------------------------------
+-- EMAIL BLIND INDEX
+-- Date: 2025-02-10
+-- Description: Emails are now encrypted with randomized AES-GCM and looked up through an
+--              HMAC blind index. Existing rows keep working and are upgraded on next login
+--              or in bulk with `go run cmd/keygen/main.go rotate`.
+--------------------------------------------------------------------
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_hash TEXT
+    CHECK (email_hash IS NULL OR length(email_hash) BETWEEN 1 AND 100);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_hash ON users(email_hash);
+
+ALTER TABLE otp_tokens ADD COLUMN IF NOT EXISTS email_hash TEXT
+    CHECK (email_hash IS NULL OR length(email_hash) BETWEEN 1 AND 100);
+CREATE INDEX IF NOT EXISTS idx_otp_tokens_email_hash ON otp_tokens(email_hash) WHERE used = false;
+
+-- Lockouts are short-lived counters, so they are reset and re-keyed by blind index
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_name = 'otp_lockouts' AND column_name = 'email') THEN
+        DELETE FROM otp_lockouts;
+        ALTER TABLE otp_lockouts RENAME COLUMN email TO email_hash;
+    END IF;
+END;
+$$;
+
+-- Ciphertexts are no longer comparable between tables; match OTPs on the blind index
+DROP POLICY IF EXISTS "Users manage own OTP tokens" ON otp_tokens;
+CREATE POLICY "Users manage own OTP tokens"
+    ON otp_tokens FOR ALL TO authenticated USING (
+        email_hash IN (SELECT email_hash FROM users WHERE id = (select auth.uid()))
+    );
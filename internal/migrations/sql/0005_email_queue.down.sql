@@ -0,0 +1,2 @@
+-- Queued and dead-lettered emails are lost
+DROP TABLE IF EXISTS email_queue;
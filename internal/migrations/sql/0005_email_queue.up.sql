@@ -0,0 +1,35 @@
+--------------------------------------------------------------------
+-- EMAIL DELIVERY QUEUE
+-- Date: 2025-02-17
+-- Description: Outbound emails are queued and delivered by a background worker with
+--              exponential backoff. Sent rows are deleted; rows that keep failing stay
+--              behind as dead letters until an admin retries or discards them.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS email_queue (
+    id              UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    kind            TEXT NOT NULL CHECK (length(kind) BETWEEN 1 AND 50),   -- Template name
+    recipient       TEXT NOT NULL CHECK (length(recipient) <= 500),         -- Encrypted email
+    subject         TEXT NOT NULL CHECK (length(subject) <= 500),
+    payload         TEXT NOT NULL,                                          -- Encrypted HTML and text bodies
+    status          TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'sending', 'dead')),
+    attempts        INTEGER NOT NULL DEFAULT 0 CHECK (attempts >= 0),
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    locked_until    TIMESTAMPTZ,                                            -- Worker lease while sending
+    expires_at      TIMESTAMPTZ,                                            -- Drop instead of delivering late
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_queue_due ON email_queue(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_email_queue_leased ON email_queue(locked_until) WHERE status = 'sending';
+CREATE INDEX IF NOT EXISTS idx_email_queue_dead ON email_queue(updated_at DESC) WHERE status = 'dead';
+
+-- Only the service role touches the queue
+ALTER TABLE email_queue ENABLE ROW LEVEL SECURITY;
+
+CREATE TRIGGER trg_email_queue_updated_at
+    BEFORE UPDATE ON email_queue
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_boards_inbound_email_token;
+ALTER TABLE boards DROP COLUMN IF EXISTS inbound_email_token;
@@ -0,0 +1,13 @@
+--------------------------------------------------------------------
+-- INBOUND EMAIL
+-- Date: 2025-02-24
+-- Description: Each board gets a random address token (created the first time someone
+--              asks for the board's address). Mail to <token>@domain becomes a task and
+--              mail to <token>+<task id>@domain becomes a comment on that task.
+--------------------------------------------------------------------
+
+ALTER TABLE boards ADD COLUMN IF NOT EXISTS inbound_email_token TEXT
+    CHECK (inbound_email_token IS NULL OR length(inbound_email_token) BETWEEN 16 AND 64);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_boards_inbound_email_token
+    ON boards(inbound_email_token) WHERE inbound_email_token IS NOT NULL;
@@ -0,0 +1,14 @@
+DROP TABLE IF EXISTS task_dependencies;
+
+DELETE FROM activity_log
+WHERE action IN ('attachment_add','attachment_delete','dependency_add','dependency_remove');
+
+ALTER TABLE activity_log DROP CONSTRAINT IF EXISTS activity_log_action_check;
+ALTER TABLE activity_log ADD CONSTRAINT activity_log_action_check CHECK (action IN (
+    'task_create','task_update','task_move','task_delete','task_complete',
+    'column_create','column_update','column_delete','column_reorder',
+    'board_create','board_update','board_delete',
+    'member_invite','member_join','member_remove','member_role_change',
+    'comment_create','comment_update','comment_delete',
+    'edit_proposed','edit_approved','edit_rejected','edit_applied'
+));
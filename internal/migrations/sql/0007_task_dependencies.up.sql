@@ -0,0 +1,49 @@
+--------------------------------------------------------------------
+-- TASK DEPENDENCIES
+-- Date: 2025-03-03
+-- Description: Links between tasks, also across boards. "blocks" links must not form
+--              cycles (checked by the application); a blocked task cannot move into a
+--              done column unless the move is forced. The activity log also learns the
+--              attachment and dependency actions.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS task_dependencies (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    source_task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    target_task_id UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    type           TEXT NOT NULL CHECK (type IN ('blocks', 'relates_to', 'duplicates')),
+    created_by     UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (source_task_id <> target_task_id),
+    UNIQUE (source_task_id, target_task_id, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_dependencies_source ON task_dependencies(source_task_id, type);
+CREATE INDEX IF NOT EXISTS idx_task_dependencies_target ON task_dependencies(target_task_id, type);
+
+ALTER TABLE task_dependencies ENABLE ROW LEVEL SECURITY;
+
+-- Members can see links that touch a task on one of their boards
+CREATE POLICY "task_dependencies_select_policy"
+ON task_dependencies FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM tasks t
+        INNER JOIN boards b ON t.board_id = b.id
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE t.id IN (task_dependencies.source_task_id, task_dependencies.target_task_id)
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+ALTER TABLE activity_log DROP CONSTRAINT IF EXISTS activity_log_action_check;
+ALTER TABLE activity_log ADD CONSTRAINT activity_log_action_check CHECK (action IN (
+    'task_create','task_update','task_move','task_delete','task_complete',
+    'column_create','column_update','column_delete','column_reorder',
+    'board_create','board_update','board_delete',
+    'member_invite','member_join','member_remove','member_role_change',
+    'comment_create','comment_update','comment_delete',
+    'edit_proposed','edit_approved','edit_rejected','edit_applied',
+    'attachment_add','attachment_delete',
+    'dependency_add','dependency_remove'
+));
@@ -0,0 +1,3 @@
+-- Generated tasks stay; they just lose the link to their series
+ALTER TABLE tasks DROP COLUMN IF EXISTS recurrence_id;
+DROP TABLE IF EXISTS task_recurrences;
@@ -0,0 +1,47 @@
+--------------------------------------------------------------------
+-- RECURRING TASKS
+-- Date: 2025-03-10
+-- Description: A recurrence series generates the next task instance when the current one
+--              is completed, or when the next occurrence comes due. Instances point back
+--              at their series; deleting the series leaves the tasks in place.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS task_recurrences (
+    id                      UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    board_id                UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    rule                    TEXT NOT NULL CHECK (length(rule) BETWEEN 1 AND 500),  -- RRULE subset
+    starts_at               TIMESTAMPTZ NOT NULL,
+    deadline_offset_seconds BIGINT,                                                -- NULL: instances get no deadline
+    occurrences             INTEGER NOT NULL DEFAULT 1 CHECK (occurrences >= 0),
+    next_occurrence_at      TIMESTAMPTZ,
+    current_task_id         UUID REFERENCES tasks(id) ON DELETE SET NULL,
+    active                  BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by              UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at              TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at              TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_recurrences_due
+    ON task_recurrences(next_occurrence_at) WHERE active = true;
+CREATE INDEX IF NOT EXISTS idx_task_recurrences_board ON task_recurrences(board_id);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS recurrence_id UUID
+    REFERENCES task_recurrences(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_recurrence_id ON tasks(recurrence_id) WHERE recurrence_id IS NOT NULL;
+
+ALTER TABLE task_recurrences ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "task_recurrences_select_policy"
+ON task_recurrences FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM boards b
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE b.id = task_recurrences.board_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+CREATE TRIGGER trg_task_recurrences_updated_at
+    BEFORE UPDATE ON task_recurrences
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
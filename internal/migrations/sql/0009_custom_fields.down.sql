@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_tasks_custom_fields;
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_custom_fields_check;
+ALTER TABLE tasks DROP COLUMN IF EXISTS custom_fields;
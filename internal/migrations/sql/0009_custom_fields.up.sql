@@ -0,0 +1,14 @@
+--------------------------------------------------------------------
+-- CUSTOM FIELDS
+-- Date: 2025-03-17
+-- Description: Boards define custom fields in settings->'custom_fields'; tasks store their
+--              values keyed by field ID. Values are validated by the application.
+--------------------------------------------------------------------
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS custom_fields JSONB NOT NULL DEFAULT '{}'::jsonb;
+
+ALTER TABLE tasks DROP CONSTRAINT IF EXISTS tasks_custom_fields_check;
+ALTER TABLE tasks ADD CONSTRAINT tasks_custom_fields_check
+    CHECK (jsonb_typeof(custom_fields) = 'object');
+
+CREATE INDEX IF NOT EXISTS idx_tasks_custom_fields ON tasks USING GIN (custom_fields);
@@ -0,0 +1,43 @@
+--------------------------------------------------------------------
+-- TASK CHECKLISTS
+-- Date: 2025-03-24
+-- Description: Ordered checklist items inside a task. Boards can require every item to
+--              be checked before a task is completed (settings->'require_checklist').
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS task_checklist_items (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id     UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    content     TEXT NOT NULL CHECK (length(content) BETWEEN 1 AND 500),
+    position    INTEGER NOT NULL DEFAULT 0,
+    checked     BOOLEAN NOT NULL DEFAULT FALSE,
+    checked_at  TIMESTAMPTZ,
+    checked_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    assigned_to UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_by  UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT task_checklist_items_checked_at CHECK (checked = (checked_at IS NOT NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_checklist_items_task ON task_checklist_items(task_id, position);
+CREATE INDEX IF NOT EXISTS idx_task_checklist_items_assigned_to
+    ON task_checklist_items(assigned_to) WHERE assigned_to IS NOT NULL;
+
+ALTER TABLE task_checklist_items ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "task_checklist_items_select_policy"
+ON task_checklist_items FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM tasks t
+        INNER JOIN boards b ON t.board_id = b.id
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE t.id = task_checklist_items.task_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+CREATE TRIGGER trg_task_checklist_items_updated_at
+    BEFORE UPDATE ON task_checklist_items
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS time_entries;
+
+-- Totals beyond the old range are capped so the column type can shrink back
+UPDATE tasks SET actual_hours = 999.99 WHERE actual_hours > 999.99;
+ALTER TABLE tasks ALTER COLUMN actual_hours TYPE DECIMAL(5,2);
@@ -0,0 +1,46 @@
+--------------------------------------------------------------------
+-- TIME TRACKING
+-- Date: 2025-03-31
+-- Description: Time entries per user and task, from start/stop timers or entered by hand.
+--              A user has at most one running timer (ended_at IS NULL) across all boards.
+--              tasks.actual_hours is derived from the finished entries.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS time_entries (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id    UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    board_id   UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    user_id    UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    started_at TIMESTAMPTZ NOT NULL,
+    ended_at   TIMESTAMPTZ,
+    note       TEXT NOT NULL DEFAULT '' CHECK (length(note) <= 500),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT time_entries_order CHECK (ended_at IS NULL OR ended_at >= started_at)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_time_entries_one_running
+    ON time_entries(user_id) WHERE ended_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_time_entries_task ON time_entries(task_id);
+CREATE INDEX IF NOT EXISTS idx_time_entries_board_started ON time_entries(board_id, started_at);
+CREATE INDEX IF NOT EXISTS idx_time_entries_user_started ON time_entries(user_id, started_at);
+
+-- Derived totals can outgrow the hand-typed range
+ALTER TABLE tasks ALTER COLUMN actual_hours TYPE DECIMAL(8,2);
+
+ALTER TABLE time_entries ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "time_entries_select_policy"
+ON time_entries FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM boards b
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE b.id = time_entries.board_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+CREATE TRIGGER trg_time_entries_updated_at
+    BEFORE UPDATE ON time_entries
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
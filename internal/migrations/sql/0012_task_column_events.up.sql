@@ -0,0 +1,40 @@
+--------------------------------------------------------------------
+-- TASK COLUMN EVENTS
+-- Date: 2025-04-07
+-- Description: Durable history of tasks entering columns, for board analytics
+--              (cumulative flow, lead/cycle time, throughput, aging WIP). A NULL
+--              from_column_id marks the task's creation. Column IDs carry no foreign
+--              key so the history survives column deletion.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS task_column_events (
+    id             UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    task_id        UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    board_id       UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    from_column_id UUID,
+    to_column_id   UUID NOT NULL,
+    user_id        UUID REFERENCES users(id) ON DELETE SET NULL,
+    occurred_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_task_column_events_board ON task_column_events(board_id, occurred_at);
+CREATE INDEX IF NOT EXISTS idx_task_column_events_task ON task_column_events(task_id, occurred_at);
+
+-- Existing tasks start their history in their current column
+INSERT INTO task_column_events (task_id, board_id, from_column_id, to_column_id, occurred_at)
+SELECT t.id, t.board_id, NULL, t.column_id, t.created_at
+FROM tasks t
+WHERE NOT EXISTS (SELECT 1 FROM task_column_events e WHERE e.task_id = t.id);
+
+ALTER TABLE task_column_events ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "task_column_events_select_policy"
+ON task_column_events FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM boards b
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE b.id = task_column_events.board_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
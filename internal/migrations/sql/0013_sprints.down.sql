@@ -0,0 +1,3 @@
+ALTER TABLE tasks DROP COLUMN IF EXISTS sprint_id;
+DROP TABLE IF EXISTS sprint_task_changes;
+DROP TABLE IF EXISTS sprints;
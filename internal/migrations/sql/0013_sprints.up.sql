@@ -0,0 +1,73 @@
+--------------------------------------------------------------------
+-- SPRINTS
+-- Date: 2025-04-14
+-- Description: Time-boxed iterations per board. A sprint is planned, then active
+--              (at most one per board), then closed with a report. Tasks join a
+--              sprint through tasks.sprint_id; sprint_task_changes keeps the scope
+--              history that burndown charts are drawn from.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS sprints (
+    id         UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    board_id   UUID NOT NULL REFERENCES boards(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL CHECK (length(name) BETWEEN 1 AND 100),
+    goal       TEXT NOT NULL DEFAULT '' CHECK (length(goal) <= 1000),
+    starts_at  TIMESTAMPTZ NOT NULL,
+    ends_at    TIMESTAMPTZ NOT NULL,
+    status     TEXT NOT NULL DEFAULT 'planned' CHECK (status IN ('planned','active','closed')),
+    started_at TIMESTAMPTZ,
+    closed_at  TIMESTAMPTZ,
+    report     JSONB,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CONSTRAINT sprints_dates CHECK (ends_at >= starts_at)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_sprints_one_active
+    ON sprints(board_id) WHERE status = 'active';
+CREATE INDEX IF NOT EXISTS idx_sprints_board ON sprints(board_id, starts_at);
+
+ALTER TABLE tasks ADD COLUMN IF NOT EXISTS sprint_id UUID REFERENCES sprints(id) ON DELETE SET NULL;
+CREATE INDEX IF NOT EXISTS idx_tasks_sprint ON tasks(sprint_id) WHERE sprint_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS sprint_task_changes (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    sprint_id   UUID NOT NULL REFERENCES sprints(id) ON DELETE CASCADE,
+    task_id     UUID NOT NULL REFERENCES tasks(id) ON DELETE CASCADE,
+    added       BOOLEAN NOT NULL,
+    user_id     UUID REFERENCES users(id) ON DELETE SET NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_sprint_task_changes_sprint ON sprint_task_changes(sprint_id, occurred_at);
+
+ALTER TABLE sprints ENABLE ROW LEVEL SECURITY;
+ALTER TABLE sprint_task_changes ENABLE ROW LEVEL SECURITY;
+
+CREATE POLICY "sprints_select_policy"
+ON sprints FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM boards b
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE b.id = sprints.board_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+CREATE POLICY "sprint_task_changes_select_policy"
+ON sprint_task_changes FOR SELECT TO authenticated
+USING (
+    EXISTS (
+        SELECT 1 FROM sprints s
+        JOIN boards b ON b.id = s.board_id
+        LEFT JOIN board_members bm ON b.id = bm.board_id
+        WHERE s.id = sprint_task_changes.sprint_id
+        AND (b.owner_id = (select auth.uid()) OR bm.user_id = (select auth.uid()))
+    )
+);
+
+CREATE TRIGGER trg_sprints_updated_at
+    BEFORE UPDATE ON sprints
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
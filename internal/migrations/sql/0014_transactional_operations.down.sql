@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS public.delete_user_account(UUID, TEXT[]);
+DROP FUNCTION IF EXISTS public.delete_task(UUID);
+DROP FUNCTION IF EXISTS public.delete_board(UUID);
+DROP FUNCTION IF EXISTS public.create_board(TEXT, TEXT, UUID, UUID, UUID);
@@ -0,0 +1,142 @@
+--------------------------------------------------------------------
+-- TRANSACTIONAL OPERATIONS
+-- Date: 2025-04-21
+-- Description: Multi-step mutations that must succeed or fail as a whole.
+--              PostgREST runs each RPC call in its own transaction, so any
+--              error raised below rolls back every statement of the call.
+--              Functions return the affected ID so that an empty response
+--              can be told apart from success.
+--------------------------------------------------------------------
+
+-- Creates a board with its owner membership and the default columns. When
+-- p_parent_task_id is set the board becomes that task's nested board.
+CREATE OR REPLACE FUNCTION public.create_board(
+    p_title TEXT,
+    p_description TEXT,
+    p_owner_id UUID,
+    p_parent_board_id UUID DEFAULT NULL,
+    p_parent_task_id UUID DEFAULT NULL
+)
+RETURNS boards
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+DECLARE
+    v_board boards;
+    v_column TEXT;
+    v_position INTEGER := 0;
+BEGIN
+    INSERT INTO boards (title, description, owner_id, parent_board_id)
+    VALUES (p_title, p_description, p_owner_id, p_parent_board_id)
+    RETURNING * INTO v_board;
+
+    -- trg_ensure_board_owner_membership normally adds this already
+    INSERT INTO board_members (board_id, user_id, role)
+    VALUES (v_board.id, p_owner_id, 'owner')
+    ON CONFLICT (board_id, user_id) DO NOTHING;
+
+    FOREACH v_column IN ARRAY ARRAY['To Do', 'In Progress', 'Review', 'Done'] LOOP
+        INSERT INTO columns (board_id, title, position)
+        VALUES (v_board.id, v_column, v_position);
+        v_position := v_position + 1;
+    END LOOP;
+
+    IF p_parent_task_id IS NOT NULL THEN
+        UPDATE tasks SET nested_board_id = v_board.id
+        WHERE id = p_parent_task_id AND nested_board_id IS NULL;
+        IF NOT FOUND THEN
+            RAISE EXCEPTION 'task % not found or already has a nested board', p_parent_task_id
+                USING ERRCODE = 'no_data_found';
+        END IF;
+    END IF;
+
+    RETURN v_board;
+END;
+$$;
+
+-- Unlinks the board from its parent task and deletes it with everything
+-- that cascades from it
+CREATE OR REPLACE FUNCTION public.delete_board(p_board_id UUID)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    UPDATE tasks SET nested_board_id = NULL WHERE nested_board_id = p_board_id;
+
+    DELETE FROM boards WHERE id = p_board_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'board % not found', p_board_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_board_id;
+END;
+$$;
+
+-- Deletes a task and, after it, the task's nested board
+CREATE OR REPLACE FUNCTION public.delete_task(p_task_id UUID)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+DECLARE
+    v_nested_board_id UUID;
+BEGIN
+    DELETE FROM tasks WHERE id = p_task_id
+    RETURNING nested_board_id INTO v_nested_board_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'task % not found', p_task_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    IF v_nested_board_id IS NOT NULL THEN
+        DELETE FROM boards WHERE id = v_nested_board_id;
+    END IF;
+
+    RETURN p_task_id;
+END;
+$$;
+
+-- Permanently deletes a user and all of their data. OTP tokens are keyed by
+-- the email's blind indexes, which only the application can compute.
+CREATE OR REPLACE FUNCTION public.delete_user_account(p_user_id UUID, p_email_hashes TEXT[])
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    -- Owned boards cascade to their sub-boards, columns, tasks and members
+    UPDATE tasks SET nested_board_id = NULL
+    WHERE nested_board_id IN (SELECT id FROM boards WHERE owner_id = p_user_id);
+    DELETE FROM boards WHERE owner_id = p_user_id;
+
+    DELETE FROM board_members WHERE user_id = p_user_id;
+    DELETE FROM otp_tokens WHERE email_hash = ANY(COALESCE(p_email_hashes, ARRAY[]::TEXT[]));
+    DELETE FROM user_presence WHERE user_id = p_user_id;
+    DELETE FROM realtime_sessions WHERE user_id = p_user_id;
+    DELETE FROM activity_log WHERE user_id = p_user_id;
+    DELETE FROM comments WHERE user_id = p_user_id;
+    DELETE FROM task_assignees WHERE user_id = p_user_id;
+    DELETE FROM proposed_edits WHERE proposed_by = p_user_id;
+    DELETE FROM approval_notifications WHERE recipient_id = p_user_id;
+
+    DELETE FROM users WHERE id = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'user % not found', p_user_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_user_id;
+END;
+$$;
+
+REVOKE EXECUTE ON FUNCTION public.create_board(TEXT, TEXT, UUID, UUID, UUID) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION public.delete_board(UUID) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION public.delete_task(UUID) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION public.delete_user_account(UUID, TEXT[]) FROM PUBLIC, anon, authenticated;
+GRANT EXECUTE ON FUNCTION public.create_board(TEXT, TEXT, UUID, UUID, UUID) TO service_role;
+GRANT EXECUTE ON FUNCTION public.delete_board(UUID) TO service_role;
+GRANT EXECUTE ON FUNCTION public.delete_task(UUID) TO service_role;
+GRANT EXECUTE ON FUNCTION public.delete_user_account(UUID, TEXT[]) TO service_role;
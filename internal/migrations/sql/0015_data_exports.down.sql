@@ -0,0 +1,2 @@
+-- Archives already in storage are left behind under exports/
+DROP TABLE IF EXISTS data_exports;
@@ -0,0 +1,33 @@
+--------------------------------------------------------------------
+-- PERSONAL DATA EXPORTS
+-- Date: 2025-04-28
+-- Description: "Download my data" requests. A background worker builds the archive,
+--              stores it in attachment storage under blob_key and emails the user.
+--              Archives are deleted again once expires_at has passed.
+--------------------------------------------------------------------
+
+CREATE TABLE IF NOT EXISTS data_exports (
+    id           UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'building', 'ready', 'failed')),
+    blob_key     TEXT,
+    size_bytes   BIGINT CHECK (size_bytes IS NULL OR size_bytes >= 0),
+    download_url TEXT NOT NULL CHECK (length(download_url) <= 2000),  -- Link sent in the ready email
+    locked_until TIMESTAMPTZ,                                   -- Worker lease while building
+    expires_at   TIMESTAMPTZ,                                   -- Archive is deleted after this
+    last_error   TEXT,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_data_exports_user ON data_exports(user_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_data_exports_pending ON data_exports(created_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_data_exports_expiry ON data_exports(expires_at) WHERE expires_at IS NOT NULL;
+
+-- Only the service role touches exports
+ALTER TABLE data_exports ENABLE ROW LEVEL SECURITY;
+
+CREATE TRIGGER trg_data_exports_updated_at
+    BEFORE UPDATE ON data_exports
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
@@ -0,0 +1,33 @@
+DROP FUNCTION IF EXISTS public.record_otp_failure(TEXT, UUID[], INTEGER, INTEGER, INTEGER, INTEGER);
+
+-- Restore delete_user_account from 0014, which left lockout rows behind
+CREATE OR REPLACE FUNCTION public.delete_user_account(p_user_id UUID, p_email_hashes TEXT[])
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    -- Owned boards cascade to their sub-boards, columns, tasks and members
+    UPDATE tasks SET nested_board_id = NULL
+    WHERE nested_board_id IN (SELECT id FROM boards WHERE owner_id = p_user_id);
+    DELETE FROM boards WHERE owner_id = p_user_id;
+
+    DELETE FROM board_members WHERE user_id = p_user_id;
+    DELETE FROM otp_tokens WHERE email_hash = ANY(COALESCE(p_email_hashes, ARRAY[]::TEXT[]));
+    DELETE FROM user_presence WHERE user_id = p_user_id;
+    DELETE FROM realtime_sessions WHERE user_id = p_user_id;
+    DELETE FROM activity_log WHERE user_id = p_user_id;
+    DELETE FROM comments WHERE user_id = p_user_id;
+    DELETE FROM task_assignees WHERE user_id = p_user_id;
+    DELETE FROM proposed_edits WHERE proposed_by = p_user_id;
+    DELETE FROM approval_notifications WHERE recipient_id = p_user_id;
+
+    DELETE FROM users WHERE id = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'user % not found', p_user_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_user_id;
+END;
+$$;
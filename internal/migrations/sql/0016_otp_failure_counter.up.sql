@@ -0,0 +1,94 @@
+--------------------------------------------------------------------
+-- ATOMIC OTP FAILURE COUNTER
+-- Date: 2025-05-05
+-- Description: Wrong OTP guesses are counted and the lockout decided in a single
+--              UPDATE, so parallel guesses can no longer all read the same count.
+--              Deleting an account now also removes its lockout rows.
+--------------------------------------------------------------------
+
+-- Counts one wrong guess against the given codes and the email. Codes are burned
+-- after p_max_attempts; at p_max_failures the email is locked for p_base_lockout
+-- seconds, doubled for every earlier lockout up to p_max_lockout, and all of its
+-- active codes are burned. Returns the updated row: failed_attempts is 0 and
+-- locked_until is set exactly when this guess caused the lockout.
+CREATE OR REPLACE FUNCTION public.record_otp_failure(
+    p_email_hash TEXT,
+    p_token_ids UUID[],
+    p_max_attempts INTEGER,
+    p_max_failures INTEGER,
+    p_base_lockout INTEGER,
+    p_max_lockout INTEGER
+)
+RETURNS otp_lockouts
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+DECLARE
+    v_lockout otp_lockouts;
+BEGIN
+    UPDATE otp_tokens
+    SET attempts = attempts + 1,
+        used = attempts + 1 >= p_max_attempts
+    WHERE id = ANY(COALESCE(p_token_ids, ARRAY[]::UUID[])) AND used = false;
+
+    INSERT INTO otp_lockouts (email_hash) VALUES (p_email_hash)
+    ON CONFLICT (email_hash) DO NOTHING;
+
+    -- The row lock taken here serializes concurrent guesses for the same email
+    UPDATE otp_lockouts
+    SET failed_attempts = CASE WHEN failed_attempts + 1 >= p_max_failures
+                               THEN 0 ELSE failed_attempts + 1 END,
+        lockout_count = CASE WHEN failed_attempts + 1 >= p_max_failures
+                             THEN lockout_count + 1 ELSE lockout_count END,
+        locked_until = CASE WHEN failed_attempts + 1 >= p_max_failures
+                            THEN NOW() + make_interval(secs => LEAST(
+                                p_base_lockout::DOUBLE PRECISION * power(2, LEAST(lockout_count, 30)),
+                                p_max_lockout))
+                            ELSE locked_until END
+    WHERE email_hash = p_email_hash
+    RETURNING * INTO v_lockout;
+
+    IF v_lockout.failed_attempts = 0 THEN
+        UPDATE otp_tokens SET used = true
+        WHERE email_hash = p_email_hash AND used = false;
+    END IF;
+
+    RETURN v_lockout;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.delete_user_account(p_user_id UUID, p_email_hashes TEXT[])
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    -- Owned boards cascade to their sub-boards, columns, tasks and members
+    UPDATE tasks SET nested_board_id = NULL
+    WHERE nested_board_id IN (SELECT id FROM boards WHERE owner_id = p_user_id);
+    DELETE FROM boards WHERE owner_id = p_user_id;
+
+    DELETE FROM board_members WHERE user_id = p_user_id;
+    DELETE FROM otp_tokens WHERE email_hash = ANY(COALESCE(p_email_hashes, ARRAY[]::TEXT[]));
+    DELETE FROM otp_lockouts WHERE email_hash = ANY(COALESCE(p_email_hashes, ARRAY[]::TEXT[]));
+    DELETE FROM user_presence WHERE user_id = p_user_id;
+    DELETE FROM realtime_sessions WHERE user_id = p_user_id;
+    DELETE FROM activity_log WHERE user_id = p_user_id;
+    DELETE FROM comments WHERE user_id = p_user_id;
+    DELETE FROM task_assignees WHERE user_id = p_user_id;
+    DELETE FROM proposed_edits WHERE proposed_by = p_user_id;
+    DELETE FROM approval_notifications WHERE recipient_id = p_user_id;
+
+    DELETE FROM users WHERE id = p_user_id;
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'user % not found', p_user_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_user_id;
+END;
+$$;
+
+REVOKE EXECUTE ON FUNCTION public.record_otp_failure(TEXT, UUID[], INTEGER, INTEGER, INTEGER, INTEGER) FROM PUBLIC, anon, authenticated;
+GRANT EXECUTE ON FUNCTION public.record_otp_failure(TEXT, UUID[], INTEGER, INTEGER, INTEGER, INTEGER) TO service_role;
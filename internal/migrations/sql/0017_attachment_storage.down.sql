@@ -0,0 +1,9 @@
+DROP FUNCTION IF EXISTS public.remove_task_attachment(UUID, TEXT);
+DROP FUNCTION IF EXISTS public.replace_task_attachment(UUID, JSONB);
+DROP FUNCTION IF EXISTS public.append_task_attachment(UUID, JSONB, INTEGER);
+
+-- Avatars in blob storage no longer pass the check; fall back to the initials
+UPDATE users SET avatar_url = NULL WHERE avatar_url LIKE '/avatars/%';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_avatar_url_check;
+ALTER TABLE users ADD CONSTRAINT users_avatar_url_check
+    CHECK (avatar_url IS NULL OR avatar_url ~* '^(https?://|data:image/)');
@@ -0,0 +1,110 @@
+--------------------------------------------------------------------
+-- ATTACHMENT STORAGE
+-- Date: 2025-05-12
+-- Description: Avatars stored in blob storage are served from /avatars/, so avatar_url
+--              accepts those paths. Attachments are added, replaced and removed one
+--              entry at a time inside the database, so concurrent uploads no longer
+--              overwrite each other's copy of tasks.attachments.
+--------------------------------------------------------------------
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_avatar_url_check;
+ALTER TABLE users ADD CONSTRAINT users_avatar_url_check
+    CHECK (avatar_url IS NULL OR avatar_url ~* '^(https?://|data:image/|/avatars/)');
+
+-- Appends one attachment unless the task already has p_max_attachments
+CREATE OR REPLACE FUNCTION public.append_task_attachment(
+    p_task_id UUID,
+    p_attachment JSONB,
+    p_max_attachments INTEGER
+)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    UPDATE tasks
+    SET attachments = COALESCE(attachments, '[]'::JSONB) || jsonb_build_array(p_attachment),
+        version = version + 1,
+        updated_at = NOW()
+    WHERE id = p_task_id
+      AND jsonb_array_length(COALESCE(attachments, '[]'::JSONB)) < p_max_attachments;
+
+    IF NOT FOUND THEN
+        IF EXISTS (SELECT 1 FROM tasks WHERE id = p_task_id) THEN
+            RAISE EXCEPTION 'task % has too many attachments', p_task_id USING ERRCODE = 'check_violation';
+        END IF;
+        RAISE EXCEPTION 'task % not found', p_task_id USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_task_id;
+END;
+$$;
+
+-- Replaces the attachment with the same id, as the blob migration does after moving it
+CREATE OR REPLACE FUNCTION public.replace_task_attachment(p_task_id UUID, p_attachment JSONB)
+RETURNS UUID
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+BEGIN
+    UPDATE tasks
+    SET attachments = (
+            SELECT jsonb_agg(CASE WHEN entry->>'id' = p_attachment->>'id' THEN p_attachment ELSE entry END
+                             ORDER BY position)
+            FROM jsonb_array_elements(attachments) WITH ORDINALITY AS a(entry, position)
+        ),
+        updated_at = NOW()
+    WHERE id = p_task_id
+      AND attachments @> jsonb_build_array(jsonb_build_object('id', p_attachment->>'id'));
+
+    IF NOT FOUND THEN
+        RAISE EXCEPTION 'attachment % not found on task %', p_attachment->>'id', p_task_id
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    RETURN p_task_id;
+END;
+$$;
+
+-- Removes one attachment and returns it, so the caller can delete its blobs
+CREATE OR REPLACE FUNCTION public.remove_task_attachment(p_task_id UUID, p_attachment_id TEXT)
+RETURNS JSONB
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+DECLARE
+    v_removed JSONB;
+BEGIN
+    SELECT entry INTO v_removed
+    FROM tasks, jsonb_array_elements(tasks.attachments) AS entry
+    WHERE tasks.id = p_task_id AND entry->>'id' = p_attachment_id
+    FOR UPDATE OF tasks;
+
+    IF v_removed IS NULL THEN
+        RAISE EXCEPTION 'attachment % not found on task %', p_attachment_id, p_task_id
+            USING ERRCODE = 'no_data_found';
+    END IF;
+
+    UPDATE tasks
+    SET attachments = (
+            SELECT COALESCE(jsonb_agg(entry ORDER BY position), '[]'::JSONB)
+            FROM jsonb_array_elements(attachments) WITH ORDINALITY AS a(entry, position)
+            WHERE entry->>'id' <> p_attachment_id
+        ),
+        version = version + 1,
+        updated_at = NOW()
+    WHERE id = p_task_id;
+
+    RETURN v_removed;
+END;
+$$;
+
+REVOKE EXECUTE ON FUNCTION public.append_task_attachment(UUID, JSONB, INTEGER) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION public.replace_task_attachment(UUID, JSONB) FROM PUBLIC, anon, authenticated;
+REVOKE EXECUTE ON FUNCTION public.remove_task_attachment(UUID, TEXT) FROM PUBLIC, anon, authenticated;
+GRANT EXECUTE ON FUNCTION public.append_task_attachment(UUID, JSONB, INTEGER) TO service_role;
+GRANT EXECUTE ON FUNCTION public.replace_task_attachment(UUID, JSONB) TO service_role;
+GRANT EXECUTE ON FUNCTION public.remove_task_attachment(UUID, TEXT) TO service_role;
@@ -0,0 +1,2 @@
+-- apply_migration is not restored; migrations no longer go through PostgREST
+SELECT 1;
@@ -0,0 +1,10 @@
+--------------------------------------------------------------------
+-- DROP APPLY_MIGRATION
+-- Date: 2025-05-13
+-- Description: apply_migration ran any SQL it was given with the privileges of its
+--              owner and was reachable over PostgREST with the service key.
+--              cmd/migrate now applies migrations over a direct connection
+--              (DATABASE_URL), so installs bootstrapped before that lose it here.
+--------------------------------------------------------------------
+
+DROP FUNCTION IF EXISTS public.apply_migration(INTEGER, TEXT, TEXT, TEXT, BOOLEAN);
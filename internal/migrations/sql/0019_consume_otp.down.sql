@@ -0,0 +1 @@
+DROP FUNCTION IF EXISTS public.consume_otp(UUID, TEXT);
@@ -0,0 +1,47 @@
+--------------------------------------------------------------------
+-- ATOMIC OTP CONSUMPTION
+-- Date: 2025-05-14
+-- Description: A matching code is burned and the lockout checked in one call,
+--              so two submissions of the same code cannot both sign in, and a
+--              code burned by a concurrent lockout no longer works.
+--------------------------------------------------------------------
+
+-- Marks the code used if it is still unused and unexpired and the email is not
+-- locked out, then clears the email's failure counters. Returns false when the
+-- code could not be consumed. The lockout row lock is the one record_otp_failure
+-- takes, so a lockout and a sign-in for the same email do not interleave.
+CREATE OR REPLACE FUNCTION public.consume_otp(p_token_id UUID, p_email_hash TEXT)
+RETURNS BOOLEAN
+LANGUAGE plpgsql
+SECURITY DEFINER
+SET search_path = public
+AS $$
+DECLARE
+    v_locked_until TIMESTAMPTZ;
+BEGIN
+    SELECT locked_until INTO v_locked_until
+    FROM otp_lockouts
+    WHERE email_hash = p_email_hash
+    FOR UPDATE;
+
+    IF v_locked_until IS NOT NULL AND v_locked_until > NOW() THEN
+        RETURN false;
+    END IF;
+
+    UPDATE otp_tokens
+    SET used = true
+    WHERE id = p_token_id AND used = false AND expires_at > NOW();
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    UPDATE otp_lockouts
+    SET failed_attempts = 0, lockout_count = 0, locked_until = NULL
+    WHERE email_hash = p_email_hash;
+
+    RETURN true;
+END;
+$$;
+
+REVOKE EXECUTE ON FUNCTION public.consume_otp(UUID, TEXT) FROM PUBLIC, anon, authenticated;
+GRANT EXECUTE ON FUNCTION public.consume_otp(UUID, TEXT) TO service_role;
@@ -0,0 +1,23 @@
+--------------------------------------------------------------------
+-- ONE ACTIVE DATA EXPORT PER USER
+-- Date: 2025-05-15
+-- Description: A user has at most one export pending or building at a time, so
+--              concurrent requests cannot both queue one. Duplicates queued
+--              before this migration are failed, keeping each user's newest.
+--------------------------------------------------------------------
+
+UPDATE data_exports
+SET status = 'failed',
+    locked_until = NULL,
+    last_error = 'superseded by a newer export request',
+    updated_at = NOW()
+WHERE status IN ('pending', 'building')
+  AND id NOT IN (
+      SELECT DISTINCT ON (user_id) id
+      FROM data_exports
+      WHERE status IN ('pending', 'building')
+      ORDER BY user_id, created_at DESC, id DESC
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_data_exports_active
+    ON data_exports(user_id) WHERE status IN ('pending', 'building');
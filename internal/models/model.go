@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"time"
@@ -84,6 +85,9 @@ type Task struct {
 	Tags           []string                 `json:"tags" db:"tags"`
 	Attachments    []map[string]interface{} `json:"attachments" db:"attachments"`
 	NestedBoardID  *uuid.UUID               `json:"nested_board_id" db:"nested_board_id"`
+	RecurrenceID   *uuid.UUID               `json:"recurrence_id" db:"recurrence_id"`
+	SprintID       *uuid.UUID               `json:"sprint_id" db:"sprint_id"`
+	CustomFields   map[string]interface{}   `json:"custom_fields" db:"custom_fields"` // Values keyed by CustomField.ID
 	EstimatedHours *float64                 `json:"estimated_hours" db:"estimated_hours"`
 	ActualHours    *float64                 `json:"actual_hours" db:"actual_hours"`
 	CreatedAt      time.Time                `json:"created_at" db:"created_at"`
@@ -96,6 +100,216 @@ type Task struct {
 	Assignees   []TaskAssignee `json:"assignees,omitempty"`
 	Comments    []Comment      `json:"comments,omitempty"`
 	NestedBoard *Board         `json:"nested_board,omitempty"`
+	// Dependencies lists every link this task is either end of
+	Dependencies []TaskDependency `json:"dependencies,omitempty"`
+	Recurrence   *TaskRecurrence  `json:"recurrence,omitempty"`
+	Checklist    []ChecklistItem  `json:"checklist,omitempty"`
+	TimeEntries  []TimeEntry      `json:"time_entries,omitempty"`
+}
+
+// TaskRecurrence is a series of recurring task instances. The latest instance
+// (CurrentTaskID) is the template for the next one, which is due at NextOccurrenceAt;
+// NextOccurrenceAt is nil once the series has ended or was stopped.
+type TaskRecurrence struct {
+	ID               uuid.UUID  `json:"id" db:"id"`
+	BoardID          uuid.UUID  `json:"board_id" db:"board_id"`
+	Rule             string     `json:"rule" db:"rule"` // RRULE subset, see internal/recurrence
+	StartsAt         time.Time  `json:"starts_at" db:"starts_at"`
+	DeadlineOffset   *int64     `json:"deadline_offset_seconds" db:"deadline_offset_seconds"` // Deadline relative to each occurrence
+	Occurrences      int        `json:"occurrences" db:"occurrences"`                         // Occurrences used up, including skipped ones
+	NextOccurrenceAt *time.Time `json:"next_occurrence_at" db:"next_occurrence_at"`
+	CurrentTaskID    *uuid.UUID `json:"current_task_id" db:"current_task_id"`
+	Active           bool       `json:"active" db:"active"`
+	CreatedBy        *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Custom field types
+const (
+	CustomFieldText        = "text"
+	CustomFieldNumber      = "number"
+	CustomFieldDate        = "date"
+	CustomFieldSelect      = "select"
+	CustomFieldMultiSelect = "multi_select"
+	CustomFieldUser        = "user"
+	CustomFieldCheckbox    = "checkbox"
+	CustomFieldURL         = "url"
+)
+
+// CustomField is a board-level field definition, stored in Board.Settings["custom_fields"]
+type CustomField struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Options []string `json:"options,omitempty"` // Choices for select and multi_select
+}
+
+// Task dependency types. "blocks" means the source task has to be finished before the
+// target; "duplicates" means the source duplicates the target.
+const (
+	DependencyBlocks     = "blocks"
+	DependencyRelatesTo  = "relates_to"
+	DependencyDuplicates = "duplicates"
+)
+
+// ChecklistItem is an ordered step inside a task, a lighter alternative to a nested board
+type ChecklistItem struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	TaskID     uuid.UUID  `json:"task_id" db:"task_id"`
+	Content    string     `json:"content" db:"content"`
+	Position   int        `json:"position" db:"position"`
+	Checked    bool       `json:"checked" db:"checked"`
+	CheckedAt  *time.Time `json:"checked_at" db:"checked_at"`
+	CheckedBy  *uuid.UUID `json:"checked_by" db:"checked_by"`
+	AssignedTo *uuid.UUID `json:"assigned_to" db:"assigned_to"`
+	CreatedBy  *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// TimeEntry is time a user spent on a task. Running timers have no EndedAt; a user has at
+// most one running timer.
+type TimeEntry struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	TaskID    uuid.UUID  `json:"task_id" db:"task_id"`
+	BoardID   uuid.UUID  `json:"board_id" db:"board_id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	StartedAt time.Time  `json:"started_at" db:"started_at"`
+	EndedAt   *time.Time `json:"ended_at" db:"ended_at"`
+	Note      string     `json:"note" db:"note"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Relationships
+	User *User `json:"user,omitempty"`
+}
+
+// IsRunning reports whether the entry is a running timer
+func (e *TimeEntry) IsRunning() bool {
+	return e.EndedAt == nil
+}
+
+// Duration is the tracked time, up to now for a running timer
+func (e *TimeEntry) Duration(now time.Time) time.Duration {
+	if e.EndedAt != nil {
+		return e.EndedAt.Sub(e.StartedAt)
+	}
+	return now.Sub(e.StartedAt)
+}
+
+// Sprint statuses
+const (
+	SprintPlanned = "planned"
+	SprintActive  = "active"
+	SprintClosed  = "closed"
+)
+
+// Sprint is a time-boxed iteration on a board. StartsAt and EndsAt are the planned first
+// and last days (midnight UTC); StartedAt and ClosedAt are when it actually started and closed.
+type Sprint struct {
+	ID        uuid.UUID     `json:"id" db:"id"`
+	BoardID   uuid.UUID     `json:"board_id" db:"board_id"`
+	Name      string        `json:"name" db:"name"`
+	Goal      string        `json:"goal" db:"goal"`
+	StartsAt  time.Time     `json:"starts_at" db:"starts_at"`
+	EndsAt    time.Time     `json:"ends_at" db:"ends_at"`
+	Status    string        `json:"status" db:"status"`
+	StartedAt *time.Time    `json:"started_at" db:"started_at"`
+	ClosedAt  *time.Time    `json:"closed_at" db:"closed_at"`
+	Report    *SprintReport `json:"report" db:"report"`
+	CreatedBy *uuid.UUID    `json:"created_by" db:"created_by"`
+	CreatedAt time.Time     `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at" db:"updated_at"`
+}
+
+// IsOpen reports whether tasks can still join or leave the sprint
+func (s *Sprint) IsOpen() bool {
+	return s.Status != SprintClosed
+}
+
+// SprintTotals is an amount of work both as tasks and as estimated hours
+type SprintTotals struct {
+	Tasks int     `json:"tasks"`
+	Hours float64 `json:"hours"`
+}
+
+// SprintTaskRef names a task in a sprint report
+type SprintTaskRef struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+// SprintReport summarizes a sprint when it closes
+type SprintReport struct {
+	StartedAt       time.Time       `json:"started_at"`
+	ClosedAt        time.Time       `json:"closed_at"`
+	Committed       SprintTotals    `json:"committed"`
+	Added           SprintTotals    `json:"added"`
+	Removed         SprintTotals    `json:"removed"`
+	Completed       SprintTotals    `json:"completed"`
+	Incomplete      SprintTotals    `json:"incomplete"`
+	CompletedTasks  []SprintTaskRef `json:"completed_tasks"`
+	IncompleteTasks []SprintTaskRef `json:"incomplete_tasks"`
+	Disposition     string          `json:"disposition"`              // what happened to incomplete tasks: rollover or backlog
+	RolledOverTo    string          `json:"rolled_over_to,omitempty"` // sprint ID
+}
+
+// SprintChange records a task joining (Added) or leaving a sprint
+type SprintChange struct {
+	ID         uuid.UUID  `json:"id" db:"id"`
+	SprintID   uuid.UUID  `json:"sprint_id" db:"sprint_id"`
+	TaskID     uuid.UUID  `json:"task_id" db:"task_id"`
+	Added      bool       `json:"added" db:"added"`
+	UserID     *uuid.UUID `json:"user_id" db:"user_id"`
+	OccurredAt time.Time  `json:"occurred_at" db:"occurred_at"`
+}
+
+// ColumnEvent records a task entering a column; FromColumnID is nil when the task was created
+type ColumnEvent struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	TaskID       uuid.UUID  `json:"task_id" db:"task_id"`
+	BoardID      uuid.UUID  `json:"board_id" db:"board_id"`
+	FromColumnID *uuid.UUID `json:"from_column_id" db:"from_column_id"`
+	ToColumnID   uuid.UUID  `json:"to_column_id" db:"to_column_id"`
+	UserID       *uuid.UUID `json:"user_id" db:"user_id"`
+	OccurredAt   time.Time  `json:"occurred_at" db:"occurred_at"`
+}
+
+// TaskDependency links two tasks, possibly on different boards
+type TaskDependency struct {
+	ID           uuid.UUID  `json:"id" db:"id"`
+	SourceTaskID uuid.UUID  `json:"source_task_id" db:"source_task_id"`
+	TargetTaskID uuid.UUID  `json:"target_task_id" db:"target_task_id"`
+	Type         string     `json:"type" db:"type"`
+	CreatedBy    *uuid.UUID `json:"created_by" db:"created_by"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+
+	// Relationships
+	SourceTask *Task `json:"source_task,omitempty"`
+	TargetTask *Task `json:"target_task,omitempty"`
+}
+
+// Other returns the task at the other end of the link from taskID
+func (d *TaskDependency) Other(taskID uuid.UUID) *Task {
+	if d.SourceTaskID == taskID {
+		return d.TargetTask
+	}
+	return d.SourceTask
+}
+
+// Attachment is one entry of Task.Attachments. The file itself lives in blob storage
+// under Key; entries written before blob storage existed carry the file inline in Data.
+type Attachment struct {
+	ID           string    `json:"id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"`
+	Size         int64     `json:"size"`
+	Key          string    `json:"key,omitempty"`
+	ThumbnailKey string    `json:"thumbnail_key,omitempty"`
+	Data         string    `json:"data,omitempty"` // Legacy base64 contents
+	UploadedBy   string    `json:"uploaded_by"`
+	UploadedAt   time.Time `json:"uploaded_at"`
 }
 
 type TaskAssignee struct {
@@ -120,6 +334,7 @@ type OTPToken struct {
 	Token     string    `json:"token" db:"token"` // This will store hashed OTP
 	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
 	Used      bool      `json:"used" db:"used"`
+	Attempts  int       `json:"attempts" db:"attempts"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 
 	// Decrypted fields (not stored in DB, used for processing)
@@ -127,6 +342,96 @@ type OTPToken struct {
 	PlaintextToken string `json:"plaintext_token,omitempty" db:"-"`
 }
 
+// OTPLockout tracks failed verification attempts for one email address
+type OTPLockout struct {
+	EmailHash      string     `json:"email_hash" db:"email_hash"` // Blind index of the email
+	FailedAttempts int        `json:"failed_attempts" db:"failed_attempts"`
+	LockoutCount   int        `json:"lockout_count" db:"lockout_count"`
+	LockedUntil    *time.Time `json:"locked_until" db:"locked_until"`
+	LastSentAt     *time.Time `json:"last_sent_at" db:"last_sent_at"`
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// IsLocked reports whether verification and resends are currently blocked
+func (l *OTPLockout) IsLocked() bool {
+	return l != nil && l.LockedUntil != nil && time.Now().Before(*l.LockedUntil)
+}
+
+// Email delivery queue statuses
+const (
+	EmailStatusPending = "pending"
+	EmailStatusSending = "sending"
+	EmailStatusDead    = "dead"
+)
+
+// EmailJob is one outbound email waiting in the delivery queue. Rows are deleted once sent;
+// jobs that keep failing stay behind with status "dead" until an admin retries or discards them.
+type EmailJob struct {
+	ID            uuid.UUID  `json:"id" db:"id"`
+	Kind          string     `json:"kind" db:"kind"`           // Template name, e.g. "otp"
+	Recipient     string     `json:"recipient" db:"recipient"` // Encrypted
+	Subject       string     `json:"subject" db:"subject"`
+	Payload       string     `json:"payload" db:"payload"` // Encrypted HTML and text bodies
+	Status        string     `json:"status" db:"status"`
+	Attempts      int        `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" db:"next_attempt_at"`
+	LockedUntil   *time.Time `json:"locked_until" db:"locked_until"`
+	ExpiresAt     *time.Time `json:"expires_at" db:"expires_at"` // Undelivered jobs are dropped after this
+	LastError     *string    `json:"last_error" db:"last_error"`
+	CreatedAt     time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at" db:"updated_at"`
+
+	// Decrypted fields (not stored in database)
+	To       string `json:"-" db:"-"`
+	HTMLBody string `json:"-" db:"-"`
+	TextBody string `json:"-" db:"-"`
+	ReplyTo  string `json:"-" db:"-"`
+}
+
+// Personal data export statuses
+const (
+	DataExportPending  = "pending"
+	DataExportBuilding = "building"
+	DataExportReady    = "ready"
+	DataExportFailed   = "failed"
+)
+
+// DataExport is a user's "Download my data" request. The archive is built in the
+// background and kept in attachment storage under BlobKey until ExpiresAt.
+type DataExport struct {
+	ID          uuid.UUID  `json:"id" db:"id"`
+	UserID      uuid.UUID  `json:"user_id" db:"user_id"`
+	Status      string     `json:"status" db:"status"`
+	BlobKey     *string    `json:"blob_key" db:"blob_key"`
+	SizeBytes   *int64     `json:"size_bytes" db:"size_bytes"`
+	DownloadURL string     `json:"download_url" db:"download_url"` // Link sent in the ready email
+	LockedUntil *time.Time `json:"locked_until" db:"locked_until"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	LastError   *string    `json:"last_error" db:"last_error"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Downloadable reports whether the archive is built and has not expired yet
+func (e *DataExport) Downloadable() bool {
+	return e.Status == DataExportReady && e.BlobKey != nil &&
+		(e.ExpiresAt == nil || time.Now().Before(*e.ExpiresAt))
+}
+
+// PersonalData is what a data export contains: the rows stored about one user,
+// keyed by column as PostgREST returns them. The profile email is decrypted.
+type PersonalData struct {
+	Profile     map[string]interface{}
+	Boards      []map[string]interface{} // Owned and joined, with the user's role
+	Memberships []map[string]interface{}
+	Tasks       []map[string]interface{} // Created by or assigned to the user
+	Comments    []map[string]interface{}
+	Activity    []map[string]interface{}
+	Sessions    []map[string]interface{}
+	Presence    []map[string]interface{}
+}
+
 type Comment struct {
 	ID        uuid.UUID `json:"id" db:"id"`
 	TaskID    uuid.UUID `json:"task_id" db:"task_id"`
@@ -284,6 +589,124 @@ func (t *Task) HasNestedBoard() bool {
 	return t.NestedBoardID != nil
 }
 
+// CustomFields decodes the board's custom field definitions from its settings
+func (b *Board) CustomFields() []CustomField {
+	raw, ok := b.Settings["custom_fields"]
+	if !ok {
+		return nil
+	}
+	encoded, err := json.Marshal(raw)
+	if err != nil {
+		return nil
+	}
+	var fields []CustomField
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil
+	}
+	return fields
+}
+
+// IsResolved reports whether the task no longer blocks others: it is marked completed
+// or sits in a done column (Column must be loaded for the latter)
+func (t *Task) IsResolved() bool {
+	return t.Completed || (t.Column != nil && t.Column.IsDone())
+}
+
+// OpenBlockers returns the unresolved tasks that block this one
+func (t *Task) OpenBlockers() []Task {
+	var blockers []Task
+	for _, dependency := range t.Dependencies {
+		if dependency.Type == DependencyBlocks && dependency.TargetTaskID == t.ID &&
+			dependency.SourceTask != nil && !dependency.SourceTask.IsResolved() {
+			blockers = append(blockers, *dependency.SourceTask)
+		}
+	}
+	return blockers
+}
+
+// BlockedTaskCount is the number of tasks waiting on this one
+func (t *Task) BlockedTaskCount() int {
+	count := 0
+	for _, dependency := range t.Dependencies {
+		if dependency.Type == DependencyBlocks && dependency.SourceTaskID == t.ID {
+			count++
+		}
+	}
+	return count
+}
+
+// LinkedTaskCount is the number of related and duplicate links
+func (t *Task) LinkedTaskCount() int {
+	count := 0
+	for _, dependency := range t.Dependencies {
+		if dependency.Type != DependencyBlocks {
+			count++
+		}
+	}
+	return count
+}
+
+// ChecklistProgress returns the number of checked and total checklist items
+func (t *Task) ChecklistProgress() (checked, total int) {
+	for _, item := range t.Checklist {
+		if item.Checked {
+			checked++
+		}
+	}
+	return checked, len(t.Checklist)
+}
+
+// RequiresChecklist reports whether tasks on this board can only be completed once every
+// checklist item is checked ({"require_checklist": true} in the settings)
+func (b *Board) RequiresChecklist() bool {
+	required, _ := b.Settings["require_checklist"].(bool)
+	return required
+}
+
+// IsDone reports whether tasks in this column count as finished: either the column's
+// settings say so ({"done": true}) or it has a conventional done title
+func (c *Column) IsDone() bool {
+	if done, ok := c.Settings["done"].(bool); ok {
+		return done
+	}
+	switch strings.ToLower(strings.TrimSpace(c.Title)) {
+	case "done", "complete", "completed", "closed", "finished":
+		return true
+	}
+	return false
+}
+
+// GetAttachments decodes Task.Attachments, skipping malformed entries
+func (t *Task) GetAttachments() []Attachment {
+	attachments := make([]Attachment, 0, len(t.Attachments))
+	for _, raw := range t.Attachments {
+		encoded, err := json.Marshal(raw)
+		if err != nil {
+			continue
+		}
+		var attachment Attachment
+		if err := json.Unmarshal(encoded, &attachment); err != nil || attachment.ID == "" {
+			continue
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments
+}
+
+// SetAttachments replaces Task.Attachments with the encoded list
+func (t *Task) SetAttachments(attachments []Attachment) error {
+	encoded, err := json.Marshal(attachments)
+	if err != nil {
+		return fmt.Errorf("failed to encode attachments: %w", err)
+	}
+	var raw []map[string]interface{}
+	if err := json.Unmarshal(encoded, &raw); err != nil {
+		return fmt.Errorf("failed to encode attachments: %w", err)
+	}
+	t.Attachments = raw
+	return nil
+}
+
 func (b *Board) IsSubBoard() bool {
 	return b.ParentBoardID != nil
 }
@@ -0,0 +1,322 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"sudo/internal/config"
+)
+
+const (
+	// How long discovery documents and signing keys are cached before refetching
+	metadataTTL = time.Hour
+
+	// Upper bound for responses read from the identity provider
+	maxResponseSize = 1 << 20
+)
+
+// Provider is a single OpenID Connect identity provider configured from the environment
+type Provider struct {
+	Name           string
+	DisplayName    string
+	Issuer         string
+	ClientID       string
+	ClientSecret   string
+	RedirectURL    string
+	Scopes         []string
+	AllowedDomains []string
+
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	discovery   *discoveryDocument
+	keys        *keySet
+	refreshedAt time.Time
+}
+
+// ProviderInfo is the subset of provider details safe to render on the login page
+type ProviderInfo struct {
+	Name        string
+	DisplayName string
+}
+
+// Manager holds every configured provider, keyed by its lowercase name
+type Manager struct {
+	providers map[string]*Provider
+	order     []string
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewManager creates the providers configured with OIDC_PROVIDERS. Providers without a
+// display name use their capitalised name and those without scopes request
+// openid, email and profile.
+func NewManager(cfg config.OIDC) (*Manager, error) {
+	m := &Manager{providers: make(map[string]*Provider)}
+
+	for _, pc := range cfg.Providers {
+		if _, exists := m.providers[pc.Name]; exists {
+			return nil, fmt.Errorf("oidc provider %q configured twice", pc.Name)
+		}
+		if pc.Issuer == "" || pc.ClientID == "" {
+			return nil, fmt.Errorf("oidc provider %q requires an issuer and a client ID", pc.Name)
+		}
+
+		p := &Provider{
+			Name:         pc.Name,
+			DisplayName:  pc.DisplayName,
+			Issuer:       pc.Issuer,
+			ClientID:     pc.ClientID,
+			ClientSecret: pc.ClientSecret,
+			RedirectURL:  pc.RedirectURL,
+			Scopes:       pc.Scopes,
+			httpClient:   &http.Client{Timeout: 10 * time.Second},
+		}
+		if p.DisplayName == "" {
+			p.DisplayName = strings.ToUpper(p.Name[:1]) + p.Name[1:]
+		}
+		if len(p.Scopes) == 0 {
+			p.Scopes = []string{"openid", "email", "profile"}
+		}
+		for _, d := range pc.AllowedDomains {
+			p.AllowedDomains = append(p.AllowedDomains, strings.ToLower(strings.TrimPrefix(d, "@")))
+		}
+
+		m.providers[p.Name] = p
+		m.order = append(m.order, p.Name)
+	}
+
+	return m, nil
+}
+
+// Get returns the provider with the given name
+func (m *Manager) Get(name string) (*Provider, bool) {
+	if m == nil {
+		return nil, false
+	}
+	p, ok := m.providers[strings.ToLower(name)]
+	return p, ok
+}
+
+// Providers lists the configured providers in the order they were declared
+func (m *Manager) Providers() []ProviderInfo {
+	if m == nil {
+		return nil
+	}
+	infos := make([]ProviderInfo, 0, len(m.order))
+	for _, name := range m.order {
+		p := m.providers[name]
+		infos = append(infos, ProviderInfo{Name: p.Name, DisplayName: p.DisplayName})
+	}
+	return infos
+}
+
+// Enabled reports whether at least one provider is configured
+func (m *Manager) Enabled() bool {
+	return m != nil && len(m.providers) > 0
+}
+
+// AuthCodeURL builds the authorization endpoint URL for the code + PKCE (S256) flow
+func (p *Provider) AuthCodeURL(ctx context.Context, redirectURL, state, nonce, codeVerifier string) (string, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	authURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+
+	q := authURL.Query()
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", redirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", CodeChallenge(codeVerifier))
+	q.Set("code_challenge_method", "S256")
+	authURL.RawQuery = q.Encode()
+
+	return authURL.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified ID token claims
+func (p *Provider) Exchange(ctx context.Context, redirectURL, code, codeVerifier, nonce string) (*Claims, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURL)
+	form.Set("code_verifier", codeVerifier)
+	form.Set("client_id", p.ClientID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doc.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+
+	var token tokenResponse
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, token.Error, token.ErrorDescription)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response did not include an id_token")
+	}
+
+	return p.verifyIDToken(ctx, token.IDToken, nonce)
+}
+
+// EmailAllowed reports whether the email's domain is permitted for this provider.
+// An empty allow-list permits every domain.
+func (p *Provider) EmailAllowed(email string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, allowed := range p.AllowedDomains {
+		if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// metadata returns the cached discovery document, fetching it when stale
+func (p *Provider) metadata(ctx context.Context) (*discoveryDocument, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.refreshedAt) < metadataTTL {
+		return p.discovery, nil
+	}
+
+	var doc discoveryDocument
+	if err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &doc); err != nil {
+		return nil, fmt.Errorf("failed to load oidc discovery for %s: %w", p.Name, err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery issuer %q does not match configured issuer %q", doc.Issuer, p.Issuer)
+	}
+	if doc.AuthorizationEndpoint == "" || doc.TokenEndpoint == "" || doc.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery document for %s is missing required endpoints", p.Name)
+	}
+
+	p.discovery = &doc
+	p.keys = nil
+	p.refreshedAt = time.Now()
+	return p.discovery, nil
+}
+
+// signingKeys returns the provider's JWKS, refetching when forced (e.g. unknown key id)
+func (p *Provider) signingKeys(ctx context.Context, force bool) (*keySet, error) {
+	doc, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.keys != nil && !force {
+		return p.keys, nil
+	}
+
+	var raw jsonWebKeySet
+	if err := p.getJSON(ctx, doc.JWKSURI, &raw); err != nil {
+		return nil, fmt.Errorf("failed to load signing keys for %s: %w", p.Name, err)
+	}
+
+	keys, err := parseKeySet(raw)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	return keys, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// RandomToken returns a URL-safe random string used for state, nonce and PKCE verifiers
+func RandomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CodeChallenge derives the S256 PKCE challenge for a verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
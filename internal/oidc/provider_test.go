@@ -0,0 +1,218 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sudo/internal/config"
+)
+
+// mockProvider is an identity provider serving discovery, JWKS and the token endpoint.
+// The token endpoint answers with whatever ID token claims the test set.
+type mockProvider struct {
+	*httptest.Server
+	t   *testing.T
+	key *rsa.PrivateKey
+
+	mu       sync.Mutex
+	claims   map[string]interface{}
+	lastForm url.Values
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.mu.Lock()
+		m.lastForm = r.PostForm
+		claims := m.claims
+		m.mu.Unlock()
+
+		if r.PostForm.Get("code") != "good-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"id_token":     m.sign(claims),
+		})
+	})
+
+	m.Server = httptest.NewServer(mux)
+	t.Cleanup(m.Close)
+	return m
+}
+
+// setClaims makes the token endpoint issue an ID token with valid claims for nonce,
+// changed by edit
+func (m *mockProvider) setClaims(nonce string, edit func(map[string]interface{})) {
+	claims := map[string]interface{}{
+		"iss":            m.URL,
+		"sub":            "user-1",
+		"aud":            "sudo-client",
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "Ada@Example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	m.mu.Lock()
+	m.claims = claims
+	m.mu.Unlock()
+}
+
+func (m *mockProvider) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test-key", "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func (m *mockProvider) provider(t *testing.T) *Provider {
+	t.Helper()
+	manager, err := NewManager(config.OIDC{Providers: []config.OIDCProvider{{
+		Name:         "mock",
+		Issuer:       m.URL,
+		ClientID:     "sudo-client",
+		ClientSecret: "secret",
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, _ := manager.Get("mock")
+	return p
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	mock := newMockProvider(t)
+	p := mock.provider(t)
+
+	authURL, err := p.AuthCodeURL(context.Background(), "https://app.test/callback", "state-1", "nonce-1", "verifier-1")
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	if !strings.HasPrefix(authURL, mock.URL+"/authorize?") || q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" ||
+		q.Get("code_challenge") != CodeChallenge("verifier-1") || q.Get("code_challenge_method") != "S256" {
+		t.Errorf("unexpected authorization URL %s", authURL)
+	}
+}
+
+func TestExchange(t *testing.T) {
+	mock := newMockProvider(t)
+
+	tests := []struct {
+		name    string
+		code    string
+		nonce   string
+		edit    func(map[string]interface{})
+		wantErr string
+	}{
+		{name: "valid", code: "good-code", nonce: "nonce-1"},
+		{name: "audience list with our client", code: "good-code", nonce: "nonce-1", edit: func(c map[string]interface{}) {
+			c["aud"] = []string{"other", "sudo-client"}
+			c["azp"] = "sudo-client"
+		}},
+		{name: "nonce mismatch", code: "good-code", nonce: "other-nonce", wantErr: "nonce mismatch"},
+		{name: "missing nonce", code: "good-code", nonce: "", wantErr: "nonce mismatch"},
+		{name: "expired", code: "good-code", nonce: "nonce-1", edit: func(c map[string]interface{}) {
+			c["exp"] = time.Now().Add(-time.Hour).Unix()
+		}, wantErr: "expired"},
+		{name: "wrong audience", code: "good-code", nonce: "nonce-1", edit: func(c map[string]interface{}) {
+			c["aud"] = "someone-else"
+		}, wantErr: "not issued for this client"},
+		{name: "wrong issuer", code: "good-code", nonce: "nonce-1", edit: func(c map[string]interface{}) {
+			c["iss"] = "https://evil.example.com"
+		}, wantErr: "issuer"},
+		{name: "rejected code", code: "bad-code", nonce: "nonce-1", wantErr: "invalid_grant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock.setClaims("nonce-1", tt.edit)
+			claims, err := mock.provider(t).Exchange(context.Background(), "https://app.test/callback", tt.code, "verifier-1", tt.nonce)
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Exchange error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange failed: %v", err)
+			}
+			if claims.Email != "Ada@Example.com" || !bool(claims.EmailVerified) || claims.Subject != "user-1" {
+				t.Errorf("claims = %+v", claims)
+			}
+			if form := mock.lastForm; form.Get("code_verifier") != "verifier-1" || form.Get("redirect_uri") != "https://app.test/callback" {
+				t.Errorf("token request = %v", form)
+			}
+		})
+	}
+}
+
+func TestExchangeRejectsForgedSignature(t *testing.T) {
+	mock := newMockProvider(t)
+	mock.setClaims("nonce-1", nil)
+
+	// A token signed by another key must not verify against the provider's JWKS
+	forger := newMockProvider(t)
+	p := mock.provider(t)
+	token := forger.sign(mock.claims)
+	if _, err := p.verifyIDToken(context.Background(), token, "nonce-1"); err == nil ||
+		!strings.Contains(err.Error(), "signature verification failed") {
+		t.Fatalf("verifyIDToken error = %v, want signature failure", err)
+	}
+}
@@ -0,0 +1,268 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Allowed clock drift between us and the identity provider
+const clockSkew = 2 * time.Minute
+
+// Claims are the ID token claims we rely on to sign a user in
+type Claims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	Expiry            int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     flexBool `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// audience accepts both the string and array forms of the aud claim
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// flexBool accepts providers that send email_verified as the string "true"
+type flexBool bool
+
+func (b *flexBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+	Y       string `json:"y"`
+}
+
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+type keySet struct {
+	byID map[string]crypto.PublicKey
+	all  []crypto.PublicKey
+}
+
+func parseKeySet(raw jsonWebKeySet) (*keySet, error) {
+	ks := &keySet{byID: make(map[string]crypto.PublicKey)}
+
+	for _, k := range raw.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var pub crypto.PublicKey
+		switch k.KeyType {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RSA modulus in key %q: %w", k.KeyID, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RSA exponent in key %q: %w", k.KeyID, err)
+			}
+			pub = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			if k.Curve != "P-256" {
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(k.X)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EC x coordinate in key %q: %w", k.KeyID, err)
+			}
+			y, err := base64.RawURLEncoding.DecodeString(k.Y)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EC y coordinate in key %q: %w", k.KeyID, err)
+			}
+			pub = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		default:
+			continue
+		}
+
+		if k.KeyID != "" {
+			ks.byID[k.KeyID] = pub
+		}
+		ks.all = append(ks.all, pub)
+	}
+
+	if len(ks.all) == 0 {
+		return nil, fmt.Errorf("no usable signing keys in JWKS")
+	}
+	return ks, nil
+}
+
+// candidates returns the keys that may have signed a token with the given key id
+func (ks *keySet) candidates(kid string) []crypto.PublicKey {
+	if kid == "" {
+		return ks.all
+	}
+	if key, ok := ks.byID[kid]; ok {
+		return []crypto.PublicKey{key}
+	}
+	return nil
+}
+
+// verifyIDToken checks the signature and standard claims of an ID token
+func (p *Provider) verifyIDToken(ctx context.Context, rawToken, expectedNonce string) (*Claims, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed id_token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token header encoding: %w", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("invalid id_token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token signature encoding: %w", err)
+	}
+
+	keys, err := p.signingKeys(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	candidates := keys.candidates(header.KeyID)
+	if len(candidates) == 0 {
+		// The provider may have rotated keys since we cached them
+		if keys, err = p.signingKeys(ctx, true); err != nil {
+			return nil, err
+		}
+		candidates = keys.candidates(header.KeyID)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	verified := false
+	for _, key := range candidates {
+		if verifySignature(header.Algorithm, key, signed, signature) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("id_token signature verification failed")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token payload encoding: %w", err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+
+	if err := p.validateClaims(&claims, expectedNonce, time.Now()); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+func (p *Provider) validateClaims(claims *Claims, expectedNonce string, now time.Time) error {
+	if strings.TrimSuffix(claims.Issuer, "/") != p.Issuer {
+		return fmt.Errorf("id_token issuer %q does not match %q", claims.Issuer, p.Issuer)
+	}
+
+	audienceOK := false
+	for _, aud := range claims.Audience {
+		if aud == p.ClientID {
+			audienceOK = true
+			break
+		}
+	}
+	if !audienceOK {
+		return fmt.Errorf("id_token was not issued for this client")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != "" && claims.AuthorizedParty != p.ClientID {
+		return fmt.Errorf("id_token authorized party mismatch")
+	}
+
+	if claims.Expiry == 0 || now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)) {
+		return fmt.Errorf("id_token has expired")
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(clockSkew)) {
+		return fmt.Errorf("id_token issued in the future")
+	}
+
+	if expectedNonce == "" || claims.Nonce != expectedNonce {
+		return fmt.Errorf("id_token nonce mismatch")
+	}
+	return nil
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	digest := sha256.Sum256(signed)
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match RS256")
+		}
+		return rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature)
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("key type does not match ES256")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("invalid ES256 signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported id_token algorithm %q", alg)
+	}
+}
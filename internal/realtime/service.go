@@ -6,28 +6,58 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"sudo/internal/database"
 	"sudo/internal/models"
+	"sudo/internal/tracing"
 	"sudo/templates/components"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-// WebSocket upgrader with security settings
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// In production, validate against allowed origins
-		return true // TODO: Restrict to your domain in production
-	},
+// newUpgrader returns a WebSocket upgrader that only accepts the given origins.
+// With no origins configured, only same-host connections are accepted.
+func newUpgrader(allowedOrigins []string) websocket.Upgrader {
+	allowed := make(map[string]bool, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.ToLower(strings.TrimRight(origin, "/"))] = true
+	}
+
+	return websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				// Not a browser, so there is no cross-site cookie to abuse
+				return true
+			}
+
+			u, err := url.Parse(origin)
+			if err != nil || u.Host == "" {
+				return false
+			}
+
+			if len(allowed) == 0 {
+				return strings.EqualFold(u.Host, r.Host)
+			}
+			if allowed[strings.ToLower(u.Scheme+"://"+u.Host)] {
+				return true
+			}
+
+			log.Printf("WebSocket origin rejected: %s", origin)
+			return false
+		},
+	}
 }
 
 // Message types for WebSocket communication
@@ -43,8 +73,13 @@ const (
 	MessageTypeMemberAdded    = "member_added"
 	MessageTypeMemberRemoved  = "member_removed"
 	MessageTypePresenceUpdate = "presence_update"
+	MessageTypeServerRestart  = "server_restarting"
 )
 
+// restartReconnectDelay is how long clients are asked to wait before reconnecting after
+// a shutdown, so they reach another instance or the restarted one
+const restartReconnectDelay = 2 * time.Second
+
 // WebSocket message structure
 type WebSocketMessage struct {
 	Type      string                 `json:"type"`
@@ -71,6 +106,8 @@ type Client struct {
 	userID   uuid.UUID
 	user     *models.User
 	lastSeen time.Time
+	// trace is the request that opened the connection; message spans link to it
+	trace trace.SpanContext
 }
 
 // RealtimeService manages all WebSocket connections
@@ -81,27 +118,41 @@ type RealtimeService struct {
 	register   chan *Client
 	unregister chan *Client
 	db         *database.DB
+	upgrader   websocket.Upgrader
 	mu         sync.RWMutex
+
+	// Set by Shutdown; done stops the hub and writers tracks open connections
+	shuttingDown bool
+	done         chan struct{}
+	stopOnce     sync.Once
+	writers      sync.WaitGroup
 }
 
-// NewRealtimeService creates a new real-time service
-func NewRealtimeService(db *database.DB) *RealtimeService {
+// NewRealtimeService creates a new real-time service accepting WebSocket
+// connections from allowedOrigins (same host only when empty)
+func NewRealtimeService(db *database.DB, allowedOrigins []string) *RealtimeService {
 	return &RealtimeService{
 		clients:    make(map[string]map[*Client]bool),
 		broadcast:  make(chan *WebSocketMessage, 256),
 		register:   make(chan *Client, 64),
 		unregister: make(chan *Client, 64),
 		db:         db,
+		upgrader:   newUpgrader(allowedOrigins),
+		done:       make(chan struct{}),
 	}
 }
 
-// Run starts the WebSocket service hub
+// Run starts the WebSocket service hub; it returns once Shutdown has closed all connections
 func (s *RealtimeService) Run() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-s.done:
+			log.Printf("Realtime hub stopped")
+			return
+
 		case client := <-s.register:
 			s.registerClient(client)
 
@@ -117,6 +168,97 @@ func (s *RealtimeService) Run() {
 	}
 }
 
+// Shutdown refuses new connections, tells every client that the server is restarting and
+// closes its connection, marks the users offline and stops the hub. It returns ctx's error
+// when connections were still being closed at the deadline.
+func (s *RealtimeService) Shutdown(ctx context.Context) error {
+	notice, err := json.Marshal(&WebSocketMessage{
+		Type:      MessageTypeServerRestart,
+		Timestamp: time.Now(),
+		Data: map[string]interface{}{
+			"message":            "Server restarting, reconnecting...",
+			"reconnect_after_ms": restartReconnectDelay.Milliseconds(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal restart notice: %w", err)
+	}
+
+	// Close the send channels under the lock, so broadcasts cannot send on them in between
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		return nil
+	}
+	s.shuttingDown = true
+	clients := s.clients
+	s.clients = make(map[string]map[*Client]bool)
+
+	count := 0
+	for _, boardClients := range clients {
+		for client := range boardClients {
+			select {
+			case client.send <- notice:
+			default:
+				// Buffer full; the client still gets the close frame
+			}
+			// The writer sends what is queued, then a close frame, then closes the connection
+			close(client.send)
+			count++
+		}
+	}
+	s.mu.Unlock()
+	log.Printf("Realtime shutdown: closing %d connections", count)
+
+	// Mark everyone offline; users come back online when they reconnect
+	for _, boardClients := range clients {
+		for client := range boardClients {
+			s.updateUserPresence(client, false)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		s.writers.Wait()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	s.stopOnce.Do(func() { close(s.done) })
+	return err
+}
+
+func (s *RealtimeService) isShuttingDown() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.shuttingDown
+}
+
+// restartCloseMessage is the close frame clients get when the server shuts down
+func restartCloseMessage() []byte {
+	return websocket.FormatCloseMessage(websocket.CloseServiceRestart, "server restarting, reconnect")
+}
+
+// publish queues a message for the hub; it is dropped once the hub has stopped
+func (s *RealtimeService) publish(message *WebSocketMessage) {
+	select {
+	case s.broadcast <- message:
+	case <-s.done:
+	}
+}
+
+// disconnect asks the hub to remove a client; after shutdown there is nothing left to remove
+func (s *RealtimeService) disconnect(client *Client) {
+	select {
+	case s.unregister <- client:
+	case <-s.done:
+	}
+}
+
 // HandleWebSocketConnection upgrades HTTP to WebSocket
 func (s *RealtimeService) HandleWebSocketConnection(c *gin.Context) {
 	// Validate authentication using existing session
@@ -140,7 +282,7 @@ func (s *RealtimeService) HandleWebSocketConnection(c *gin.Context) {
 	}
 
 	// Verify user has access to this board
-	hasAccess, err := s.db.HasBoardAccess(context.Background(), user.ID, boardUUID)
+	hasAccess, err := s.db.HasBoardAccess(c.Request.Context(), user.ID, boardUUID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify board access"})
 		return
@@ -151,13 +293,29 @@ func (s *RealtimeService) HandleWebSocketConnection(c *gin.Context) {
 		return
 	}
 
+	if s.isShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is restarting"})
+		return
+	}
+
 	// Upgrade connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := s.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
+	// Shutdown may have started during the upgrade
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		_ = conn.WriteControl(websocket.CloseMessage, restartCloseMessage(), time.Now().Add(time.Second))
+		conn.Close()
+		return
+	}
+	s.writers.Add(1)
+	s.mu.Unlock()
+
 	// Create client and register
 	client := &Client{
 		conn:     conn,
@@ -166,9 +324,13 @@ func (s *RealtimeService) HandleWebSocketConnection(c *gin.Context) {
 		userID:   user.ID,
 		user:     user,
 		lastSeen: time.Now(),
+		trace:    trace.SpanContextFromContext(c.Request.Context()),
 	}
 
-	s.register <- client
+	select {
+	case s.register <- client:
+	case <-s.done:
+	}
 
 	// Start client goroutines
 	go s.handleClientWrite(client)
@@ -194,7 +356,7 @@ func (s *RealtimeService) validateWebSocketAuth(c *gin.Context) (*models.User, e
 	}
 
 	// Verify user exists and is valid
-	user, err := s.db.GetUserByID(context.Background(), userID)
+	user, err := s.db.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %w", err)
 	}
@@ -207,6 +369,12 @@ func (s *RealtimeService) registerClient(client *Client) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Connections that were still queued when Shutdown ran are closed right away
+	if s.shuttingDown {
+		close(client.send)
+		return
+	}
+
 	// Initialize board client map if needed
 	if s.clients[client.boardID] == nil {
 		s.clients[client.boardID] = make(map[*Client]bool)
@@ -254,21 +422,16 @@ func (s *RealtimeService) unregisterClient(client *Client) {
 
 // broadcastToBoard sends message to all clients in a board
 func (s *RealtimeService) broadcastToBoard(message *WebSocketMessage) {
-	s.mu.RLock()
-	clients := s.clients[message.BoardID]
-	s.mu.RUnlock()
-
-	if clients == nil {
-		return
-	}
-
 	messageBytes, err := json.Marshal(message)
 	if err != nil {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
 
-	for client := range clients {
+	// Hold the lock while sending so Shutdown cannot close a send channel in between
+	var full []*Client
+	s.mu.RLock()
+	for client := range s.clients[message.BoardID] {
 		// Don't send message back to sender
 		if client.userID.String() == message.UserID {
 			continue
@@ -277,16 +440,21 @@ func (s *RealtimeService) broadcastToBoard(message *WebSocketMessage) {
 		select {
 		case client.send <- messageBytes:
 		default:
-			// Client buffer full, disconnect
-			s.unregister <- client
+			full = append(full, client)
 		}
 	}
+	s.mu.RUnlock()
+
+	// Client buffer full, disconnect
+	for _, client := range full {
+		s.disconnect(client)
+	}
 }
 
 // handleClientRead processes incoming messages from client
 func (s *RealtimeService) handleClientRead(client *Client) {
 	defer func() {
-		s.unregister <- client
+		s.disconnect(client)
 		client.conn.Close()
 	}()
 
@@ -313,8 +481,19 @@ func (s *RealtimeService) handleClientRead(client *Client) {
 			break
 		}
 
+		// Each message is its own trace, linked to the request that opened the connection
+		ctx, span := tracing.Start(context.Background(), "WebSocket "+message.Type,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithLinks(trace.Link{SpanContext: client.trace}),
+			trace.WithAttributes(
+				attribute.String("websocket.message.type", message.Type),
+				attribute.String("board.id", client.boardID),
+				attribute.String("user.id", client.userID.String()),
+			))
+
 		// Process message based on type
-		s.handleClientMessage(client, &message)
+		s.handleClientMessage(ctx, client, &message)
+		span.End()
 	}
 }
 
@@ -324,6 +503,7 @@ func (s *RealtimeService) handleClientWrite(client *Client) {
 	defer func() {
 		ticker.Stop()
 		client.conn.Close()
+		s.writers.Done()
 	}()
 
 	for {
@@ -334,7 +514,11 @@ func (s *RealtimeService) handleClientWrite(client *Client) {
 				return
 			}
 			if !ok {
-				_ = client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				closeMessage := []byte{}
+				if s.isShuttingDown() {
+					closeMessage = restartCloseMessage()
+				}
+				_ = client.conn.WriteMessage(websocket.CloseMessage, closeMessage)
 				return
 			}
 
@@ -356,7 +540,7 @@ func (s *RealtimeService) handleClientWrite(client *Client) {
 }
 
 // handleClientMessage processes different message types
-func (s *RealtimeService) handleClientMessage(client *Client, message *WebSocketMessage) {
+func (s *RealtimeService) handleClientMessage(ctx context.Context, client *Client, message *WebSocketMessage) {
 	// Validate message
 	if message.BoardID != client.boardID {
 		s.sendErrorToClient(client, "Board ID mismatch")
@@ -369,9 +553,9 @@ func (s *RealtimeService) handleClientMessage(client *Client, message *WebSocket
 
 	switch message.Type {
 	case MessageTypeTaskMove:
-		s.handleTaskMove(client, message)
+		s.handleTaskMove(ctx, client, message)
 	case MessageTypeTaskUpdate:
-		s.handleTaskUpdate(client, message)
+		s.handleTaskUpdate(ctx, client, message)
 	case MessageTypeCursorMove:
 		s.handleCursorMove(client, message)
 	case MessageTypeUserPresence:
@@ -382,7 +566,7 @@ func (s *RealtimeService) handleClientMessage(client *Client, message *WebSocket
 }
 
 // handleTaskMove processes task movement between columns
-func (s *RealtimeService) handleTaskMove(client *Client, message *WebSocketMessage) {
+func (s *RealtimeService) handleTaskMove(ctx context.Context, client *Client, message *WebSocketMessage) {
 	// Extract task movement data
 	taskID, _ := message.Data["task_id"].(string)
 	columnID, _ := message.Data["column_id"].(string)
@@ -406,6 +590,25 @@ func (s *RealtimeService) handleTaskMove(client *Client, message *WebSocketMessa
 		return
 	}
 
+	current, err := s.db.GetTask(ctx, taskUUID)
+	if err != nil {
+		s.sendErrorToClient(client, "Task not found")
+		return
+	}
+
+	// Same rule as the HTTP move: blocked tasks only enter a done column when forced
+	if force, _ := message.Data["force"].(bool); !force {
+		column, err := s.db.GetColumn(ctx, columnUUID)
+		if err != nil {
+			s.sendErrorToClient(client, "Invalid column ID")
+			return
+		}
+		if column.IsDone() && current.ColumnID != columnUUID && len(current.OpenBlockers()) > 0 {
+			s.sendErrorToClient(client, "Task is blocked by unfinished tasks")
+			return
+		}
+	}
+
 	// Update task in database
 	updates := map[string]interface{}{
 		"column_id": columnUUID,
@@ -413,21 +616,28 @@ func (s *RealtimeService) handleTaskMove(client *Client, message *WebSocketMessa
 		"version":   int(version) + 1,
 	}
 
-	err = s.db.UpdateTask(context.Background(), taskUUID, updates)
+	err = s.db.UpdateTask(ctx, taskUUID, updates)
 	if err != nil {
 		s.sendErrorToClient(client, fmt.Sprintf("Failed to move task: %v", err))
 		return
 	}
 
+	if current.ColumnID != columnUUID {
+		err = s.db.RecordColumnEvent(ctx, taskUUID, current.BoardID, &current.ColumnID, columnUUID, &client.userID)
+		if err != nil {
+			log.Printf("Failed to record task move: %v", err)
+		}
+	}
+
 	// Get updated task for broadcasting
-	task, err := s.db.GetTask(context.Background(), taskUUID)
+	task, err := s.db.GetTask(ctx, taskUUID)
 	if err != nil {
 		log.Printf("Failed to get updated task: %v", err)
 		return
 	}
 
 	// Render updated task HTML using existing Templ component
-	taskHTML, err := s.renderTaskCard(task)
+	taskHTML, err := s.renderTaskCard(ctx, task)
 	if err != nil {
 		log.Printf("Failed to render task HTML: %v", err)
 		return
@@ -447,11 +657,11 @@ func (s *RealtimeService) handleTaskMove(client *Client, message *WebSocketMessa
 		},
 	}
 
-	s.broadcast <- htmxMessage
+	s.publish(htmxMessage)
 }
 
 // handleTaskUpdate processes task property updates
-func (s *RealtimeService) handleTaskUpdate(client *Client, message *WebSocketMessage) {
+func (s *RealtimeService) handleTaskUpdate(ctx context.Context, client *Client, message *WebSocketMessage) {
 	taskID, _ := message.Data["task_id"].(string)
 	updates, _ := message.Data["updates"].(map[string]interface{})
 
@@ -487,6 +697,23 @@ func (s *RealtimeService) handleTaskUpdate(client *Client, message *WebSocketMes
 					validatedUpdates[key] = userID
 				}
 			}
+		case "custom_fields":
+			values, ok := value.(map[string]interface{})
+			if !ok {
+				s.sendErrorToClient(client, "Invalid custom field values")
+				return
+			}
+			task, err := s.db.GetTask(ctx, taskUUID)
+			if err != nil || task.BoardID.String() != client.boardID {
+				s.sendErrorToClient(client, "Task not found")
+				return
+			}
+			merged, err := s.db.ApplyCustomFieldValues(ctx, task.BoardID, task.CustomFields, values)
+			if err != nil {
+				s.sendErrorToClient(client, err.Error())
+				return
+			}
+			validatedUpdates[key] = merged
 		}
 	}
 
@@ -496,7 +723,7 @@ func (s *RealtimeService) handleTaskUpdate(client *Client, message *WebSocketMes
 	}
 
 	// Update task in database
-	err = s.db.UpdateTask(context.Background(), taskUUID, validatedUpdates)
+	err = s.db.UpdateTask(ctx, taskUUID, validatedUpdates)
 	if err != nil {
 		s.sendErrorToClient(client, fmt.Sprintf("Failed to update task: %v", err))
 		return
@@ -514,7 +741,7 @@ func (s *RealtimeService) handleTaskUpdate(client *Client, message *WebSocketMes
 		},
 	}
 
-	s.broadcast <- broadcastMessage
+	s.publish(broadcastMessage)
 }
 
 // handleCursorMove processes live cursor position updates
@@ -540,7 +767,7 @@ func (s *RealtimeService) handleCursorMove(client *Client, message *WebSocketMes
 		},
 	}
 
-	s.broadcast <- broadcastMessage
+	s.publish(broadcastMessage)
 }
 
 // handlePresenceUpdate processes user presence changes
@@ -565,7 +792,7 @@ func (s *RealtimeService) handlePresenceUpdate(client *Client, message *WebSocke
 		},
 	}
 
-	s.broadcast <- broadcastMessage
+	s.publish(broadcastMessage)
 }
 
 // Database helper methods
@@ -635,7 +862,7 @@ func (s *RealtimeService) broadcastPresenceUpdate(boardID string, userID uuid.UU
 		},
 	}
 
-	s.broadcast <- message
+	s.publish(message)
 }
 
 // sendBoardSnapshot sends current board state to newly connected client
@@ -720,30 +947,38 @@ func (s *RealtimeService) getOnlineUsers(boardID string) []map[string]interface{
 	if err == nil {
 		presences, err := s.db.GetBoardPresence(context.Background(), boardUUID)
 		if err == nil {
+			// Only show users who were active in the last 5 minutes
+			var recent []models.UserPresence
+			var recentIDs []uuid.UUID
 			for _, presence := range presences {
 				// Skip if already in active users list
-				if seen[presence.UserID] {
+				if seen[presence.UserID] || now.Sub(presence.LastActivity) > 5*time.Minute {
 					continue
 				}
+				recent = append(recent, presence)
+				recentIDs = append(recentIDs, presence.UserID)
+			}
 
-				// Only show users who were active in the last 5 minutes
-				timeSinceActive := now.Sub(presence.LastActivity)
-				if timeSinceActive <= 5*time.Minute {
-					// Get user details
-					user, err := s.db.GetUserByID(context.Background(), presence.UserID)
-					if err == nil && user != nil {
-						users = append(users, map[string]interface{}{
-							"id":         user.ID.String(),
-							"name":       user.Name,
-							"initials":   user.GetInitials(),
-							"email":      user.Email,
-							"avatar_url": user.AvatarURL,
-							"last_seen":  presence.LastActivity,
-							"status":     "offline", // Gray dot for recently offline
-						})
-						seen[presence.UserID] = true
-					}
+			// Get user details in one query
+			recentUsers, err := s.db.GetUsersByIDs(context.Background(), recentIDs)
+			if err != nil {
+				log.Printf("Failed to get recently online users: %v", err)
+			}
+			for _, presence := range recent {
+				user := recentUsers[presence.UserID]
+				if user == nil || seen[presence.UserID] {
+					continue
 				}
+				users = append(users, map[string]interface{}{
+					"id":         user.ID.String(),
+					"name":       user.Name,
+					"initials":   user.GetInitials(),
+					"email":      user.Email,
+					"avatar_url": user.AvatarURL,
+					"last_seen":  presence.LastActivity,
+					"status":     "offline", // Gray dot for recently offline
+				})
+				seen[presence.UserID] = true
 			}
 		}
 	}
@@ -776,14 +1011,18 @@ func (s *RealtimeService) sendErrorToClient(client *Client, errorMsg string) {
 }
 
 // renderTaskCard renders task HTML using existing Templ components
-func (s *RealtimeService) renderTaskCard(task *models.Task) (string, error) {
+func (s *RealtimeService) renderTaskCard(ctx context.Context, task *models.Task) (string, error) {
+	ctx, span := tracing.Start(ctx, "renderTaskCard", trace.WithAttributes(attribute.String("task.id", task.ID.String())))
+	defer span.End()
+
 	// Use your existing task card component
 	component := components.TaskCard(*task)
 
 	// Render to string
 	var htmlBuilder strings.Builder
-	err := component.Render(context.Background(), &htmlBuilder)
+	err := component.Render(ctx, &htmlBuilder)
 	if err != nil {
+		tracing.RecordError(span, err)
 		return "", fmt.Errorf("failed to render task card: %w", err)
 	}
 
@@ -839,8 +1078,38 @@ func (s *RealtimeService) GetConnectedUsersCount(boardID string) int {
 	return len(userSet)
 }
 
+// HubStats is a snapshot of the hub's queues and connections
+type HubStats struct {
+	BroadcastQueue    int  `json:"broadcast_queue"`
+	BroadcastCapacity int  `json:"broadcast_capacity"`
+	RegisterQueue     int  `json:"register_queue"`
+	UnregisterQueue   int  `json:"unregister_queue"`
+	Connections       int  `json:"connections"`
+	Boards            int  `json:"boards"`
+	ShuttingDown      bool `json:"shutting_down"`
+}
+
+// Stats reports how far the hub is behind and how many connections it serves
+func (s *RealtimeService) Stats() HubStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := HubStats{
+		BroadcastQueue:    len(s.broadcast),
+		BroadcastCapacity: cap(s.broadcast),
+		RegisterQueue:     len(s.register),
+		UnregisterQueue:   len(s.unregister),
+		Boards:            len(s.clients),
+		ShuttingDown:      s.shuttingDown,
+	}
+	for _, clients := range s.clients {
+		stats.Connections += len(clients)
+	}
+	return stats
+}
+
 // BroadcastTaskUpdate sends task updates to all board clients
-func (s *RealtimeService) BroadcastTaskUpdate(boardID string, task *models.Task, updateType string) {
+func (s *RealtimeService) BroadcastTaskUpdate(ctx context.Context, boardID string, task *models.Task, updateType string) {
 	message := &WebSocketMessage{
 		Type:      MessageTypeHTMXUpdate,
 		BoardID:   boardID,
@@ -859,7 +1128,7 @@ func (s *RealtimeService) BroadcastTaskUpdate(boardID string, task *models.Task,
 		log.Printf("Broadcasting delete notification for task %s", task.ID.String())
 	} else {
 		// For other updates, render the task card HTML
-		taskHTML, err := s.renderTaskCard(task)
+		taskHTML, err := s.renderTaskCard(ctx, task)
 		if err != nil {
 			log.Printf("Failed to render task for broadcast: %v", err)
 			return
@@ -906,7 +1175,7 @@ func (s *RealtimeService) BroadcastMemberAdded(boardID string, member *models.Us
 		},
 	}
 
-	s.broadcast <- message
+	s.publish(message)
 	log.Printf("Broadcast member added to board %s: %s", boardID, member.GetDisplayName())
 }
 
@@ -946,7 +1215,7 @@ func (s *RealtimeService) BroadcastMemberRemoved(boardID string, memberID uuid.U
 		},
 	}
 
-	s.broadcast <- message
+	s.publish(message)
 	log.Printf("Broadcast member removed from board %s: %s", boardID, memberID.String())
 }
 
@@ -971,7 +1240,7 @@ func (s *RealtimeService) BroadcastPresenceUpdate(boardID string) {
 		},
 	}
 
-	s.broadcast <- message
+	s.publish(message)
 }
 
 // renderPresenceIndicator renders presence indicator HTML with online/offline status
@@ -0,0 +1,285 @@
+package recurrence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"sudo/internal/database"
+	"sudo/internal/models"
+	"sudo/internal/realtime"
+	"sudo/internal/rrule"
+
+	"github.com/google/uuid"
+)
+
+const (
+	pollInterval = time.Minute
+	batchSize    = 50
+)
+
+var (
+	ErrAlreadyRecurring = errors.New("task already belongs to an active series")
+	ErrNoOccurrences    = errors.New("rule has no occurrences after the first one")
+	ErrNotActive        = errors.New("series has ended or was stopped")
+
+	// errBrokenSeries marks series that can never produce another instance
+	errBrokenSeries = errors.New("broken series")
+)
+
+// Service generates the instances of recurring tasks, either when the latest instance is
+// completed or when the next occurrence comes due
+type Service struct {
+	db       *database.DB
+	realtime *realtime.RealtimeService
+	now      func() time.Time
+}
+
+func NewService(db *database.DB, rt *realtime.RealtimeService) *Service {
+	return &Service{
+		db:       db,
+		realtime: rt,
+		now:      time.Now,
+	}
+}
+
+// Start makes task the first instance of a new series starting at startsAt. The task's
+// deadline is kept as an offset from each occurrence.
+func (s *Service) Start(ctx context.Context, task *models.Task, rule *rrule.Rule, startsAt time.Time, userID uuid.UUID) (*models.TaskRecurrence, error) {
+	if task.Recurrence != nil && task.Recurrence.Active {
+		return nil, ErrAlreadyRecurring
+	}
+
+	next, ok := rule.Next(startsAt, startsAt)
+	if !ok || rule.Count == 1 {
+		return nil, ErrNoOccurrences
+	}
+
+	recurrence := &models.TaskRecurrence{
+		BoardID:          task.BoardID,
+		Rule:             rule.String(),
+		StartsAt:         startsAt,
+		Occurrences:      1,
+		NextOccurrenceAt: &next,
+		CreatedBy:        &userID,
+	}
+	if task.Deadline != nil {
+		offset := int64(task.Deadline.Sub(startsAt) / time.Second)
+		recurrence.DeadlineOffset = &offset
+	}
+
+	return s.db.CreateTaskRecurrence(ctx, task.ID, recurrence)
+}
+
+// TaskCompleted creates the next instance right away when the latest instance of a series
+// is completed, instead of waiting for the next occurrence to come due
+func (s *Service) TaskCompleted(ctx context.Context, task *models.Task, userID uuid.UUID) {
+	if task.RecurrenceID == nil {
+		return
+	}
+
+	recurrence, err := s.db.GetTaskRecurrence(ctx, *task.RecurrenceID)
+	if err != nil {
+		log.Printf("[RECURRENCE] Failed to load series of task %s: %v", task.ID.String(), err)
+		return
+	}
+	if !recurrence.Active || recurrence.NextOccurrenceAt == nil ||
+		recurrence.CurrentTaskID == nil || *recurrence.CurrentTaskID != task.ID {
+		return
+	}
+
+	if _, err := s.generate(ctx, recurrence, &userID, false); err != nil {
+		log.Printf("[RECURRENCE] Failed to create next instance of series %s: %v", recurrence.ID.String(), err)
+	}
+}
+
+// Skip drops the next occurrence of the series without creating a task for it
+func (s *Service) Skip(ctx context.Context, recurrence *models.TaskRecurrence) (*models.TaskRecurrence, error) {
+	if !recurrence.Active || recurrence.NextOccurrenceAt == nil {
+		return nil, ErrNotActive
+	}
+
+	rule, err := rrule.Parse(recurrence.Rule)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stored rule: %w", err)
+	}
+
+	updates := s.advanceUpdates(rule, recurrence, false)
+	won, err := s.db.AdvanceTaskRecurrence(ctx, recurrence.ID, recurrence.Occurrences, updates)
+	if err != nil {
+		return nil, err
+	}
+	if !won {
+		return nil, fmt.Errorf("series changed in the meantime, please retry")
+	}
+
+	return s.db.GetTaskRecurrence(ctx, recurrence.ID)
+}
+
+// Stop ends the series; tasks created so far are kept
+func (s *Service) Stop(ctx context.Context, recurrence *models.TaskRecurrence) error {
+	return s.db.UpdateTaskRecurrence(ctx, recurrence.ID, map[string]interface{}{
+		"active":             false,
+		"next_occurrence_at": nil,
+	})
+}
+
+// Run creates the instances of series that came due until ctx is cancelled
+func (s *Service) Run(ctx context.Context) {
+	log.Printf("[RECURRENCE] Scheduler started")
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		s.processDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			log.Printf("[RECURRENCE] Scheduler stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Service) processDue(ctx context.Context) {
+	for ctx.Err() == nil {
+		due, err := s.db.ListDueRecurrences(ctx, s.now(), batchSize)
+		if err != nil {
+			log.Printf("[RECURRENCE] Failed to list due series: %v", err)
+			return
+		}
+
+		failed := 0
+		for i := range due {
+			if _, err := s.generate(ctx, &due[i], due[i].CreatedBy, true); err != nil {
+				failed++
+				log.Printf("[RECURRENCE] Failed to create instance of series %s: %v", due[i].ID.String(), err)
+				// Stop a broken series so it isn't retried every minute
+				if errors.Is(err, errBrokenSeries) {
+					if stopErr := s.Stop(ctx, &due[i]); stopErr != nil {
+						log.Printf("[RECURRENCE] Failed to stop series %s: %v", due[i].ID.String(), stopErr)
+					}
+				}
+			}
+		}
+
+		// Series that failed are still due; leave them for the next tick
+		if len(due) < batchSize || failed > 0 {
+			return
+		}
+	}
+}
+
+// advanceUpdates moves the series past its next occurrence. When catchUp is set,
+// occurrences that were missed (e.g. while the server was down) are passed over too.
+func (s *Service) advanceUpdates(rule *rrule.Rule, recurrence *models.TaskRecurrence, catchUp bool) map[string]interface{} {
+	following, ok := rule.Next(recurrence.StartsAt, *recurrence.NextOccurrenceAt)
+	if catchUp {
+		now := s.now()
+		for ok && !following.After(now) {
+			following, ok = rule.Next(recurrence.StartsAt, following)
+		}
+	}
+
+	used := recurrence.Occurrences + 1
+	if rule.Count > 0 && used >= rule.Count {
+		ok = false
+	}
+
+	updates := map[string]interface{}{
+		"occurrences":        used,
+		"next_occurrence_at": nil,
+		"active":             ok,
+	}
+	if ok {
+		updates["next_occurrence_at"] = following.UTC()
+	}
+	return updates
+}
+
+// generate creates the instance for the series' next occurrence from its latest instance.
+// It returns nil without an error if another caller got there first.
+func (s *Service) generate(ctx context.Context, recurrence *models.TaskRecurrence, actorID *uuid.UUID, catchUp bool) (*models.Task, error) {
+	rule, err := rrule.Parse(recurrence.Rule)
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse stored rule: %v", errBrokenSeries, err)
+	}
+	if recurrence.CurrentTaskID == nil {
+		return nil, fmt.Errorf("%w: latest instance was deleted", errBrokenSeries)
+	}
+	template, err := s.db.GetTask(ctx, *recurrence.CurrentTaskID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load latest instance: %w", err)
+	}
+	column, err := s.db.GetFirstColumn(ctx, recurrence.BoardID)
+	if err != nil {
+		return nil, err
+	}
+
+	occurrence := *recurrence.NextOccurrenceAt
+	won, err := s.db.AdvanceTaskRecurrence(ctx, recurrence.ID, recurrence.Occurrences, s.advanceUpdates(rule, recurrence, catchUp))
+	if err != nil || !won {
+		return nil, err
+	}
+
+	task, err := s.db.CreateTask(ctx, template.Title, template.Description, column.ID, recurrence.BoardID, template.Priority)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{
+		"recurrence_id": recurrence.ID.String(),
+	}
+	if len(template.Tags) > 0 {
+		updates["tags"] = template.Tags
+	}
+	if template.EstimatedHours != nil {
+		updates["estimated_hours"] = *template.EstimatedHours
+	}
+	if recurrence.DeadlineOffset != nil {
+		updates["deadline"] = occurrence.Add(time.Duration(*recurrence.DeadlineOffset) * time.Second).UTC()
+	}
+	if err := s.db.UpdateTask(ctx, task.ID, updates); err != nil {
+		log.Printf("[RECURRENCE] Failed to copy details to task %s: %v", task.ID.String(), err)
+	}
+
+	for _, assignee := range template.Assignees {
+		assignedBy := assignee.UserID
+		if assignee.AssignedBy != nil {
+			assignedBy = *assignee.AssignedBy
+		}
+		if err := s.db.AddTaskAssignee(ctx, task.ID, assignee.UserID, assignedBy); err != nil {
+			log.Printf("[RECURRENCE] Failed to carry over assignee %s: %v", assignee.UserID.String(), err)
+		}
+	}
+
+	if err := s.db.UpdateTaskRecurrence(ctx, recurrence.ID, map[string]interface{}{"current_task_id": task.ID.String()}); err != nil {
+		return nil, err
+	}
+
+	if actorID != nil {
+		err = s.db.LogActivity(ctx, *actorID, recurrence.BoardID, &task.ID, "task_create",
+			fmt.Sprintf("Created recurring task: %s", task.Title), map[string]interface{}{
+				"recurrence_id": recurrence.ID.String(),
+				"occurrence_at": occurrence,
+			})
+		if err != nil {
+			log.Printf("[RECURRENCE] Failed to log activity: %v", err)
+		}
+	}
+
+	created, err := s.db.GetTask(ctx, task.ID)
+	if err != nil {
+		return task, nil
+	}
+	if s.realtime != nil {
+		s.realtime.BroadcastTaskUpdate(ctx, recurrence.BoardID.String(), created, "created")
+	}
+
+	log.Printf("[RECURRENCE] Created instance %d of series %s: task %s", recurrence.Occurrences+1, recurrence.ID.String(), task.ID.String())
+	return created, nil
+}
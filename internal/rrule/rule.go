@@ -0,0 +1,327 @@
+package rrule
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported frequencies (RFC 5545 FREQ values)
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the search for the next occurrence of rules that rarely or never match,
+// e.g. BYMONTHDAY=30 with a yearly interval starting in February
+const maxPeriods = 1000
+
+var weekdayCodes = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// Rule is the subset of an iCalendar RRULE we support: FREQ, INTERVAL, BYDAY (without
+// ordinals), BYMONTHDAY, COUNT and UNTIL
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []time.Weekday
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// Parse reads an RRULE such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10". A leading
+// "RRULE:" is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, fmt.Errorf("empty recurrence rule")
+	}
+
+	rule := &Rule{Interval: 1}
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		key = strings.ToUpper(strings.TrimSpace(key))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("invalid rule part %q", part)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%s given twice", key)
+		}
+		seen[key] = true
+
+		switch key {
+		case "FREQ":
+			switch value {
+			case Daily, Weekly, Monthly, Yearly:
+				rule.Freq = value
+			default:
+				return nil, fmt.Errorf("unsupported frequency %q", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 || interval > 1000 {
+				return nil, fmt.Errorf("invalid interval %q", value)
+			}
+			rule.Interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 || count > 10000 {
+				return nil, fmt.Errorf("invalid count %q", value)
+			}
+			rule.Count = count
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, code := range strings.Split(value, ",") {
+				day, ok := parseWeekday(code)
+				if !ok {
+					return nil, fmt.Errorf("unsupported BYDAY value %q", code)
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				day, err := strconv.Atoi(v)
+				if err != nil || day == 0 || day < -31 || day > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY value %q", v)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, day)
+			}
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, fmt.Errorf("FREQ is required")
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq != Monthly {
+		return nil, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if len(rule.ByDay) > 0 && rule.Freq == Yearly {
+		return nil, fmt.Errorf("BYDAY is not supported with FREQ=YEARLY")
+	}
+
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102T150405", "20060102"} {
+		if until, err := time.Parse(layout, value); err == nil {
+			if layout == "20060102" {
+				// A date-only UNTIL includes the whole day
+				until = until.Add(24*time.Hour - time.Second)
+			}
+			return until, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL %q", value)
+}
+
+func parseWeekday(code string) (time.Weekday, bool) {
+	for i, c := range weekdayCodes {
+		if c == strings.TrimSpace(code) {
+			return time.Weekday(i), true
+		}
+	}
+	return 0, false
+}
+
+// String formats the rule back into RRULE syntax
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		codes := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			codes[i] = weekdayCodes[day]
+		}
+		parts = append(parts, "BYDAY="+strings.Join(codes, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			days[i] = strconv.Itoa(day)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Describe returns a short human-readable summary, e.g. "Every 2 weeks on Mon, Wed, 10 times"
+func (r *Rule) Describe() string {
+	units := map[string]string{Daily: "day", Weekly: "week", Monthly: "month", Yearly: "year"}
+	names := map[string]string{Daily: "Daily", Weekly: "Weekly", Monthly: "Monthly", Yearly: "Yearly"}
+
+	description := names[r.Freq]
+	if r.Interval > 1 {
+		description = fmt.Sprintf("Every %d %ss", r.Interval, units[r.Freq])
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, day := range r.ByDay {
+			days[i] = day.String()[:3]
+		}
+		description += " on " + strings.Join(days, ", ")
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, day := range r.ByMonthDay {
+			if day == -1 {
+				days[i] = "last day"
+			} else {
+				days[i] = fmt.Sprintf("day %d", day)
+			}
+		}
+		description += " on " + strings.Join(days, ", ")
+	}
+
+	if r.Count > 0 {
+		description += fmt.Sprintf(", %d times", r.Count)
+	}
+	if r.Until != nil {
+		description += ", until " + r.Until.Format("Jan 2, 2006")
+	}
+	return description
+}
+
+// Next returns the first occurrence of a series starting at start that comes strictly after
+// after. ok is false once the rule has no more occurrences (UNTIL passed or nothing matches).
+// COUNT is not applied here since it depends on how many occurrences the caller used up.
+func (r *Rule) Next(start, after time.Time) (time.Time, bool) {
+	first := r.firstPeriod(start, after)
+	for k := first; k < first+maxPeriods; k++ {
+		for _, candidate := range r.period(start, k) {
+			if candidate.Before(start) || !candidate.After(after) {
+				continue
+			}
+			if r.Until != nil && candidate.After(*r.Until) {
+				return time.Time{}, false
+			}
+			return candidate, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// firstPeriod estimates the earliest period index that can contain an occurrence after after
+func (r *Rule) firstPeriod(start, after time.Time) int {
+	if !after.After(start) {
+		return 0
+	}
+
+	var elapsed int
+	switch r.Freq {
+	case Daily:
+		elapsed = int(after.Sub(start).Hours() / 24)
+	case Weekly:
+		elapsed = int(after.Sub(start).Hours() / (24 * 7))
+	case Monthly:
+		elapsed = (after.Year()-start.Year())*12 + int(after.Month()) - int(start.Month())
+	case Yearly:
+		elapsed = after.Year() - start.Year()
+	}
+
+	// Step back one period to stay clear of rounding at period boundaries
+	if k := elapsed/r.Interval - 1; k > 0 {
+		return k
+	}
+	return 0
+}
+
+// period returns the sorted occurrences in the k-th period of the series
+func (r *Rule) period(start time.Time, k int) []time.Time {
+	hour, minute, second := start.Clock()
+	loc := start.Location()
+
+	var occurrences []time.Time
+	switch r.Freq {
+	case Daily:
+		day := start.AddDate(0, 0, k*r.Interval)
+		if r.matchesDay(day.Weekday()) {
+			occurrences = append(occurrences, day)
+		}
+
+	case Weekly:
+		// Weeks start on Monday (the RRULE default WKST)
+		monday := start.AddDate(0, 0, -((int(start.Weekday())+6)%7)+7*k*r.Interval)
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		for _, weekday := range days {
+			occurrences = append(occurrences, monday.AddDate(0, 0, (int(weekday)+6)%7))
+		}
+
+	case Monthly:
+		first := time.Date(start.Year(), start.Month()+time.Month(k*r.Interval), 1, hour, minute, second, 0, loc)
+		daysInMonth := first.AddDate(0, 1, -1).Day()
+
+		var days []int
+		switch {
+		case len(r.ByMonthDay) > 0:
+			days = r.ByMonthDay
+		case len(r.ByDay) > 0:
+			for day := 1; day <= daysInMonth; day++ {
+				if r.matchesDay(first.AddDate(0, 0, day-1).Weekday()) {
+					days = append(days, day)
+				}
+			}
+		default:
+			days = []int{start.Day()}
+		}
+
+		for _, day := range days {
+			if day < 0 {
+				day = daysInMonth + day + 1
+			}
+			// Months without that day are skipped, as in RFC 5545
+			if day >= 1 && day <= daysInMonth {
+				occurrences = append(occurrences, first.AddDate(0, 0, day-1))
+			}
+		}
+
+	case Yearly:
+		date := time.Date(start.Year()+k*r.Interval, start.Month(), start.Day(), hour, minute, second, 0, loc)
+		if date.Month() == start.Month() {
+			occurrences = append(occurrences, date)
+		}
+	}
+
+	sort.Slice(occurrences, func(i, j int) bool { return occurrences[i].Before(occurrences[j]) })
+	return occurrences
+}
+
+func (r *Rule) matchesDay(weekday time.Weekday) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, day := range r.ByDay {
+		if day == weekday {
+			return true
+		}
+	}
+	return false
+}
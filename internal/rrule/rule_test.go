@@ -0,0 +1,126 @@
+package rrule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	rule, err := Parse("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := rule.String(); got != "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10" {
+		t.Errorf("String() = %q", got)
+	}
+	if got := rule.Describe(); got != "Every 2 weeks on Mon, Wed, 10 times" {
+		t.Errorf("Describe() = %q", got)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;COUNT=3;UNTIL=20250101",
+		"FREQ=WEEKLY;BYDAY=1MO",
+		"FREQ=WEEKLY;BYMONTHDAY=3",
+		"FREQ=DAILY;FREQ=WEEKLY",
+		"FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := Parse(invalid); err == nil {
+			t.Errorf("Parse(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// Monday 2025-03-03 09:00 UTC
+	start := time.Date(2025, 3, 3, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		rule  string
+		after time.Time
+		want  []time.Time
+	}{
+		{
+			rule:  "FREQ=DAILY;INTERVAL=3",
+			after: start,
+			want: []time.Time{
+				time.Date(2025, 3, 6, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 9, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			rule:  "FREQ=WEEKLY;BYDAY=MO,FR",
+			after: start,
+			want: []time.Time{
+				time.Date(2025, 3, 7, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 10, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 14, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			rule:  "FREQ=WEEKLY;INTERVAL=2",
+			after: time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2025, 6, 9, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 6, 23, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			// Months without a 31st are skipped
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31",
+			after: start,
+			want: []time.Time{
+				time.Date(2025, 3, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 5, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 7, 31, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=-1",
+			after: start,
+			want: []time.Time{
+				time.Date(2025, 3, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 4, 30, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			rule:  "FREQ=DAILY;UNTIL=20250305",
+			after: start,
+			want: []time.Time{
+				time.Date(2025, 3, 4, 9, 0, 0, 0, time.UTC),
+				time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		rule, err := Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", tt.rule, err)
+		}
+
+		after := tt.after
+		for _, want := range tt.want {
+			got, ok := rule.Next(start, after)
+			if !ok || !got.Equal(want) {
+				t.Errorf("%s: Next after %s = %s (%v), want %s", tt.rule, after, got, ok, want)
+				break
+			}
+			after = got
+		}
+	}
+
+	until, _ := Parse("FREQ=DAILY;UNTIL=20250305")
+	if got, ok := until.Next(start, time.Date(2025, 3, 5, 9, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("Next after UNTIL should end the series, got %s", got)
+	}
+
+	// Feb 30th never exists, so the search must give up instead of looping forever
+	never, _ := Parse("FREQ=MONTHLY;INTERVAL=12;BYMONTHDAY=30")
+	if got, ok := never.Next(time.Date(2025, 2, 1, 9, 0, 0, 0, time.UTC), start); ok {
+		t.Errorf("Rule without occurrences returned %s", got)
+	}
+}
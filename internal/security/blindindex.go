@@ -0,0 +1,94 @@
+package security
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+const (
+	// Key derivation contexts for the cached per-key secrets
+	emailContext      = "email-v2"
+	blindIndexContext = "email-index"
+
+	// Marks the randomized email format; '.' never appears in standard base64,
+	// so it cannot be confused with the legacy deterministic format
+	randomizedEmailMarker = "r."
+)
+
+// cachedKey derives a key for (key version, context) with Argon2id once and reuses it,
+// instead of running Argon2id on every encryption like the legacy per-email salt scheme.
+func (cs *CryptoService) cachedKey(version int, masterKey []byte, context string, size uint32) []byte {
+	cacheKey := "key/" + strconv.Itoa(version) + "/" + context
+	if key, ok := cs.derivedKeys.Load(cacheKey); ok {
+		return key.([]byte)
+	}
+
+	salt := sha256.Sum256([]byte("sudo-kdf:" + context))
+	key := argon2.IDKey(
+		append(masterKey[:len(masterKey):len(masterKey)], []byte(context)...),
+		salt[:],
+		argonTime,
+		argonMemory,
+		argonThreads,
+		size,
+	)
+
+	actual, _ := cs.derivedKeys.LoadOrStore(cacheKey, key)
+	return actual.([]byte)
+}
+
+// emailCipher returns the cached AES-GCM instance for a key version
+func (cs *CryptoService) emailCipher(version int, masterKey []byte) (cipher.AEAD, error) {
+	return cs.contextCipher(version, masterKey, emailContext)
+}
+
+// contextCipher returns the cached AES-GCM instance for a key version and context
+func (cs *CryptoService) contextCipher(version int, masterKey []byte, context string) (cipher.AEAD, error) {
+	cacheKey := "aead/" + strconv.Itoa(version) + "/" + context
+	if aead, ok := cs.derivedKeys.Load(cacheKey); ok {
+		return aead.(cipher.AEAD), nil
+	}
+
+	block, err := aes.NewCipher(cs.cachedKey(version, masterKey, context, keySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+
+	actual, _ := cs.derivedKeys.LoadOrStore(cacheKey, gcm)
+	return actual.(cipher.AEAD), nil
+}
+
+// EmailBlindIndex returns a keyed hash of the normalized email for equality lookups.
+// It reveals nothing about the email without the master key and is cheap to compute.
+func (cs *CryptoService) EmailBlindIndex(email string) string {
+	return cs.blindIndex(cs.keyVersion, cs.masterKey, email)
+}
+
+// EmailBlindIndexes returns the blind index under every known key, current first,
+// so rows not yet rotated onto the current key are still found
+func (cs *CryptoService) EmailBlindIndexes(email string) []string {
+	indexes := []string{cs.EmailBlindIndex(email)}
+	for _, version := range cs.previousVersions() {
+		indexes = append(indexes, cs.blindIndex(version, cs.previousKeys[version], email))
+	}
+	return indexes
+}
+
+func (cs *CryptoService) blindIndex(version int, masterKey []byte, email string) string {
+	h := hmac.New(sha256.New, cs.cachedKey(version, masterKey, blindIndexContext, hmacKeySize))
+	h.Write([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return EmailVersionPrefix(version) + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
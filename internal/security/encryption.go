@@ -9,9 +9,14 @@ import (
 	"crypto/subtle"
 	"encoding/base64"
 	"fmt"
-	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"sudo/internal/config"
+
 	"golang.org/x/crypto/argon2"
 )
 
@@ -33,16 +38,87 @@ const (
 )
 
 type CryptoService struct {
-	masterKey []byte
+	masterKey  []byte
+	keyVersion int
+
+	// Keys from earlier versions, kept so data can still be read while it is re-encrypted
+	previousKeys map[int][]byte
+
+	// Derived keys and ciphers, computed once per key version and context
+	derivedKeys sync.Map
+}
+
+// Emails encrypted with key version 1 carry no prefix; later versions are
+// prefixed with "v<version>:" so the right key can be picked.
+const (
+	legacyKeyVersion = 1
+	keyVersionPrefix = "v"
+	keyVersionSep    = ":"
+)
+
+// NewCryptoService creates the encryption service for the configured keys.
+//
+// cfg.MasterKey is the current key and cfg.KeyVersion its version. During a rotation,
+// cfg.PreviousKeys holds the older keys by version so existing ciphertexts remain readable.
+func NewCryptoService(cfg config.Encryption) (*CryptoService, error) {
+	if cfg.MasterKey == "" {
+		return nil, fmt.Errorf("ENCRYPTION_MASTER_KEY is not set")
+	}
+
+	masterKey, err := decodeMasterKey(cfg.MasterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyVersion := cfg.KeyVersion
+	if keyVersion == 0 {
+		keyVersion = legacyKeyVersion
+	}
+	if keyVersion < legacyKeyVersion {
+		return nil, fmt.Errorf("ENCRYPTION_KEY_VERSION must be a positive integer, got %d", keyVersion)
+	}
+
+	previousKeys := make(map[int][]byte)
+	for version, keyB64 := range cfg.PreviousKeys {
+		if version < legacyKeyVersion {
+			return nil, fmt.Errorf("invalid previous key version %d", version)
+		}
+		if version == keyVersion {
+			return nil, fmt.Errorf("previous key version %d clashes with ENCRYPTION_KEY_VERSION", version)
+		}
+
+		key, err := decodeMasterKey(keyB64)
+		if err != nil {
+			return nil, fmt.Errorf("previous key version %d: %w", version, err)
+		}
+		previousKeys[version] = key
+	}
+
+	return &CryptoService{
+		masterKey:    masterKey,
+		keyVersion:   keyVersion,
+		previousKeys: previousKeys,
+	}, nil
 }
 
-// NewCryptoService creates a new encryption service
-func NewCryptoService() (*CryptoService, error) {
-	masterKeyB64 := os.Getenv("ENCRYPTION_MASTER_KEY")
-	if masterKeyB64 == "" {
-		return nil, fmt.Errorf("ENCRYPTION_MASTER_KEY environment variable not set")
+// NewCryptoServiceWithKey creates a service for a single key that is not the configured one,
+// such as the key of the instance a backup is meant for
+func NewCryptoServiceWithKey(masterKeyB64 string, keyVersion int) (*CryptoService, error) {
+	masterKey, err := decodeMasterKey(masterKeyB64)
+	if err != nil {
+		return nil, err
 	}
+	if keyVersion < legacyKeyVersion {
+		return nil, fmt.Errorf("key version must be a positive integer, got %d", keyVersion)
+	}
+	return &CryptoService{
+		masterKey:    masterKey,
+		keyVersion:   keyVersion,
+		previousKeys: make(map[int][]byte),
+	}, nil
+}
 
+func decodeMasterKey(masterKeyB64 string) ([]byte, error) {
 	masterKey, err := base64.StdEncoding.DecodeString(masterKeyB64)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode master key: %w", err)
@@ -52,9 +128,58 @@ func NewCryptoService() (*CryptoService, error) {
 		return nil, fmt.Errorf("master key must be %d bytes, got %d", keySize, len(masterKey))
 	}
 
-	return &CryptoService{
-		masterKey: masterKey,
-	}, nil
+	return masterKey, nil
+}
+
+// KeyVersion returns the version of the key used for new ciphertexts
+func (cs *CryptoService) KeyVersion() int {
+	return cs.keyVersion
+}
+
+// SelfTest encrypts and decrypts a probe value with the current key, so a readiness
+// check finds out the key works before a user does
+func (cs *CryptoService) SelfTest() error {
+	const probe = "readiness@probe.invalid"
+	encrypted, err := cs.EncryptEmail(probe)
+	if err != nil {
+		return err
+	}
+	decrypted, err := cs.DecryptEmail(encrypted)
+	if err != nil {
+		return err
+	}
+	if decrypted != probe || cs.EmailBlindIndex(probe) == "" {
+		return fmt.Errorf("encryption round trip returned a different value")
+	}
+	return nil
+}
+
+// keyForVersion returns the master key for a version, if it is known
+func (cs *CryptoService) keyForVersion(version int) ([]byte, bool) {
+	if version == cs.keyVersion {
+		return cs.masterKey, true
+	}
+	key, ok := cs.previousKeys[version]
+	return key, ok
+}
+
+// allKeys returns every known master key, current first
+func (cs *CryptoService) allKeys() [][]byte {
+	keys := [][]byte{cs.masterKey}
+	for _, version := range cs.previousVersions() {
+		keys = append(keys, cs.previousKeys[version])
+	}
+	return keys
+}
+
+// previousVersions lists the previous key versions, newest first
+func (cs *CryptoService) previousVersions() []int {
+	versions := make([]int, 0, len(cs.previousKeys))
+	for version := range cs.previousKeys {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+	return versions
 }
 
 // GenerateMasterKey generates a new master key for the ENCRYPTION_MASTER_KEY env var
@@ -68,8 +193,17 @@ func GenerateMasterKey() (string, error) {
 
 // deriveKey derives an encryption key from master key + context + salt
 func (cs *CryptoService) deriveKey(context string, salt []byte) []byte {
+	return deriveKeyFrom(cs.masterKey, context, salt)
+}
+
+// deriveHMACKey derives an HMAC key from master key + context + salt
+func (cs *CryptoService) deriveHMACKey(context string, salt []byte) []byte {
+	return deriveHMACKeyFrom(cs.masterKey, context, salt)
+}
+
+func deriveKeyFrom(masterKey []byte, context string, salt []byte) []byte {
 	return argon2.IDKey(
-		append(cs.masterKey, []byte(context)...),
+		append(masterKey[:len(masterKey):len(masterKey)], []byte(context)...),
 		salt,
 		argonTime,
 		argonMemory,
@@ -78,10 +212,9 @@ func (cs *CryptoService) deriveKey(context string, salt []byte) []byte {
 	)
 }
 
-// deriveHMACKey derives an HMAC key from master key + context + salt
-func (cs *CryptoService) deriveHMACKey(context string, salt []byte) []byte {
+func deriveHMACKeyFrom(masterKey []byte, context string, salt []byte) []byte {
 	return argon2.IDKey(
-		append(cs.masterKey, []byte("hmac-"+context)...),
+		append(masterKey[:len(masterKey):len(masterKey)], []byte("hmac-"+context)...),
 		salt,
 		argonTime,
 		argonMemory,
@@ -90,19 +223,157 @@ func (cs *CryptoService) deriveHMACKey(context string, salt []byte) []byte {
 	)
 }
 
-// EncryptEmail encrypts an email with deterministic encryption for queryability
+// EncryptEmail encrypts an email with randomized AES-GCM. Lookups go through EmailBlindIndex
+// because the same email now produces a different ciphertext every time.
 func (cs *CryptoService) EncryptEmail(email string) (string, error) {
 	if email == "" {
 		return "", fmt.Errorf("email cannot be empty")
 	}
 
+	gcm, err := cs.emailCipher(cs.keyVersion, cs.masterKey)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	// Combine: nonce + ciphertext (GCM tag included); the context is bound as additional data
+	result := gcm.Seal(nonce, nonce, []byte(email), []byte(emailContext))
+
+	return EmailVersionPrefix(cs.keyVersion) + randomizedEmailMarker + base64.StdEncoding.EncodeToString(result), nil
+}
+
+// LegacyEmailLookupValues returns the old deterministic ciphertexts of an email under every known key.
+// They only match rows written before the blind index existed and are expensive to compute.
+func (cs *CryptoService) LegacyEmailLookupValues(email string) ([]string, error) {
+	values := make([]string, 0, 1+len(cs.previousKeys))
+
+	current, err := encryptEmailDeterministic(email, cs.keyVersion, cs.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, current)
+
+	for _, version := range cs.previousVersions() {
+		encrypted, err := encryptEmailDeterministic(email, version, cs.previousKeys[version])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, encrypted)
+	}
+	return values, nil
+}
+
+// EmailKeyVersion reports which key version produced an encrypted email
+func EmailKeyVersion(encryptedEmail string) int {
+	version, _ := splitKeyVersion(encryptedEmail)
+	return version
+}
+
+// EmailVersionPrefix is the prefix carried by ciphertexts of the given key version
+func EmailVersionPrefix(version int) string {
+	if version <= legacyKeyVersion {
+		return ""
+	}
+	return keyVersionPrefix + strconv.Itoa(version) + keyVersionSep
+}
+
+// CurrentEmailPrefix is the prefix shared by every email encrypted with the current key and format
+func (cs *CryptoService) CurrentEmailPrefix() string {
+	return EmailVersionPrefix(cs.keyVersion) + randomizedEmailMarker
+}
+
+// ReencryptEmail re-encrypts an email under the current key and format. The boolean is false
+// when the ciphertext is already current and was returned unchanged.
+func (cs *CryptoService) ReencryptEmail(encryptedEmail string) (string, bool, error) {
+	if strings.HasPrefix(encryptedEmail, cs.CurrentEmailPrefix()) {
+		return encryptedEmail, false, nil
+	}
+
+	email, err := cs.DecryptEmail(encryptedEmail)
+	if err != nil {
+		return "", false, err
+	}
+
+	reencrypted, err := cs.EncryptEmail(email)
+	if err != nil {
+		return "", false, err
+	}
+	return reencrypted, true, nil
+}
+
+// splitKeyVersion separates the optional version prefix from the base64 payload
+func splitKeyVersion(encrypted string) (int, string) {
+	if !strings.HasPrefix(encrypted, keyVersionPrefix) {
+		return legacyKeyVersion, encrypted
+	}
+
+	versionStr, payload, ok := strings.Cut(strings.TrimPrefix(encrypted, keyVersionPrefix), keyVersionSep)
+	if !ok {
+		return legacyKeyVersion, encrypted
+	}
+	version, err := strconv.Atoi(versionStr)
+	if err != nil {
+		return legacyKeyVersion, encrypted
+	}
+	return version, payload
+}
+
+// DecryptEmail decrypts an encrypted email in either the randomized or the legacy deterministic format
+func (cs *CryptoService) DecryptEmail(encryptedEmail string) (string, error) {
+	if encryptedEmail == "" {
+		return "", fmt.Errorf("encrypted email cannot be empty")
+	}
+
+	// Pick the key the email was encrypted with
+	version, payload := splitKeyVersion(encryptedEmail)
+	masterKey, ok := cs.keyForVersion(version)
+	if !ok {
+		return "", fmt.Errorf("no key configured for encryption key version %d", version)
+	}
+
+	if !strings.HasPrefix(payload, randomizedEmailMarker) {
+		return decryptEmailDeterministic(payload, masterKey)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(payload, randomizedEmailMarker))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted email: %w", err)
+	}
+
+	gcm, err := cs.emailCipher(version, masterKey)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < nonceSize+gcm.Overhead() {
+		return "", fmt.Errorf("encrypted email too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:nonceSize], data[nonceSize:], []byte(emailContext))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt email: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// encryptEmailDeterministic produces the original (pre blind index) deterministic format.
+// It is only used to find rows that have not been migrated yet.
+func encryptEmailDeterministic(email string, version int, masterKey []byte) (string, error) {
+	if email == "" {
+		return "", fmt.Errorf("email cannot be empty")
+	}
+
 	// Use email as salt source for deterministic encryption
 	// This allows the same email to always produce the same ciphertext for queries
 	emailHash := sha256.Sum256([]byte(email))
 	salt := emailHash[:saltSize]
 
 	// Derive encryption key
-	key := cs.deriveKey("email", salt)
+	key := deriveKeyFrom(masterKey, "email", salt)
 
 	// Create AES-GCM cipher
 	block, err := aes.NewCipher(key)
@@ -123,7 +394,7 @@ func (cs *CryptoService) EncryptEmail(email string) (string, error) {
 	ciphertext := gcm.Seal(nil, nonce, []byte(email), nil)
 
 	// Create HMAC for integrity
-	hmacKey := cs.deriveHMACKey("email", salt)
+	hmacKey := deriveHMACKeyFrom(masterKey, "email", salt)
 	h := hmac.New(sha256.New, hmacKey)
 	h.Write(salt)
 	h.Write(nonce)
@@ -137,17 +408,13 @@ func (cs *CryptoService) EncryptEmail(email string) (string, error) {
 	result = append(result, ciphertext...)
 	result = append(result, tag...)
 
-	return base64.StdEncoding.EncodeToString(result), nil
+	return EmailVersionPrefix(version) + base64.StdEncoding.EncodeToString(result), nil
 }
 
-// DecryptEmail decrypts an encrypted email
-func (cs *CryptoService) DecryptEmail(encryptedEmail string) (string, error) {
-	if encryptedEmail == "" {
-		return "", fmt.Errorf("encrypted email cannot be empty")
-	}
-
+// decryptEmailDeterministic decrypts the original deterministic format (salt + nonce + ciphertext + hmac)
+func decryptEmailDeterministic(payload string, masterKey []byte) (string, error) {
 	// Decode base64
-	data, err := base64.StdEncoding.DecodeString(encryptedEmail)
+	data, err := base64.StdEncoding.DecodeString(payload)
 	if err != nil {
 		return "", fmt.Errorf("failed to decode encrypted email: %w", err)
 	}
@@ -163,7 +430,7 @@ func (cs *CryptoService) DecryptEmail(encryptedEmail string) (string, error) {
 	ciphertext := data[saltSize+nonceSize : len(data)-hmacKeySize]
 
 	// Verify HMAC
-	hmacKey := cs.deriveHMACKey("email", salt)
+	hmacKey := deriveHMACKeyFrom(masterKey, "email", salt)
 	h := hmac.New(sha256.New, hmacKey)
 	h.Write(salt)
 	h.Write(nonce)
@@ -175,7 +442,7 @@ func (cs *CryptoService) DecryptEmail(encryptedEmail string) (string, error) {
 	}
 
 	// Derive decryption key
-	key := cs.deriveKey("email", salt)
+	key := deriveKeyFrom(masterKey, "email", salt)
 
 	// Create cipher
 	block, err := aes.NewCipher(key)
@@ -257,14 +524,19 @@ func (cs *CryptoService) VerifyOTP(otp, hashedOTP string) (bool, error) {
 	storedHash := data[saltSize : saltSize+argonKeyLen]
 	hmacTag := data[saltSize+argonKeyLen:]
 
-	// Verify HMAC
-	hmacKey := cs.deriveHMACKey("otp", salt)
-	h := hmac.New(sha256.New, hmacKey)
-	h.Write(salt)
-	h.Write(storedHash)
-	expectedTag := h.Sum(nil)
+	// Verify HMAC (codes issued just before a key rotation carry a tag from the previous key)
+	tagValid := false
+	for _, masterKey := range cs.allKeys() {
+		h := hmac.New(sha256.New, deriveHMACKeyFrom(masterKey, "otp", salt))
+		h.Write(salt)
+		h.Write(storedHash)
+		if subtle.ConstantTimeCompare(hmacTag, h.Sum(nil)) == 1 {
+			tagValid = true
+			break
+		}
+	}
 
-	if subtle.ConstantTimeCompare(hmacTag, expectedTag) != 1 {
+	if !tagValid {
 		return false, fmt.Errorf("HMAC verification failed - data may be tampered")
 	}
 
@@ -392,6 +664,60 @@ func (cs *CryptoService) DecryptSensitiveData(encryptedData string, context stri
 	return string(plaintext), nil
 }
 
+// EncryptRecord encrypts data bound to context like EncryptSensitiveData, but with a key derived once
+// per context instead of per call, so it is cheap enough for data written on request paths
+func (cs *CryptoService) EncryptRecord(data string, context string) (string, error) {
+	if data == "" {
+		return "", fmt.Errorf("data cannot be empty")
+	}
+
+	gcm, err := cs.contextCipher(cs.keyVersion, cs.masterKey, "record:"+context)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	result := gcm.Seal(nonce, nonce, []byte(data), []byte(context))
+	return EmailVersionPrefix(cs.keyVersion) + base64.StdEncoding.EncodeToString(result), nil
+}
+
+// DecryptRecord decrypts data produced by EncryptRecord with the same context
+func (cs *CryptoService) DecryptRecord(encryptedData string, context string) (string, error) {
+	if encryptedData == "" {
+		return "", fmt.Errorf("encrypted data cannot be empty")
+	}
+
+	version, payload := splitKeyVersion(encryptedData)
+	masterKey, ok := cs.keyForVersion(version)
+	if !ok {
+		return "", fmt.Errorf("no key configured for encryption key version %d", version)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode encrypted data: %w", err)
+	}
+
+	gcm, err := cs.contextCipher(version, masterKey, "record:"+context)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < nonceSize+gcm.Overhead() {
+		return "", fmt.Errorf("encrypted data too short")
+	}
+
+	plaintext, err := gcm.Open(nil, data[:nonceSize], data[nonceSize:], []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
 // SecureCompare performs a constant-time string comparison
 func SecureCompare(a, b string) bool {
 	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
@@ -0,0 +1,76 @@
+package security
+
+import (
+	"testing"
+
+	"sudo/internal/config"
+)
+
+// Compare the legacy per-call Argon2id email scheme with the cached-key blind index:
+//
+//	go test ./internal/security -run '^$' -bench Email -benchmem
+func newBenchmarkCryptoService(b *testing.B) *CryptoService {
+	b.Helper()
+
+	masterKey, err := GenerateMasterKey()
+	if err != nil {
+		b.Fatalf("Failed to generate master key: %v", err)
+	}
+	crypto, err := NewCryptoService(config.Encryption{MasterKey: masterKey, KeyVersion: 1})
+	if err != nil {
+		b.Fatalf("Failed to create crypto service: %v", err)
+	}
+	return crypto
+}
+
+// BenchmarkEmailLookupLegacy is what every GetUserByEmail used to pay
+func BenchmarkEmailLookupLegacy(b *testing.B) {
+	crypto := newBenchmarkCryptoService(b)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := encryptEmailDeterministic("bench@example.com", crypto.keyVersion, crypto.masterKey); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEmailLookupBlindIndex(b *testing.B) {
+	crypto := newBenchmarkCryptoService(b)
+	crypto.EmailBlindIndex("warmup@example.com")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		crypto.EmailBlindIndex("bench@example.com")
+	}
+}
+
+func BenchmarkEmailDecryptLegacy(b *testing.B) {
+	crypto := newBenchmarkCryptoService(b)
+	encrypted, err := encryptEmailDeterministic("bench@example.com", crypto.keyVersion, crypto.masterKey)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.DecryptEmail(encrypted); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEmailDecryptRandomized(b *testing.B) {
+	crypto := newBenchmarkCryptoService(b)
+	encrypted, err := crypto.EncryptEmail("bench@example.com")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := crypto.DecryptEmail(encrypted); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
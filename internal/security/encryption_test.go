@@ -1,8 +1,10 @@
 package security
 
 import (
-	"os"
+	"strings"
 	"testing"
+
+	"sudo/internal/config"
 )
 
 func TestEncryptionFunctionality(t *testing.T) {
@@ -12,12 +14,8 @@ func TestEncryptionFunctionality(t *testing.T) {
 		t.Fatalf("Failed to generate master key: %v", err)
 	}
 
-	// Set it in environment for testing
-	os.Setenv("ENCRYPTION_MASTER_KEY", masterKey)
-	defer os.Unsetenv("ENCRYPTION_MASTER_KEY")
-
 	// Create crypto service
-	crypto, err := NewCryptoService()
+	crypto, err := NewCryptoService(config.Encryption{MasterKey: masterKey, KeyVersion: 1})
 	if err != nil {
 		t.Fatalf("Failed to create crypto service: %v", err)
 	}
@@ -45,14 +43,51 @@ func TestEncryptionFunctionality(t *testing.T) {
 			t.Errorf("Decrypted email %s doesn't match original %s", decrypted, testEmail)
 		}
 
-		// Test deterministic encryption (same email should produce same ciphertext)
+		// Test randomized encryption (same email should produce different ciphertext)
 		encrypted2, err := crypto.EncryptEmail(testEmail)
 		if err != nil {
 			t.Fatalf("Failed to encrypt email second time: %v", err)
 		}
 
-		if encrypted != encrypted2 {
-			t.Error("Email encryption should be deterministic")
+		if encrypted == encrypted2 {
+			t.Error("Email encryption should not be deterministic")
+		}
+
+		// Lookups use the blind index, which is deterministic and ignores case
+		if crypto.EmailBlindIndex(testEmail) != crypto.EmailBlindIndex(" Test@Example.com ") {
+			t.Error("Email blind index should be deterministic for the normalized email")
+		}
+
+		if crypto.EmailBlindIndex(testEmail) == crypto.EmailBlindIndex("other@example.com") {
+			t.Error("Different emails should have different blind indexes")
+		}
+	})
+
+	t.Run("LegacyEmailFormat", func(t *testing.T) {
+		testEmail := "legacy@example.com"
+
+		// Rows written before the blind index still decrypt and can be found
+		legacy, err := crypto.LegacyEmailLookupValues(testEmail)
+		if err != nil {
+			t.Fatalf("Failed to build legacy lookup values: %v", err)
+		}
+
+		decrypted, err := crypto.DecryptEmail(legacy[0])
+		if err != nil {
+			t.Fatalf("Failed to decrypt legacy email: %v", err)
+		}
+
+		if decrypted != testEmail {
+			t.Errorf("Decrypted legacy email %s doesn't match original %s", decrypted, testEmail)
+		}
+
+		upgraded, changed, err := crypto.ReencryptEmail(legacy[0])
+		if err != nil || !changed {
+			t.Fatalf("Legacy email should be re-encrypted, got changed=%v err=%v", changed, err)
+		}
+
+		if !strings.HasPrefix(upgraded, crypto.CurrentEmailPrefix()) {
+			t.Error("Re-encrypted email should use the randomized format")
 		}
 	})
 
@@ -155,6 +190,25 @@ func TestEncryptionFunctionality(t *testing.T) {
 		}
 	})
 
+	t.Run("RecordEncryption", func(t *testing.T) {
+		testData := `{"html":"<p>123456</p>"}`
+
+		encrypted, err := crypto.EncryptRecord(testData, "test-record")
+		if err != nil {
+			t.Fatalf("Failed to encrypt record: %v", err)
+		}
+
+		decrypted, err := crypto.DecryptRecord(encrypted, "test-record")
+		if err != nil || decrypted != testData {
+			t.Fatalf("Record should round-trip, got %q, %v", decrypted, err)
+		}
+
+		// The context is bound to the ciphertext
+		if _, err := crypto.DecryptRecord(encrypted, "other-record"); err == nil {
+			t.Error("Record should not decrypt under a different context")
+		}
+	})
+
 	t.Run("SecurityFeatures", func(t *testing.T) {
 		// Test empty inputs
 		_, err := crypto.EncryptEmail("")
@@ -229,3 +283,73 @@ func TestMasterKeyGeneration(t *testing.T) {
 	t.Logf("Sample master key: %s", key1)
 	t.Log("Save this key securely as ENCRYPTION_MASTER_KEY environment variable")
 }
+
+func TestKeyRotation(t *testing.T) {
+	oldKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatalf("Failed to generate old master key: %v", err)
+	}
+	newKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatalf("Failed to generate new master key: %v", err)
+	}
+
+	// Encrypt with the original (version 1) key
+	oldCrypto, err := NewCryptoService(config.Encryption{MasterKey: oldKey, KeyVersion: 1})
+	if err != nil {
+		t.Fatalf("Failed to create old crypto service: %v", err)
+	}
+
+	testEmail := "rotate@example.com"
+	legacy, err := oldCrypto.EncryptEmail(testEmail)
+	if err != nil {
+		t.Fatalf("Failed to encrypt email: %v", err)
+	}
+	if EmailKeyVersion(legacy) != 1 {
+		t.Errorf("Unprefixed ciphertext should be version 1, got %d", EmailKeyVersion(legacy))
+	}
+
+	// Switch to version 2 while keeping the old key readable
+	crypto, err := NewCryptoService(config.Encryption{
+		MasterKey:    newKey,
+		KeyVersion:   2,
+		PreviousKeys: map[int]string{1: oldKey},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create rotated crypto service: %v", err)
+	}
+
+	decrypted, err := crypto.DecryptEmail(legacy)
+	if err != nil || decrypted != testEmail {
+		t.Fatalf("Old ciphertext should still decrypt, got %q, %v", decrypted, err)
+	}
+
+	indexes := crypto.EmailBlindIndexes(testEmail)
+	if len(indexes) != 2 || indexes[1] != oldCrypto.EmailBlindIndex(testEmail) {
+		t.Errorf("Blind indexes should contain the current and previous key's index")
+	}
+
+	rotated, changed, err := crypto.ReencryptEmail(legacy)
+	if err != nil || !changed {
+		t.Fatalf("Failed to re-encrypt legacy ciphertext: %v", err)
+	}
+	if EmailKeyVersion(rotated) != 2 || !strings.HasPrefix(rotated, crypto.CurrentEmailPrefix()) {
+		t.Errorf("Re-encrypted email should use the current key version")
+	}
+
+	if _, changed, _ := crypto.ReencryptEmail(rotated); changed {
+		t.Error("Already rotated ciphertext should be left unchanged")
+	}
+
+	// Once the previous key is dropped, only current-version data is readable
+	finalCrypto, err := NewCryptoService(config.Encryption{MasterKey: newKey, KeyVersion: 2})
+	if err != nil {
+		t.Fatalf("Failed to create final crypto service: %v", err)
+	}
+	if _, err := finalCrypto.DecryptEmail(legacy); err == nil {
+		t.Error("Legacy ciphertext should not decrypt without the previous key")
+	}
+	if decrypted, err := finalCrypto.DecryptEmail(rotated); err != nil || decrypted != testEmail {
+		t.Errorf("Rotated ciphertext should decrypt with the current key, got %q, %v", decrypted, err)
+	}
+}
@@ -0,0 +1,183 @@
+package sprints
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"sudo/internal/models"
+)
+
+// Unit is what a burndown chart counts
+type Unit string
+
+const (
+	Count Unit = "count"
+	Hours Unit = "hours"
+
+	// MaxDays bounds the length of a sprint
+	MaxDays = 120
+)
+
+func ParseUnit(s string) (Unit, error) {
+	switch Unit(s) {
+	case Count, Hours:
+		return Unit(s), nil
+	case "":
+		return Count, nil
+	}
+	return "", fmt.Errorf("unknown unit %q", s)
+}
+
+// Change is a task joining (In) or leaving a sprint
+type Change struct {
+	At time.Time
+	In bool
+}
+
+// Item is a task that was in the sprint at some point, with its changes oldest first
+type Item struct {
+	ID       string
+	Title    string
+	Estimate *float64   // estimated hours
+	DoneAt   *time.Time // nil while unfinished
+	Changes  []Change
+}
+
+// Point is one day of a chart. Actual values are nil for days that have not ended yet.
+type Point struct {
+	Date      time.Time `json:"date"`
+	Ideal     float64   `json:"ideal"`
+	Scope     *float64  `json:"scope"`
+	Done      *float64  `json:"done"`
+	Remaining *float64  `json:"remaining"`
+}
+
+// Chart has the data for both a burndown (Remaining) and a burnup (Done against Scope)
+type Chart struct {
+	Unit   Unit    `json:"unit"`
+	Points []Point `json:"points"`
+}
+
+// inAt reports whether the item was in the sprint at t
+func (item Item) inAt(t time.Time) bool {
+	in := false
+	for _, change := range item.Changes {
+		if change.At.After(t) {
+			break
+		}
+		in = change.In
+	}
+	return in
+}
+
+func (item Item) doneBy(t time.Time) bool {
+	return item.DoneAt != nil && !item.DoneAt.After(t)
+}
+
+func (item Item) weight(unit Unit) float64 {
+	if unit == Hours {
+		if item.Estimate == nil {
+			return 0
+		}
+		return *item.Estimate
+	}
+	return 1
+}
+
+// Burndown charts the days from start to end (midnights, both inclusive) counting scope
+// and done work at the end of each day. The ideal line falls from the scope at start to
+// zero at the end of the last day.
+func Burndown(unit Unit, start, end, now time.Time, items []Item) (*Chart, error) {
+	days := int(end.Sub(start).Hours()/24) + 1
+	if days < 1 || days > MaxDays {
+		return nil, fmt.Errorf("sprints must last 1 to %d days", MaxDays)
+	}
+
+	committed := 0.0
+	for _, item := range items {
+		if item.inAt(start) {
+			committed += item.weight(unit)
+		}
+	}
+
+	chart := &Chart{Unit: unit, Points: make([]Point, 0, days)}
+	for i := 0; i < days; i++ {
+		date := start.AddDate(0, 0, i)
+		point := Point{Date: date, Ideal: round(committed * float64(days-i-1) / float64(days))}
+		dayEnd := date.AddDate(0, 0, 1)
+		if dayEnd.After(now) {
+			// The current day shows the state so far
+			if date.After(now) {
+				chart.Points = append(chart.Points, point)
+				continue
+			}
+			dayEnd = now
+		}
+
+		scope, done := 0.0, 0.0
+		for _, item := range items {
+			if !item.inAt(dayEnd) {
+				continue
+			}
+			scope += item.weight(unit)
+			if item.doneBy(dayEnd) {
+				done += item.weight(unit)
+			}
+		}
+		scope, done = round(scope), round(done)
+		remaining := round(scope - done)
+		point.Scope, point.Done, point.Remaining = &scope, &done, &remaining
+		chart.Points = append(chart.Points, point)
+	}
+
+	return chart, nil
+}
+
+// Summarize builds the close report of a sprint that ran from startedAt to closedAt
+func Summarize(startedAt, closedAt time.Time, items []Item) *models.SprintReport {
+	report := &models.SprintReport{
+		StartedAt:       startedAt,
+		ClosedAt:        closedAt,
+		CompletedTasks:  []models.SprintTaskRef{},
+		IncompleteTasks: []models.SprintTaskRef{},
+	}
+
+	sorted := append([]Item(nil), items...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Title < sorted[j].Title })
+	for _, item := range sorted {
+		atStart, atClose := item.inAt(startedAt), item.inAt(closedAt)
+		if atStart {
+			add(&report.Committed, item)
+		} else if atClose {
+			add(&report.Added, item)
+		}
+		if atStart && !atClose {
+			add(&report.Removed, item)
+		}
+		if !atClose {
+			continue
+		}
+
+		ref := models.SprintTaskRef{ID: item.ID, Title: item.Title}
+		if item.doneBy(closedAt) {
+			add(&report.Completed, item)
+			report.CompletedTasks = append(report.CompletedTasks, ref)
+		} else {
+			add(&report.Incomplete, item)
+			report.IncompleteTasks = append(report.IncompleteTasks, ref)
+		}
+	}
+
+	return report
+}
+
+func add(t *models.SprintTotals, item Item) {
+	t.Tasks++
+	t.Hours = round(t.Hours + item.weight(Hours))
+}
+
+func round(f float64) float64 {
+	return math.Round(f*100) / 100
+}
@@ -0,0 +1,85 @@
+package sprints
+
+import (
+	"testing"
+	"time"
+
+	"sudo/internal/models"
+)
+
+func TestBurndown(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2025, 4, day, hour, 0, 0, 0, time.UTC) }
+	hours := func(h float64) *float64 { return &h }
+	doneAt := at(8, 15)
+
+	items := []Item{
+		{ID: "a", Title: "A", Estimate: hours(4), DoneAt: &doneAt, Changes: []Change{{at(5, 9), true}}},
+		{ID: "b", Title: "B", Estimate: hours(6), Changes: []Change{{at(5, 9), true}}},
+		// Added on the second day
+		{ID: "c", Title: "C", Estimate: hours(2), Changes: []Change{{at(8, 10), true}}},
+		// Removed on the second day
+		{ID: "d", Title: "D", Changes: []Change{{at(6, 9), true}, {at(8, 11), false}}},
+	}
+
+	start, end := at(7, 0), at(10, 0)
+	chart, err := Burndown(Hours, start, end, at(9, 12), items)
+	if err != nil {
+		t.Fatalf("Burndown failed: %v", err)
+	}
+	if len(chart.Points) != 4 {
+		t.Fatalf("got %d points, want 4", len(chart.Points))
+	}
+
+	want := []struct{ ideal, scope, done, remaining float64 }{
+		{7.5, 10, 0, 10},
+		{5, 12, 4, 8},
+		{2.5, 12, 4, 8}, // so far today
+	}
+	for i, w := range want {
+		p := chart.Points[i]
+		if p.Ideal != w.ideal || *p.Scope != w.scope || *p.Done != w.done || *p.Remaining != w.remaining {
+			t.Errorf("point %d = ideal %v scope %v done %v remaining %v, want %+v", i, p.Ideal, *p.Scope, *p.Done, *p.Remaining, w)
+		}
+	}
+	if last := chart.Points[3]; last.Ideal != 0 || last.Remaining != nil {
+		t.Errorf("future point = %+v, want ideal 0 and no actuals", last)
+	}
+
+	byCount, err := Burndown(Count, start, end, at(9, 12), items)
+	if err != nil {
+		t.Fatalf("Burndown failed: %v", err)
+	}
+	if p := byCount.Points[0]; *p.Scope != 3 || *p.Remaining != 3 {
+		t.Errorf("first count point = scope %v remaining %v, want 3 and 3", *p.Scope, *p.Remaining)
+	}
+
+	if _, err := Burndown(Count, end, start, end, items); err == nil {
+		t.Error("Burndown should refuse an end before the start")
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	at := func(day, hour int) time.Time { return time.Date(2025, 4, day, hour, 0, 0, 0, time.UTC) }
+	hours := func(h float64) *float64 { return &h }
+	doneAt := at(8, 15)
+
+	report := Summarize(at(7, 9), at(18, 17), []Item{
+		{ID: "b", Title: "B", Estimate: hours(6), Changes: []Change{{at(5, 9), true}}},
+		{ID: "a", Title: "A", Estimate: hours(4), DoneAt: &doneAt, Changes: []Change{{at(5, 9), true}}},
+		{ID: "c", Title: "C", Estimate: hours(2.5), Changes: []Change{{at(8, 10), true}}},
+		{ID: "d", Title: "D", Changes: []Change{{at(6, 9), true}, {at(8, 11), false}}},
+	})
+
+	if report.Committed != (models.SprintTotals{Tasks: 3, Hours: 10}) {
+		t.Errorf("Committed = %+v", report.Committed)
+	}
+	if report.Added != (models.SprintTotals{Tasks: 1, Hours: 2.5}) || report.Removed != (models.SprintTotals{Tasks: 1}) {
+		t.Errorf("Added = %+v, Removed = %+v", report.Added, report.Removed)
+	}
+	if report.Completed != (models.SprintTotals{Tasks: 1, Hours: 4}) || report.Incomplete != (models.SprintTotals{Tasks: 2, Hours: 8.5}) {
+		t.Errorf("Completed = %+v, Incomplete = %+v", report.Completed, report.Incomplete)
+	}
+	if len(report.IncompleteTasks) != 2 || report.IncompleteTasks[0].ID != "b" || report.IncompleteTasks[1].ID != "c" {
+		t.Errorf("IncompleteTasks = %+v", report.IncompleteTasks)
+	}
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // Register the GIF decoder for image.Decode
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"strings"
+)
+
+// Larger images are not decoded, so a small upload cannot expand into gigabytes of pixels
+const maxThumbnailSourcePixels = 40_000_000
+
+// SniffContentType detects a blob's type from its contents; client-supplied types are not trusted
+func SniffContentType(data []byte) string {
+	contentType := http.DetectContentType(data)
+	if mediaType, _, ok := strings.Cut(contentType, ";"); ok && !strings.HasPrefix(mediaType, "text/") {
+		return mediaType
+	}
+	return contentType
+}
+
+// CanThumbnail reports whether Thumbnail can decode the content type
+func CanThumbnail(contentType string) bool {
+	switch contentType {
+	case "image/png", "image/jpeg", "image/gif":
+		return true
+	}
+	return false
+}
+
+// ThumbnailContentType is the type Thumbnail produces for a source image type
+func ThumbnailContentType(contentType string) string {
+	if contentType == "image/png" || contentType == "image/gif" {
+		return "image/png"
+	}
+	return "image/jpeg"
+}
+
+// Thumbnail scales an image to fit within maxSize×maxSize (never enlarging it) and
+// re-encodes it, which also strips metadata such as EXIF location. Images with
+// transparency are returned as PNG and everything else as JPEG.
+func Thumbnail(data []byte, maxSize int) ([]byte, string, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if config.Width*config.Height > maxThumbnailSourcePixels {
+		return nil, "", fmt.Errorf("image is too large to thumbnail (%dx%d)", config.Width, config.Height)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	bounds := src.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width == 0 || height == 0 {
+		return nil, "", fmt.Errorf("image is empty")
+	}
+	if width > maxSize || height > maxSize {
+		if width >= height {
+			height = max(1, height*maxSize/width)
+			width = maxSize
+		} else {
+			width = max(1, width*maxSize/height)
+			height = maxSize
+		}
+	}
+
+	thumb := scale(src, width, height)
+
+	var out bytes.Buffer
+	contentType := ThumbnailContentType("image/" + format)
+	if contentType == "image/png" {
+		err = png.Encode(&out, thumb)
+	} else {
+		err = jpeg.Encode(&out, thumb, &jpeg.Options{Quality: 85})
+	}
+	return out.Bytes(), contentType, err
+}
+
+// scale resizes with a box filter, averaging every source pixel that maps onto a target pixel
+func scale(src image.Image, width, height int) *image.NRGBA {
+	bounds := src.Bounds()
+	rgba := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := y*srcHeight/height, max((y+1)*srcHeight/height, y*srcHeight/height+1)
+		for x := 0; x < width; x++ {
+			x0, x1 := x*srcWidth/width, max((x+1)*srcWidth/width, x*srcWidth/width+1)
+
+			var r, g, b, a, count uint64
+			for sy := y0; sy < y1; sy++ {
+				offset := sy*rgba.Stride + x0*4
+				for sx := x0; sx < x1; sx++ {
+					alpha := uint64(rgba.Pix[offset+3])
+					// Weight colour by alpha so transparent pixels do not darken edges
+					r += uint64(rgba.Pix[offset]) * alpha
+					g += uint64(rgba.Pix[offset+1]) * alpha
+					b += uint64(rgba.Pix[offset+2]) * alpha
+					a += alpha
+					count++
+					offset += 4
+				}
+			}
+
+			i := y*dst.Stride + x*4
+			if a > 0 {
+				dst.Pix[i] = uint8(r / a)
+				dst.Pix[i+1] = uint8(g / a)
+				dst.Pix[i+2] = uint8(b / a)
+			}
+			dst.Pix[i+3] = uint8(a / count)
+		}
+	}
+	return dst
+}
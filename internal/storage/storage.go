@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"sudo/internal/config"
+)
+
+// ErrNotFound is returned by Get when no blob is stored under the key
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs such as task attachments and avatars. Keys are slash-separated
+// relative paths ("tasks/<task id>/<attachment id>"). Implementations must be safe
+// for concurrent use.
+type Store interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob and its size; the caller closes the reader
+	Get(ctx context.Context, key string) (io.ReadCloser, int64, error)
+	// Delete removes the blob; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStore picks the store for cfg.Driver (local or s3). When unset it uses S3 if
+// cfg.S3.Bucket is set and otherwise stores blobs on disk under cfg.Path.
+func NewStore(cfg config.Storage) (Store, error) {
+	driver := cfg.Driver
+	if driver == "" {
+		if cfg.S3.Bucket != "" {
+			driver = "s3"
+		} else {
+			driver = "local"
+		}
+	}
+
+	switch driver {
+	case "local":
+		return NewLocalStore(cfg.Path)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:        cfg.S3.Endpoint,
+			Region:          cfg.S3.Region,
+			Bucket:          cfg.S3.Bucket,
+			AccessKeyID:     cfg.S3.AccessKeyID,
+			SecretAccessKey: cfg.S3.SecretAccessKey,
+			PathStyle:       cfg.S3.PathStyle,
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q (expected local or s3)", driver)
+	}
+}
+
+// validateKey rejects keys that could escape the store's root or bucket prefix
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") ||
+		path.Clean(key) != key || key == ".." || strings.HasPrefix(key, "../") {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible server (path-style only)
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	t       *testing.T
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=test-key/20250301/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=") {
+		f.t.Errorf("unexpected Authorization header: %s", auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		f.t.Errorf("payload hash does not match body")
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[r.URL.Path] = body
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte("<Error><Code>NoSuchKey</Code></Error>"))
+			return
+		}
+		_, _ = w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+	data := []byte("hello attachment")
+
+	if err := store.Put(ctx, "tasks/one/two", data, "text/plain"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	reader, size, err := store.Get(ctx, "tasks/one/two")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	got, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(got, data) || size != int64(len(data)) {
+		t.Errorf("Get returned %q (%d bytes), want %q", got, size, data)
+	}
+
+	if err := store.Delete(ctx, "tasks/one/two"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "tasks/one/two"); err != nil {
+		t.Errorf("Deleting a missing blob should succeed, got %v", err)
+	}
+	if _, _, err := store.Get(ctx, "tasks/one/two"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete should return ErrNotFound, got %v", err)
+	}
+
+	for _, key := range []string{"", "/etc/passwd", "../outside", "tasks/../../outside", "tasks//double"} {
+		if err := store.Put(ctx, key, data, "text/plain"); err == nil {
+			t.Errorf("Put should reject key %q", key)
+		}
+	}
+}
+
+func TestStores(t *testing.T) {
+	t.Run("Local", func(t *testing.T) {
+		store, err := NewLocalStore(t.TempDir())
+		if err != nil {
+			t.Fatalf("Failed to create local store: %v", err)
+		}
+		testStore(t, store)
+	})
+
+	t.Run("S3", func(t *testing.T) {
+		server := httptest.NewServer(&fakeS3{objects: map[string][]byte{}, t: t})
+		defer server.Close()
+
+		store, err := NewS3Store(S3Config{
+			Endpoint:        server.URL,
+			Region:          "us-east-1",
+			Bucket:          "sudo",
+			AccessKeyID:     "test-key",
+			SecretAccessKey: "test-secret",
+			PathStyle:       true,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create S3 store: %v", err)
+		}
+		store.now = func() time.Time { return time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC) }
+		testStore(t, store)
+	})
+}
+
+func TestThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 1000, 500))
+	for y := 0; y < 500; y++ {
+		for x := 0; x < 1000; x++ {
+			src.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatalf("Failed to encode test image: %v", err)
+	}
+
+	if contentType := SniffContentType(encoded.Bytes()); contentType != "image/png" || !CanThumbnail(contentType) {
+		t.Fatalf("SniffContentType returned %q", contentType)
+	}
+
+	thumb, contentType, err := Thumbnail(encoded.Bytes(), 320)
+	if err != nil {
+		t.Fatalf("Thumbnail failed: %v", err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("PNG thumbnails should stay PNG, got %s", contentType)
+	}
+
+	decoded, err := png.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("Thumbnail is not a valid PNG: %v", err)
+	}
+	if bounds := decoded.Bounds(); bounds.Dx() != 320 || bounds.Dy() != 160 {
+		t.Errorf("Thumbnail is %dx%d, want 320x160", bounds.Dx(), bounds.Dy())
+	}
+
+	if _, _, err := Thumbnail([]byte("not an image"), 320); err == nil {
+		t.Error("Thumbnail should reject non-image data")
+	}
+}
@@ -0,0 +1,193 @@
+package timesheet
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Period is the column width of a report
+type Period string
+
+const (
+	Day  Period = "day"
+	Week Period = "week"
+
+	// maxColumns bounds the size of a report, e.g. a year of days
+	maxColumns = 400
+)
+
+// Interval is a stretch of tracked time attributed to Key (a user or a task)
+type Interval struct {
+	Key   string
+	Start time.Time
+	End   time.Time
+}
+
+// Row is the time tracked for one key, in seconds per report column
+type Row struct {
+	Key     string  `json:"key"`
+	Name    string  `json:"name"`
+	Seconds []int64 `json:"seconds"`
+	Total   int64   `json:"total"`
+}
+
+// Report is a timesheet: one row per key, one column per day or week
+type Report struct {
+	Period Period      `json:"period"`
+	Starts []time.Time `json:"starts"`
+	Rows   []Row       `json:"rows"`
+	Totals []int64     `json:"totals"`
+	Total  int64       `json:"total"`
+}
+
+func ParsePeriod(s string) (Period, error) {
+	switch Period(s) {
+	case Day, Week:
+		return Period(s), nil
+	case "":
+		return Day, nil
+	}
+	return "", fmt.Errorf("unknown period %q", s)
+}
+
+// Start returns the start of the period containing t, in t's location. Weeks start on Monday.
+func (p Period) Start(t time.Time) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if p == Week {
+		offset := (int(day.Weekday()) + 6) % 7
+		day = day.AddDate(0, 0, -offset)
+	}
+	return day
+}
+
+func (p Period) next(t time.Time) time.Time {
+	if p == Week {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// Build sums intervals into the periods covering [from, to). Intervals are clipped to the
+// range and split where they cross a period boundary.
+func Build(p Period, from, to time.Time, intervals []Interval) (*Report, error) {
+	report := &Report{Period: p}
+	for start := p.Start(from); start.Before(to); start = p.next(start) {
+		if len(report.Starts) == maxColumns {
+			return nil, fmt.Errorf("report would have more than %d columns", maxColumns)
+		}
+		report.Starts = append(report.Starts, start)
+	}
+	report.Totals = make([]int64, len(report.Starts))
+
+	rows := make(map[string]*Row)
+	for _, interval := range intervals {
+		start, end := interval.Start, interval.End
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+
+		for i, columnStart := range report.Starts {
+			columnEnd := p.next(columnStart)
+			overlapStart, overlapEnd := start, end
+			if overlapStart.Before(columnStart) {
+				overlapStart = columnStart
+			}
+			if overlapEnd.After(columnEnd) {
+				overlapEnd = columnEnd
+			}
+			if !overlapEnd.After(overlapStart) {
+				continue
+			}
+
+			seconds := int64(overlapEnd.Sub(overlapStart) / time.Second)
+			row, ok := rows[interval.Key]
+			if !ok {
+				row = &Row{Key: interval.Key, Name: interval.Key, Seconds: make([]int64, len(report.Starts))}
+				rows[interval.Key] = row
+			}
+			row.Seconds[i] += seconds
+			row.Total += seconds
+			report.Totals[i] += seconds
+			report.Total += seconds
+		}
+	}
+
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	report.sortRows()
+	return report, nil
+}
+
+// SetNames labels the rows, e.g. with user or task names, and re-sorts them
+func (r *Report) SetNames(names map[string]string) {
+	for i := range r.Rows {
+		if name, ok := names[r.Rows[i].Key]; ok {
+			r.Rows[i].Name = name
+		}
+	}
+	r.sortRows()
+}
+
+func (r *Report) sortRows() {
+	sort.Slice(r.Rows, func(i, j int) bool {
+		if r.Rows[i].Name != r.Rows[j].Name {
+			return r.Rows[i].Name < r.Rows[j].Name
+		}
+		return r.Rows[i].Key < r.Rows[j].Key
+	})
+}
+
+// Label names column i, e.g. "2025-03-03" or "Week of 2025-03-03"
+func (r *Report) Label(i int) string {
+	if r.Period == Week {
+		return "Week of " + r.Starts[i].Format("2006-01-02")
+	}
+	return r.Starts[i].Format("2006-01-02")
+}
+
+// WriteCSV writes the report in hours with two decimals, with a totals row at the bottom
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+
+	header := []string{"Name"}
+	for i := range r.Starts {
+		header = append(header, r.Label(i))
+	}
+	header = append(header, "Total")
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write timesheet header: %w", err)
+	}
+
+	for _, row := range r.Rows {
+		if err := writer.Write(csvRow(row.Name, row.Seconds, row.Total)); err != nil {
+			return fmt.Errorf("failed to write timesheet row: %w", err)
+		}
+	}
+	if err := writer.Write(csvRow("Total", r.Totals, r.Total)); err != nil {
+		return fmt.Errorf("failed to write timesheet totals: %w", err)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func csvRow(name string, seconds []int64, total int64) []string {
+	record := []string{name}
+	for _, s := range seconds {
+		record = append(record, Hours(s))
+	}
+	return append(record, Hours(total))
+}
+
+// Hours formats seconds as hours with two decimals
+func Hours(seconds int64) string {
+	return strconv.FormatFloat(float64(seconds)/3600, 'f', 2, 64)
+}
@@ -0,0 +1,89 @@
+package timesheet
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	// Sunday evening
+	sunday := time.Date(2025, 3, 9, 22, 30, 0, 0, time.UTC)
+	if got := Day.Start(sunday); !got.Equal(time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Day.Start = %s", got)
+	}
+	if got := Week.Start(sunday); !got.Equal(time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Week.Start = %s, want Monday 2025-03-03", got)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	from := time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 0, 3)
+	at := func(day, hour int) time.Time { return time.Date(2025, 3, day, hour, 0, 0, 0, time.UTC) }
+
+	report, err := Build(Day, from, to, []Interval{
+		{Key: "bob", Start: at(3, 9), End: at(3, 11)},
+		// Crosses midnight into the next day
+		{Key: "alice", Start: at(3, 23), End: at(4, 2)},
+		// Starts before the range
+		{Key: "bob", Start: at(2, 22), End: at(3, 1)},
+		// Ends after the range
+		{Key: "alice", Start: at(5, 23), End: at(6, 1)},
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if len(report.Starts) != 3 {
+		t.Fatalf("got %d columns, want 3", len(report.Starts))
+	}
+	hour := int64(3600)
+	want := []Row{
+		{Key: "alice", Name: "alice", Seconds: []int64{hour, 2 * hour, hour}, Total: 4 * hour},
+		{Key: "bob", Name: "bob", Seconds: []int64{3 * hour, 0, 0}, Total: 3 * hour},
+	}
+	if !reflect.DeepEqual(report.Rows, want) {
+		t.Errorf("Rows = %+v, want %+v", report.Rows, want)
+	}
+	if report.Total != 7*hour || !reflect.DeepEqual(report.Totals, []int64{4 * hour, 2 * hour, hour}) {
+		t.Errorf("Totals = %v (%d)", report.Totals, report.Total)
+	}
+
+	report.SetNames(map[string]string{"alice": "Zoe", "bob": "Bob"})
+	var buf bytes.Buffer
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("WriteCSV failed: %v", err)
+	}
+	wantCSV := "Name,2025-03-03,2025-03-04,2025-03-05,Total\n" +
+		"Bob,3.00,0.00,0.00,3.00\n" +
+		"Zoe,1.00,2.00,1.00,4.00\n" +
+		"Total,4.00,2.00,1.00,7.00\n"
+	if buf.String() != wantCSV {
+		t.Errorf("CSV =\n%s\nwant\n%s", buf.String(), wantCSV)
+	}
+}
+
+func TestBuildWeeks(t *testing.T) {
+	from := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC) // Saturday
+	to := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	report, err := Build(Week, from, to, []Interval{
+		{Key: "a", Start: time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC), End: time.Date(2025, 3, 2, 11, 30, 0, 0, time.UTC)},
+		{Key: "a", Start: time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC), End: time.Date(2025, 3, 12, 11, 0, 0, 0, time.UTC)},
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if got := report.Label(0); got != "Week of 2025-02-24" {
+		t.Errorf("Label(0) = %q", got)
+	}
+	if !reflect.DeepEqual(report.Rows[0].Seconds, []int64{5400, 0, 3600}) {
+		t.Errorf("Seconds = %v", report.Rows[0].Seconds)
+	}
+
+	if _, err := Build(Day, from, from.AddDate(5, 0, 0), nil); err == nil {
+		t.Error("Build should refuse oversized reports")
+	}
+}
@@ -0,0 +1,111 @@
+// Package tracing sets up the OpenTelemetry SDK, so a slow request can be broken down
+// into its route, database calls, rendering and emails. Routes are traced by otelgin;
+// the rest of the code starts spans with Start. Spans are propagated with the W3C
+// traceparent header. When tracing is off the global provider is a no-op.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"sudo/internal/buildinfo"
+	"sudo/internal/config"
+)
+
+const (
+	instrumentationName = "sudo"
+	// shutdownTimeout bounds the final export when the server stops
+	shutdownTimeout = 10 * time.Second
+)
+
+// Tracer owns the SDK provider, which exports spans in batches in the background
+type Tracer struct {
+	provider *sdktrace.TracerProvider
+}
+
+// Configure installs the global tracer provider for the configured exporter and returns
+// the tracer, whose Run flushes the last spans at shutdown. It returns nil when tracing
+// is off.
+func Configure(cfg config.Tracing, env string) (*Tracer, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "otlp":
+		exporter, err = otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(cfg.Endpoint+"/v1/traces"),
+			otlptracehttp.WithHeaders(cfg.Headers))
+		log.Printf("[TRACING] Exporting %.0f%% of traces to %s", cfg.SampleRatio*100, cfg.Endpoint)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		log.Printf("[TRACING] Writing %.0f%% of traces to stdout", cfg.SampleRatio*100)
+	default:
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	t := &Tracer{provider: newProvider(cfg, env, exporter)}
+	otel.SetTracerProvider(t.provider)
+	return t, nil
+}
+
+// newProvider samples cfg.SampleRatio of new traces. Requests that arrive with a
+// traceparent continue the caller's trace but are sampled at the same ratio, so a
+// client cannot force every request it sends to be recorded
+func newProvider(cfg config.Tracing, env string, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	ratio := sdktrace.TraceIDRatioBased(cfg.SampleRatio)
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(ratio,
+			sdktrace.WithRemoteParentSampled(ratio),
+			sdktrace.WithRemoteParentNotSampled(ratio),
+		)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", buildinfo.Version),
+			attribute.String("deployment.environment", env),
+		)),
+	)
+}
+
+// Run waits until ctx is cancelled, then exports the spans still queued
+func (t *Tracer) Run(ctx context.Context) {
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := t.provider.Shutdown(shutdownCtx); err != nil {
+		log.Printf("[TRACING] Failed to export the last spans: %v", err)
+	}
+}
+
+// Start starts a span as a child of the one in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// RecordError marks the span as failed with err; a nil err is ignored
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -0,0 +1,119 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"sudo/internal/config"
+)
+
+func TestSampling(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := newProvider(config.Tracing{ServiceName: "sudo-test", SampleRatio: 0}, "test", exporter)
+	tracer := provider.Tracer(instrumentationName)
+
+	ctx, root := tracer.Start(context.Background(), "root")
+	_, child := tracer.Start(ctx, "child")
+	if root.SpanContext().IsSampled() || child.SpanContext().IsSampled() {
+		t.Error("ratio 0 should not sample new traces")
+	}
+	if child.SpanContext().TraceID() != root.SpanContext().TraceID() {
+		t.Error("unsampled child should stay in its parent's trace")
+	}
+	child.End()
+	root.End()
+
+	// A caller's sampled flag cannot force recording, but its trace is continued
+	header := http.Header{"Traceparent": {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}
+	remote := propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, forced := tracer.Start(remote, "forced")
+	if forced.SpanContext().IsSampled() || forced.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("a sampled remote parent should be continued but not followed, got %+v", forced.SpanContext())
+	}
+	forced.End()
+
+	// Nor can an unsampled flag suppress it
+	exporter = tracetest.NewInMemoryExporter()
+	provider = newProvider(config.Tracing{ServiceName: "sudo-test", SampleRatio: 1}, "test", exporter)
+	header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	remote = propagation.TraceContext{}.Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span := provider.Tracer(instrumentationName).Start(remote, "remote")
+	if !span.SpanContext().IsSampled() || span.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("an unsampled remote parent should still be sampled at ratio 1, got %+v", span.SpanContext())
+	}
+	RecordError(span, errors.New("board not found"))
+	RecordError(span, nil)
+	span.End()
+
+	if err := provider.ForceFlush(context.Background()); err != nil {
+		t.Fatalf("ForceFlush failed: %v", err)
+	}
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || spans[0].Name != "remote" {
+		t.Fatalf("exported %d spans, want only the remote child", len(spans))
+	}
+	if spans[0].Status.Code != codes.Error || spans[0].Status.Description != "board not found" || len(spans[0].Events) != 1 {
+		t.Errorf("status = %+v, events = %d", spans[0].Status, len(spans[0].Events))
+	}
+	if spans[0].Parent.SpanID().String() != "00f067aa0ba902b7" {
+		t.Errorf("parent = %s", spans[0].Parent.SpanID())
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	var exports atomic.Int32
+	var auth atomic.Value
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			http.NotFound(w, r)
+			return
+		}
+		auth.Store(r.Header.Get("Authorization"))
+		exports.Add(1)
+	}))
+	defer collector.Close()
+
+	tracer, err := Configure(config.Tracing{
+		Exporter:    "otlp",
+		Endpoint:    collector.URL,
+		Headers:     map[string]string{"Authorization": "Bearer token"},
+		ServiceName: "sudo-test",
+		SampleRatio: 1,
+	}, "test")
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	ctx, request := Start(context.Background(), "GET /board/:id", trace.WithSpanKind(trace.SpanKindServer))
+	_, query := Start(ctx, "DB.GetBoard")
+	query.End()
+	request.End()
+
+	// Run sends what is still queued once the workers stop
+	runCtx, stop := context.WithCancel(context.Background())
+	stop()
+	tracer.Run(runCtx)
+
+	if exports.Load() == 0 {
+		t.Fatal("no spans were exported")
+	}
+	if got := auth.Load(); got != "Bearer token" {
+		t.Errorf("export headers not sent, Authorization = %v", got)
+	}
+}
+
+func TestConfigureOff(t *testing.T) {
+	tracer, err := Configure(config.Tracing{Exporter: "none"}, "test")
+	if tracer != nil || err != nil {
+		t.Errorf("Configure = %v, %v, want nil when tracing is off", tracer, err)
+	}
+}
@@ -281,7 +281,7 @@ function initializeSortables(content) {
                 const controller = new AbortController();
                 const timeoutId = setTimeout(() => controller.abort(), 10000); // 10 second timeout
                 
-                fetch('/tasks/move', {
+                const sendMove = (force) => fetch('/tasks/move', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/x-www-form-urlencoded',
@@ -291,15 +291,29 @@ function initializeSortables(content) {
                     body: new URLSearchParams({
                         task_id: taskId,
                         column_id: newColumnId,
-                        position: newPosition
+                        position: newPosition,
+                        force: force ? 'true' : 'false'
                     })
                 }).then(response => {
                     console.log('Server response status:', response.status);
+                    // Blocked tasks need confirmation before moving into a done column
+                    if (response.status === 409 && !force) {
+                        clearTimeout(timeoutId);
+                        return response.json().then(conflict => {
+                            const blockers = (conflict.blocked_by || []).map(blocker => `- ${blocker.title}`).join('\n');
+                            if (confirm(`${conflict.error}:\n${blockers}\n\nMove it anyway?`)) {
+                                return sendMove(true);
+                            }
+                            throw new Error(conflict.error);
+                        });
+                    }
                     if (!response.ok) {
                         throw new Error(`Server responded with status ${response.status}`);
                     }
                     return response.json();
-                }).then(data => {
+                });
+
+                sendMove(false).then(data => {
                     clearTimeout(timeoutId); // Clear timeout on success
                     console.log('Task move successful:', data);
                     
@@ -1448,6 +1462,9 @@ function toggleTaskComplete(taskId) {
 
             // Refresh the board or update UI
             location.reload();
+        } else if (response.status === 409) {
+            // The board requires a finished checklist
+            response.text().then(message => showNotification(message, 'error'));
         } else {
             console.error('Failed to toggle task completion');
         }
@@ -2098,6 +2115,30 @@ function saveTaskChanges(taskId) {
     }
     formData.append('completed', completed.toString());
 
+    // Custom field values keyed by field ID; empty values clear the field
+    const customFields = {};
+    form.querySelectorAll('.task-custom-field').forEach(input => {
+        const fieldId = input.dataset.fieldId;
+        switch (input.dataset.fieldType) {
+            case 'checkbox':
+                customFields[fieldId] = input.checked;
+                break;
+            case 'multi_select':
+                customFields[fieldId] = Array.from(input.selectedOptions).map(option => option.value);
+                break;
+            default:
+                customFields[fieldId] = input.value.trim();
+        }
+    });
+    if (Object.keys(customFields).length > 0) {
+        formData.append('custom_fields', JSON.stringify(customFields));
+    }
+
+    const estimate = document.getElementById('task-estimated-hours');
+    if (estimate) {
+        formData.append('estimated_hours', estimate.value.trim());
+    }
+
     console.log('Saving task changes:', { taskId, title, priority, completed });
 
     // Send update request
@@ -2136,12 +2177,19 @@ function saveTaskChanges(taskId) {
             // Update sub-board button visibility in case task count changed
             setTimeout(checkTasksAndUpdateButton, 200);
             
+        } else if (response.status === 400 || response.status === 409) {
+            // Rejected changes, e.g. invalid custom fields or an unfinished checklist
+            return response.text().then(message => {
+                const failure = new Error(message);
+                failure.userMessage = message;
+                throw failure;
+            });
         } else {
             throw new Error(`Failed to save task changes: ${response.status}`);
         }
     }).catch(error => {
         console.error('Error saving task changes:', error);
-        showNotification('Failed to save task changes. Please try again.', 'error');
+        showNotification(error.userMessage || 'Failed to save task changes. Please try again.', 'error');
         
         // Restore button state
         if (saveButton) {
@@ -47,6 +47,16 @@ class SudoRealtimeClient {
             console.log('WebSocket connection closed:', event.code, event.reason);
             this.showConnectionStatus('disconnected');
             this.clearAllCursors();
+
+            // 1012 (service restart): the server asked us to come back, so don't use up attempts
+            if (event.code === 1012 || this.restartDelay) {
+                const delay = (this.restartDelay || 2000) + Math.random() * 1000;
+                this.restartDelay = null;
+                this.reconnectAttempts = 0;
+                console.log(`Server restarting, reconnecting in ${Math.round(delay)}ms`);
+                setTimeout(() => this.connect(), delay);
+                return;
+            }
             this.scheduleReconnect();
         };
         
@@ -126,6 +136,9 @@ class SudoRealtimeClient {
             case 'board_snapshot':
                 this.handleBoardSnapshot(message);
                 break;
+            case 'server_restarting':
+                this.restartDelay = message.data.reconnect_after_ms;
+                break;
         }
     }
 
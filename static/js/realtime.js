@@ -26,8 +26,18 @@ class RealtimeClient {
             this.handleMessage(message);
         };
         
-        this.ws.onclose = () => {
+        this.ws.onclose = (event) => {
             console.log('WebSocket connection closed');
+
+            // 1012 (service restart): the server asked us to come back, so don't use up attempts
+            if (event.code === 1012 || this.restartDelay) {
+                const delay = (this.restartDelay || 2000) + Math.random() * 1000;
+                this.restartDelay = null;
+                this.reconnectAttempts = 0;
+                console.log(`Server restarting, reconnecting in ${Math.round(delay)}ms...`);
+                setTimeout(() => this.connect(), delay);
+                return;
+            }
             this.handleReconnect();
         };
         
@@ -50,6 +60,9 @@ class RealtimeClient {
             case 'error':
                 this.handleError(message);
                 break;
+            case 'server_restarting':
+                this.restartDelay = message.data.reconnect_after_ms;
+                break;
         }
     }
 